@@ -0,0 +1,46 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/spf13/pflag"
+	"go.uber.org/zap"
+)
+
+func main() {
+	logger, err := logger.NewLogger()
+	if err != nil {
+		log.Fatalf("cannot create logger")
+	}
+
+	address := pflag.StringP("address", "a", "localhost:8080", "run address")
+	scriptPath := pflag.StringP("script", "s", "", "path to JSON script with responses")
+	latency := pflag.DurationP("latency", "l", 0, "latency added to every response")
+	pflag.Parse()
+
+	server := accrualmock.New()
+	server.Default(accrualmock.Registered(), accrualmock.Processing(), accrualmock.Processed(100))
+	server.SetLatency(*latency)
+
+	if *scriptPath != "" {
+		file, err := os.Open(*scriptPath)
+		if err != nil {
+			logger.Log.Fatal("cannot open script", zap.Error(err))
+		}
+		err = server.LoadScript(file)
+		file.Close()
+		if err != nil {
+			logger.Log.Fatal("cannot load script", zap.Error(err))
+		}
+	}
+
+	logger.Log.Info("Start accrual mock", zap.String("address", *address))
+	if err := http.ListenAndServe(*address, middlewares.LoggerMiddleware(logger)(server)); err != nil {
+		logger.Log.Fatal("Failed to start server", zap.String("error", err.Error()))
+	}
+}
@@ -3,38 +3,108 @@ package main
 import (
 	"context"
 	"log"
+	"os"
+	// Statements and campaigns accept IANA time zones, the image may lack a
+	// zoneinfo database.
+	_ "time/tzdata"
 
 	"github.com/AndreyKuskov2/gophermart/internal/app"
-	"github.com/AndreyKuskov2/gophermart/internal/client"
 	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
 	"github.com/AndreyKuskov2/gophermart/internal/storage"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
 )
 
 func main() {
-	logger, err := logger.NewLogger()
+	bootstrapLogger, err := logger.NewLogger()
 	if err != nil {
 		log.Fatalf("cannot create logger")
 	}
 
-	cfg, err := config.NewConfig(logger)
+	cfg, err := config.NewConfig(bootstrapLogger)
+	if err != nil {
+		bootstrapLogger.Log.Fatal(err.Error())
+	}
+
+	logger, err := logger.New(cfg.LoggerOptions())
+	if err != nil {
+		bootstrapLogger.Log.Fatal("cannot create logger", zap.Error(err))
+	}
+	defer logger.Log.Sync()
+	logger.Log.Info("configuration loaded", zap.Stringer("config", cfg))
+	if cfg.WeakJWTSecret() {
+		logger.Log.Warn("jwt token is the default or too short, it is refused in production mode")
+	}
+
+	if len(cfg.Command) > 0 && cfg.Command[0] == config.CommandMigrate {
+		if err := runMigrate(cfg.DatabaseURI, cfg.Command[1:]); err != nil {
+			logger.Log.Fatal(err.Error())
+		}
+		return
+	}
+
+	storage, err := newStorage(cfg, logger)
 	if err != nil {
 		logger.Log.Fatal(err.Error())
 	}
+	defer storage.Close()
 
-	storage, err := storage.NewPostgres(cfg.DatabaseURI)
+	if len(cfg.Command) > 0 && cfg.Command[0] == config.CommandReconcile {
+		gophermart, err := app.NewApp(cfg, logger, storage, events.NewHub(), nil)
+		if err != nil {
+			logger.Log.Fatal(err.Error())
+		}
+		if err := runReconcile(gophermart, cfg.Command[1:]); err != nil {
+			logger.Log.Fatal(err.Error())
+		}
+		return
+	}
+
+	hub := events.NewHub()
+	gophermart, err := app.NewApp(cfg, logger, storage, hub, newOrderEventPublisher(storage, hub, logger))
 	if err != nil {
 		logger.Log.Fatal(err.Error())
 	}
-	logger.Log.Info("migrations succesfully applied")
 
-	accrualClient := client.NewClient(cfg.AccrualSystemAddress)
+	go gophermart.Processor.Run(context.Background(), cfg.UpdateInterval, cfg.WorkerCount)
 
-	accrualProcessor := app.NewAccrualProcessor(storage, accrualClient, logger)
+	reloader := app.NewConfigReloader(cfg, func() (*config.Config, error) {
+		return config.Load(os.Args[1:])
+	}, logger, gophermart.Processor)
+	go reloader.Run(context.Background())
 
-	go accrualProcessor.Run(context.Background(), cfg.UpdateInterval, cfg.WorkerCount)
+	gophermart.Run()
+}
 
-	app := app.NewApp(cfg, logger, storage)
+func newStorage(cfg *config.Config, logger *logger.Logger) (storage.Storager, error) {
+	if cfg.StorageType == config.StorageTypeMemory {
+		logger.Log.Warn("using in-memory storage, data will be lost on restart")
+		return storage.NewMemory(), nil
+	}
+
+	if cfg.SkipMigrations {
+		logger.Log.Info("skipping migrations")
+	} else {
+		if err := storage.MigrateUp(cfg.DatabaseURI); err != nil {
+			return nil, err
+		}
+		logger.Log.Info("migrations successfully applied")
+	}
+
+	return storage.NewPostgres(cfg.DatabaseURI)
+}
+
+// newOrderEventPublisher broadcasts order status changes through Postgres so
+// that subscribers connected to any instance receive them. The in-memory
+// backend is single-instance and publishes to the hub directly.
+func newOrderEventPublisher(s storage.Storager, hub *events.Hub, logger *logger.Logger) app.OrderEventPublisher {
+	pg, ok := s.(*storage.Postgres)
+	if !ok {
+		return hub
+	}
 
-	app.Run()
+	notifier := events.NewPostgresNotifier(pg.DB, logger)
+	go notifier.Listen(context.Background(), hub)
+	return notifier
 }
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"os"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app"
+)
+
+const reconcileUsage = "usage: gophermart [--reconcile-sample N] [--reconcile-window-hours N] [--reconcile-auto-correct] reconcile"
+
+// runReconcile checks the settled orders of every tenant against the
+// accrual system once and prints the mismatches.
+func runReconcile(gophermart *app.App, args []string) error {
+	if len(args) > 0 {
+		return errors.New(reconcileUsage)
+	}
+	return app.WriteReconcileReport(os.Stdout, gophermart.Reconciler.Reconcile(context.Background()))
+}
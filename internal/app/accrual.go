@@ -1,128 +1,329 @@
 package app
 
 import (
+	"cmp"
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"slices"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/AndreyKuskov2/gophermart/internal/client"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
 	"go.uber.org/zap"
 )
 
 type OrdersStorager interface {
 	GetPendingOrders(ctx context.Context) ([]models.Orders, error)
-	UpdateOrderStatus(ctx context.Context, orderNumber, status string, accrual *float32) error
+	UpdateOrderStatus(ctx context.Context, orderNumber, status string, accrual *float32, rawResponse json.RawMessage) error
+	InvalidateOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error)
 }
 
+type OrderEventPublisher interface {
+	Publish(event events.OrderStatusChanged)
+}
+
+// BonusApplier grants the bonuses of the campaigns of the tenant of the
+// context for an order that has just been processed.
+type BonusApplier interface {
+	ApplyCampaignsService(ctx context.Context, order models.Orders) error
+}
+
+// ReferralRewarder rewards the referral of the owner of an order that has
+// just been processed.
+type ReferralRewarder interface {
+	RewardReferralService(ctx context.Context, order models.Orders) error
+}
+
+// TierCreditor grants the loyalty tier bonus of an order that has just been
+// processed.
+type TierCreditor interface {
+	CreditTierBonusService(ctx context.Context, order models.Orders) error
+}
+
+// AccrualClients maps tenant ids to the providers of their accrual systems.
+type AccrualClients map[string]client.AccrualProvider
+
+// NewAccrualClients returns the provider of the accrual system of every
+// tenant, routing orders to the accrual systems of the tenant's
+// accrual_routes by their numbers.
+func NewAccrualClients(cfg *config.Config) (AccrualClients, error) {
+	clients := AccrualClients{}
+	for _, t := range cfg.AllTenants() {
+		provider, err := client.NewProvider(t.ProviderName(), t.AccrualSystemAddress)
+		if err != nil {
+			return nil, fmt.Errorf("tenant %s: %w", t.ID, err)
+		}
+		if len(t.AccrualRoutes) == 0 {
+			clients[t.ID] = provider
+			continue
+		}
+
+		routes := make([]client.Route, 0, len(t.AccrualRoutes))
+		for _, r := range t.AccrualRoutes {
+			routeProvider, err := client.NewProvider(cmp.Or(r.Provider, t.ProviderName()), r.AccrualSystemAddress)
+			if err != nil {
+				return nil, fmt.Errorf("tenant %s: %w", t.ID, err)
+			}
+			routes = append(routes, client.Route{Prefix: r.Prefix, Provider: routeProvider})
+		}
+		clients[t.ID] = client.NewRouter(provider, routes...)
+	}
+	return clients, nil
+}
+
+// AccrualProcessor polls the accrual system of every tenant for the orders
+// of that tenant.
 type AccrualProcessor struct {
-	storage       OrdersStorager
-	accrualClient *client.Client
-	Log           *logger.Logger
-	workerCount   int
+	storage        OrdersStorager
+	accrualClients AccrualClients
+	events         OrderEventPublisher
+	bonuses        BonusApplier
+	referrals      ReferralRewarder
+	tiers          TierCreditor
+	Log            *logger.Logger
+
+	mu           sync.Mutex
+	interval     time.Duration
+	workerCount  int
+	reconfigured chan struct{}
 }
 
-func NewAccrualProcessor(orderRepository OrdersStorager, accrualClient *client.Client, log *logger.Logger) *AccrualProcessor {
+func NewAccrualProcessor(orderRepository OrdersStorager, accrualClients AccrualClients, events OrderEventPublisher, bonuses BonusApplier, referrals ReferralRewarder, tiers TierCreditor, log *logger.Logger) *AccrualProcessor {
 	return &AccrualProcessor{
-		storage:       orderRepository,
-		accrualClient: accrualClient,
-		Log:           log,
+		storage:        orderRepository,
+		accrualClients: accrualClients,
+		events:         events,
+		bonuses:        bonuses,
+		referrals:      referrals,
+		tiers:          tiers,
+		Log:            log,
+		reconfigured:   make(chan struct{}, 1),
 	}
 }
 
 func (p *AccrualProcessor) Run(ctx context.Context, interval int, workerCount int) {
-	ticker := time.NewTicker(time.Duration(interval) * time.Second)
+	p.Reconfigure(interval, workerCount)
+
+	ticker := time.NewTicker(p.settings().interval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ctx.Done():
 			return
+		case <-p.reconfigured:
+			ticker.Reset(p.settings().interval)
 		case <-ticker.C:
-			p.processPendingOrders(ctx, workerCount)
+			p.ProcessPendingOrders(ctx, p.settings().workerCount)
 		}
 	}
 }
 
-func (p *AccrualProcessor) processPendingOrders(ctx context.Context, workerCount int) {
-	orders, err := p.storage.GetPendingOrders(ctx)
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			p.Log.Log.Info("no pending orders found")
-			return
-		}
-		p.Log.Log.Error("failed to get pending orders", zap.Error(err))
-		return
+// Reconfigure changes the poll interval and the number of workers of a
+// running processor. The new values are used from the next poll on.
+func (p *AccrualProcessor) Reconfigure(interval int, workerCount int) {
+	p.mu.Lock()
+	p.interval = time.Duration(interval) * time.Second
+	p.workerCount = workerCount
+	p.mu.Unlock()
+
+	select {
+	case p.reconfigured <- struct{}{}:
+	default:
 	}
+}
+
+type processorSettings struct {
+	interval    time.Duration
+	workerCount int
+}
+
+func (p *AccrualProcessor) settings() processorSettings {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return processorSettings{interval: p.interval, workerCount: p.workerCount}
+}
+
+// ProcessPendingOrders polls the accrual systems for the pending orders of
+// every tenant at once, with up to workerCount requests in flight to each.
+func (p *AccrualProcessor) ProcessPendingOrders(ctx context.Context, workerCount int) {
+	tenantIDs := make([]string, 0, len(p.accrualClients))
+	for id := range p.accrualClients {
+		tenantIDs = append(tenantIDs, id)
+	}
+	slices.Sort(tenantIDs)
 
-	jobs := make(chan models.Orders)
 	var wg sync.WaitGroup
+	for _, id := range tenantIDs {
+		tenantCtx := tenant.WithID(ctx, id)
+		orders, err := p.storage.GetPendingOrders(tenantCtx)
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				p.Log.Log.Info("no pending orders found", zap.String("tenant", id))
+				continue
+			}
+			p.Log.Log.Error("failed to get pending orders", zap.String("tenant", id), zap.Error(err))
+			continue
+		}
+		if len(orders) == 0 {
+			continue
+		}
 
-	for i := 0; i < workerCount; i++ {
 		wg.Add(1)
 		go func() {
 			defer wg.Done()
-			for order := range jobs {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					p.processOrder(ctx, order)
-				}
-			}
+			p.processTenantOrders(tenantCtx, p.accrualClients[id], orders, workerCount)
 		}()
 	}
-
-	go func() {
-		defer close(jobs)
-		for _, order := range orders {
-			select {
-			case jobs <- order:
-			case <-ctx.Done():
-				return
-			}
-		}
-	}()
-
 	wg.Wait()
 }
 
-func (p *AccrualProcessor) processOrder(ctx context.Context, order models.Orders) {
-	reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
-	defer cancel()
-
-	response, retryAfter, err := p.accrualClient.GetOrderInfo(reqCtx, order.Number)
-	if err != nil {
-		p.Log.Log.Info("failed to get order info", zap.String("order_number", order.Number), zap.Error(err))
-		return
+func (p *AccrualProcessor) processTenantOrders(ctx context.Context, accrualClient client.AccrualProvider, orders []models.Orders, workerCount int) {
+	byNumber := make(map[string]models.Orders, len(orders))
+	numbers := make([]string, 0, len(orders))
+	for _, order := range orders {
+		byNumber[order.Number] = order
+		numbers = append(numbers, order.Number)
 	}
 
-	if retryAfter > 0 {
-		p.Log.Log.Info("accrual service is busy, retrying later",
-			zap.String("order_number", order.Number), zap.Int("retry_after", retryAfter))
-		select {
-		case <-ctx.Done():
-			return
-		case <-time.After(time.Duration(retryAfter) * time.Second):
+	// Orders of a busy accrual system are left to a later poll; its provider
+	// does not ask it again before its Retry-After has passed, while the
+	// other providers of the tenant go on.
+	var postponed, retryAfter atomic.Int64
+	accrualClient.GetOrdersInfo(ctx, numbers, workerCount, func(info client.OrderInfo) {
+		if info.RetryAfter > 0 {
+			postponed.Add(1)
+			retryAfter.CompareAndSwap(0, int64(info.RetryAfter))
 			return
 		}
+		p.processOrder(ctx, byNumber[info.Order], info)
+	})
+
+	if count := postponed.Load(); count > 0 {
+		p.Log.Log.Info("accrual service is busy, retrying later",
+			zap.String("tenant", tenant.ID(ctx)), zap.Int64("orders", count), zap.Int64("retry_after", retryAfter.Load()))
+	}
+}
+
+func (p *AccrualProcessor) processOrder(ctx context.Context, order models.Orders, info client.OrderInfo) {
+	if info.Err != nil {
+		p.Log.Log.Info("failed to get order info", zap.String("order_number", order.Number), zap.Error(info.Err))
+		return
 	}
 
+	response := info.Response
 	if response == nil {
 		p.Log.Log.Info("empty response from accrual service", zap.String("order_number", order.Number))
 		return
 	}
+	// The accrual system has not taken the order up yet.
+	if response.Status == client.StatusNew {
+		return
+	}
 
-	var newAccrual *float32
+	var accrual *float32
 	if response.Status == "PROCESSED" {
-		newAccrual = &response.Accrual
+		accrual = &response.Accrual
 	}
-
-	if err = p.storage.UpdateOrderStatus(ctx, order.Number, response.Status, newAccrual); err != nil {
+	// An order cancelled since it was polled, or updated by another poll,
+	// is left as it is: its bonuses and events belong to whoever changed it.
+	err := p.UpdateOrder(ctx, order, response.Status, accrual, response.Raw)
+	if err != nil && !errors.Is(err, storage.ErrOrderStatusChanged) {
 		p.Log.Log.Info("failed to update order accrual", zap.String("order_number", order.Number), zap.Error(err))
-		return
 	}
 }
+
+// UpdateOrder stores the status and accrual the accrual system holds for
+// order and, when that changes the order, grants what the new status earns
+// and publishes the change. It fails with storage.ErrOrderStatusChanged when
+// the order is left as it is. Processed orders the accrual system
+// invalidates go through InvalidateOrder instead, which takes back what
+// they earned.
+func (p *AccrualProcessor) UpdateOrder(ctx context.Context, order models.Orders, status string, newAccrual *float32, rawResponse json.RawMessage) error {
+	if err := p.storage.UpdateOrderStatus(ctx, order.Number, status, newAccrual, rawResponse); err != nil {
+		return err
+	}
+
+	var accrual float32
+	if newAccrual != nil {
+		accrual = *newAccrual
+	}
+
+	// Bonuses are granted once per order and campaign, an order processed
+	// again is only rewarded by the campaigns that skipped it.
+	if p.bonuses != nil && status == "PROCESSED" && (order.Status != status || order.Accrual != accrual) {
+		processed := order
+		processed.Status, processed.Accrual = status, accrual
+		if err := p.bonuses.ApplyCampaignsService(ctx, processed); err != nil {
+			p.Log.Log.Error("failed to apply campaigns", zap.String("order_number", order.Number), zap.Error(err))
+		}
+	}
+
+	// Only the first order of a referred user to be processed rewards the
+	// referral; later ones find it rewarded already.
+	if p.referrals != nil && status == "PROCESSED" && order.Status != status {
+		processed := order
+		processed.Status, processed.Accrual = status, accrual
+		if err := p.referrals.RewardReferralService(ctx, processed); err != nil {
+			p.Log.Log.Error("failed to reward referral", zap.String("order_number", order.Number), zap.Error(err))
+		}
+	}
+
+	// The tier bonus is granted for the tier the owner holds when the order
+	// is first processed.
+	if p.tiers != nil && status == "PROCESSED" && order.Status != status {
+		processed := order
+		processed.Status, processed.Accrual = status, accrual
+		if err := p.tiers.CreditTierBonusService(ctx, processed); err != nil {
+			p.Log.Log.Error("failed to credit tier bonus", zap.String("order_number", order.Number), zap.Error(err))
+		}
+	}
+
+	if p.events != nil && (order.Status != status || order.Accrual != accrual) {
+		p.events.Publish(events.OrderStatusChanged{
+			UserID:    order.UserID,
+			Number:    order.Number,
+			Status:    status,
+			Accrual:   accrual,
+			ChangedAt: time.Now(),
+		})
+	}
+	return nil
+}
+
+// InvalidateOrder applies an INVALID result of the accrual system to an order
+// that was processed already. What the order earned, its accrual, bonuses and
+// referral rewards, is clawed back under the negative balance policy.
+func (p *AccrualProcessor) InvalidateOrder(ctx context.Context, order models.Orders, policy string) (*models.CancelledOrder, error) {
+	invalidated, err := p.storage.InvalidateOrder(ctx, models.OrderCancellation{
+		Number:      order.Number,
+		UserID:      order.UserID,
+		Status:      order.Status,
+		Policy:      policy,
+		CancelledBy: models.CancelledByReconciler,
+		Reason:      "invalidated by the accrual system",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if p.events != nil {
+		p.events.Publish(events.OrderStatusChanged{
+			UserID:    order.UserID,
+			Number:    order.Number,
+			Status:    invalidated.Status,
+			ChangedAt: invalidated.CancelledAt,
+		})
+	}
+	return invalidated, nil
+}
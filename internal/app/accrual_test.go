@@ -0,0 +1,399 @@
+package app
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/client"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type accrualTestEnv struct {
+	processor *AccrualProcessor
+	storage   *storage.Memory
+	hub       *events.Hub
+	bonuses   *recordingBonusApplier
+	referrals *recordingReferralRewarder
+	tiers     *recordingTierCreditor
+	mock      *accrualmock.Server
+	userID    int
+}
+
+func newAccrualTestEnv(t *testing.T) *accrualTestEnv {
+	t.Helper()
+	mock := accrualmock.New()
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	memory := storage.NewMemory()
+	userID, err := memory.CreateUser(context.Background(), models.UserCreditials{Login: "user", Password: "password"})
+	require.NoError(t, err)
+
+	hub := events.NewHub()
+	bonuses := &recordingBonusApplier{}
+	referrals := &recordingReferralRewarder{}
+	tiers := &recordingTierCreditor{}
+	return &accrualTestEnv{
+		processor: NewAccrualProcessor(memory, AccrualClients{tenant.DefaultID: client.NewClient(server.URL)}, hub, bonuses, referrals, tiers, log),
+		storage:   memory,
+		hub:       hub,
+		bonuses:   bonuses,
+		referrals: referrals,
+		tiers:     tiers,
+		mock:      mock,
+		userID:    userID,
+	}
+}
+
+type recordingBonusApplier struct {
+	mu     sync.Mutex
+	orders []models.Orders
+}
+
+func (r *recordingBonusApplier) ApplyCampaignsService(ctx context.Context, order models.Orders) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders = append(r.orders, order)
+	return nil
+}
+
+type recordingReferralRewarder struct {
+	mu     sync.Mutex
+	orders []models.Orders
+}
+
+func (r *recordingReferralRewarder) RewardReferralService(ctx context.Context, order models.Orders) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders = append(r.orders, order)
+	return nil
+}
+
+type recordingTierCreditor struct {
+	mu     sync.Mutex
+	orders []models.Orders
+}
+
+func (r *recordingTierCreditor) CreditTierBonusService(ctx context.Context, order models.Orders) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.orders = append(r.orders, order)
+	return nil
+}
+
+// stubProvider answers every order with response, a copy of it for the
+// number asked for. GetOrdersInfo calls beforeAnswer, when set, before it
+// hands an answer over.
+type stubProvider struct {
+	mu           sync.Mutex
+	response     models.AccrualResponse
+	beforeAnswer func(number string)
+}
+
+func (p *stubProvider) respond(response models.AccrualResponse) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.response = response
+}
+
+func (p *stubProvider) GetOrderInfo(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	response := p.response
+	response.Order = orderNumber
+	return &response, 0, nil
+}
+
+func (p *stubProvider) GetOrdersInfo(ctx context.Context, orderNumbers []string, workers int, handle func(client.OrderInfo)) {
+	for _, number := range orderNumbers {
+		response, retryAfter, err := p.GetOrderInfo(ctx, number)
+		if p.beforeAnswer != nil {
+			p.beforeAnswer(number)
+		}
+		handle(client.OrderInfo{Order: number, Response: response, RetryAfter: retryAfter, Err: err})
+	}
+}
+
+func (env *accrualTestEnv) createOrder(t *testing.T, number string) {
+	t.Helper()
+	require.NoError(t, env.storage.CreateNewOrder(context.Background(), &models.Orders{Number: number, Status: "NEW", UserID: env.userID}))
+}
+
+func (env *accrualTestEnv) orderStatus(t *testing.T, number string) string {
+	t.Helper()
+	order, err := env.storage.GetOrderByNumber(context.Background(), number)
+	require.NoError(t, err)
+	return order.Status
+}
+
+func TestAccrualProcessor_Progression(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	ctx := context.Background()
+	env.createOrder(t, "79927398713")
+	env.mock.Script("79927398713", accrualmock.Registered(), accrualmock.Processing(), accrualmock.Processed(500))
+
+	env.processor.ProcessPendingOrders(ctx, 2)
+	assert.Equal(t, "PROCESSING", env.orderStatus(t, "79927398713"))
+
+	env.processor.ProcessPendingOrders(ctx, 2)
+	assert.Equal(t, "PROCESSING", env.orderStatus(t, "79927398713"))
+
+	env.processor.ProcessPendingOrders(ctx, 2)
+	assert.Equal(t, "PROCESSED", env.orderStatus(t, "79927398713"))
+
+	env.processor.ProcessPendingOrders(ctx, 2)
+	assert.Equal(t, 3, env.mock.Calls("79927398713"))
+
+	balance, err := env.storage.GetUserBalance(ctx, strconv.Itoa(env.userID))
+	require.NoError(t, err)
+	assert.Equal(t, float64(500), balance.Current)
+
+	history, err := env.storage.GetOrderStatusHistory(ctx, "79927398713")
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.Equal(t, []string{"NEW", "PROCESSING", "PROCESSED"}, []string{history[0].Status, history[1].Status, history[2].Status})
+	assert.JSONEq(t, `{"order":"79927398713","status":"PROCESSED","accrual":500}`, string(history[2].RawResponse))
+}
+
+func TestAccrualProcessor_PublishesChanges(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.mock.Script("79927398713", accrualmock.Processing(), accrualmock.Processing(), accrualmock.Processed(500))
+	changes, cancel := env.hub.Subscribe(env.userID)
+	defer cancel()
+
+	for i := 0; i < 3; i++ {
+		env.processor.ProcessPendingOrders(context.Background(), 1)
+	}
+
+	require.Len(t, changes, 2)
+	first, second := <-changes, <-changes
+	assert.Equal(t, "PROCESSING", first.Status)
+	assert.Equal(t, "PROCESSED", second.Status)
+	assert.Equal(t, float32(500), second.Accrual)
+	assert.Equal(t, "79927398713", second.Number)
+}
+
+func TestAccrualProcessor_AppliesCampaigns(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.createOrder(t, "12345678903")
+	env.mock.Script("79927398713", accrualmock.Processing(), accrualmock.Processed(500))
+	env.mock.Script("12345678903", accrualmock.Invalid())
+
+	for i := 0; i < 3; i++ {
+		env.processor.ProcessPendingOrders(context.Background(), 1)
+	}
+
+	require.Len(t, env.bonuses.orders, 1, "campaigns are applied once, to processed orders only")
+	order := env.bonuses.orders[0]
+	assert.Equal(t, "79927398713", order.Number)
+	assert.Equal(t, "PROCESSED", order.Status)
+	assert.Equal(t, float32(500), order.Accrual)
+	assert.Equal(t, env.userID, order.UserID)
+}
+
+func TestAccrualProcessor_RewardsReferrals(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.createOrder(t, "12345678903")
+	env.mock.Script("79927398713", accrualmock.Processing(), accrualmock.Processed(500))
+	env.mock.Script("12345678903", accrualmock.Invalid())
+
+	for i := 0; i < 3; i++ {
+		env.processor.ProcessPendingOrders(context.Background(), 1)
+	}
+
+	require.Len(t, env.referrals.orders, 1, "referrals are rewarded when an order becomes processed")
+	assert.Equal(t, "79927398713", env.referrals.orders[0].Number)
+	assert.Equal(t, "PROCESSED", env.referrals.orders[0].Status)
+}
+
+func TestAccrualProcessor_CreditsTierBonuses(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.createOrder(t, "12345678903")
+	env.mock.Script("79927398713", accrualmock.Processing(), accrualmock.Processed(500))
+	env.mock.Script("12345678903", accrualmock.Invalid())
+
+	for i := 0; i < 3; i++ {
+		env.processor.ProcessPendingOrders(context.Background(), 1)
+	}
+
+	require.Len(t, env.tiers.orders, 1, "tier bonuses are credited when an order becomes processed")
+	assert.Equal(t, "79927398713", env.tiers.orders[0].Number)
+	assert.Equal(t, float32(500), env.tiers.orders[0].Accrual)
+}
+
+func TestAccrualProcessor_Invalid(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.mock.Script("79927398713", accrualmock.Invalid())
+
+	env.processor.ProcessPendingOrders(context.Background(), 1)
+	assert.Equal(t, "INVALID", env.orderStatus(t, "79927398713"))
+}
+
+func TestAccrualProcessor_FailuresKeepOrderPending(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.createOrder(t, "12345678903")
+	env.mock.Script("79927398713", accrualmock.NoContent(), accrualmock.Processed(10))
+	env.mock.Script("12345678903", accrualmock.Fault(http.StatusInternalServerError), accrualmock.Processed(20))
+
+	env.processor.ProcessPendingOrders(context.Background(), 2)
+	assert.Equal(t, "NEW", env.orderStatus(t, "79927398713"))
+	assert.Equal(t, "NEW", env.orderStatus(t, "12345678903"))
+
+	env.processor.ProcessPendingOrders(context.Background(), 2)
+	assert.Equal(t, "PROCESSED", env.orderStatus(t, "79927398713"))
+	assert.Equal(t, "PROCESSED", env.orderStatus(t, "12345678903"))
+}
+
+func TestAccrualProcessor_TooManyRequests(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.mock.Script("79927398713", accrualmock.TooManyRequests(1), accrualmock.Processed(10))
+
+	start := time.Now()
+	env.processor.ProcessPendingOrders(context.Background(), 1)
+	assert.Less(t, time.Since(start), time.Second, "the poll does not wait for the accrual system")
+	assert.Equal(t, "NEW", env.orderStatus(t, "79927398713"))
+
+	env.processor.ProcessPendingOrders(context.Background(), 1)
+	assert.Equal(t, "NEW", env.orderStatus(t, "79927398713"))
+	assert.Equal(t, 1, env.mock.Calls("79927398713"), "the accrual system is left alone until its Retry-After has passed")
+
+	time.Sleep(time.Second)
+	env.processor.ProcessPendingOrders(context.Background(), 1)
+	assert.Equal(t, "PROCESSED", env.orderStatus(t, "79927398713"))
+}
+
+func TestAccrualProcessor_TooManyRequestsOfOneProvider(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.createOrder(t, "4561261212345467")
+	env.mock.Script("79927398713", accrualmock.TooManyRequests(60))
+
+	cards := &stubProvider{response: models.AccrualResponse{Status: client.StatusProcessed, Accrual: 300}}
+	env.processor.accrualClients[tenant.DefaultID] = client.NewRouter(env.processor.accrualClients[tenant.DefaultID], client.Route{Prefix: "4", Provider: cards})
+
+	start := time.Now()
+	env.processor.ProcessPendingOrders(context.Background(), 2)
+	assert.Less(t, time.Since(start), time.Second, "a busy accrual system does not hold the others back")
+	assert.Equal(t, "NEW", env.orderStatus(t, "79927398713"))
+	assert.Equal(t, "PROCESSED", env.orderStatus(t, "4561261212345467"))
+}
+
+func TestAccrualProcessor_Timeout(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.mock.Script("79927398713", accrualmock.Processed(10).WithDelay(10*time.Second))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	env.processor.ProcessPendingOrders(ctx, 1)
+	assert.Equal(t, "NEW", env.orderStatus(t, "79927398713"))
+}
+
+func TestAccrualProcessor_Tenants(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.mock.Script("79927398713", accrualmock.Processed(10))
+
+	acmeMock := accrualmock.New()
+	acmeServer := httptest.NewServer(acmeMock)
+	t.Cleanup(acmeServer.Close)
+	env.processor.accrualClients["acme"] = client.NewClient(acmeServer.URL)
+
+	acme := tenant.WithID(context.Background(), "acme")
+	acmeUserID, err := env.storage.CreateUser(acme, models.UserCreditials{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	require.NoError(t, env.storage.CreateNewOrder(acme, &models.Orders{Number: "79927398713", Status: "NEW", UserID: acmeUserID}))
+	acmeMock.Script("79927398713", accrualmock.Processed(700))
+
+	env.processor.ProcessPendingOrders(context.Background(), 2)
+
+	assert.Equal(t, 1, env.mock.Calls("79927398713"))
+	assert.Equal(t, 1, acmeMock.Calls("79927398713"), "every tenant is polled at its own accrual system")
+
+	balance, err := env.storage.GetUserBalance(context.Background(), strconv.Itoa(env.userID))
+	require.NoError(t, err)
+	assert.Equal(t, float64(10), balance.Current)
+	balance, err = env.storage.GetUserBalance(acme, strconv.Itoa(acmeUserID))
+	require.NoError(t, err)
+	assert.Equal(t, float64(700), balance.Current)
+}
+
+func TestAccrualProcessor_Providers(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	env.createOrder(t, "79927398713")
+	env.createOrder(t, "4561261212345467")
+	env.mock.Script("79927398713", accrualmock.Processed(10))
+
+	cards := &stubProvider{response: models.AccrualResponse{Status: client.StatusNew}}
+	env.processor.accrualClients[tenant.DefaultID] = client.NewRouter(env.processor.accrualClients[tenant.DefaultID], client.Route{Prefix: "4", Provider: cards})
+
+	env.processor.ProcessPendingOrders(context.Background(), 2)
+	assert.Equal(t, "PROCESSED", env.orderStatus(t, "79927398713"))
+	assert.Equal(t, 1, env.mock.Calls("79927398713"))
+	assert.Zero(t, env.mock.Calls("4561261212345467"), "orders are routed by their number")
+	assert.Equal(t, "NEW", env.orderStatus(t, "4561261212345467"))
+	history, err := env.storage.GetOrderStatusHistory(context.Background(), "4561261212345467")
+	require.NoError(t, err)
+	assert.Len(t, history, 1, "orders the accrual system has not taken up are left alone")
+
+	cards.respond(models.AccrualResponse{Status: client.StatusProcessed, Accrual: 300})
+	env.processor.ProcessPendingOrders(context.Background(), 2)
+	assert.Equal(t, "PROCESSED", env.orderStatus(t, "4561261212345467"))
+
+	balance, err := env.storage.GetUserBalance(context.Background(), strconv.Itoa(env.userID))
+	require.NoError(t, err)
+	assert.Equal(t, float64(310), balance.Current)
+}
+
+func TestAccrualProcessor_CancelledWhilePolled(t *testing.T) {
+	env := newAccrualTestEnv(t)
+	ctx := context.Background()
+	env.createOrder(t, "79927398713")
+	changes, unsubscribe := env.hub.Subscribe(env.userID)
+	defer unsubscribe()
+
+	// The order is cancelled after it was listed as pending and before its
+	// accrual result is stored.
+	provider := &stubProvider{response: models.AccrualResponse{Status: client.StatusProcessed, Accrual: 500}}
+	provider.beforeAnswer = func(number string) {
+		_, err := env.storage.CancelOrder(ctx, models.OrderCancellation{
+			Number: number, UserID: env.userID, Status: "NEW", Policy: models.ClawbackAllow, CancelledBy: models.CancelledByUser,
+		})
+		require.NoError(t, err)
+	}
+	env.processor.accrualClients[tenant.DefaultID] = provider
+
+	env.processor.ProcessPendingOrders(ctx, 1)
+	assert.Equal(t, models.OrderCancelled, env.orderStatus(t, "79927398713"))
+	assert.Empty(t, env.bonuses.orders, "a cancelled order earns no campaign bonus")
+	assert.Empty(t, env.referrals.orders, "a cancelled order rewards no referral")
+	assert.Empty(t, env.tiers.orders, "a cancelled order earns no tier bonus")
+	assert.Empty(t, changes, "nothing is published for an order left unchanged")
+
+	balance, err := env.storage.GetUserBalance(ctx, strconv.Itoa(env.userID))
+	require.NoError(t, err)
+	assert.Zero(t, balance.Current)
+}
@@ -2,6 +2,7 @@ package app
 
 import (
 	"context"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
@@ -9,23 +10,69 @@ import (
 	"time"
 
 	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/grpcserver"
 	"github.com/AndreyKuskov2/gophermart/internal/storage"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
 	"go.uber.org/zap"
 )
 
+// shutdownTimeout bounds how long running requests may delay a shutdown.
+const shutdownTimeout = 5 * time.Second
+
 type App struct {
 	Cfg     *config.Config
 	Log     *logger.Logger
-	Storage *storage.Postgres
+	Storage storage.Storager
+	Events  *events.Hub
+
+	// Publisher broadcasts the order status changes of requests and of the
+	// accrual processor, e.g. cancellations.
+	Publisher OrderEventPublisher
+
+	// Processor polls the accrual systems for the pending orders, Reconciler
+	// checks the settled ones against them and Tiers recalculates the loyalty
+	// tiers. Run starts the reconciler and the recalculation, the processor
+	// is left to the caller.
+	Processor  *AccrualProcessor
+	Reconciler *Reconciler
+	Tiers      *TierRecalculator
+
+	// OnAPIResponseError enables validation of responses against the
+	// OpenAPI specification. Tests use it to catch contract drift.
+	OnAPIResponseError func(r *http.Request, err error)
+
+	services *services
 }
 
-func NewApp(cfg *config.Config, log *logger.Logger, storage *storage.Postgres) *App {
-	return &App{
-		Cfg:     cfg,
-		Log:     log,
-		Storage: storage,
+// NewApp builds the services of the app once. Order status changes are
+// published to publisher, to events when it is nil.
+func NewApp(cfg *config.Config, log *logger.Logger, storage storage.Storager, events *events.Hub, publisher OrderEventPublisher) (*App, error) {
+	app := &App{
+		Cfg:       cfg,
+		Log:       log,
+		Storage:   storage,
+		Events:    events,
+		Publisher: publisher,
+	}
+	if app.Publisher == nil {
+		app.Publisher = events
+	}
+
+	accrualClients, err := NewAccrualClients(cfg)
+	if err != nil {
+		return nil, err
 	}
+	app.services = app.newServices()
+	app.Processor = NewAccrualProcessor(storage, accrualClients, app.Publisher, app.services.campaign, app.services.referral, app.services.tier, log)
+	app.Reconciler = NewReconciler(storage, app.Processor, accrualClients, app.services.audit, ReconcileOptions{
+		Window:         cfg.ReconcileWindow(),
+		Sample:         cfg.ReconcileSample,
+		AutoCorrect:    cfg.ReconcileAutoCorrect,
+		ClawbackPolicy: cfg.ClawbackPolicy,
+	}, cfg.ReconcilePeriod(), log)
+	app.Tiers = NewTierRecalculator(app.services.tier, cfg.TenantIDs(), cfg.TierRecalcPeriod(), log)
+	return app, nil
 }
 
 func (app *App) Run() {
@@ -34,6 +81,14 @@ func (app *App) Run() {
 
 	router := app.GophermartRouter()
 
+	jobs, stopJobs := context.WithCancel(context.Background())
+	defer stopJobs()
+	go NewAccountPurger(app.services.account, app.Cfg.TenantIDs(), accountPurgeInterval, app.Log).Run(jobs)
+	go app.Tiers.Run(jobs)
+	if app.Cfg.ReconcileInterval > 0 {
+		go app.Reconciler.Run(jobs)
+	}
+
 	go func() {
 		app.Log.Log.Info("Start web-server", zap.String("address", app.Cfg.RunAddress))
 		if err := http.ListenAndServe(app.Cfg.RunAddress, router); err != nil {
@@ -41,9 +96,25 @@ func (app *App) Run() {
 		}
 	}()
 
+	if app.Cfg.GRPCAddress != "" {
+		listener, err := net.Listen("tcp", app.Cfg.GRPCAddress)
+		if err != nil {
+			app.Log.Log.Fatal("Failed to listen grpc address", zap.String("error", err.Error()))
+		}
+		grpcServer := app.GophermartGRPCServer()
+		defer grpcserver.Stop(grpcServer, shutdownTimeout)
+
+		go func() {
+			app.Log.Log.Info("Start grpc-server", zap.String("address", app.Cfg.GRPCAddress))
+			if err := grpcServer.Serve(listener); err != nil {
+				app.Log.Log.Fatal("Failed to start grpc server", zap.String("error", err.Error()))
+			}
+		}()
+	}
+
 	<-stop
 
-	_, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	_, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
 	defer cancel()
 
 	app.Log.Log.Info("Shutting down server...")
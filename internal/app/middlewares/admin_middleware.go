@@ -0,0 +1,61 @@
+package middlewares
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http"
+
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+type AdminUserGetter interface {
+	GetUserByID(ctx context.Context, userID string) (*models.User, error)
+}
+
+// RequireAdmin lets through users listed in the admin user ids of the tenant
+// of the request. It must be installed after JwtAuthValidator.
+func RequireAdmin(users AdminUserGetter, cfg *config.Config, log *logger.Logger) func(next http.Handler) http.Handler {
+	return requireUser(users, cfg.IsAdmin, "admin access denied", log)
+}
+
+// RequirePartner lets through users listed in the partner user ids of the
+// tenant of the request. It must be installed after JwtAuthValidator.
+func RequirePartner(users AdminUserGetter, cfg *config.Config, log *logger.Logger) func(next http.Handler) http.Handler {
+	return requireUser(users, cfg.IsPartner, "partner access denied", log)
+}
+
+func requireUser(users AdminUserGetter, allowed func(tenantID string, userID int) bool, denied string, log *logger.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			claims, ok := r.Context().Value(ContextClaims).(*jwt.JWTClaims)
+			if !ok {
+				render.Status(r, http.StatusUnauthorized)
+				render.PlainText(w, r, "")
+				return
+			}
+
+			user, err := users.GetUserByID(r.Context(), claims.Subject)
+			if err != nil && !errors.Is(err, sql.ErrNoRows) {
+				log.Ctx(r.Context()).Error("cannot get user", zap.Error(err))
+				render.Status(r, http.StatusInternalServerError)
+				render.PlainText(w, r, "")
+				return
+			}
+			if user == nil || !allowed(tenant.ID(r.Context()), user.UserID) {
+				log.Ctx(r.Context()).Debug(denied)
+				render.Status(r, http.StatusForbidden)
+				render.PlainText(w, r, "")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
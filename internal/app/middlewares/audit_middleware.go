@@ -0,0 +1,27 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/go-chi/chi/middleware"
+)
+
+// AuditMetadata attaches the client address, user agent and request id to
+// the request context for audit events. It must be installed after
+// middleware.RequestID and RealIP.
+func AuditMetadata(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip := r.RemoteAddr
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+		ctx := audit.WithMetadata(r.Context(), audit.Metadata{
+			IP:        ip,
+			UserAgent: r.UserAgent(),
+			RequestID: middleware.GetReqID(r.Context()),
+		})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
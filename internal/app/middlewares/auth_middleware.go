@@ -5,9 +5,10 @@ import (
 	"net/http"
 
 	"github.com/AndreyKuskov2/gophermart/internal/config"
-	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
 	"github.com/go-chi/render"
+	"go.uber.org/zap"
 )
 
 type contextKey string
@@ -16,25 +17,34 @@ const (
 	ContextClaims contextKey = "claims"
 )
 
+// JwtAuthValidator verifies the token with the key of the tenant resolved
+// by TenantResolver or, if there is none, of the tenant named by the token.
+// Tokens of another tenant are rejected.
 func JwtAuthValidator(cfg *config.Config, log *logger.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			tokenString := r.Header.Get("Authorization")
 			if tokenString == "" {
-				log.Log.Error("no authorization token")
+				log.Ctx(r.Context()).Debug("no authorization token")
 				render.Status(r, http.StatusUnauthorized)
 				render.PlainText(w, r, "no authorization token")
 				return
 			}
-			claims, err := jwt.VerifyToken(tokenString, cfg.JWTSecretToken)
+			tenantID, claims, err := tenant.VerifyToken(r.Context(), tokenString, cfg.TenantJWTSecret)
 			if err != nil {
-				log.Log.Error(err.Error())
+				log.Ctx(r.Context()).Debug("invalid token", zap.Error(err))
 				render.Status(r, http.StatusUnauthorized)
 				render.PlainText(w, r, "invalid token")
 				return
 			}
 
-			r = r.Clone(context.WithValue(r.Context(), ContextClaims, claims))
+			ctx := context.WithValue(r.Context(), ContextClaims, claims)
+			if _, resolved := tenant.FromContext(ctx); !resolved {
+				ctx = tenant.WithID(ctx, tenantID)
+				ctx = log.WithFields(ctx, zap.String("tenant", tenantID))
+			}
+			ctx = log.WithFields(ctx, zap.String("user_id", claims.Subject))
+			r = r.Clone(ctx)
 			next.ServeHTTP(w, r)
 		})
 	}
@@ -5,27 +5,50 @@ import (
 	"time"
 
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 	"go.uber.org/zap"
 )
 
+// LoggerMiddleware attaches a request-scoped logger carrying the request id
+// to the request context and logs every request once it is served.
 func LoggerMiddleware(log *logger.Logger) func(next http.Handler) http.Handler {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 			start := time.Now()
 			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
 
+			ctx := log.WithFields(r.Context(), zap.String("request_id", middleware.GetReqID(r.Context())))
+			r = r.WithContext(ctx)
 			next.ServeHTTP(ww, r)
 
 			duration := time.Since(start)
 
-			log.Log.Info("",
+			fields := []zap.Field{
 				zap.String("uri", r.RequestURI),
 				zap.String("method", r.Method),
 				zap.Duration("duration", duration),
 				zap.Int("status", ww.Status()),
 				zap.Int("size", ww.BytesWritten()),
-			)
+			}
+			if rctx := chi.RouteContext(ctx); rctx != nil && rctx.RoutePattern() != "" {
+				fields = append(fields, zap.String("route", rctx.RoutePattern()))
+			}
+			log.Ctx(ctx).Info("request served", fields...)
+		})
+	}
+}
+
+// RouteLogger adds the matched route pattern to the request-scoped logger.
+// The pattern is only known after routing, so the middleware has to be
+// installed with Group or With rather than Use on a router.
+func RouteLogger(log *logger.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if rctx := chi.RouteContext(r.Context()); rctx != nil {
+				r = r.WithContext(log.WithFields(r.Context(), zap.String("route", rctx.RoutePattern())))
+			}
+			next.ServeHTTP(w, r)
 		})
 	}
 }
@@ -0,0 +1,58 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/chi/middleware"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestLoggerMiddleware_RequestScopedFields(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	log := &logger.Logger{Log: zap.New(core)}
+	cfg := &config.Config{JWTSecretToken: "test-secret"}
+
+	router := chi.NewRouter()
+	router.Use(middleware.RequestID)
+	router.Use(LoggerMiddleware(log))
+	router.Route("/api/user", func(r chi.Router) {
+		r.Group(func(r chi.Router) {
+			r.Use(RouteLogger(log))
+			r.Use(JwtAuthValidator(cfg, log))
+			r.Get("/orders/{number}", func(w http.ResponseWriter, r *http.Request) {
+				log.Ctx(r.Context()).Info("handled")
+				w.WriteHeader(http.StatusNoContent)
+			})
+		})
+	})
+
+	token, err := jwt.CreateJwtToken(cfg.JWTSecretToken, 42)
+	require.NoError(t, err)
+	request := httptest.NewRequest(http.MethodGet, "/api/user/orders/79927398713", nil)
+	request.Header.Set("Authorization", token)
+	router.ServeHTTP(httptest.NewRecorder(), request)
+
+	entries := logs.All()
+	require.Len(t, entries, 2)
+
+	handled := entries[0].ContextMap()
+	assert.Equal(t, "handled", entries[0].Message)
+	assert.NotEmpty(t, handled["request_id"])
+	assert.Equal(t, "/api/user/orders/{number}", handled["route"])
+	assert.Equal(t, "42", handled["user_id"])
+
+	served := entries[1].ContextMap()
+	assert.Equal(t, "request served", entries[1].Message)
+	assert.Equal(t, handled["request_id"], served["request_id"])
+	assert.Equal(t, "/api/user/orders/{number}", served["route"])
+	assert.EqualValues(t, http.StatusNoContent, served["status"])
+}
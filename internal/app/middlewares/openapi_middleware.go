@@ -0,0 +1,100 @@
+package middlewares
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers/legacy"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+// OpenAPIValidator rejects requests that do not match the OpenAPI document
+// with 400. Requests to routes missing from the document are passed through.
+// When onResponseError is set, responses are validated as well and every
+// mismatch is reported to it; this is meant for tests.
+func OpenAPIValidator(doc *openapi3.T, log *logger.Logger, onResponseError func(r *http.Request, err error)) (func(next http.Handler) http.Handler, error) {
+	router, err := legacy.NewRouter(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			route, pathParams, err := router.FindRoute(r)
+			if err != nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			requestInput := &openapi3filter.RequestValidationInput{
+				Request:    r,
+				PathParams: pathParams,
+				Route:      route,
+				Options: &openapi3filter.Options{
+					AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				},
+			}
+			if err := openapi3filter.ValidateRequest(r.Context(), requestInput); err != nil {
+				log.Ctx(r.Context()).Debug("request does not match openapi specification", zap.Error(err))
+				render.Status(r, http.StatusBadRequest)
+				render.PlainText(w, r, "")
+				return
+			}
+
+			if onResponseError == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			recorder := &responseRecorder{ResponseWriter: w}
+			next.ServeHTTP(recorder, r)
+			if recorder.status == 0 {
+				recorder.status = http.StatusOK
+			}
+
+			responseInput := &openapi3filter.ResponseValidationInput{
+				RequestValidationInput: requestInput,
+				Status:                 recorder.status,
+				Header:                 recorder.Header(),
+				Options: &openapi3filter.Options{
+					IncludeResponseStatus: true,
+				},
+			}
+			responseInput.SetBodyBytes(recorder.body.Bytes())
+			if err := openapi3filter.ValidateResponse(r.Context(), responseInput); err != nil {
+				onResponseError(r, err)
+			}
+		})
+	}, nil
+}
+
+type responseRecorder struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rr *responseRecorder) WriteHeader(status int) {
+	if rr.status == 0 {
+		rr.status = status
+	}
+	rr.ResponseWriter.WriteHeader(status)
+}
+
+func (rr *responseRecorder) Write(b []byte) (int, error) {
+	if rr.status == 0 {
+		rr.status = http.StatusOK
+	}
+	rr.body.Write(b)
+	return rr.ResponseWriter.Write(b)
+}
+
+func (rr *responseRecorder) Flush() {
+	if flusher, ok := rr.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
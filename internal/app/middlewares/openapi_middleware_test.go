@@ -0,0 +1,103 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/api"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestOpenAPIValidator(t *testing.T, onResponseError func(r *http.Request, err error)) func(next http.Handler) http.Handler {
+	t.Helper()
+	doc, err := api.LoadOpenAPI()
+	require.NoError(t, err)
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	validator, err := OpenAPIValidator(doc, log, onResponseError)
+	require.NoError(t, err)
+	return validator
+}
+
+func TestOpenAPIValidator_Request(t *testing.T) {
+	validator := newTestOpenAPIValidator(t, nil)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		status      int
+	}{
+		{"valid credentials", http.MethodPost, "/api/user/register", "application/json", `{"login":"user","password":"pass"}`, http.StatusTeapot},
+		{"missing password", http.MethodPost, "/api/user/register", "application/json", `{"login":"user"}`, http.StatusBadRequest},
+		{"malformed json", http.MethodPost, "/api/user/login", "application/json", `{"login":`, http.StatusBadRequest},
+		{"wrong content type", http.MethodPost, "/api/user/login", "text/plain", `login`, http.StatusBadRequest},
+		{"order number", http.MethodPost, "/api/user/orders", "text/plain", `79927398713`, http.StatusTeapot},
+		{"negative withdraw", http.MethodPost, "/api/user/balance/withdraw", "application/json", `{"order":"2377225624","sum":-1}`, http.StatusBadRequest},
+		{"undocumented route", http.MethodGet, "/debug", "", "", http.StatusTeapot},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := validator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(http.StatusTeapot)
+			}))
+
+			req := httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+		})
+	}
+}
+
+func TestOpenAPIValidator_Response(t *testing.T) {
+	tests := []struct {
+		name   string
+		status int
+		body   string
+		valid  bool
+	}{
+		{"valid balance", http.StatusOK, `{"current":500.5,"withdrawn":42}`, true},
+		{"wrong type", http.StatusOK, `{"current":"500","withdrawn":42}`, false},
+		{"missing field", http.StatusOK, `{"current":500}`, false},
+		{"undocumented status", http.StatusTeapot, ``, false},
+		{"documented error", http.StatusUnauthorized, ``, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var responseErr error
+			validator := newTestOpenAPIValidator(t, func(r *http.Request, err error) {
+				responseErr = err
+			})
+			handler := validator(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", "application/json")
+				w.WriteHeader(tt.status)
+				w.Write([]byte(tt.body))
+			}))
+
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/user/balance", nil))
+
+			assert.Equal(t, tt.status, w.Code)
+			assert.Equal(t, tt.body, w.Body.String())
+			if tt.valid {
+				assert.NoError(t, responseErr)
+			} else {
+				assert.Error(t, responseErr)
+			}
+		})
+	}
+}
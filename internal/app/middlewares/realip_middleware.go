@@ -0,0 +1,64 @@
+package middlewares
+
+import (
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// RealIP sets r.RemoteAddr to the client address given by the X-Real-IP or
+// X-Forwarded-For header, but only for requests sent by one of the trusted
+// proxies. Anyone else could put any address there. Of X-Forwarded-For the
+// rightmost address that is not a trusted proxy is taken, the ones left of
+// it were written by the client.
+func RealIP(trusted []netip.Prefix) func(next http.Handler) http.Handler {
+	isTrusted := func(addr netip.Addr) bool {
+		for _, prefix := range trusted {
+			if prefix.Contains(addr.Unmap()) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			peer, ok := parseIP(r.RemoteAddr)
+			if !ok || !isTrusted(peer) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if ip, ok := parseIP(r.Header.Get("X-Real-IP")); ok {
+				r.RemoteAddr = ip.String()
+			} else if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+				hops := strings.Split(forwarded, ",")
+				for i := len(hops) - 1; i >= 0; i-- {
+					ip, ok := parseIP(hops[i])
+					if !ok {
+						break
+					}
+					r.RemoteAddr = ip.String()
+					if !isTrusted(ip) {
+						break
+					}
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// parseIP parses an address with or without a port.
+func parseIP(s string) (netip.Addr, bool) {
+	s = strings.TrimSpace(s)
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
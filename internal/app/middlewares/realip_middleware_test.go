@@ -0,0 +1,50 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRealIP(t *testing.T) {
+	trusted := []netip.Prefix{netip.MustParsePrefix("10.0.0.0/8"), netip.MustParsePrefix("::1/128")}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		forwarded  string
+		want       string
+	}{
+		{name: "no headers", remoteAddr: "10.0.0.1:4000", want: "10.0.0.1:4000"},
+		{name: "untrusted peer", remoteAddr: "203.0.113.7:4000", realIP: "198.51.100.1", forwarded: "198.51.100.2", want: "203.0.113.7:4000"},
+		{name: "real ip from proxy", remoteAddr: "10.0.0.1:4000", realIP: "198.51.100.1", forwarded: "198.51.100.2", want: "198.51.100.1"},
+		{name: "ipv6 proxy", remoteAddr: "[::1]:4000", realIP: "198.51.100.1", want: "198.51.100.1"},
+		{name: "forwarded from proxy", remoteAddr: "10.0.0.1:4000", forwarded: "198.51.100.2", want: "198.51.100.2"},
+		{name: "client written hops are skipped", remoteAddr: "10.0.0.1:4000", forwarded: "192.0.2.9, 198.51.100.2, 10.0.0.2", want: "198.51.100.2"},
+		{name: "invalid real ip", remoteAddr: "10.0.0.1:4000", realIP: "nobody", forwarded: "198.51.100.2", want: "198.51.100.2"},
+		{name: "invalid forwarded hop", remoteAddr: "10.0.0.1:4000", forwarded: "198.51.100.2, nobody", want: "10.0.0.1:4000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			handler := RealIP(trusted)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				request.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.forwarded != "" {
+				request.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), request)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
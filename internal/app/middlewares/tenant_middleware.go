@@ -0,0 +1,41 @@
+package middlewares
+
+import (
+	"net/http"
+
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+// TenantResolver attaches the tenant named by the X-Tenant-ID header or
+// matched by the host name to the request context. Requests naming an
+// unknown tenant are rejected. When neither matches, JwtAuthValidator takes
+// the tenant from the token and other requests belong to the default tenant.
+func TenantResolver(cfg *config.Config, log *logger.Logger) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			var t config.Tenant
+			var ok bool
+			if id := r.Header.Get(tenant.Header); id != "" {
+				if t, ok = cfg.TenantByID(id); !ok {
+					log.Ctx(r.Context()).Debug("unknown tenant", zap.String("tenant", id))
+					render.Status(r, http.StatusBadRequest)
+					render.PlainText(w, r, "unknown tenant")
+					return
+				}
+			} else {
+				t, ok = cfg.TenantByHost(r.Host)
+			}
+
+			if ok {
+				ctx := tenant.WithID(r.Context(), t.ID)
+				ctx = log.WithFields(ctx, zap.String("tenant", t.ID))
+				r = r.WithContext(ctx)
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,85 @@
+package middlewares
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantResolver(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+	cfg := &config.Config{
+		JWTSecretToken: "default-secret",
+		Tenants: []config.Tenant{
+			{ID: "acme", Hosts: []string{"acme.test"}, JWTSecretToken: "acme-secret"},
+			{ID: "globex", JWTSecretToken: "globex-secret"},
+		},
+	}
+
+	var resolved string
+	router := chi.NewRouter()
+	router.Use(TenantResolver(cfg, log))
+	router.Get("/public", func(w http.ResponseWriter, r *http.Request) {
+		resolved = tenant.ID(r.Context())
+	})
+	router.With(JwtAuthValidator(cfg, log)).Get("/private", func(w http.ResponseWriter, r *http.Request) {
+		resolved = tenant.ID(r.Context())
+	})
+
+	acmeToken, err := jwt.CreateTenantJwtToken("acme-secret", 1, "acme")
+	require.NoError(t, err)
+	defaultToken, err := jwt.CreateJwtToken("default-secret", 2)
+	require.NoError(t, err)
+	forgedToken, err := jwt.CreateTenantJwtToken("globex-secret", 3, "acme")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		path       string
+		host       string
+		header     string
+		token      string
+		wantStatus int
+		wantTenant string
+	}{
+		{name: "default", path: "/public", wantStatus: http.StatusOK, wantTenant: "default"},
+		{name: "header", path: "/public", header: "globex", wantStatus: http.StatusOK, wantTenant: "globex"},
+		{name: "host", path: "/public", host: "ACME.test:8000", wantStatus: http.StatusOK, wantTenant: "acme"},
+		{name: "header wins over host", path: "/public", host: "acme.test", header: "default", wantStatus: http.StatusOK, wantTenant: "default"},
+		{name: "unknown header", path: "/public", header: "initech", wantStatus: http.StatusBadRequest},
+		{name: "tenant from token", path: "/private", token: acmeToken, wantStatus: http.StatusOK, wantTenant: "acme"},
+		{name: "default token", path: "/private", token: defaultToken, wantStatus: http.StatusOK, wantTenant: "default"},
+		{name: "token of other tenant", path: "/private", header: "globex", token: acmeToken, wantStatus: http.StatusUnauthorized},
+		{name: "default token on tenant host", path: "/private", host: "acme.test", token: defaultToken, wantStatus: http.StatusUnauthorized},
+		{name: "token signed by other tenant", path: "/private", token: forgedToken, wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resolved = ""
+			request := httptest.NewRequest(http.MethodGet, tt.path, nil)
+			if tt.host != "" {
+				request.Host = tt.host
+			}
+			if tt.header != "" {
+				request.Header.Set(tenant.Header, tt.header)
+			}
+			if tt.token != "" {
+				request.Header.Set("Authorization", tt.token)
+			}
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			assert.Equal(t, tt.wantStatus, recorder.Code)
+			assert.Equal(t, tt.wantTenant, resolved)
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const accountPurgeInterval = time.Hour
+
+type AccountPurgeServicer interface {
+	PurgeDeletedAccountsService(ctx context.Context) (int, error)
+}
+
+// AccountPurger periodically removes the accounts of every tenant whose
+// deletion grace period has passed.
+type AccountPurger struct {
+	service   AccountPurgeServicer
+	tenantIDs []string
+	interval  time.Duration
+	log       *logger.Logger
+}
+
+func NewAccountPurger(service AccountPurgeServicer, tenantIDs []string, interval time.Duration, log *logger.Logger) *AccountPurger {
+	return &AccountPurger{
+		service:   service,
+		tenantIDs: tenantIDs,
+		interval:  interval,
+		log:       log,
+	}
+}
+
+func (p *AccountPurger) Run(ctx context.Context) {
+	ticker := time.NewTicker(p.interval)
+	defer ticker.Stop()
+
+	for {
+		p.Purge(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (p *AccountPurger) Purge(ctx context.Context) {
+	for _, id := range p.tenantIDs {
+		purged, err := p.service.PurgeDeletedAccountsService(tenant.WithID(ctx, id))
+		if err != nil {
+			p.log.Log.Error("cannot purge deleted accounts", zap.String("tenant", id), zap.Error(err))
+			continue
+		}
+		if purged > 0 {
+			p.log.Log.Info("purged deleted accounts", zap.String("tenant", id), zap.Int("count", purged))
+		}
+	}
+}
@@ -0,0 +1,63 @@
+package app
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type countingPurgeService struct {
+	calls atomic.Int32
+	err   error
+
+	mu      sync.Mutex
+	tenants []string
+}
+
+func (s *countingPurgeService) PurgeDeletedAccountsService(ctx context.Context) (int, error) {
+	s.calls.Add(1)
+	s.mu.Lock()
+	s.tenants = append(s.tenants, tenant.ID(ctx))
+	s.mu.Unlock()
+	return 1, s.err
+}
+
+func TestAccountPurger_Run(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	service := &countingPurgeService{err: errors.New("db error")}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		NewAccountPurger(service, []string{tenant.DefaultID}, 10*time.Millisecond, log).Run(ctx)
+		close(done)
+	}()
+
+	assert.Eventually(t, func() bool { return service.calls.Load() >= 3 }, time.Second, 5*time.Millisecond,
+		"purges on start and on every tick, errors do not stop the purger")
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("purger did not stop")
+	}
+}
+
+func TestAccountPurger_PurgeEveryTenant(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	service := &countingPurgeService{err: errors.New("db error")}
+	NewAccountPurger(service, []string{tenant.DefaultID, "acme", "globex"}, time.Hour, log).Purge(context.Background())
+
+	assert.Equal(t, []string{tenant.DefaultID, "acme", "globex"}, service.tenants, "an error does not skip the other tenants")
+}
@@ -0,0 +1,271 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"expvar"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"strconv"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/client"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// reconcileMetrics are published under "reconciliation" by expvar. All but
+// last_mismatches are totals since the start of the process.
+var reconcileMetrics = expvar.NewMap("reconciliation")
+
+type ReconcileStorager interface {
+	GetSettledOrders(ctx context.Context, since time.Time) ([]models.Orders, error)
+}
+
+// OrderUpdater applies a result of the accrual system to an order the way
+// the AccrualProcessor does, granting bonuses and publishing the change.
+type OrderUpdater interface {
+	UpdateOrder(ctx context.Context, order models.Orders, status string, accrual *float32, rawResponse json.RawMessage) error
+	InvalidateOrder(ctx context.Context, order models.Orders, policy string) (*models.CancelledOrder, error)
+}
+
+type Auditor interface {
+	Record(ctx context.Context, eventType string, userID string, details map[string]any)
+}
+
+// ReconcileOptions select the orders a Reconciler checks: the processed and
+// invalid orders uploaded over Window, at most Sample of them per tenant
+// picked at random, all of them if Sample is 0. With AutoCorrect, orders the
+// accrual system holds a different final result for are updated to it.
+// ClawbackPolicy is the negative balance policy of the clawbacks of processed
+// orders corrected to INVALID; reject caps them as a correction cannot be
+// refused.
+type ReconcileOptions struct {
+	Window         time.Duration
+	Sample         int
+	AutoCorrect    bool
+	ClawbackPolicy string
+}
+
+// Reconciler compares settled orders with what the accrual system of their
+// tenant holds for them, catching the orders the AccrualProcessor failed to
+// update. Corrections go through the updater, so an order corrected to
+// PROCESSED earns its bonuses like a polled one and an order corrected from
+// PROCESSED to INVALID has its accrual, bonuses and referral rewards clawed
+// back like a cancelled one. Such orders are only reported afterwards, as
+// processing them again would credit an accrual that was clawed back.
+type Reconciler struct {
+	storage        ReconcileStorager
+	updater        OrderUpdater
+	accrualClients AccrualClients
+	auditor        Auditor
+	options        ReconcileOptions
+	interval       time.Duration
+	log            *logger.Logger
+}
+
+func NewReconciler(storage ReconcileStorager, updater OrderUpdater, accrualClients AccrualClients, auditor Auditor, options ReconcileOptions, interval time.Duration, log *logger.Logger) *Reconciler {
+	return &Reconciler{
+		storage:        storage,
+		updater:        updater,
+		accrualClients: accrualClients,
+		auditor:        auditor,
+		options:        options,
+		interval:       interval,
+		log:            log,
+	}
+}
+
+func (r *Reconciler) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		report := r.Reconcile(ctx)
+		for _, m := range report.Mismatches {
+			r.log.Log.Warn("order differs from the accrual system",
+				zap.String("tenant", m.TenantID), zap.String("order_number", m.Order), zap.Int("user_id", m.UserID),
+				zap.String("status", m.LocalStatus), zap.Float32("accrual", m.LocalAccrual),
+				zap.String("remote_status", m.RemoteStatus), zap.Float32("remote_accrual", m.RemoteAccrual),
+				zap.Bool("corrected", m.Corrected))
+		}
+		if len(report.Mismatches) > 0 || report.Failed > 0 {
+			r.log.Log.Warn("orders differ from the accrual system",
+				zap.Int("checked", report.Checked), zap.Int("mismatches", len(report.Mismatches)),
+				zap.Int("corrected", report.Corrected), zap.Int("failed", report.Failed))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Reconcile checks the orders of every tenant once.
+func (r *Reconciler) Reconcile(ctx context.Context) *models.ReconcileReport {
+	report := &models.ReconcileReport{StartedAt: time.Now(), Mismatches: []models.ReconcileMismatch{}}
+
+	tenantIDs := make([]string, 0, len(r.accrualClients))
+	for id := range r.accrualClients {
+		tenantIDs = append(tenantIDs, id)
+	}
+	slices.Sort(tenantIDs)
+	for _, id := range tenantIDs {
+		r.reconcileTenant(tenant.WithID(ctx, id), r.accrualClients[id], report)
+	}
+
+	reconcileMetrics.Add("runs", 1)
+	reconcileMetrics.Add("checked", int64(report.Checked))
+	reconcileMetrics.Add("failed", int64(report.Failed))
+	reconcileMetrics.Add("mismatches", int64(len(report.Mismatches)))
+	reconcileMetrics.Add("corrected", int64(report.Corrected))
+	lastMismatches := new(expvar.Int)
+	lastMismatches.Set(int64(len(report.Mismatches)))
+	reconcileMetrics.Set("last_mismatches", lastMismatches)
+	return report
+}
+
+func (r *Reconciler) reconcileTenant(ctx context.Context, accrualClient client.AccrualProvider, report *models.ReconcileReport) {
+	orders, err := r.storage.GetSettledOrders(ctx, time.Now().Add(-r.options.Window))
+	if err != nil {
+		r.log.Log.Error("cannot get orders to reconcile", zap.String("tenant", tenant.ID(ctx)), zap.Error(err))
+		return
+	}
+	if r.options.Sample > 0 && len(orders) > r.options.Sample {
+		rand.Shuffle(len(orders), func(i, j int) { orders[i], orders[j] = orders[j], orders[i] })
+		orders = orders[:r.options.Sample]
+	}
+
+	for i, order := range orders {
+		reqCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+		response, retryAfter, err := accrualClient.GetOrderInfo(reqCtx, order.Number)
+		cancel()
+		if err != nil {
+			r.log.Log.Info("failed to get order info", zap.String("order_number", order.Number), zap.Error(err))
+			report.Failed++
+			continue
+		}
+		// The rest of the orders are left to the next run rather than
+		// waiting for the accrual system.
+		if retryAfter > 0 {
+			r.log.Log.Info("accrual service is busy, reconciliation postponed",
+				zap.String("tenant", tenant.ID(ctx)), zap.Int("retry_after", retryAfter))
+			report.Failed += len(orders) - i
+			return
+		}
+		report.Checked++
+
+		mismatch, ok := compareOrder(order, response)
+		if !ok {
+			continue
+		}
+		mismatch.TenantID = tenant.ID(ctx)
+		if r.options.AutoCorrect && !isInvalidated(order) && (mismatch.RemoteStatus == "PROCESSED" || mismatch.RemoteStatus == "INVALID") {
+			mismatch.Corrected = r.correct(ctx, order, mismatch, response.Raw)
+			if mismatch.Corrected {
+				report.Corrected++
+			}
+		}
+		report.Mismatches = append(report.Mismatches, mismatch)
+	}
+}
+
+// compareOrder reports how order differs from response, the answer of the
+// accrual system for it.
+func compareOrder(order models.Orders, response *models.AccrualResponse) (models.ReconcileMismatch, bool) {
+	mismatch := models.ReconcileMismatch{
+		Order:       order.Number,
+		UserID:      order.UserID,
+		LocalStatus: order.Status,
+	}
+	// The accrual an invalidated order keeps was clawed back.
+	if !isInvalidated(order) {
+		mismatch.LocalAccrual = order.Accrual
+	}
+	if response == nil {
+		return mismatch, true
+	}
+
+	mismatch.RemoteStatus = response.Status
+	if mismatch.RemoteStatus == "PROCESSED" {
+		mismatch.RemoteAccrual = response.Accrual
+	}
+	differs := mismatch.RemoteStatus != mismatch.LocalStatus ||
+		math.Abs(float64(mismatch.RemoteAccrual-mismatch.LocalAccrual)) >= 0.005
+	return mismatch, differs
+}
+
+// isInvalidated reports whether order was invalidated after it was
+// processed, keeping the accrual its clawback offsets.
+func isInvalidated(order models.Orders) bool {
+	return order.Status == "INVALID" && order.Accrual > 0
+}
+
+func (r *Reconciler) correct(ctx context.Context, order models.Orders, mismatch models.ReconcileMismatch, raw json.RawMessage) bool {
+	details := map[string]any{
+		"order":          mismatch.Order,
+		"status":         mismatch.LocalStatus,
+		"accrual":        mismatch.LocalAccrual,
+		"remote_status":  mismatch.RemoteStatus,
+		"remote_accrual": mismatch.RemoteAccrual,
+	}
+
+	var err error
+	if mismatch.LocalStatus == "PROCESSED" && mismatch.RemoteStatus == "INVALID" {
+		var invalidated *models.CancelledOrder
+		invalidated, err = r.updater.InvalidateOrder(ctx, order, r.options.ClawbackPolicy)
+		if err == nil {
+			details["clawback"], details["written_off"] = invalidated.Clawback, invalidated.WrittenOff
+		}
+	} else {
+		var accrual *float32
+		if mismatch.RemoteStatus == "PROCESSED" {
+			accrual = &mismatch.RemoteAccrual
+		}
+		err = r.updater.UpdateOrder(ctx, order, mismatch.RemoteStatus, accrual, raw)
+	}
+	if errors.Is(err, storage.ErrOrderStatusChanged) {
+		r.log.Log.Info("order changed while reconciled", zap.String("order_number", mismatch.Order))
+		return false
+	}
+	if err != nil {
+		r.log.Log.Error("failed to correct order", zap.String("order_number", mismatch.Order), zap.Error(err))
+		return false
+	}
+	r.auditor.Record(ctx, audit.EventOrderReconciled, strconv.Itoa(mismatch.UserID), details)
+	return true
+}
+
+// WriteReconcileReport writes the mismatches of report as a table followed
+// by a summary.
+func WriteReconcileReport(w io.Writer, report *models.ReconcileReport) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if len(report.Mismatches) > 0 {
+		fmt.Fprintln(tw, "TENANT\tORDER\tLOCAL STATUS\tLOCAL ACCRUAL\tREMOTE STATUS\tREMOTE ACCRUAL\tCORRECTED")
+		for _, m := range report.Mismatches {
+			remoteStatus := m.RemoteStatus
+			if remoteStatus == "" {
+				remoteStatus = "UNKNOWN"
+			}
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%s\t%.2f\t%t\n",
+				m.TenantID, m.Order, m.LocalStatus, m.LocalAccrual, remoteStatus, m.RemoteAccrual, m.Corrected)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintf(w, "checked: %d, mismatches: %d, corrected: %d, failed: %d\n",
+		report.Checked, len(report.Mismatches), report.Corrected, report.Failed)
+	return err
+}
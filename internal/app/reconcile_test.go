@@ -0,0 +1,304 @@
+package app
+
+import (
+	"bytes"
+	"context"
+	"expvar"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/client"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingAuditor struct {
+	mu      sync.Mutex
+	events  []string
+	details []map[string]any
+}
+
+func (r *recordingAuditor) Record(ctx context.Context, eventType string, userID string, details map[string]any) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, eventType)
+	r.details = append(r.details, details)
+}
+
+type reconcileTestEnv struct {
+	storage   *storage.Memory
+	mock      *accrualmock.Server
+	auditor   *recordingAuditor
+	clients   AccrualClients
+	hub       *events.Hub
+	bonuses   *recordingBonusApplier
+	referrals *recordingReferralRewarder
+	tiers     *recordingTierCreditor
+	log       *logger.Logger
+	userID    int
+}
+
+func newReconcileTestEnv(t *testing.T) *reconcileTestEnv {
+	t.Helper()
+	mock := accrualmock.New()
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	memory := storage.NewMemory()
+	userID, err := memory.CreateUser(context.Background(), models.UserCreditials{Login: "user", Password: "password"})
+	require.NoError(t, err)
+
+	return &reconcileTestEnv{
+		storage:   memory,
+		mock:      mock,
+		auditor:   &recordingAuditor{},
+		clients:   AccrualClients{tenant.DefaultID: client.NewClient(server.URL)},
+		hub:       events.NewHub(),
+		bonuses:   &recordingBonusApplier{},
+		referrals: &recordingReferralRewarder{},
+		tiers:     &recordingTierCreditor{},
+		log:       log,
+		userID:    userID,
+	}
+}
+
+func (env *reconcileTestEnv) reconciler(options ReconcileOptions) *Reconciler {
+	if options.Window == 0 {
+		options.Window = time.Hour
+	}
+	processor := NewAccrualProcessor(env.storage, env.clients, env.hub, env.bonuses, env.referrals, env.tiers, env.log)
+	return NewReconciler(env.storage, processor, env.clients, env.auditor, options, time.Hour, env.log)
+}
+
+func (env *reconcileTestEnv) settleOrder(t *testing.T, number, status string, accrual float32) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, env.storage.CreateNewOrder(ctx, &models.Orders{Number: number, Status: "NEW", UserID: env.userID}))
+	require.NoError(t, env.storage.UpdateOrderStatus(ctx, number, status, &accrual, nil))
+}
+
+func TestReconciler_Mismatches(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	env.settleOrder(t, "79927398713", "PROCESSED", 500)
+	env.settleOrder(t, "12345678903", "PROCESSED", 100)
+	env.settleOrder(t, "2377225624", "INVALID", 0)
+	env.mock.Script("79927398713", accrualmock.Processed(500))
+	env.mock.Script("12345678903", accrualmock.Processed(150))
+	env.mock.Script("2377225624", accrualmock.NoContent())
+
+	report := env.reconciler(ReconcileOptions{}).Reconcile(context.Background())
+
+	assert.Equal(t, 3, report.Checked)
+	assert.Zero(t, report.Failed)
+	assert.Zero(t, report.Corrected)
+	require.Len(t, report.Mismatches, 2)
+	byOrder := map[string]models.ReconcileMismatch{}
+	for _, m := range report.Mismatches {
+		byOrder[m.Order] = m
+	}
+	assert.Equal(t, models.ReconcileMismatch{
+		TenantID: tenant.DefaultID, Order: "12345678903", UserID: env.userID,
+		LocalStatus: "PROCESSED", LocalAccrual: 100, RemoteStatus: "PROCESSED", RemoteAccrual: 150,
+	}, byOrder["12345678903"])
+	assert.Empty(t, byOrder["2377225624"].RemoteStatus, "orders unknown to the accrual system have no remote status")
+
+	order, err := env.storage.GetOrderByNumber(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, float32(100), order.Accrual, "orders are only reported without auto-correction")
+	assert.Empty(t, env.auditor.events)
+}
+
+func TestReconciler_AutoCorrect(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	env.settleOrder(t, "79927398713", "INVALID", 0)
+	env.settleOrder(t, "12345678903", "PROCESSED", 100)
+	env.mock.Script("79927398713", accrualmock.Processed(500))
+	env.mock.Script("12345678903", accrualmock.Processing())
+
+	report := env.reconciler(ReconcileOptions{AutoCorrect: true}).Reconcile(context.Background())
+
+	require.Len(t, report.Mismatches, 2)
+	assert.Equal(t, 1, report.Corrected, "only final results of the accrual system are applied")
+	assert.Equal(t, []string{audit.EventOrderReconciled}, env.auditor.events)
+
+	order, err := env.storage.GetOrderByNumber(context.Background(), "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSED", order.Status)
+	assert.Equal(t, float32(500), order.Accrual)
+	balance, err := env.storage.GetUserBalance(context.Background(), strconv.Itoa(env.userID))
+	require.NoError(t, err)
+	assert.Equal(t, float64(600), balance.Current)
+
+	order, err = env.storage.GetOrderByNumber(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSED", order.Status)
+}
+
+func TestReconciler_Sample(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	for _, number := range []string{"79927398713", "12345678903", "2377225624"} {
+		env.settleOrder(t, number, "PROCESSED", 10)
+		env.mock.Script(number, accrualmock.Processed(10))
+	}
+
+	report := env.reconciler(ReconcileOptions{Sample: 2}).Reconcile(context.Background())
+	assert.Equal(t, 2, report.Checked)
+	assert.Empty(t, report.Mismatches)
+}
+
+func TestReconciler_Failures(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	env.settleOrder(t, "79927398713", "PROCESSED", 10)
+	env.mock.Script("79927398713", accrualmock.TooManyRequests(60))
+
+	report := env.reconciler(ReconcileOptions{}).Reconcile(context.Background())
+	assert.Zero(t, report.Checked)
+	assert.Equal(t, 1, report.Failed)
+	assert.Empty(t, report.Mismatches)
+}
+
+func TestReconciler_Metrics(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	env.settleOrder(t, "79927398713", "PROCESSED", 10)
+	env.mock.Script("79927398713", accrualmock.Processed(20))
+
+	counter := func(key string) int64 {
+		value, ok := reconcileMetrics.Get(key).(*expvar.Int)
+		if !ok {
+			return 0
+		}
+		return value.Value()
+	}
+	runs, mismatches := counter("runs"), counter("mismatches")
+
+	env.reconciler(ReconcileOptions{}).Reconcile(context.Background())
+	assert.Equal(t, runs+1, counter("runs"))
+	assert.Equal(t, mismatches+1, counter("mismatches"))
+	assert.Equal(t, int64(1), counter("last_mismatches"))
+}
+
+func TestWriteReconcileReport(t *testing.T) {
+	report := &models.ReconcileReport{
+		Checked:   3,
+		Corrected: 1,
+		Failed:    1,
+		Mismatches: []models.ReconcileMismatch{
+			{TenantID: "default", Order: "79927398713", LocalStatus: "INVALID", RemoteStatus: "PROCESSED", RemoteAccrual: 500, Corrected: true},
+			{TenantID: "default", Order: "12345678903", LocalStatus: "PROCESSED", LocalAccrual: 100},
+		},
+	}
+
+	var out bytes.Buffer
+	require.NoError(t, WriteReconcileReport(&out, report))
+	assert.Equal(t,
+		"TENANT   ORDER        LOCAL STATUS  LOCAL ACCRUAL  REMOTE STATUS  REMOTE ACCRUAL  CORRECTED\n"+
+			"default  79927398713  INVALID       0.00           PROCESSED      500.00          true\n"+
+			"default  12345678903  PROCESSED     100.00         UNKNOWN        0.00            false\n"+
+			"checked: 3, mismatches: 2, corrected: 1, failed: 1\n",
+		out.String())
+
+	out.Reset()
+	require.NoError(t, WriteReconcileReport(&out, &models.ReconcileReport{Checked: 2}))
+	assert.Equal(t, "checked: 2, mismatches: 0, corrected: 0, failed: 0\n", out.String())
+}
+
+func TestReconciler_CorrectionsEarnBonuses(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	env.settleOrder(t, "79927398713", "INVALID", 0)
+	env.settleOrder(t, "12345678903", "PROCESSED", 100)
+	env.mock.Script("79927398713", accrualmock.Processed(500))
+	env.mock.Script("12345678903", accrualmock.Invalid())
+	changes, unsubscribe := env.hub.Subscribe(env.userID)
+	defer unsubscribe()
+
+	report := env.reconciler(ReconcileOptions{AutoCorrect: true}).Reconcile(context.Background())
+	assert.Equal(t, 2, report.Corrected)
+
+	// An order corrected to PROCESSED is rewarded like a polled one.
+	require.Len(t, env.bonuses.orders, 1)
+	assert.Equal(t, "79927398713", env.bonuses.orders[0].Number)
+	assert.Equal(t, float32(500), env.bonuses.orders[0].Accrual)
+	require.Len(t, env.referrals.orders, 1)
+	assert.Equal(t, "79927398713", env.referrals.orders[0].Number)
+	require.Len(t, env.tiers.orders, 1)
+	assert.Equal(t, "79927398713", env.tiers.orders[0].Number)
+	assert.Len(t, changes, 2, "both corrections are published")
+
+	// What an order corrected to INVALID earned is clawed back, which the
+	// audit event of the correction records.
+	require.Len(t, env.auditor.details, 2)
+	clawbacks := map[string]any{}
+	for _, details := range env.auditor.details {
+		clawbacks[details["order"].(string)] = details["clawback"]
+	}
+	assert.Equal(t, map[string]any{"79927398713": nil, "12345678903": float64(100)}, clawbacks)
+	balance, err := env.storage.GetUserBalance(context.Background(), strconv.Itoa(env.userID))
+	require.NoError(t, err)
+	assert.Equal(t, float64(500), balance.Current)
+	stored, err := env.storage.GetClawbacksByUserID(context.Background(), env.userID)
+	require.NoError(t, err)
+	require.Len(t, stored, 1)
+	assert.Equal(t, "12345678903", stored[0].OrderNumber)
+	assert.Equal(t, models.CancelledByReconciler, stored[0].CancelledBy)
+}
+
+func TestReconciler_InvalidatedOrdersAreOnlyReported(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	env.settleOrder(t, "12345678903", "PROCESSED", 100)
+	env.mock.Script("12345678903", accrualmock.Invalid())
+	reconciler := env.reconciler(ReconcileOptions{AutoCorrect: true, ClawbackPolicy: models.ClawbackReject})
+	require.NoError(t, env.storage.CreateWithdrawal(context.Background(), &models.WithdrawBalance{
+		UserID: strconv.Itoa(env.userID), OrderNumber: "2377225624", Amount: 60,
+	}))
+
+	report := reconciler.Reconcile(context.Background())
+	require.Equal(t, 1, report.Corrected)
+	require.Len(t, env.auditor.details, 1)
+	assert.Equal(t, float64(40), env.auditor.details[0]["clawback"], "a correction caps the clawback under the reject policy")
+	assert.Equal(t, float64(60), env.auditor.details[0]["written_off"])
+
+	report = reconciler.Reconcile(context.Background())
+	assert.Empty(t, report.Mismatches, "the clawed back accrual is not a mismatch")
+
+	env.mock.Script("12345678903", accrualmock.Processed(100))
+	report = reconciler.Reconcile(context.Background())
+	require.Len(t, report.Mismatches, 1)
+	assert.False(t, report.Mismatches[0].Corrected)
+	order, err := env.storage.GetOrderByNumber(context.Background(), "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID", order.Status)
+}
+
+func TestReconciler_SkipsOrdersCancelledMeanwhile(t *testing.T) {
+	env := newReconcileTestEnv(t)
+	env.settleOrder(t, "79927398713", "INVALID", 0)
+	env.mock.Script("79927398713", accrualmock.Processed(500))
+	orders, err := env.storage.GetSettledOrders(context.Background(), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+
+	_, err = env.storage.CancelOrder(context.Background(), models.OrderCancellation{
+		Number: "79927398713", UserID: env.userID, Status: "INVALID", Policy: models.ClawbackAllow, CancelledBy: models.CancelledByAdmin,
+	})
+	require.NoError(t, err)
+
+	reconciler := env.reconciler(ReconcileOptions{AutoCorrect: true})
+	mismatch, ok := compareOrder(orders[0], &models.AccrualResponse{Order: "79927398713", Status: "PROCESSED", Accrual: 500})
+	require.True(t, ok)
+	assert.False(t, reconciler.correct(context.Background(), orders[0], mismatch, nil))
+	assert.Empty(t, env.bonuses.orders)
+	assert.Empty(t, env.auditor.events)
+}
@@ -0,0 +1,75 @@
+package app
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+// ConfigReloader re-reads the configuration on SIGHUP and applies the log
+// level, the poll interval and the worker count without a restart. Other
+// changes are reported and ignored until the next start.
+type ConfigReloader struct {
+	cfg       config.Config
+	load      func() (*config.Config, error)
+	log       *logger.Logger
+	processor *AccrualProcessor
+}
+
+func NewConfigReloader(cfg *config.Config, load func() (*config.Config, error), log *logger.Logger, processor *AccrualProcessor) *ConfigReloader {
+	return &ConfigReloader{
+		cfg:       *cfg,
+		load:      load,
+		log:       log,
+		processor: processor,
+	}
+}
+
+func (r *ConfigReloader) Run(ctx context.Context) {
+	hangup := make(chan os.Signal, 1)
+	signal.Notify(hangup, syscall.SIGHUP)
+	defer signal.Stop(hangup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hangup:
+			if err := r.Reload(); err != nil {
+				r.log.Log.Error("cannot reload configuration, keeping the current one", zap.Error(err))
+			}
+		}
+	}
+}
+
+func (r *ConfigReloader) Reload() error {
+	next, err := r.load()
+	if err != nil {
+		return err
+	}
+
+	if changed := config.RestartRequired(&r.cfg, next); len(changed) > 0 {
+		r.log.Log.Warn("configuration changes require a restart", zap.Strings("fields", changed))
+	}
+
+	if err := r.log.SetLevel(next.LogLevel); err != nil {
+		return err
+	}
+	r.processor.Reconfigure(next.UpdateInterval, next.WorkerCount)
+
+	r.cfg.LogLevel = next.LogLevel
+	r.cfg.UpdateInterval = next.UpdateInterval
+	r.cfg.WorkerCount = next.WorkerCount
+
+	r.log.Log.Info("configuration reloaded",
+		zap.String("log_level", next.LogLevel),
+		zap.Int("update_interval", next.UpdateInterval),
+		zap.Int("worker_count", next.WorkerCount),
+	)
+	return nil
+}
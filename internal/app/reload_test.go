@@ -0,0 +1,54 @@
+package app
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestConfigReloader_Reload(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	processor := NewAccrualProcessor(nil, nil, nil, nil, nil, nil, log)
+	processor.Reconfigure(10, 5)
+
+	current := &config.Config{RunAddress: "localhost:8000", LogLevel: "info", UpdateInterval: 10, WorkerCount: 5}
+	next := *current
+	next.LogLevel = "debug"
+	next.UpdateInterval = 2
+	next.WorkerCount = 8
+	next.RunAddress = "localhost:9000"
+
+	reloader := NewConfigReloader(current, func() (*config.Config, error) {
+		return &next, nil
+	}, log, processor)
+	require.NoError(t, reloader.Reload())
+
+	assert.True(t, log.Log.Core().Enabled(zap.DebugLevel))
+	assert.Equal(t, processorSettings{interval: 2 * time.Second, workerCount: 8}, processor.settings())
+	assert.Equal(t, "localhost:8000", reloader.cfg.RunAddress, "restart-only fields are not applied")
+}
+
+func TestConfigReloader_ReloadKeepsConfigOnError(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	processor := NewAccrualProcessor(nil, nil, nil, nil, nil, nil, log)
+	processor.Reconfigure(10, 5)
+
+	current := &config.Config{LogLevel: "info", UpdateInterval: 10, WorkerCount: 5}
+	reloader := NewConfigReloader(current, func() (*config.Config, error) {
+		return nil, errors.New("invalid configuration")
+	}, log, processor)
+	require.Error(t, reloader.Reload())
+
+	assert.False(t, log.Log.Core().Enabled(zap.DebugLevel))
+	assert.Equal(t, processorSettings{interval: 10 * time.Second, workerCount: 5}, processor.settings())
+}
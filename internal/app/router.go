@@ -1,41 +1,119 @@
 package app
 
 import (
+	"expvar"
+
+	"github.com/AndreyKuskov2/gophermart/api"
 	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
 	"github.com/AndreyKuskov2/gophermart/internal/handlers"
-	"github.com/AndreyKuskov2/gophermart/internal/service"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
+	"go.uber.org/zap"
 )
 
 func (app *App) GophermartRouter() chi.Router {
 	router := chi.NewRouter()
 
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	router.Use(middlewares.RealIP(app.Cfg.TrustedProxyPrefixes()))
+	router.Use(middlewares.AuditMetadata)
 	router.Use(middlewares.LoggerMiddleware(app.Log))
+	router.Use(middlewares.TenantResolver(app.Cfg, app.Log))
 	router.Use(middleware.Recoverer)
 
-	userService := service.NewGophermartUserService(app.Storage, app.Log)
-	userHandlers := handlers.NewGophermartUserHandlers(userService, app.Cfg, app.Log)
-
-	orderService := service.NewGophermartOrderService(app.Storage, app.Storage, app.Log)
-	orderHandlers := handlers.NewGophermartOrderHandlers(orderService, app.Cfg, app.Log)
+	openAPI, err := api.LoadOpenAPI()
+	if err != nil {
+		app.Log.Log.Fatal("cannot load openapi specification", zap.Error(err))
+	}
+	openAPIValidator, err := middlewares.OpenAPIValidator(openAPI, app.Log, app.OnAPIResponseError)
+	if err != nil {
+		app.Log.Log.Fatal("cannot create openapi validator", zap.Error(err))
+	}
 
-	balanceService := service.NewGophermartUserBalanceService(app.Storage, app.Log)
-	balanceHandlers := handlers.NewGophermartBalanceHandlers(balanceService, app.Cfg, app.Log)
+	services := app.services
+	userHandlers := handlers.NewGophermartUserHandlers(services.user, app.Cfg, app.Log)
+	orderHandlers := handlers.NewGophermartOrderHandlers(services.order, app.Cfg, app.Log)
+	cancelOrderHandlers := handlers.NewGophermartCancelOrderHandlers(services.cancel, app.Cfg, app.Log)
+	balanceHandlers := handlers.NewGophermartBalanceHandlers(services.balance, app.Cfg, app.Log)
+	withdrawHandlers := handlers.NewGophermartWithdrawHandlers(services.withdraw, app.Cfg, app.Log)
+	orderStreamHandlers := handlers.NewGophermartOrderStreamHandlers(app.Events, app.Cfg, app.Log)
+	auditHandlers := handlers.NewGophermartAuditHandlers(services.audit, app.Cfg, app.Log)
+	accountHandlers := handlers.NewGophermartAccountHandlers(services.account, app.Cfg, app.Log)
+	statementHandlers := handlers.NewGophermartStatementHandlers(services.statement, app.Cfg, app.Log)
+	transferHandlers := handlers.NewGophermartTransferHandlers(services.transfer, app.Cfg, app.Log)
+	campaignHandlers := handlers.NewGophermartCampaignHandlers(services.campaign, app.Cfg, app.Log)
+	referralHandlers := handlers.NewGophermartReferralHandlers(services.referral, app.Cfg, app.Log)
+	tierHandlers := handlers.NewGophermartTierHandlers(services.tier, app.Cfg, app.Log)
 
-	withdrawService := service.NewGophermartWithdrawService(app.Storage, app.Storage, app.Log)
-	withdrawHandlers := handlers.NewGophermartWithdrawHandlers(withdrawService, app.Cfg, app.Log)
+	router.Get("/api/openapi.yaml", handlers.OpenAPISpecHandler)
 
 	router.Route("/api/user", func(r chi.Router) {
-		r.Post("/register", userHandlers.RegisterUserHandler)
-		r.Post("/login", userHandlers.LoginUserHandler)
-		r.With(middlewares.JwtAuthValidator(app.Cfg, app.Log)).Post("/orders", orderHandlers.CreateNewOrderHandler)
-		r.With(middlewares.JwtAuthValidator(app.Cfg, app.Log)).Get("/orders", orderHandlers.GetOrdersHandler)
-		r.With(middlewares.JwtAuthValidator(app.Cfg, app.Log)).Get("/balance", balanceHandlers.GetBalanceHandler)
-		r.With(middlewares.JwtAuthValidator(app.Cfg, app.Log)).Post("/balance/withdraw", withdrawHandlers.WithdrawBalanceHandler)
-		r.With(middlewares.JwtAuthValidator(app.Cfg, app.Log)).Get("/withdrawals", withdrawHandlers.WithdrawAlsHandler)
+		r.Group(func(r chi.Router) {
+			r.Use(openAPIValidator)
+			r.Use(middlewares.RouteLogger(app.Log))
+
+			r.Post("/register", userHandlers.RegisterUserHandler)
+			r.Post("/login", userHandlers.LoginUserHandler)
+		})
+
+		// Requests are authenticated before they are validated, so that
+		// anonymous callers get 401 whatever they send.
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RouteLogger(app.Log))
+			r.Use(middlewares.JwtAuthValidator(app.Cfg, app.Log))
+			r.Use(openAPIValidator)
+
+			r.Post("/orders", orderHandlers.CreateNewOrderHandler)
+			r.Get("/orders", orderHandlers.GetOrdersHandler)
+			r.Get("/orders/stream", orderStreamHandlers.OrderStreamHandler)
+			r.Get("/orders/{number}", orderHandlers.GetOrderHandler)
+			r.Post("/orders/{number}/cancel", cancelOrderHandlers.CancelUserOrderHandler)
+			r.Get("/balance", balanceHandlers.GetBalanceHandler)
+			r.Post("/balance/withdraw", withdrawHandlers.WithdrawBalanceHandler)
+			r.Get("/withdrawals", withdrawHandlers.WithdrawAlsHandler)
+			r.Post("/balance/transfer", transferHandlers.TransferHandler)
+			r.Get("/transfers", transferHandlers.GetTransfersHandler)
+			r.Get("/referrals", referralHandlers.GetReferralsHandler)
+			r.Get("/tier", tierHandlers.GetTierHandler)
+			r.Get("/statement", statementHandlers.StatementHandler)
+			r.Get("/profile", accountHandlers.GetProfileHandler)
+			r.Patch("/profile", accountHandlers.UpdateProfileHandler)
+			r.Get("/export", accountHandlers.ExportHandler)
+			r.Delete("/", accountHandlers.DeleteAccountHandler)
+		})
+	})
+
+	router.Route("/api/admin", func(r chi.Router) {
+		r.Use(middlewares.JwtAuthValidator(app.Cfg, app.Log))
+		r.Use(middlewares.RequireAdmin(app.Storage, app.Cfg, app.Log))
+		r.Use(openAPIValidator)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RouteLogger(app.Log))
+
+			r.Get("/audit", auditHandlers.GetAuditEventsHandler)
+			r.Get("/audit/verify", auditHandlers.VerifyAuditChainHandler)
+			r.Get("/metrics", expvar.Handler().ServeHTTP)
+			r.Get("/campaigns", campaignHandlers.GetCampaignsHandler)
+			r.Post("/campaigns", campaignHandlers.CreateCampaignHandler)
+			r.Post("/campaigns/dry-run", campaignHandlers.DryRunCampaignHandler)
+			r.Get("/campaigns/{id}", campaignHandlers.GetCampaignHandler)
+			r.Put("/campaigns/{id}", campaignHandlers.UpdateCampaignHandler)
+			r.Delete("/campaigns/{id}", campaignHandlers.DeleteCampaignHandler)
+			r.Post("/orders/{number}/cancel", cancelOrderHandlers.AdminCancelOrderHandler)
+		})
+	})
+
+	router.Route("/api/partner", func(r chi.Router) {
+		r.Use(middlewares.JwtAuthValidator(app.Cfg, app.Log))
+		r.Use(middlewares.RequirePartner(app.Storage, app.Cfg, app.Log))
+		r.Use(openAPIValidator)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middlewares.RouteLogger(app.Log))
+
+			r.Post("/orders/{number}/cancel", cancelOrderHandlers.PartnerCancelOrderHandler)
+		})
 	})
 
 	return router
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/api"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestApp(t *testing.T) *App {
+	t.Helper()
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+	app, err := NewApp(&config.Config{JWTSecretToken: "test-secret"}, log, storage.NewMemory(), events.NewHub(), nil)
+	require.NoError(t, err)
+	return app
+}
+
+func TestGophermartRouter_MatchesOpenAPI(t *testing.T) {
+	doc, err := api.LoadOpenAPI()
+	require.NoError(t, err)
+
+	documented := map[string]bool{}
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented[method+" "+path] = true
+		}
+	}
+
+	routed := map[string]bool{}
+	err = chi.Walk(newTestApp(t).GophermartRouter(), func(method, route string, handler http.Handler, middlewares ...func(http.Handler) http.Handler) error {
+		if strings.HasPrefix(route, "/api/user") || strings.HasPrefix(route, "/api/admin") || strings.HasPrefix(route, "/api/partner") {
+			routed[method+" "+strings.TrimSuffix(route, "/")] = true
+		}
+		return nil
+	})
+	require.NoError(t, err)
+
+	require.NotEmpty(t, routed)
+	assert.Equal(t, documented, routed)
+}
+
+func TestGophermartRouter_ServesOpenAPI(t *testing.T) {
+	w := httptest.NewRecorder()
+	newTestApp(t).GophermartRouter().ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/openapi.yaml", nil))
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "application/yaml", w.Header().Get("Content-Type"))
+	assert.Equal(t, api.OpenAPISpec, w.Body.Bytes())
+}
@@ -0,0 +1,78 @@
+package app
+
+import (
+	"github.com/AndreyKuskov2/gophermart/internal/grpcserver"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+)
+
+type services struct {
+	user      *service.GophermartUserService
+	order     *service.GophermartOrderService
+	cancel    *service.GophermartCancelOrderService
+	balance   *service.GophermartUserBalanceService
+	withdraw  *service.GophermartWithdrawService
+	audit     *service.GophermartAuditService
+	account   *service.GophermartAccountService
+	statement *service.GophermartStatementService
+	transfer  *service.GophermartTransferService
+	campaign  *service.GophermartCampaignService
+	referral  *service.GophermartReferralService
+	tier      *service.GophermartTierService
+}
+
+func (app *App) newServices() *services {
+	auditService := service.NewGophermartAuditService(app.Storage, app.Log)
+	referralService := service.NewGophermartReferralService(app.Storage, auditService, models.ReferralReward{
+		ReferrerBonus: app.Cfg.ReferralReferrerBonus,
+		RefereeBonus:  app.Cfg.ReferralRefereeBonus,
+	}, app.Log)
+	tierService := service.NewGophermartTierService(app.Storage, auditService, app.Cfg.LoyaltyTiers, app.Cfg.TierWindow(), app.Log)
+	orderNumbers := app.orderNumberValidators()
+	return &services{
+		user:      service.NewGophermartUserService(app.Storage, auditService, referralService, app.Log),
+		order:     service.NewGophermartOrderService(app.Storage, app.Storage, orderNumbers, auditService, app.Log),
+		cancel:    service.NewGophermartCancelOrderService(app.Storage, app.Cfg.ClawbackPolicy, app.Publisher, auditService, app.Log),
+		balance:   service.NewGophermartUserBalanceService(app.Storage, tierService, app.Log),
+		withdraw:  service.NewGophermartWithdrawService(app.Storage, app.Storage, orderNumbers, auditService, app.Log),
+		audit:     auditService,
+		account:   service.NewGophermartAccountService(app.Storage, auditService, app.Cfg.DeletionGracePeriod(), app.Log),
+		statement: service.NewGophermartStatementService(app.Storage, app.Log),
+		transfer: service.NewGophermartTransferService(app.Storage, auditService, models.TransferLimit{
+			MaxAmount: app.Cfg.TransferDailyLimit,
+			MaxCount:  app.Cfg.TransferDailyCount,
+		}, app.Log),
+		campaign: service.NewGophermartCampaignService(app.Storage, auditService, app.Log),
+		referral: referralService,
+		tier:     tierService,
+	}
+}
+
+// orderNumberValidators builds the validators of the order number rules of
+// every tenant. Config.Validate rejects invalid rules, a tenant left with
+// them anyway gets the default validator.
+func (app *App) orderNumberValidators() service.OrderNumberValidators {
+	validators := service.OrderNumberValidators{}
+	for _, t := range app.Cfg.AllTenants() {
+		v, err := app.Cfg.OrderNumberRules(t).Validator()
+		if err != nil {
+			app.Log.Log.Error("invalid order number rules, using the default ones", zap.String("tenant", t.ID), zap.Error(err))
+			continue
+		}
+		validators[t.ID] = v
+	}
+	return validators
+}
+
+func (app *App) GophermartGRPCServer() *grpc.Server {
+	services := app.services
+	return grpcserver.NewGRPCServer(grpcserver.Services{
+		User:     services.user,
+		Order:    services.order,
+		Balance:  services.balance,
+		Withdraw: services.withdraw,
+		Events:   app.Events,
+	}, app.Cfg, app.Log)
+}
@@ -0,0 +1,59 @@
+package app
+
+import (
+	"context"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type TierRecalculateServicer interface {
+	RecalculateTiersService(ctx context.Context) (int, error)
+}
+
+// TierRecalculator periodically recalculates the loyalty tiers of the users
+// of every tenant.
+type TierRecalculator struct {
+	service   TierRecalculateServicer
+	tenantIDs []string
+	interval  time.Duration
+	log       *logger.Logger
+}
+
+func NewTierRecalculator(service TierRecalculateServicer, tenantIDs []string, interval time.Duration, log *logger.Logger) *TierRecalculator {
+	return &TierRecalculator{
+		service:   service,
+		tenantIDs: tenantIDs,
+		interval:  interval,
+		log:       log,
+	}
+}
+
+func (r *TierRecalculator) Run(ctx context.Context) {
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+
+	for {
+		r.Recalculate(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (r *TierRecalculator) Recalculate(ctx context.Context) {
+	for _, id := range r.tenantIDs {
+		changed, err := r.service.RecalculateTiersService(tenant.WithID(ctx, id))
+		if err != nil {
+			r.log.Log.Error("cannot recalculate loyalty tiers", zap.String("tenant", id), zap.Error(err))
+		}
+		if changed > 0 {
+			r.log.Log.Info("recalculated loyalty tiers", zap.String("tenant", id), zap.Int("changed", changed))
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func chain(t *testing.T, n int) []models.AuditEvent {
+	t.Helper()
+
+	userID := 7
+	events := make([]models.AuditEvent, n)
+	prevHash := ""
+	for i := range events {
+		events[i] = models.AuditEvent{
+			EventID:   int64(i + 1),
+			EventType: EventWithdrawal,
+			UserID:    &userID,
+			IP:        "10.0.0.1",
+			Details:   json.RawMessage(`{"sum":50}`),
+			CreatedAt: Timestamp(time.Date(2026, 1, 1, 0, 0, i, 0, time.UTC)),
+			PrevHash:  prevHash,
+		}
+		events[i].Hash = Hash(prevHash, &events[i])
+		prevHash = events[i].Hash
+	}
+	return events
+}
+
+func TestHash(t *testing.T) {
+	event := chain(t, 1)[0]
+	assert.Len(t, event.Hash, 64)
+	assert.Equal(t, event.Hash, Hash("", &event), "hash is deterministic")
+
+	other := event
+	other.EventID = 42
+	assert.Equal(t, event.Hash, Hash("", &other), "event id is not covered")
+
+	other = event
+	other.CreatedAt = event.CreatedAt.In(time.FixedZone("UTC+3", 3*60*60))
+	assert.Equal(t, event.Hash, Hash("", &other), "time zone does not matter")
+
+	// Moving a character between adjacent fields must change the hash.
+	other = event
+	other.IP, other.UserAgent = "10.0.0.", "1"
+	assert.NotEqual(t, event.Hash, Hash("", &other))
+
+	other = event
+	other.UserID = nil
+	assert.NotEqual(t, event.Hash, Hash("", &other))
+
+	assert.NotEqual(t, event.Hash, Hash("previous", &event))
+}
+
+func TestVerify(t *testing.T) {
+	assert.Equal(t, models.AuditChainStatus{Valid: true}, Verify(nil))
+	assert.Equal(t, models.AuditChainStatus{Valid: true, Checked: 3}, Verify(chain(t, 3)))
+
+	tests := []struct {
+		name   string
+		tamper func(events []models.AuditEvent) []models.AuditEvent
+		broken int64
+	}{
+		{
+			name: "modified details",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[1].Details = json.RawMessage(`{"sum":5}`)
+				return events
+			},
+			broken: 2,
+		},
+		{
+			name: "deleted event",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				return append(events[:1], events[2:]...)
+			},
+			broken: 3,
+		},
+		{
+			name: "rehashed event",
+			tamper: func(events []models.AuditEvent) []models.AuditEvent {
+				events[0].IP = "10.0.0.2"
+				events[0].Hash = Hash("", &events[0])
+				return events
+			},
+			broken: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			status := Verify(tt.tamper(chain(t, 3)))
+			assert.False(t, status.Valid)
+			require.NotNil(t, status.BrokenEventID)
+			assert.Equal(t, tt.broken, *status.BrokenEventID)
+		})
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	assert.Equal(t, Metadata{}, MetadataFromContext(context.Background()))
+
+	metadata := Metadata{IP: "10.0.0.1", UserAgent: "curl/8.0", RequestID: "req-1"}
+	assert.Equal(t, metadata, MetadataFromContext(WithMetadata(context.Background(), metadata)))
+}
+
+func TestUserID(t *testing.T) {
+	require.NotNil(t, UserID("7"))
+	assert.Equal(t, 7, *UserID("7"))
+	assert.Nil(t, UserID(""))
+	assert.Nil(t, UserID("abc"))
+}
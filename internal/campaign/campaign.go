@@ -0,0 +1,214 @@
+// Package campaign evaluates the rules of local bonus campaigns. A campaign
+// grants a bonus on top of the accrual of a processed order: a multiplier of
+// the accrual on some weekdays or a fixed amount for the first order of a
+// user. The bonuses of a campaign are capped per user and calendar month.
+package campaign
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+)
+
+const (
+	// RuleMultiplier grants accrual × (multiplier − 1), so that the order
+	// earns multiplier times its accrual, for the orders uploaded on
+	// weekdays in timezone. No weekdays means every day.
+	RuleMultiplier = "multiplier"
+	// RuleFirstOrder grants amount for the first processed order of a user.
+	RuleFirstOrder = "first_order"
+
+	maxNameLength = 128
+)
+
+var weekdays = map[string]time.Weekday{
+	"sunday":    time.Sunday,
+	"monday":    time.Monday,
+	"tuesday":   time.Tuesday,
+	"wednesday": time.Wednesday,
+	"thursday":  time.Thursday,
+	"friday":    time.Friday,
+	"saturday":  time.Saturday,
+}
+
+// Facts are what a rule is evaluated against.
+type Facts struct {
+	Order models.Orders
+	// PreviousOrders is the number of processed orders the user uploaded
+	// before Order.
+	PreviousOrders int
+}
+
+// Validate reports what is wrong with the campaign, if anything.
+func Validate(c models.Campaign) error {
+	var errs []error
+	if c.Name == "" || len([]rune(c.Name)) > maxNameLength {
+		errs = append(errs, fmt.Errorf("name must have 1 to %d characters", maxNameLength))
+	}
+	if c.MonthlyCap < 0 {
+		errs = append(errs, errors.New("monthly_cap must not be negative"))
+	}
+	if c.EndsAt != nil && !c.EndsAt.After(c.StartsAt) {
+		errs = append(errs, errors.New("ends_at must be after starts_at"))
+	}
+
+	switch rule := c.Rule; rule.Type {
+	case RuleMultiplier:
+		if rule.Multiplier <= 1 {
+			errs = append(errs, errors.New("multiplier must be greater than 1"))
+		}
+		for _, day := range rule.Weekdays {
+			if _, ok := weekdays[strings.ToLower(day)]; !ok {
+				errs = append(errs, fmt.Errorf("unknown weekday %q", day))
+			}
+		}
+		if _, err := location(rule.Timezone); err != nil {
+			errs = append(errs, fmt.Errorf("unknown timezone %q", rule.Timezone))
+		}
+	case RuleFirstOrder:
+		if rule.Amount <= 0 {
+			errs = append(errs, errors.New("amount must be positive"))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown rule type %q", rule.Type))
+	}
+	return errors.Join(errs...)
+}
+
+// Active reports whether the campaign applies to an order uploaded at at.
+func Active(c models.Campaign, at time.Time) bool {
+	return c.Enabled && !at.Before(c.StartsAt) && (c.EndsAt == nil || at.Before(*c.EndsAt))
+}
+
+// Evaluate returns the bonus the rule of the campaign grants, rounded to
+// cents, before the limits of the campaign are applied.
+func Evaluate(c models.Campaign, facts Facts) float64 {
+	if facts.Order.Status != "PROCESSED" {
+		return 0
+	}
+
+	var bonus float64
+	switch rule := c.Rule; rule.Type {
+	case RuleMultiplier:
+		if !onWeekday(rule, facts.Order.UploadedAt) {
+			return 0
+		}
+		bonus = float64(facts.Order.Accrual) * (rule.Multiplier - 1)
+	case RuleFirstOrder:
+		if facts.PreviousOrders > 0 {
+			return 0
+		}
+		bonus = rule.Amount
+	}
+	return math.Round(bonus*100) / 100
+}
+
+// Limit returns the limits the bonuses of the campaign are granted under.
+func Limit(c models.Campaign) models.BonusLimit {
+	return models.BonusLimit{
+		MonthlyCap:  c.MonthlyCap,
+		OncePerUser: c.Rule.Type == RuleFirstOrder,
+	}
+}
+
+// Capped returns the part of bonus that can be granted to a user who has
+// got granted from the campaign this month.
+func Capped(limit models.BonusLimit, granted, bonus float64) float64 {
+	if limit.MonthlyCap <= 0 {
+		return bonus
+	}
+	return math.Max(0, math.Min(bonus, math.Round((limit.MonthlyCap-granted)*100)/100))
+}
+
+// MonthStart returns the start of the UTC month of t. Monthly caps are reset
+// then.
+func MonthStart(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+// Preview returns the bonuses the campaign would have granted for the
+// processed orders uploaded in [from, to). orders may contain older orders of
+// the same users, which only count as their history. The preview dates every
+// bonus by the upload of its order and ignores the bonuses granted before.
+func Preview(c models.Campaign, orders []models.Orders, from, to time.Time) models.CampaignPreview {
+	orders = slices.Clone(orders)
+	sort.SliceStable(orders, func(i, j int) bool {
+		if !orders[i].UploadedAt.Equal(orders[j].UploadedAt) {
+			return orders[i].UploadedAt.Before(orders[j].UploadedAt)
+		}
+		return orders[i].OrderID < orders[j].OrderID
+	})
+
+	type monthKey struct {
+		userID int
+		month  time.Time
+	}
+
+	preview := models.CampaignPreview{From: from, To: to, Bonuses: []models.Bonus{}}
+	limit := Limit(c)
+	previous := map[int]int{}
+	rewarded := map[int]bool{}
+	granted := map[monthKey]float64{}
+	users := map[int]bool{}
+	for _, order := range orders {
+		facts := Facts{Order: order, PreviousOrders: previous[order.UserID]}
+		previous[order.UserID]++
+		if order.UploadedAt.Before(from) || !order.UploadedAt.Before(to) {
+			continue
+		}
+		preview.Orders++
+		users[order.UserID] = true
+
+		if !Active(c, order.UploadedAt) || (limit.OncePerUser && rewarded[order.UserID]) {
+			continue
+		}
+		key := monthKey{userID: order.UserID, month: MonthStart(order.UploadedAt)}
+		bonus := Capped(limit, granted[key], Evaluate(c, facts))
+		if bonus <= 0 {
+			continue
+		}
+		granted[key] += bonus
+		rewarded[order.UserID] = true
+		preview.TotalBonus = math.Round((preview.TotalBonus+bonus)*100) / 100
+		preview.Bonuses = append(preview.Bonuses, models.Bonus{
+			UserID:      order.UserID,
+			OrderNumber: order.Number,
+			CampaignID:  c.CampaignID,
+			Amount:      bonus,
+			CreatedAt:   order.UploadedAt,
+		})
+	}
+	preview.Users = len(users)
+	return preview
+}
+
+func onWeekday(rule models.CampaignRule, at time.Time) bool {
+	if len(rule.Weekdays) == 0 {
+		return true
+	}
+	loc, err := location(rule.Timezone)
+	if err != nil {
+		return false
+	}
+	day := at.In(loc).Weekday()
+	for _, name := range rule.Weekdays {
+		if weekdays[strings.ToLower(name)] == day {
+			return true
+		}
+	}
+	return false
+}
+
+func location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	return time.LoadLocation(name)
+}
@@ -0,0 +1,184 @@
+package campaign
+
+import (
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	// 2026-03-07 is a Saturday.
+	saturday = time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC)
+	monday   = time.Date(2026, 3, 9, 12, 0, 0, 0, time.UTC)
+)
+
+func weekendCampaign() models.Campaign {
+	return models.Campaign{
+		CampaignID: 1,
+		Name:       "Double weekend",
+		Rule:       models.CampaignRule{Type: RuleMultiplier, Multiplier: 2, Weekdays: []string{"saturday", "Sunday"}},
+		StartsAt:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Enabled:    true,
+	}
+}
+
+func firstOrderCampaign() models.Campaign {
+	return models.Campaign{
+		CampaignID: 2,
+		Name:       "Welcome",
+		Rule:       models.CampaignRule{Type: RuleFirstOrder, Amount: 50},
+		StartsAt:   time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC),
+		Enabled:    true,
+	}
+}
+
+func processed(number string, userID int, accrual float32, uploadedAt time.Time) models.Orders {
+	return models.Orders{Number: number, UserID: userID, Status: "PROCESSED", Accrual: accrual, UploadedAt: uploadedAt}
+}
+
+func TestValidate(t *testing.T) {
+	endsBeforeStart := weekendCampaign()
+	endsAt := endsBeforeStart.StartsAt.Add(-time.Hour)
+	endsBeforeStart.EndsAt = &endsAt
+
+	tests := []struct {
+		name   string
+		modify func(c *models.Campaign)
+		errMsg string
+	}{
+		{name: "valid multiplier", modify: func(c *models.Campaign) {}},
+		{name: "valid first order", modify: func(c *models.Campaign) { *c = firstOrderCampaign() }},
+		{name: "no name", modify: func(c *models.Campaign) { c.Name = "" }, errMsg: "name"},
+		{name: "negative cap", modify: func(c *models.Campaign) { c.MonthlyCap = -1 }, errMsg: "monthly_cap"},
+		{name: "ends before start", modify: func(c *models.Campaign) { *c = endsBeforeStart }, errMsg: "ends_at"},
+		{name: "multiplier too small", modify: func(c *models.Campaign) { c.Rule.Multiplier = 1 }, errMsg: "multiplier"},
+		{name: "unknown weekday", modify: func(c *models.Campaign) { c.Rule.Weekdays = []string{"caturday"} }, errMsg: "caturday"},
+		{name: "unknown timezone", modify: func(c *models.Campaign) { c.Rule.Timezone = "Mars/Olympus_Mons" }, errMsg: "timezone"},
+		{name: "no amount", modify: func(c *models.Campaign) { *c = firstOrderCampaign(); c.Rule.Amount = 0 }, errMsg: "amount"},
+		{name: "unknown type", modify: func(c *models.Campaign) { c.Rule.Type = "lottery" }, errMsg: "lottery"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := weekendCampaign()
+			tt.modify(&c)
+			err := Validate(c)
+			if tt.errMsg == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.errMsg)
+		})
+	}
+}
+
+func TestActive(t *testing.T) {
+	c := weekendCampaign()
+	endsAt := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	c.EndsAt = &endsAt
+
+	assert.True(t, Active(c, c.StartsAt), "the start is inclusive")
+	assert.False(t, Active(c, c.StartsAt.Add(-time.Second)))
+	assert.False(t, Active(c, endsAt), "the end is exclusive")
+
+	c.Enabled = false
+	assert.False(t, Active(c, saturday))
+}
+
+func TestEvaluate_Multiplier(t *testing.T) {
+	c := weekendCampaign()
+
+	assert.Equal(t, 100.5, Evaluate(c, Facts{Order: processed("1", 1, 100.5, saturday)}))
+	assert.Zero(t, Evaluate(c, Facts{Order: processed("1", 1, 100.5, monday)}))
+
+	c.Rule.Multiplier = 1.5
+	assert.Equal(t, 33.34, Evaluate(c, Facts{Order: processed("1", 1, 66.68, saturday)}), "bonuses are rounded to cents")
+
+	// Saturday 23:30 UTC is already Sunday in Moscow and Friday 20:00 UTC
+	// is still Friday there.
+	c.Rule.Timezone = "Europe/Moscow"
+	assert.NotZero(t, Evaluate(c, Facts{Order: processed("1", 1, 10, time.Date(2026, 3, 7, 23, 30, 0, 0, time.UTC))}))
+	assert.Zero(t, Evaluate(c, Facts{Order: processed("1", 1, 10, time.Date(2026, 3, 6, 20, 0, 0, 0, time.UTC))}))
+
+	c.Rule.Weekdays = nil
+	assert.NotZero(t, Evaluate(c, Facts{Order: processed("1", 1, 10, monday)}), "no weekdays means every day")
+
+	order := processed("1", 1, 10, saturday)
+	order.Status = "PROCESSING"
+	assert.Zero(t, Evaluate(c, Facts{Order: order}))
+}
+
+func TestEvaluate_FirstOrder(t *testing.T) {
+	c := firstOrderCampaign()
+
+	assert.Equal(t, float64(50), Evaluate(c, Facts{Order: processed("1", 1, 0, monday)}))
+	assert.Zero(t, Evaluate(c, Facts{Order: processed("2", 1, 10, monday), PreviousOrders: 1}))
+}
+
+func TestCapped(t *testing.T) {
+	assert.Equal(t, float64(80), Capped(models.BonusLimit{}, 1000, 80), "no cap")
+	assert.Equal(t, float64(80), Capped(models.BonusLimit{MonthlyCap: 100}, 0, 80))
+	assert.Equal(t, float64(20), Capped(models.BonusLimit{MonthlyCap: 100}, 80, 80))
+	assert.Zero(t, Capped(models.BonusLimit{MonthlyCap: 100}, 100, 80))
+	assert.Zero(t, Capped(models.BonusLimit{MonthlyCap: 100}, 120, 80))
+}
+
+func TestMonthStart(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+
+	assert.Equal(t, time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC), MonthStart(saturday))
+	assert.Equal(t, time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC), MonthStart(time.Date(2026, 3, 1, 1, 0, 0, 0, moscow)))
+}
+
+func TestPreview(t *testing.T) {
+	c := weekendCampaign()
+	c.MonthlyCap = 150
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	orders := []models.Orders{
+		processed("5", 1, 100, saturday.AddDate(0, 0, 35)),
+		processed("1", 1, 100, saturday),
+		processed("2", 1, 100, saturday.Add(time.Hour)),
+		processed("3", 1, 100, monday),
+		processed("4", 2, 30, saturday),
+		processed("0", 3, 100, saturday.AddDate(0, -1, 0)),
+	}
+	preview := Preview(c, orders, from, to)
+
+	assert.Equal(t, from, preview.From)
+	assert.Equal(t, 5, preview.Orders, "older orders are history only")
+	assert.Equal(t, 2, preview.Users)
+	require.Len(t, preview.Bonuses, 4)
+	assert.Equal(t, []string{"1", "4", "2", "5"}, []string{
+		preview.Bonuses[0].OrderNumber, preview.Bonuses[1].OrderNumber, preview.Bonuses[2].OrderNumber, preview.Bonuses[3].OrderNumber,
+	})
+	assert.Equal(t, float64(100), preview.Bonuses[0].Amount)
+	assert.Equal(t, float64(30), preview.Bonuses[1].Amount)
+	assert.Equal(t, float64(50), preview.Bonuses[2].Amount, "capped for the month")
+	assert.Equal(t, float64(100), preview.Bonuses[3].Amount, "the cap is reset the next month")
+	assert.Equal(t, 1, preview.Bonuses[0].CampaignID)
+	assert.Equal(t, float64(280), preview.TotalBonus)
+}
+
+func TestPreview_FirstOrder(t *testing.T) {
+	c := firstOrderCampaign()
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+
+	orders := []models.Orders{
+		processed("0", 1, 10, from.Add(-time.Hour)),
+		processed("1", 1, 10, saturday),
+		processed("2", 2, 10, saturday),
+		processed("3", 2, 10, monday),
+	}
+	preview := Preview(c, orders, from, to)
+
+	require.Len(t, preview.Bonuses, 1, "user 1 ordered before the period")
+	assert.Equal(t, "2", preview.Bonuses[0].OrderNumber)
+	assert.Equal(t, float64(50), preview.TotalBonus)
+}
@@ -4,49 +4,51 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
 	"net/http"
 	"net/url"
-	"strconv"
 
 	"github.com/AndreyKuskov2/gophermart/internal/models"
 )
 
+// Client looks orders up with the REST protocol of the gophermart accrual
+// system, GET /api/orders/{number}.
 type Client struct {
-	client  *http.Client
+	*httpClient
+	lookups *lookupPool
 	baseURL string
 }
 
+// NewClient returns a client with a transport of its own, which keeps the
+// connections to the accrual system open between polls. HTTP/2 is negotiated
+// when the accrual system is served over TLS.
 func NewClient(baseURL string) *Client {
-	return &Client{
-		client:  http.DefaultClient,
-		baseURL: baseURL,
+	c := &Client{
+		httpClient: newHTTPClient(),
+		baseURL:    baseURL,
 	}
+	c.lookups = newLookupPool(c.GetOrderInfo)
+	return c
 }
 
+// GetOrderInfo returns the order with its status normalized, nil for an
+// order unknown to the accrual system, or the seconds to wait before the
+// next request when the accrual system is busy.
 func (c *Client) GetOrderInfo(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error) {
 	path, err := url.JoinPath(c.baseURL, "api", "orders", orderNumber)
 	if err != nil {
 		return nil, 0, err
 	}
-	request, err := http.NewRequestWithContext(ctx, http.MethodGet, path, nil)
-	if err != nil {
-		return nil, 0, err
-	}
 
-	response, err := c.client.Do(request)
+	response, err := c.get(ctx, path)
 	if err != nil {
 		return nil, 0, err
 	}
 	defer response.Body.Close()
 
 	if response.StatusCode == http.StatusTooManyRequests {
-		retryAfterStr := response.Header.Get("Retry-After")
-		seconds, err := strconv.Atoi(retryAfterStr)
-		if err != nil {
-			return nil, 0, err
-		}
-
-		return nil, seconds, nil
+		seconds, err := retryAfter(response)
+		return nil, seconds, err
 	}
 
 	if response.StatusCode == http.StatusNoContent {
@@ -58,10 +60,36 @@ func (c *Client) GetOrderInfo(ctx context.Context, orderNumber string) (*models.
 		return nil, 0, errors.New("failed to get order info")
 	}
 
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+
 	var accrualResponse *models.AccrualResponse
-	if err = json.NewDecoder(response.Body).Decode(&accrualResponse); err != nil {
+	if err = json.Unmarshal(body, &accrualResponse); err != nil {
 		return nil, 0, err
 	}
+	if accrualResponse != nil {
+		accrualResponse.Raw = body
+		if accrualResponse.Status, err = normalizeStatus(gophermartStatuses, accrualResponse.Status); err != nil {
+			return nil, 0, err
+		}
+	}
 
 	return accrualResponse, 0, nil
 }
+
+// gophermartStatuses maps the statuses of the gophermart accrual system; an
+// order it has registered is already being processed from the point of view
+// of the user.
+var gophermartStatuses = map[string]string{
+	"REGISTERED": StatusProcessing,
+	"PROCESSING": StatusProcessing,
+	"INVALID":    StatusInvalid,
+	"PROCESSED":  StatusProcessed,
+}
+
+// GetOrdersInfo looks orderNumbers up as described by AccrualProvider.
+func (c *Client) GetOrdersInfo(ctx context.Context, orderNumbers []string, workers int, handle func(OrderInfo)) {
+	c.lookups.lookupOrders(ctx, orderNumbers, workers, handle)
+}
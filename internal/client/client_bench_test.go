@@ -0,0 +1,64 @@
+package client
+
+import (
+	"context"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+)
+
+// The accrual mock answers after a millisecond, roughly the round trip to an
+// accrual system in the same data center.
+func newBenchmarkClient(b *testing.B) *Client {
+	b.Helper()
+	mock := accrualmock.New()
+	mock.Default(accrualmock.Processed(10))
+	mock.SetLatency(time.Millisecond)
+	server := httptest.NewServer(mock)
+	b.Cleanup(server.Close)
+	return NewClient(server.URL)
+}
+
+func benchmarkOrderNumbers(n int) []string {
+	numbers := make([]string, n)
+	for i := range numbers {
+		numbers[i] = strconv.Itoa(1000000 + i)
+	}
+	return numbers
+}
+
+func BenchmarkGetOrderInfo(b *testing.B) {
+	client := newBenchmarkClient(b)
+	numbers := benchmarkOrderNumbers(b.N)
+
+	b.ResetTimer()
+	for _, number := range numbers {
+		if _, _, err := client.GetOrderInfo(context.Background(), number); err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "orders/s")
+}
+
+func BenchmarkGetOrdersInfo(b *testing.B) {
+	for _, workers := range []int{8, 32, 128} {
+		b.Run("workers="+strconv.Itoa(workers), func(b *testing.B) {
+			client := newBenchmarkClient(b)
+			numbers := benchmarkOrderNumbers(b.N)
+
+			b.ResetTimer()
+			client.GetOrdersInfo(context.Background(), numbers, workers, func(info OrderInfo) {
+				if info.Err != nil {
+					b.Error(info.Err)
+				}
+			})
+			b.ReportMetric(float64(b.N)/b.Elapsed().Seconds(), "orders/s")
+
+			stats := client.Stats()
+			b.ReportMetric(float64(stats.ConnectionsReused)/float64(stats.Requests), "reused/op")
+		})
+	}
+}
@@ -0,0 +1,179 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestClient(t *testing.T) (*Client, *accrualmock.Server) {
+	t.Helper()
+	mock := accrualmock.New()
+	server := httptest.NewServer(mock)
+	t.Cleanup(server.Close)
+	return NewClient(server.URL), mock
+}
+
+func TestGetOrderInfo_Processed(t *testing.T) {
+	client, mock := newTestClient(t)
+	mock.Script("79927398713", accrualmock.Processed(729.98))
+
+	response, retryAfter, err := client.GetOrderInfo(context.Background(), "79927398713")
+	require.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	require.NotNil(t, response)
+	assert.Equal(t, "79927398713", response.Order)
+	assert.Equal(t, "PROCESSED", response.Status)
+	assert.Equal(t, float32(729.98), response.Accrual)
+	assert.JSONEq(t, `{"order":"79927398713","status":"PROCESSED","accrual":729.98}`, string(response.Raw))
+}
+
+func TestGetOrderInfo_NoContent(t *testing.T) {
+	client, _ := newTestClient(t)
+
+	response, retryAfter, err := client.GetOrderInfo(context.Background(), "79927398713")
+	assert.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	assert.Nil(t, response)
+}
+
+func TestGetOrderInfo_TooManyRequests(t *testing.T) {
+	client, mock := newTestClient(t)
+	mock.Script("79927398713", accrualmock.TooManyRequests(60))
+
+	response, retryAfter, err := client.GetOrderInfo(context.Background(), "79927398713")
+	assert.NoError(t, err)
+	assert.Equal(t, 60, retryAfter)
+	assert.Nil(t, response)
+}
+
+func TestGetOrderInfo_Fault(t *testing.T) {
+	client, mock := newTestClient(t)
+	mock.Script("79927398713", accrualmock.Fault(http.StatusInternalServerError))
+
+	response, _, err := client.GetOrderInfo(context.Background(), "79927398713")
+	assert.Error(t, err)
+	assert.Nil(t, response)
+}
+
+func TestGetOrderInfo_ReusesConnections(t *testing.T) {
+	client, mock := newTestClient(t)
+	mock.Default(accrualmock.Processed(10))
+
+	for i := 0; i < 3; i++ {
+		_, _, err := client.GetOrderInfo(context.Background(), "79927398713")
+		require.NoError(t, err)
+	}
+
+	stats := client.Stats()
+	assert.Equal(t, int64(3), stats.Requests)
+	assert.Equal(t, int64(1), stats.ConnectionsOpened)
+	assert.Equal(t, int64(2), stats.ConnectionsReused)
+	assert.Zero(t, stats.HTTP2Requests)
+}
+
+func TestGetOrderInfo_HTTP2(t *testing.T) {
+	mock := accrualmock.New()
+	mock.Default(accrualmock.Processed(10))
+	server := httptest.NewUnstartedServer(mock)
+	server.EnableHTTP2 = true
+	server.StartTLS()
+	t.Cleanup(server.Close)
+
+	client := NewClient(server.URL)
+	client.client.Transport.(*http.Transport).TLSClientConfig = server.Client().Transport.(*http.Transport).TLSClientConfig
+
+	response, _, err := client.GetOrderInfo(context.Background(), "79927398713")
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.Equal(t, int64(1), client.Stats().HTTP2Requests)
+}
+
+func collectOrdersInfo(client AccrualProvider, ctx context.Context, numbers []string, workers int) map[string]OrderInfo {
+	var mu sync.Mutex
+	infos := map[string]OrderInfo{}
+	client.GetOrdersInfo(ctx, numbers, workers, func(info OrderInfo) {
+		mu.Lock()
+		defer mu.Unlock()
+		infos[info.Order] = info
+	})
+	return infos
+}
+
+func TestGetOrdersInfo(t *testing.T) {
+	client, mock := newTestClient(t)
+	mock.Script("79927398713", accrualmock.Processed(500))
+	mock.Script("12345678903", accrualmock.Invalid())
+	mock.Script("2377225624", accrualmock.Fault(http.StatusInternalServerError))
+
+	infos := collectOrdersInfo(client, context.Background(), []string{"79927398713", "12345678903", "2377225624", "4561261212345467"}, 2)
+
+	require.Len(t, infos, 4)
+	require.NotNil(t, infos["79927398713"].Response)
+	assert.Equal(t, float32(500), infos["79927398713"].Response.Accrual)
+	require.NotNil(t, infos["12345678903"].Response)
+	assert.Equal(t, "INVALID", infos["12345678903"].Response.Status)
+	assert.Error(t, infos["2377225624"].Err)
+	assert.Nil(t, infos["4561261212345467"].Response)
+	assert.NoError(t, infos["4561261212345467"].Err)
+}
+
+func TestGetOrdersInfo_TooManyRequests(t *testing.T) {
+	client, mock := newTestClient(t)
+	mock.Default(accrualmock.TooManyRequests(30))
+
+	infos := collectOrdersInfo(client, context.Background(), []string{"79927398713", "12345678903", "2377225624"}, 1)
+
+	require.Len(t, infos, 3)
+	for _, info := range infos {
+		assert.Equal(t, 30, info.RetryAfter)
+	}
+	assert.Equal(t, int64(1), client.Stats().Requests, "orders are not requested once the accrual system is busy")
+
+	infos = collectOrdersInfo(client, context.Background(), []string{"79927398713"}, 1)
+	assert.Positive(t, infos["79927398713"].RetryAfter)
+	assert.LessOrEqual(t, infos["79927398713"].RetryAfter, 30)
+	assert.Equal(t, int64(1), client.Stats().Requests, "later lookups wait for the Retry-After as well")
+}
+
+func TestGetOrdersInfo_Canceled(t *testing.T) {
+	client, _ := newTestClient(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	infos := collectOrdersInfo(client, ctx, []string{"79927398713", "12345678903"}, 2)
+
+	require.Len(t, infos, 2)
+	for _, info := range infos {
+		assert.ErrorIs(t, info.Err, context.Canceled)
+	}
+	assert.Zero(t, client.Stats().Requests)
+}
+
+func TestGetOrderInfo_NormalizesStatus(t *testing.T) {
+	client, mock := newTestClient(t)
+	mock.Script("79927398713", accrualmock.Registered())
+
+	response, _, err := client.GetOrderInfo(context.Background(), "79927398713")
+	require.NoError(t, err)
+	require.NotNil(t, response)
+	assert.Equal(t, StatusProcessing, response.Status, "registered orders are being processed")
+	assert.JSONEq(t, `{"order":"79927398713","status":"REGISTERED"}`, string(response.Raw))
+}
+
+func TestGetOrderInfo_UnknownStatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"order":"79927398713","status":"ARCHIVED"}`))
+	}))
+	t.Cleanup(server.Close)
+
+	_, _, err := NewClient(server.URL).GetOrderInfo(context.Background(), "79927398713")
+	assert.ErrorContains(t, err, `unknown order status "ARCHIVED"`)
+}
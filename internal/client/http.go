@@ -0,0 +1,104 @@
+package client
+
+import (
+	"context"
+	"expvar"
+	"net"
+	"net/http"
+	"net/http/httptrace"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+// clientMetrics are published under "accrual_client" by expvar, the totals
+// of all providers since the start of the process.
+var clientMetrics = expvar.NewMap("accrual_client")
+
+// Stats counts the requests of a provider and the connections they used.
+// A connection taken from the idle pool is reused, any other one is opened.
+type Stats struct {
+	Requests          int64
+	HTTP2Requests     int64
+	ConnectionsOpened int64
+	ConnectionsReused int64
+}
+
+// httpClient sends the requests of a provider over a transport of its own,
+// counting them and the connections they used.
+type httpClient struct {
+	client *http.Client
+
+	requests          atomic.Int64
+	http2Requests     atomic.Int64
+	connectionsOpened atomic.Int64
+	connectionsReused atomic.Int64
+}
+
+func newHTTPClient() *httpClient {
+	return &httpClient{client: &http.Client{Transport: newTransport()}}
+}
+
+func newTransport() *http.Transport {
+	return &http.Transport{
+		Proxy: http.ProxyFromEnvironment,
+		DialContext: (&net.Dialer{
+			Timeout:   10 * time.Second,
+			KeepAlive: 30 * time.Second,
+		}).DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          256,
+		MaxIdleConnsPerHost:   128,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+}
+
+func (c *httpClient) Stats() Stats {
+	return Stats{
+		Requests:          c.requests.Load(),
+		HTTP2Requests:     c.http2Requests.Load(),
+		ConnectionsOpened: c.connectionsOpened.Load(),
+		ConnectionsReused: c.connectionsReused.Load(),
+	}
+}
+
+func (c *httpClient) get(ctx context.Context, url string) (*http.Response, error) {
+	request, err := http.NewRequestWithContext(httptrace.WithClientTrace(ctx, c.trace()), http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	c.requests.Add(1)
+	clientMetrics.Add("requests", 1)
+	response, err := c.client.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	if response.ProtoMajor == 2 {
+		c.http2Requests.Add(1)
+		clientMetrics.Add("http2_requests", 1)
+	}
+	return response, nil
+}
+
+func (c *httpClient) trace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		GotConn: func(info httptrace.GotConnInfo) {
+			if info.Reused {
+				c.connectionsReused.Add(1)
+				clientMetrics.Add("connections_reused", 1)
+				return
+			}
+			c.connectionsOpened.Add(1)
+			clientMetrics.Add("connections_opened", 1)
+		},
+	}
+}
+
+// retryAfter returns the seconds of the Retry-After header of a 429
+// response.
+func retryAfter(response *http.Response) (int, error) {
+	return strconv.Atoi(response.Header.Get("Retry-After"))
+}
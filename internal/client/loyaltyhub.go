@@ -0,0 +1,99 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+)
+
+// LoyaltyHubClient looks orders up in a LoyaltyHub accrual system by
+// GET /v2/accruals/{number}, answered with
+//
+//	{"order_id": "79927398713", "state": "approved", "points": 500}
+//
+// or 404 Not Found for an order it does not know.
+type LoyaltyHubClient struct {
+	*httpClient
+	lookups *lookupPool
+	baseURL string
+}
+
+func NewLoyaltyHubClient(baseURL string) *LoyaltyHubClient {
+	c := &LoyaltyHubClient{
+		httpClient: newHTTPClient(),
+		baseURL:    baseURL,
+	}
+	c.lookups = newLookupPool(c.GetOrderInfo)
+	return c
+}
+
+type loyaltyHubAccrual struct {
+	OrderID string  `json:"order_id"`
+	State   string  `json:"state"`
+	Points  float32 `json:"points"`
+}
+
+// loyaltyHubStates maps the states of LoyaltyHub accruals. Only approved
+// accruals carry points.
+var loyaltyHubStates = map[string]string{
+	"received":    StatusNew,
+	"in_progress": StatusProcessing,
+	"on_hold":     StatusProcessing,
+	"approved":    StatusProcessed,
+	"rejected":    StatusInvalid,
+	"cancelled":   StatusInvalid,
+}
+
+// GetOrderInfo looks the order up as described by AccrualProvider.
+func (c *LoyaltyHubClient) GetOrderInfo(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error) {
+	path, err := url.JoinPath(c.baseURL, "v2", "accruals", orderNumber)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	response, err := c.get(ctx, path)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer response.Body.Close()
+
+	switch response.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, 0, nil
+	case http.StatusTooManyRequests:
+		seconds, err := retryAfter(response)
+		return nil, seconds, err
+	default:
+		return nil, 0, fmt.Errorf("failed to get order info: %s", response.Status)
+	}
+
+	body, err := io.ReadAll(response.Body)
+	if err != nil {
+		return nil, 0, err
+	}
+	var accrual loyaltyHubAccrual
+	if err := json.Unmarshal(body, &accrual); err != nil {
+		return nil, 0, err
+	}
+	status, err := normalizeStatus(loyaltyHubStates, accrual.State)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	accrualResponse := &models.AccrualResponse{Order: accrual.OrderID, Status: status, Raw: body}
+	if status == StatusProcessed {
+		accrualResponse.Accrual = accrual.Points
+	}
+	return accrualResponse, 0, nil
+}
+
+// GetOrdersInfo looks orderNumbers up as described by AccrualProvider.
+func (c *LoyaltyHubClient) GetOrdersInfo(ctx context.Context, orderNumbers []string, workers int, handle func(OrderInfo)) {
+	c.lookups.lookupOrders(ctx, orderNumbers, workers, handle)
+}
@@ -0,0 +1,102 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// newLoyaltyHubServer answers GET /v2/accruals/{number} with the accruals
+// by order number, 404 for the others.
+func newLoyaltyHubServer(t *testing.T, accruals map[string]string) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /v2/accruals/{number}", func(w http.ResponseWriter, r *http.Request) {
+		accrual, ok := accruals[r.PathValue("number")]
+		switch {
+		case !ok:
+			w.WriteHeader(http.StatusNotFound)
+		case accrual == "busy":
+			w.Header().Set("Retry-After", "30")
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			w.Header().Set("Content-Type", "application/json")
+			w.Write([]byte(accrual))
+		}
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestLoyaltyHubClient_GetOrderInfo(t *testing.T) {
+	server := newLoyaltyHubServer(t, map[string]string{
+		"79927398713":      `{"order_id":"79927398713","state":"approved","points":729.98}`,
+		"12345678903":      `{"order_id":"12345678903","state":"received","points":0}`,
+		"2377225624":       `{"order_id":"2377225624","state":"in_progress","points":120}`,
+		"4561261212345467": `{"order_id":"4561261212345467","state":"rejected","points":50}`,
+	})
+	client := NewLoyaltyHubClient(server.URL)
+
+	for _, test := range []struct {
+		order   string
+		status  string
+		accrual float32
+	}{
+		{order: "79927398713", status: StatusProcessed, accrual: 729.98},
+		{order: "12345678903", status: StatusNew},
+		{order: "2377225624", status: StatusProcessing},
+		{order: "4561261212345467", status: StatusInvalid},
+	} {
+		t.Run(test.status, func(t *testing.T) {
+			response, retryAfter, err := client.GetOrderInfo(context.Background(), test.order)
+			require.NoError(t, err)
+			assert.Zero(t, retryAfter)
+			require.NotNil(t, response)
+			assert.Equal(t, test.order, response.Order)
+			assert.Equal(t, test.status, response.Status)
+			assert.Equal(t, test.accrual, response.Accrual, "only approved accruals carry points")
+			assert.Contains(t, string(response.Raw), `"order_id":"`+test.order+`"`)
+		})
+	}
+}
+
+func TestLoyaltyHubClient_GetOrderInfo_Unknown(t *testing.T) {
+	client := NewLoyaltyHubClient(newLoyaltyHubServer(t, nil).URL)
+
+	response, retryAfter, err := client.GetOrderInfo(context.Background(), "79927398713")
+	assert.NoError(t, err)
+	assert.Zero(t, retryAfter)
+	assert.Nil(t, response)
+}
+
+func TestLoyaltyHubClient_GetOrderInfo_Errors(t *testing.T) {
+	client := NewLoyaltyHubClient(newLoyaltyHubServer(t, map[string]string{
+		"79927398713": "busy",
+		"12345678903": `{"order_id":"12345678903","state":"lost"}`,
+	}).URL)
+
+	_, retryAfter, err := client.GetOrderInfo(context.Background(), "79927398713")
+	assert.NoError(t, err)
+	assert.Equal(t, 30, retryAfter)
+
+	_, _, err = client.GetOrderInfo(context.Background(), "12345678903")
+	assert.ErrorContains(t, err, `unknown order status "lost"`)
+}
+
+func TestLoyaltyHubClient_GetOrdersInfo(t *testing.T) {
+	client := NewLoyaltyHubClient(newLoyaltyHubServer(t, map[string]string{
+		"79927398713": `{"order_id":"79927398713","state":"approved","points":500}`,
+	}).URL)
+
+	infos := collectOrdersInfo(client, context.Background(), []string{"79927398713", "12345678903"}, 2)
+	require.Len(t, infos, 2)
+	require.NotNil(t, infos["79927398713"].Response)
+	assert.Equal(t, float32(500), infos["79927398713"].Response.Accrual)
+	assert.Nil(t, infos["12345678903"].Response)
+	assert.Equal(t, int64(2), client.Stats().Requests)
+}
@@ -0,0 +1,242 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+)
+
+// The statuses of gophermart orders. Providers report the statuses of their
+// accrual systems as one of them.
+const (
+	StatusNew        = "NEW"
+	StatusProcessing = "PROCESSING"
+	StatusInvalid    = "INVALID"
+	StatusProcessed  = "PROCESSED"
+)
+
+// lookupTimeout bounds every request of a batch lookup.
+const lookupTimeout = 5 * time.Second
+
+var ErrUnknownProvider = errors.New("unknown accrual provider")
+
+// AccrualProvider looks orders up in an accrual system.
+type AccrualProvider interface {
+	// GetOrderInfo returns the order with its status normalized, nil for an
+	// order unknown to the accrual system, or the seconds to wait before
+	// the next request when the accrual system is busy.
+	GetOrderInfo(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error)
+	// GetOrdersInfo looks orderNumbers up over at most workers concurrent
+	// requests and calls handle with every outcome as soon as it arrives,
+	// from the goroutine that made the request. Once the accrual system
+	// asks to retry later, orders are handled with the seconds left to wait
+	// as RetryAfter without a request, in this call and in later ones until
+	// that time has passed. It returns when every order has been handled;
+	// orders left when ctx is done are handled with its error.
+	GetOrdersInfo(ctx context.Context, orderNumbers []string, workers int, handle func(OrderInfo))
+}
+
+// OrderInfo is the outcome of the lookup of one order of a batch, with the
+// values GetOrderInfo returns for it.
+type OrderInfo struct {
+	Order      string
+	Response   *models.AccrualResponse
+	RetryAfter int
+	Err        error
+}
+
+// ProviderFactory returns a provider talking to the accrual system at
+// baseURL.
+type ProviderFactory func(baseURL string) AccrualProvider
+
+var (
+	providersMu sync.RWMutex
+	providers   = map[string]ProviderFactory{}
+)
+
+// The providers of this package. ProviderGophermart is the protocol of the
+// gophermart accrual system and the default one.
+const (
+	ProviderGophermart = "gophermart"
+	ProviderLoyaltyHub = "loyaltyhub"
+)
+
+func init() {
+	RegisterProvider(ProviderGophermart, func(baseURL string) AccrualProvider { return NewClient(baseURL) })
+	RegisterProvider(ProviderLoyaltyHub, func(baseURL string) AccrualProvider { return NewLoyaltyHubClient(baseURL) })
+}
+
+// RegisterProvider makes a provider available under name, replacing the
+// one registered under it before.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providersMu.Lock()
+	defer providersMu.Unlock()
+	providers[name] = factory
+}
+
+// NewProvider returns the provider registered under name for the accrual
+// system at baseURL.
+func NewProvider(name, baseURL string) (AccrualProvider, error) {
+	providersMu.RLock()
+	factory, ok := providers[name]
+	providersMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q", ErrUnknownProvider, name)
+	}
+	return factory(baseURL), nil
+}
+
+// ProviderNames returns the names of the registered providers, sorted.
+func ProviderNames() []string {
+	providersMu.RLock()
+	defer providersMu.RUnlock()
+	names := make([]string, 0, len(providers))
+	for name := range providers {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+// normalizeStatus maps status, a status of an accrual system, to a
+// gophermart status by statuses.
+func normalizeStatus(statuses map[string]string, status string) (string, error) {
+	normalized, ok := statuses[status]
+	if !ok {
+		return "", fmt.Errorf("unknown order status %q", status)
+	}
+	return normalized, nil
+}
+
+// lookupPool implements GetOrdersInfo for providers looking orders up one
+// by one with get. Its workers live as long as the provider, so a poll hands
+// its orders over to them rather than starting goroutines of its own. The
+// pool is resized to the workers of every batch; batches looked up at the
+// same time share its workers. The Retry-After of the accrual system is kept
+// by the pool, so a busy accrual system holds back its own provider only.
+type lookupPool struct {
+	get       func(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error)
+	jobs      chan lookupJob
+	quit      chan struct{}
+	busyUntil atomic.Int64
+
+	mu      sync.Mutex
+	workers int
+}
+
+type lookupJob struct {
+	ctx    context.Context
+	number string
+	batch  *lookupBatch
+}
+
+// lookupBatch tracks the orders of one GetOrdersInfo call.
+type lookupBatch struct {
+	handle func(OrderInfo)
+	done   sync.WaitGroup
+}
+
+func newLookupPool(get func(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error)) *lookupPool {
+	return &lookupPool{
+		get:  get,
+		jobs: make(chan lookupJob),
+		quit: make(chan struct{}),
+	}
+}
+
+func (p *lookupPool) lookupOrders(ctx context.Context, orderNumbers []string, workers int, handle func(OrderInfo)) {
+	p.resize(max(workers, 1))
+
+	batch := &lookupBatch{handle: handle}
+	batch.done.Add(len(orderNumbers))
+	for i, number := range orderNumbers {
+		select {
+		case p.jobs <- lookupJob{ctx: ctx, number: number, batch: batch}:
+		case <-ctx.Done():
+			// The workers may all be busy for good, the orders left are
+			// not handed over to them.
+			for _, number := range orderNumbers[i:] {
+				handle(OrderInfo{Order: number, Err: ctx.Err()})
+				batch.done.Done()
+			}
+			batch.done.Wait()
+			return
+		}
+	}
+	batch.done.Wait()
+}
+
+// resize starts or stops workers until workers are running. A worker stops
+// once it is done with the order it is looking up.
+func (p *lookupPool) resize(workers int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for ; p.workers < workers; p.workers++ {
+		go p.work()
+	}
+	for ; p.workers > workers; p.workers-- {
+		p.quit <- struct{}{}
+	}
+}
+
+func (p *lookupPool) work() {
+	for {
+		select {
+		case <-p.quit:
+			return
+		case job := <-p.jobs:
+			p.lookup(job)
+		}
+	}
+}
+
+func (p *lookupPool) lookup(job lookupJob) {
+	batch := job.batch
+	defer batch.done.Done()
+
+	if seconds := p.retryAfter(); seconds > 0 {
+		batch.handle(OrderInfo{Order: job.number, RetryAfter: seconds})
+		return
+	}
+	if err := job.ctx.Err(); err != nil {
+		batch.handle(OrderInfo{Order: job.number, Err: err})
+		return
+	}
+
+	reqCtx, cancel := context.WithTimeout(job.ctx, lookupTimeout)
+	response, seconds, err := p.get(reqCtx, job.number)
+	cancel()
+	if seconds > 0 {
+		p.backOff(seconds)
+	}
+	batch.handle(OrderInfo{Order: job.number, Response: response, RetryAfter: seconds, Err: err})
+}
+
+// retryAfter returns the seconds left until the accrual system may be asked
+// again, rounded up.
+func (p *lookupPool) retryAfter() int {
+	left := time.Until(time.Unix(0, p.busyUntil.Load()))
+	if left <= 0 {
+		return 0
+	}
+	return int((left + time.Second - 1) / time.Second)
+}
+
+// backOff keeps the accrual system from being asked for seconds, unless it
+// asked to wait longer before.
+func (p *lookupPool) backOff(seconds int) {
+	until := time.Now().Add(time.Duration(seconds) * time.Second).UnixNano()
+	for {
+		current := p.busyUntil.Load()
+		if current >= until || p.busyUntil.CompareAndSwap(current, until) {
+			return
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewProvider(t *testing.T) {
+	provider, err := NewProvider(ProviderGophermart, "http://accrual:8080")
+	require.NoError(t, err)
+	assert.IsType(t, &Client{}, provider)
+
+	provider, err = NewProvider(ProviderLoyaltyHub, "http://loyaltyhub:8080")
+	require.NoError(t, err)
+	assert.IsType(t, &LoyaltyHubClient{}, provider)
+
+	_, err = NewProvider("acme", "http://acme:8080")
+	assert.ErrorIs(t, err, ErrUnknownProvider)
+}
+
+func TestRegisterProvider(t *testing.T) {
+	stub := &stubProvider{}
+	RegisterProvider("stub", func(baseURL string) AccrualProvider { return stub })
+	t.Cleanup(func() {
+		providersMu.Lock()
+		delete(providers, "stub")
+		providersMu.Unlock()
+	})
+
+	assert.Equal(t, []string{ProviderGophermart, ProviderLoyaltyHub, "stub"}, ProviderNames())
+	provider, err := NewProvider("stub", "http://stub:8080")
+	require.NoError(t, err)
+	assert.Same(t, stub, provider)
+}
+
+func TestLookupPool_Resize(t *testing.T) {
+	var inFlight, peak atomic.Int32
+	pool := newLookupPool(func(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			p := peak.Load()
+			if n <= p || peak.CompareAndSwap(p, n) {
+				break
+			}
+		}
+		time.Sleep(10 * time.Millisecond)
+		return nil, 0, nil
+	})
+
+	numbers := make([]string, 8)
+	for i := range numbers {
+		numbers[i] = strconv.Itoa(i)
+	}
+	var handled atomic.Int32
+	count := func(OrderInfo) { handled.Add(1) }
+
+	pool.lookupOrders(context.Background(), numbers, 4, count)
+	assert.Equal(t, int32(8), handled.Load())
+	assert.LessOrEqual(t, peak.Load(), int32(4))
+	assert.Equal(t, 4, pool.workers)
+
+	peak.Store(0)
+	pool.lookupOrders(context.Background(), numbers, 1, count)
+	assert.Equal(t, int32(16), handled.Load())
+	assert.Equal(t, int32(1), peak.Load(), "the pool shrinks to the workers of the batch")
+	assert.Equal(t, 1, pool.workers)
+}
+
+func TestLookupPool_CanceledWhileWorkersAreBusy(t *testing.T) {
+	release := make(chan struct{})
+	pool := newLookupPool(func(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error) {
+		<-release
+		return nil, 0, nil
+	})
+	t.Cleanup(func() { close(release) })
+
+	// The only worker is stuck on the first order; the rest of the batch
+	// cannot be handed over.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var mu sync.Mutex
+	infos := map[string]OrderInfo{}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		pool.lookupOrders(ctx, []string{"1", "2", "3"}, 1, func(info OrderInfo) {
+			mu.Lock()
+			defer mu.Unlock()
+			infos[info.Order] = info
+		})
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	mu.Lock()
+	assert.ErrorIs(t, infos["2"].Err, context.DeadlineExceeded)
+	assert.ErrorIs(t, infos["3"].Err, context.DeadlineExceeded)
+	mu.Unlock()
+
+	release <- struct{}{}
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the lookup did not return")
+	}
+}
@@ -0,0 +1,68 @@
+package client
+
+import (
+	"cmp"
+	"context"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+)
+
+// Route sends the orders whose number starts with Prefix to Provider.
+type Route struct {
+	Prefix   string
+	Provider AccrualProvider
+}
+
+// Router is the provider of a tenant whose orders are split between accrual
+// systems: an order goes to the route with the longest prefix of its number,
+// or to the default provider when none matches.
+type Router struct {
+	fallback AccrualProvider
+	routes   []Route
+}
+
+func NewRouter(fallback AccrualProvider, routes ...Route) *Router {
+	routes = slices.Clone(routes)
+	slices.SortStableFunc(routes, func(a, b Route) int {
+		return cmp.Compare(len(b.Prefix), len(a.Prefix))
+	})
+	return &Router{fallback: fallback, routes: routes}
+}
+
+// ProviderFor returns the provider of the order orderNumber.
+func (r *Router) ProviderFor(orderNumber string) AccrualProvider {
+	for _, route := range r.routes {
+		if strings.HasPrefix(orderNumber, route.Prefix) {
+			return route.Provider
+		}
+	}
+	return r.fallback
+}
+
+func (r *Router) GetOrderInfo(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error) {
+	return r.ProviderFor(orderNumber).GetOrderInfo(ctx, orderNumber)
+}
+
+// GetOrdersInfo looks the orders of every provider up at the same time, with
+// up to workers requests in flight to each. A busy provider answers its own
+// orders with RetryAfter while the others are looked up as usual.
+func (r *Router) GetOrdersInfo(ctx context.Context, orderNumbers []string, workers int, handle func(OrderInfo)) {
+	batches := map[AccrualProvider][]string{}
+	for _, number := range orderNumbers {
+		provider := r.ProviderFor(number)
+		batches[provider] = append(batches[provider], number)
+	}
+
+	var wg sync.WaitGroup
+	for provider, numbers := range batches {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			provider.GetOrdersInfo(ctx, numbers, workers, handle)
+		}()
+	}
+	wg.Wait()
+}
@@ -0,0 +1,67 @@
+package client
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// stubProvider answers every order as processed with its accrual, recording
+// the orders it was asked for.
+type stubProvider struct {
+	accrual float32
+
+	mu     sync.Mutex
+	orders []string
+}
+
+func (p *stubProvider) GetOrderInfo(ctx context.Context, orderNumber string) (*models.AccrualResponse, int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.orders = append(p.orders, orderNumber)
+	return &models.AccrualResponse{Order: orderNumber, Status: StatusProcessed, Accrual: p.accrual}, 0, nil
+}
+
+func (p *stubProvider) GetOrdersInfo(ctx context.Context, orderNumbers []string, workers int, handle func(OrderInfo)) {
+	for _, number := range orderNumbers {
+		response, retryAfter, err := p.GetOrderInfo(ctx, number)
+		handle(OrderInfo{Order: number, Response: response, RetryAfter: retryAfter, Err: err})
+	}
+}
+
+func TestRouter_ProviderFor(t *testing.T) {
+	fallback, visa, visaGold := &stubProvider{}, &stubProvider{}, &stubProvider{}
+	router := NewRouter(fallback, Route{Prefix: "4", Provider: visa}, Route{Prefix: "4561", Provider: visaGold})
+
+	assert.Same(t, visaGold, router.ProviderFor("4561261212345467"), "the longest prefix wins")
+	assert.Same(t, visa, router.ProviderFor("4111111111111111"))
+	assert.Same(t, fallback, router.ProviderFor("79927398713"))
+}
+
+func TestRouter_GetOrderInfo(t *testing.T) {
+	fallback, visa := &stubProvider{accrual: 10}, &stubProvider{accrual: 20}
+	router := NewRouter(fallback, Route{Prefix: "4", Provider: visa})
+
+	response, _, err := router.GetOrderInfo(context.Background(), "4561261212345467")
+	require.NoError(t, err)
+	assert.Equal(t, float32(20), response.Accrual)
+	assert.Equal(t, []string{"4561261212345467"}, visa.orders)
+	assert.Empty(t, fallback.orders)
+}
+
+func TestRouter_GetOrdersInfo(t *testing.T) {
+	fallback, visa := &stubProvider{accrual: 10}, &stubProvider{accrual: 20}
+	router := NewRouter(fallback, Route{Prefix: "4", Provider: visa})
+
+	infos := collectOrdersInfo(router, context.Background(), []string{"79927398713", "4561261212345467", "12345678903", "4111111111111111"}, 2)
+
+	require.Len(t, infos, 4)
+	assert.Equal(t, float32(10), infos["79927398713"].Response.Accrual)
+	assert.Equal(t, float32(20), infos["4561261212345467"].Response.Accrual)
+	assert.ElementsMatch(t, []string{"79927398713", "12345678903"}, fallback.orders)
+	assert.ElementsMatch(t, []string{"4561261212345467", "4111111111111111"}, visa.orders)
+}
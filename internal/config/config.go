@@ -1,48 +1,413 @@
+// Package config builds the gophermart configuration.
+//
+// Values are taken from the following sources, each overriding the previous
+// one: built-in defaults, the config file, environment variables and command
+// line flags. The config file is set with --config/-c or CONFIG and may be
+// YAML (.yaml, .yml) or TOML (.toml); its keys are the snake_case names of
+// the flags, e.g. run_address or worker_count.
+//
+// Secrets can be read from files, e.g. Docker or Kubernetes secret mounts,
+// with the *_FILE variants: JWT_TOKEN_FILE and DATABASE_URI_FILE, the
+// matching flags and config file keys. A secret file wins over the inline
+// value from any source.
+//
+// Additional tenants, each with its own hosts, accrual system and jwt token,
+// are listed under the tenants key of the config file. The top-level accrual
+// system address, accrual provider, order number rules and jwt token belong
+// to the default tenant. Loyalty tiers, the order_number rules and the
+// accrual_routes sending orders to other accrual systems by their number are
+// likewise only read from the config file.
 package config
 
 import (
+	"errors"
 	"fmt"
+	"net/netip"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
+	"github.com/AndreyKuskov2/gophermart/internal/client"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tier"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/AndreyKuskov2/gophermart/pkg/validator"
 	"github.com/caarlos0/env"
 	"github.com/spf13/pflag"
+	"go.uber.org/zap/zapcore"
 )
 
 type Config struct {
-	RunAddress           string `env:"RUN_ADDRESS"`
-	DatabaseURI          string `env:"DATABASE_URI"`
-	AccrualSystemAddress string `env:"ACCRUAL_SYSTEM_ADDRESS"`
-	JWTSecretToken       string `env:"JWT_TOKEN"`
-	UpdateInterval       int    `env:"UPDATE_INTERVAL"`
-	WorkerCount          int    `env:"WORKER_COUNT"`
+	RunAddress            string          `env:"RUN_ADDRESS" yaml:"run_address" toml:"run_address"`
+	GRPCAddress           string          `env:"GRPC_ADDRESS" yaml:"grpc_address" toml:"grpc_address"`
+	TrustedProxies        []string        `env:"TRUSTED_PROXIES" yaml:"trusted_proxies" toml:"trusted_proxies"`
+	DatabaseURI           string          `env:"DATABASE_URI" yaml:"database_uri" toml:"database_uri"`
+	DatabaseURIFile       string          `env:"DATABASE_URI_FILE" yaml:"database_uri_file" toml:"database_uri_file"`
+	AccrualSystemAddress  string          `env:"ACCRUAL_SYSTEM_ADDRESS" yaml:"accrual_system_address" toml:"accrual_system_address"`
+	AccrualProvider       string          `env:"ACCRUAL_PROVIDER" yaml:"accrual_provider" toml:"accrual_provider"`
+	AccrualRoutes         []AccrualRoute  `yaml:"accrual_routes" toml:"accrual_routes"`
+	JWTSecretToken        string          `env:"JWT_TOKEN" yaml:"jwt_token" toml:"jwt_token"`
+	JWTSecretTokenFile    string          `env:"JWT_TOKEN_FILE" yaml:"jwt_token_file" toml:"jwt_token_file"`
+	UpdateInterval        int             `env:"UPDATE_INTERVAL" yaml:"update_interval" toml:"update_interval"`
+	WorkerCount           int             `env:"WORKER_COUNT" yaml:"worker_count" toml:"worker_count"`
+	StorageType           string          `env:"STORAGE_TYPE" yaml:"storage_type" toml:"storage_type"`
+	SkipMigrations        bool            `env:"SKIP_MIGRATIONS" yaml:"skip_migrations" toml:"skip_migrations"`
+	LogLevel              string          `env:"LOG_LEVEL" yaml:"log_level" toml:"log_level"`
+	LogEncoding           string          `env:"LOG_ENCODING" yaml:"log_encoding" toml:"log_encoding"`
+	LogOutputs            []string        `env:"LOG_OUTPUTS" yaml:"log_outputs" toml:"log_outputs"`
+	LogSamplingInitial    int             `env:"LOG_SAMPLING_INITIAL" yaml:"log_sampling_initial" toml:"log_sampling_initial"`
+	LogSamplingThereafter int             `env:"LOG_SAMPLING_THEREAFTER" yaml:"log_sampling_thereafter" toml:"log_sampling_thereafter"`
+	LogMaxSizeMB          int             `env:"LOG_MAX_SIZE_MB" yaml:"log_max_size_mb" toml:"log_max_size_mb"`
+	LogMaxBackups         int             `env:"LOG_MAX_BACKUPS" yaml:"log_max_backups" toml:"log_max_backups"`
+	LogMaxAgeDays         int             `env:"LOG_MAX_AGE_DAYS" yaml:"log_max_age_days" toml:"log_max_age_days"`
+	LogCompress           bool            `env:"LOG_COMPRESS" yaml:"log_compress" toml:"log_compress"`
+	Mode                  string          `env:"MODE" yaml:"mode" toml:"mode"`
+	AdminUserIDs          []int           `env:"ADMIN_USER_IDS" yaml:"admin_user_ids" toml:"admin_user_ids"`
+	PartnerUserIDs        []int           `env:"PARTNER_USER_IDS" yaml:"partner_user_ids" toml:"partner_user_ids"`
+	ClawbackPolicy        string          `env:"CLAWBACK_POLICY" yaml:"clawback_policy" toml:"clawback_policy"`
+	DeletionGraceDays     int             `env:"DELETION_GRACE_DAYS" yaml:"deletion_grace_days" toml:"deletion_grace_days"`
+	TransferDailyLimit    float64         `env:"TRANSFER_DAILY_LIMIT" yaml:"transfer_daily_limit" toml:"transfer_daily_limit"`
+	TransferDailyCount    int             `env:"TRANSFER_DAILY_COUNT" yaml:"transfer_daily_count" toml:"transfer_daily_count"`
+	ReferralReferrerBonus float64         `env:"REFERRAL_REFERRER_BONUS" yaml:"referral_referrer_bonus" toml:"referral_referrer_bonus"`
+	ReferralRefereeBonus  float64         `env:"REFERRAL_REFEREE_BONUS" yaml:"referral_referee_bonus" toml:"referral_referee_bonus"`
+	LoyaltyTiers          []tier.Tier     `yaml:"loyalty_tiers" toml:"loyalty_tiers"`
+	OrderNumber           validator.Rules `yaml:"order_number" toml:"order_number"`
+	TierWindowDays        int             `env:"TIER_WINDOW_DAYS" yaml:"tier_window_days" toml:"tier_window_days"`
+	TierRecalcInterval    int             `env:"TIER_RECALC_INTERVAL" yaml:"tier_recalc_interval" toml:"tier_recalc_interval"`
+	ReconcileInterval     int             `env:"RECONCILE_INTERVAL" yaml:"reconcile_interval" toml:"reconcile_interval"`
+	ReconcileWindowHours  int             `env:"RECONCILE_WINDOW_HOURS" yaml:"reconcile_window_hours" toml:"reconcile_window_hours"`
+	ReconcileSample       int             `env:"RECONCILE_SAMPLE" yaml:"reconcile_sample" toml:"reconcile_sample"`
+	ReconcileAutoCorrect  bool            `env:"RECONCILE_AUTO_CORRECT" yaml:"reconcile_auto_correct" toml:"reconcile_auto_correct"`
+	Tenants               []Tenant        `yaml:"tenants" toml:"tenants"`
+
+	ConfigFile string   `env:"CONFIG" yaml:"-" toml:"-"`
+	Command    []string `yaml:"-" toml:"-"`
 }
 
-func NewConfig(log *logger.Logger) (*Config, error) {
-	var cfg Config
+const (
+	StorageTypePostgres = "postgres"
+	StorageTypeMemory   = "memory"
+
+	CommandMigrate   = "migrate"
+	CommandReconcile = "reconcile"
+
+	configFileFlag = "config"
+	configFileEnv  = "CONFIG"
+)
+
+func defaultConfig() Config {
+	return Config{
+		RunAddress:            "localhost:8000",
+		AccrualSystemAddress:  "http://localhost:8080",
+		AccrualProvider:       client.ProviderGophermart,
+		JWTSecretToken:        defaultJWTSecret,
+		UpdateInterval:        10,
+		WorkerCount:           5,
+		StorageType:           StorageTypePostgres,
+		LogLevel:              "info",
+		LogEncoding:           logger.EncodingJSON,
+		LogOutputs:            []string{logger.OutputStdout},
+		Mode:                  ModeDevelopment,
+		ClawbackPolicy:        models.ClawbackAllow,
+		DeletionGraceDays:     30,
+		TransferDailyLimit:    1000,
+		TransferDailyCount:    10,
+		ReferralReferrerBonus: 100,
+		ReferralRefereeBonus:  50,
+		LoyaltyTiers:          tier.Defaults(),
+		OrderNumber:           validator.Rules{Checksum: validator.ChecksumLuhn, MinLength: 1, MaxLength: validator.MaxLength},
+		TierWindowDays:        90,
+		TierRecalcInterval:    3600,
+		ReconcileInterval:     3600,
+		ReconcileWindowHours:  24,
+		ReconcileSample:       100,
+	}
+}
+
+func defineFlags(flags *pflag.FlagSet, cfg *Config, defaults Config) {
+	flags.StringVarP(&cfg.ConfigFile, configFileFlag, "c", "", "path to a YAML or TOML config file")
+	flags.StringVarP(&cfg.RunAddress, "run-address", "a", defaults.RunAddress, "run address")
+	flags.StringVarP(&cfg.GRPCAddress, "grpc-address", "g", defaults.GRPCAddress, "grpc server address, disabled when empty")
+	flags.StringSliceVar(&cfg.TrustedProxies, "trusted-proxies", defaults.TrustedProxies, "addresses or CIDR ranges of the reverse proxies whose X-Real-IP and X-Forwarded-For headers are trusted")
+	flags.StringVarP(&cfg.DatabaseURI, "database-uri", "d", defaults.DatabaseURI, "database uri")
+	flags.StringVar(&cfg.DatabaseURIFile, "database-uri-file", defaults.DatabaseURIFile, "file to read the database uri from")
+	flags.StringVarP(&cfg.AccrualSystemAddress, "accrual-system-address", "r", defaults.AccrualSystemAddress, "accrual system address")
+	flags.StringVar(&cfg.AccrualProvider, "accrual-provider", defaults.AccrualProvider, "protocol of the accrual system: "+strings.Join(client.ProviderNames(), " or "))
+	flags.StringVarP(&cfg.JWTSecretToken, "jwt-token", "j", defaults.JWTSecretToken, "jwt token")
+	flags.StringVar(&cfg.JWTSecretTokenFile, "jwt-token-file", defaults.JWTSecretTokenFile, "file to read the jwt token from")
+	flags.IntVarP(&cfg.UpdateInterval, "update-interval", "i", defaults.UpdateInterval, "update interval in seconds")
+	flags.IntVarP(&cfg.WorkerCount, "worker-count", "w", defaults.WorkerCount, "number of concurrent requests to each accrual system")
+	flags.StringVarP(&cfg.StorageType, "storage-type", "s", defaults.StorageType, "storage backend: postgres or memory")
+	flags.BoolVar(&cfg.SkipMigrations, "skip-migrations", defaults.SkipMigrations, "do not apply migrations on startup")
+	flags.StringVarP(&cfg.LogLevel, "log-level", "l", defaults.LogLevel, "log level: debug, info, warn or error")
+	flags.StringVar(&cfg.LogEncoding, "log-encoding", defaults.LogEncoding, "log encoding: json or console")
+	flags.StringSliceVar(&cfg.LogOutputs, "log-outputs", defaults.LogOutputs, "log outputs: stdout, stderr or file paths")
+	flags.IntVar(&cfg.LogSamplingInitial, "log-sampling-initial", defaults.LogSamplingInitial, "log the first N repeated messages per second, 0 disables sampling")
+	flags.IntVar(&cfg.LogSamplingThereafter, "log-sampling-thereafter", defaults.LogSamplingThereafter, "then log every Nth repeated message")
+	flags.IntVar(&cfg.LogMaxSizeMB, "log-max-size-mb", defaults.LogMaxSizeMB, "rotate log files at this size, 0 disables rotation")
+	flags.IntVar(&cfg.LogMaxBackups, "log-max-backups", defaults.LogMaxBackups, "number of rotated log files to keep, 0 keeps all")
+	flags.IntVar(&cfg.LogMaxAgeDays, "log-max-age-days", defaults.LogMaxAgeDays, "days to keep rotated log files, 0 keeps them forever")
+	flags.BoolVar(&cfg.LogCompress, "log-compress", defaults.LogCompress, "gzip rotated log files")
+	flags.StringVarP(&cfg.Mode, "mode", "m", defaults.Mode, "run mode: development or production")
+	flags.IntSliceVar(&cfg.AdminUserIDs, "admin-user-ids", defaults.AdminUserIDs, "ids of the users of the default tenant allowed to use the admin api")
+	flags.IntSliceVar(&cfg.PartnerUserIDs, "partner-user-ids", defaults.PartnerUserIDs, "ids of the users of the default tenant allowed to use the partner api")
+	flags.StringVar(&cfg.ClawbackPolicy, "clawback-policy", defaults.ClawbackPolicy, "clawback of cancelled orders the balance does not cover: allow, cap or reject")
+	flags.IntVar(&cfg.DeletionGraceDays, "deletion-grace-days", defaults.DeletionGraceDays, "days a deleted account is kept before it is purged")
+	flags.Float64Var(&cfg.TransferDailyLimit, "transfer-daily-limit", defaults.TransferDailyLimit, "points a user can transfer per UTC day, 0 disables the limit")
+	flags.IntVar(&cfg.TransferDailyCount, "transfer-daily-count", defaults.TransferDailyCount, "transfers a user can send per UTC day, 0 disables the limit")
+	flags.Float64Var(&cfg.ReferralReferrerBonus, "referral-referrer-bonus", defaults.ReferralReferrerBonus, "points a user gets when a referred user's first order is processed")
+	flags.Float64Var(&cfg.ReferralRefereeBonus, "referral-referee-bonus", defaults.ReferralRefereeBonus, "points a referred user gets when their first order is processed")
+	flags.IntVar(&cfg.TierWindowDays, "tier-window-days", defaults.TierWindowDays, "days of accruals that decide the loyalty tier of a user")
+	flags.IntVar(&cfg.TierRecalcInterval, "tier-recalc-interval", defaults.TierRecalcInterval, "loyalty tier recalculation interval in seconds")
+	flags.IntVar(&cfg.ReconcileInterval, "reconcile-interval", defaults.ReconcileInterval, "reconciliation with the accrual system interval in seconds, 0 disables the job")
+	flags.IntVar(&cfg.ReconcileWindowHours, "reconcile-window-hours", defaults.ReconcileWindowHours, "hours of processed and invalid orders to reconcile")
+	flags.IntVar(&cfg.ReconcileSample, "reconcile-sample", defaults.ReconcileSample, "orders to reconcile per tenant and run, 0 checks all of them")
+	flags.BoolVar(&cfg.ReconcileAutoCorrect, "reconcile-auto-correct", defaults.ReconcileAutoCorrect, "update orders the accrual system holds a different final result for")
+}
 
-	pflag.StringVarP(&cfg.RunAddress, "run-address", "a", "localhost:8000", "run address")
-	pflag.StringVarP(&cfg.DatabaseURI, "database-uri", "d", "", "database uri")
-	pflag.StringVarP(&cfg.AccrualSystemAddress, "accrual-system-address", "r", "http://localhost:8080", "accrual system address")
-	pflag.StringVarP(&cfg.JWTSecretToken, "jwt-token", "j", "some-secret-token", "jwt token")
-	pflag.IntVarP(&cfg.UpdateInterval, "update-interval", "i", 10, "update interval in seconds")
-	pflag.IntVarP(&cfg.WorkerCount, "worker-count", "w", 5, "number of workers")
+func NewConfig(log *logger.Logger) (*Config, error) {
+	return Load(os.Args[1:])
+}
 
-	pflag.Parse()
+// Load builds and validates the configuration from command line arguments
+// and the sources described in the package documentation.
+func Load(args []string) (*Config, error) {
+	var parsed Config
+	flags := pflag.NewFlagSet("gophermart", pflag.ContinueOnError)
+	defineFlags(flags, &parsed, defaultConfig())
+	if err := flags.Parse(args); err != nil {
+		return nil, err
+	}
 
-	for _, arg := range pflag.Args() {
-		if !strings.HasPrefix(arg, "-") {
-			return nil, fmt.Errorf("unknown flag: %v", arg)
+	cfg := defaultConfig()
+	cfg.ConfigFile = os.Getenv(configFileEnv)
+	if flags.Changed(configFileFlag) {
+		cfg.ConfigFile = parsed.ConfigFile
+	}
+	if cfg.ConfigFile != "" {
+		if err := loadFile(cfg.ConfigFile, &cfg); err != nil {
+			return nil, err
 		}
 	}
 
 	if err := env.Parse(&cfg); err != nil {
-		return nil, fmt.Errorf("failed to get environment variable value")
+		return nil, fmt.Errorf("failed to get environment variable value: %w", err)
+	}
+
+	// Only flags set explicitly override the file and the environment, so
+	// they are replayed onto a flag set bound to the merged configuration.
+	overrides := pflag.NewFlagSet("gophermart", pflag.ContinueOnError)
+	defineFlags(overrides, &cfg, cfg)
+	var setErr error
+	flags.Visit(func(flag *pflag.Flag) {
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			setErr = errors.Join(setErr, overrides.Lookup(flag.Name).Value.(pflag.SliceValue).Replace(slice.GetSlice()))
+			return
+		}
+		if err := overrides.Set(flag.Name, flag.Value.String()); err != nil {
+			setErr = errors.Join(setErr, err)
+		}
+	})
+	if setErr != nil {
+		return nil, setErr
+	}
+
+	if err := cfg.loadSecrets(); err != nil {
+		return nil, err
 	}
 
-	if cfg.DatabaseURI == "" {
-		return nil, fmt.Errorf("database-uri is required")
+	cfg.Command = flags.Args()
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
 	}
 
 	return &cfg, nil
 }
+
+func (cfg *Config) LoggerOptions() logger.Options {
+	return logger.Options{
+		Level:    cfg.LogLevel,
+		Encoding: cfg.LogEncoding,
+		Outputs:  cfg.LogOutputs,
+		Sampling: logger.Sampling{
+			Initial:    cfg.LogSamplingInitial,
+			Thereafter: cfg.LogSamplingThereafter,
+		},
+		Rotation: logger.Rotation{
+			MaxSizeMB:  cfg.LogMaxSizeMB,
+			MaxBackups: cfg.LogMaxBackups,
+			MaxAgeDays: cfg.LogMaxAgeDays,
+			Compress:   cfg.LogCompress,
+		},
+	}
+}
+
+func (cfg *Config) DeletionGracePeriod() time.Duration {
+	return time.Duration(cfg.DeletionGraceDays) * 24 * time.Hour
+}
+
+// TierWindow is the rolling window of accruals loyalty tiers are computed
+// from.
+func (cfg *Config) TierWindow() time.Duration {
+	return time.Duration(cfg.TierWindowDays) * 24 * time.Hour
+}
+
+func (cfg *Config) TierRecalcPeriod() time.Duration {
+	return time.Duration(cfg.TierRecalcInterval) * time.Second
+}
+
+func (cfg *Config) ReconcilePeriod() time.Duration {
+	return time.Duration(cfg.ReconcileInterval) * time.Second
+}
+
+// ReconcileWindow is how far back orders are reconciled, by their upload.
+func (cfg *Config) ReconcileWindow() time.Duration {
+	return time.Duration(cfg.ReconcileWindowHours) * time.Hour
+}
+
+// TrustedProxyPrefixes returns the trusted proxies as prefixes, a single
+// address as a prefix of its own. Validate rejects the ones that cannot be
+// parsed, they are skipped here.
+func (cfg *Config) TrustedProxyPrefixes() []netip.Prefix {
+	prefixes := make([]netip.Prefix, 0, len(cfg.TrustedProxies))
+	for _, proxy := range cfg.TrustedProxies {
+		if prefix, err := parseProxy(proxy); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func parseProxy(proxy string) (netip.Prefix, error) {
+	if strings.Contains(proxy, "/") {
+		prefix, err := netip.ParsePrefix(proxy)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(proxy)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// IsAdmin reports whether the user of the tenant may use the admin api.
+// Rights go by user id rather than by login, which anyone can register.
+func (cfg *Config) IsAdmin(tenantID string, userID int) bool {
+	t, ok := cfg.TenantByID(tenantID)
+	return ok && slices.Contains(t.AdminUserIDs, userID)
+}
+
+// IsPartner reports whether the user of the tenant may use the partner api.
+func (cfg *Config) IsPartner(tenantID string, userID int) bool {
+	t, ok := cfg.TenantByID(tenantID)
+	return ok && slices.Contains(t.PartnerUserIDs, userID)
+}
+
+// Validate reports every problem of the configuration at once.
+func (cfg *Config) Validate() error {
+	var errs []error
+
+	if cfg.RunAddress == "" {
+		errs = append(errs, errors.New("run-address is required"))
+	}
+	if cfg.JWTSecretToken == "" {
+		errs = append(errs, errors.New("jwt-token is required"))
+	}
+	if cfg.UpdateInterval <= 0 {
+		errs = append(errs, fmt.Errorf("update-interval must be positive, got %d", cfg.UpdateInterval))
+	}
+	if cfg.WorkerCount <= 0 {
+		errs = append(errs, fmt.Errorf("worker-count must be positive, got %d", cfg.WorkerCount))
+	}
+	if cfg.TierWindowDays <= 0 {
+		errs = append(errs, fmt.Errorf("tier-window-days must be positive, got %d", cfg.TierWindowDays))
+	}
+	if cfg.TierRecalcInterval <= 0 {
+		errs = append(errs, fmt.Errorf("tier-recalc-interval must be positive, got %d", cfg.TierRecalcInterval))
+	}
+	if err := tier.Validate(cfg.LoyaltyTiers); err != nil {
+		errs = append(errs, fmt.Errorf("invalid loyalty_tiers: %w", err))
+	}
+	if _, err := cfg.OrderNumber.Validator(); err != nil {
+		errs = append(errs, fmt.Errorf("invalid order_number: %w", err))
+	}
+	for _, proxy := range cfg.TrustedProxies {
+		if _, err := parseProxy(proxy); err != nil {
+			errs = append(errs, fmt.Errorf("invalid trusted-proxies entry %q: %w", proxy, err))
+		}
+	}
+	if !slices.Contains(models.ClawbackPolicies, cfg.ClawbackPolicy) {
+		errs = append(errs, fmt.Errorf("clawback-policy must be one of %v, got %q", models.ClawbackPolicies, cfg.ClawbackPolicy))
+	}
+	errs = append(errs, cfg.validateSecrets()...)
+	errs = append(errs, cfg.validateTenants()...)
+	errs = append(errs, cfg.validateAccrualProviders()...)
+	if _, err := zapcore.ParseLevel(cfg.LogLevel); err != nil {
+		errs = append(errs, fmt.Errorf("invalid log-level: %q", cfg.LogLevel))
+	}
+	if cfg.LogEncoding != logger.EncodingJSON && cfg.LogEncoding != logger.EncodingConsole {
+		errs = append(errs, fmt.Errorf("invalid log-encoding: %q", cfg.LogEncoding))
+	}
+	if len(cfg.LogOutputs) == 0 {
+		errs = append(errs, errors.New("log-outputs must not be empty"))
+	}
+	for name, value := range map[string]int{
+		"log-sampling-initial":    cfg.LogSamplingInitial,
+		"log-sampling-thereafter": cfg.LogSamplingThereafter,
+		"log-max-size-mb":         cfg.LogMaxSizeMB,
+		"log-max-backups":         cfg.LogMaxBackups,
+		"log-max-age-days":        cfg.LogMaxAgeDays,
+		"deletion-grace-days":     cfg.DeletionGraceDays,
+		"transfer-daily-count":    cfg.TransferDailyCount,
+	} {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%v must not be negative, got %d", name, value))
+		}
+	}
+
+	for name, value := range map[string]float64{
+		"transfer-daily-limit":    cfg.TransferDailyLimit,
+		"referral-referrer-bonus": cfg.ReferralReferrerBonus,
+		"referral-referee-bonus":  cfg.ReferralRefereeBonus,
+	} {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%v must not be negative, got %v", name, value))
+		}
+	}
+
+	if cfg.ReconcileWindowHours <= 0 {
+		errs = append(errs, fmt.Errorf("reconcile-window-hours must be positive, got %d", cfg.ReconcileWindowHours))
+	}
+	for name, value := range map[string]int{
+		"reconcile-interval": cfg.ReconcileInterval,
+		"reconcile-sample":   cfg.ReconcileSample,
+	} {
+		if value < 0 {
+			errs = append(errs, fmt.Errorf("%v must not be negative, got %v", name, value))
+		}
+	}
+
+	if len(cfg.Command) > 0 && cfg.Command[0] != CommandMigrate && cfg.Command[0] != CommandReconcile {
+		errs = append(errs, fmt.Errorf("unknown command: %v", cfg.Command[0]))
+	}
+
+	switch cfg.StorageType {
+	case StorageTypePostgres:
+		if cfg.DatabaseURI == "" {
+			errs = append(errs, errors.New("database-uri is required"))
+		}
+	case StorageTypeMemory:
+		if len(cfg.Command) > 0 {
+			errs = append(errs, fmt.Errorf("%v command requires postgres storage", cfg.Command[0]))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown storage type: %v", cfg.StorageType))
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration: %w", errors.Join(errs...))
+	}
+	return nil
+}
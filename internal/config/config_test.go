@@ -0,0 +1,221 @@
+package config
+
+import (
+	"net/netip"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tier"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestLoad_Defaults(t *testing.T) {
+	cfg, err := Load([]string{"-d", "postgres://localhost/gophermart"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "localhost:8000", cfg.RunAddress)
+	assert.Equal(t, 10, cfg.UpdateInterval)
+	assert.Equal(t, 5, cfg.WorkerCount)
+	assert.Equal(t, StorageTypePostgres, cfg.StorageType)
+	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, 1000.0, cfg.TransferDailyLimit)
+	assert.Equal(t, 10, cfg.TransferDailyCount)
+	assert.Equal(t, 100.0, cfg.ReferralReferrerBonus)
+	assert.Equal(t, 50.0, cfg.ReferralRefereeBonus)
+	assert.Equal(t, tier.Defaults(), cfg.LoyaltyTiers)
+	assert.Equal(t, 90*24*time.Hour, cfg.TierWindow())
+	assert.Equal(t, time.Hour, cfg.ReconcilePeriod())
+	assert.Equal(t, 24*time.Hour, cfg.ReconcileWindow())
+	assert.Equal(t, 100, cfg.ReconcileSample)
+	assert.False(t, cfg.ReconcileAutoCorrect)
+	assert.Equal(t, models.ClawbackAllow, cfg.ClawbackPolicy)
+	assert.Empty(t, cfg.Command)
+}
+
+func TestLoad_Precedence(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+run_address: file:8000
+database_uri: postgres://file/gophermart
+worker_count: 2
+update_interval: 30
+log_level: debug
+`)
+	t.Setenv("WORKER_COUNT", "3")
+	t.Setenv("UPDATE_INTERVAL", "20")
+
+	cfg, err := Load([]string{"--config", path, "-i", "15"})
+	require.NoError(t, err)
+
+	assert.Equal(t, "file:8000", cfg.RunAddress, "file overrides defaults")
+	assert.Equal(t, "debug", cfg.LogLevel, "file overrides defaults")
+	assert.Equal(t, 3, cfg.WorkerCount, "env overrides file")
+	assert.Equal(t, 15, cfg.UpdateInterval, "flag overrides env")
+	assert.Equal(t, path, cfg.ConfigFile)
+}
+
+func TestLoad_ConfigFileFromEnv(t *testing.T) {
+	path := writeFile(t, "gophermart.toml", `
+storage_type = "memory"
+worker_count = 7
+grpc_address = "localhost:9000"
+`)
+	t.Setenv("CONFIG", path)
+
+	cfg, err := Load(nil)
+	require.NoError(t, err)
+
+	assert.Equal(t, StorageTypeMemory, cfg.StorageType)
+	assert.Equal(t, 7, cfg.WorkerCount)
+	assert.Equal(t, "localhost:9000", cfg.GRPCAddress)
+}
+
+func TestLoad_InvalidFile(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{name: "unknown yaml key", file: "gophermart.yaml", content: "workers: 3\n"},
+		{name: "unknown toml key", file: "gophermart.toml", content: "workers = 3\n"},
+		{name: "malformed yaml", file: "gophermart.yaml", content: "worker_count: [\n"},
+		{name: "unsupported format", file: "gophermart.json", content: "{}"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Load([]string{"-s", StorageTypeMemory, "-c", writeFile(t, tt.file, tt.content)})
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := Load([]string{"-s", StorageTypeMemory, "-c", filepath.Join(t.TempDir(), "missing.yaml")})
+	assert.Error(t, err)
+}
+
+func TestLoad_ReportsEveryValidationError(t *testing.T) {
+	_, err := Load([]string{"-w", "0", "-i", "-1", "--log-level", "loud", "--transfer-daily-limit", "-5", "--referral-referee-bonus", "-1", "--reconcile-sample", "-1", "--reconcile-window-hours", "0", "--clawback-policy", "forgive", "--trusted-proxies", "10.0.0.0/33", "-s", "postgres", "restore"})
+	require.Error(t, err)
+
+	for _, message := range []string{
+		"worker-count must be positive",
+		"update-interval must be positive",
+		"invalid log-level",
+		"transfer-daily-limit must not be negative",
+		"referral-referee-bonus must not be negative",
+		"reconcile-sample must not be negative",
+		"reconcile-window-hours must be positive",
+		"clawback-policy must be one of",
+		"invalid trusted-proxies entry",
+		"database-uri is required",
+		"unknown command: restore",
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestLoad_Command(t *testing.T) {
+	cfg, err := Load([]string{"-d", "postgres://localhost/gophermart", "migrate", "down", "2"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"migrate", "down", "2"}, cfg.Command)
+
+	cfg, err = Load([]string{"-d", "postgres://localhost/gophermart", "--reconcile-auto-correct", "reconcile"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"reconcile"}, cfg.Command)
+	assert.True(t, cfg.ReconcileAutoCorrect)
+
+	_, err = Load([]string{"-s", StorageTypeMemory, "migrate"})
+	assert.ErrorContains(t, err, "requires postgres storage")
+}
+
+func TestRestartRequired(t *testing.T) {
+	old := defaultConfig()
+	next := old
+	next.LogLevel = "debug"
+	next.WorkerCount = 10
+	next.UpdateInterval = 1
+	assert.Empty(t, RestartRequired(&old, &next))
+
+	next.RunAddress = "localhost:9000"
+	next.JWTSecretToken = "other"
+	assert.Equal(t, []string{"run_address", "jwt_token"}, RestartRequired(&old, &next))
+}
+
+func TestLoad_ExampleFile(t *testing.T) {
+	cfg, err := Load([]string{"-c", "../../configs/gophermart.example.yaml"})
+	require.NoError(t, err)
+	assert.Equal(t, "change-me", cfg.JWTSecretToken)
+}
+
+func TestLoad_Logging(t *testing.T) {
+	t.Setenv("LOG_OUTPUTS", "stdout,/var/log/gophermart.log")
+	t.Setenv("LOG_MAX_SIZE_MB", "100")
+
+	cfg, err := Load([]string{"-s", StorageTypeMemory, "--log-encoding", "console", "--log-sampling-initial", "10"})
+	require.NoError(t, err)
+
+	opts := cfg.LoggerOptions()
+	assert.Equal(t, "console", opts.Encoding)
+	assert.Equal(t, []string{"stdout", "/var/log/gophermart.log"}, opts.Outputs)
+	assert.Equal(t, 10, opts.Sampling.Initial)
+	assert.Equal(t, 100, opts.Rotation.MaxSizeMB)
+
+	cfg, err = Load([]string{"-s", StorageTypeMemory, "--log-outputs", "stderr,app.log"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"stderr", "app.log"}, cfg.LogOutputs, "flags override env")
+
+	_, err = Load([]string{"-s", StorageTypeMemory, "--log-encoding", "xml", "--log-max-backups", "-1"})
+	assert.ErrorContains(t, err, "invalid log-encoding")
+	assert.ErrorContains(t, err, "log-max-backups must not be negative")
+}
+
+func TestLoad_LoyaltyTiers(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+storage_type: memory
+tier_window_days: 30
+loyalty_tiers:
+  - name: member
+    min_accrual: 0
+    multiplier: 1
+  - name: vip
+    min_accrual: 200
+    multiplier: 1.5
+`)
+	cfg, err := Load([]string{"-c", path})
+	require.NoError(t, err)
+	assert.Equal(t, []tier.Tier{{Name: "member", Multiplier: 1}, {Name: "vip", MinAccrual: 200, Multiplier: 1.5}}, cfg.LoyaltyTiers,
+		"configured tiers replace the default ones")
+	assert.Equal(t, 30*24*time.Hour, cfg.TierWindow())
+
+	path = writeFile(t, "invalid.yaml", `
+storage_type: memory
+loyalty_tiers:
+  - name: vip
+    min_accrual: 200
+    multiplier: 1.5
+`)
+	_, err = Load([]string{"-c", path, "--tier-recalc-interval", "0"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid loyalty_tiers: tiers[0]: the first tier must start at 0")
+	assert.Contains(t, err.Error(), "tier-recalc-interval must be positive")
+}
+
+func TestConfig_TrustedProxyPrefixes(t *testing.T) {
+	cfg, err := Load([]string{"-s", StorageTypeMemory, "--trusted-proxies", "10.1.2.3/8,192.0.2.1,::1"})
+	require.NoError(t, err)
+	assert.Equal(t, []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("192.0.2.1/32"),
+		netip.MustParsePrefix("::1/128"),
+	}, cfg.TrustedProxyPrefixes())
+}
@@ -0,0 +1,40 @@
+package config
+
+import (
+	"reflect"
+	"strings"
+)
+
+// reloadable lists the fields that can be changed without a restart.
+var reloadable = map[string]bool{
+	"LogLevel":       true,
+	"UpdateInterval": true,
+	"WorkerCount":    true,
+}
+
+// RestartRequired returns the config file keys of the fields that differ
+// between old and next but are only applied on startup.
+func RestartRequired(old, next *Config) []string {
+	var changed []string
+
+	oldValue, nextValue := reflect.ValueOf(*old), reflect.ValueOf(*next)
+	for i := 0; i < oldValue.NumField(); i++ {
+		field := oldValue.Type().Field(i)
+		if reloadable[field.Name] {
+			continue
+		}
+		if !reflect.DeepEqual(oldValue.Field(i).Interface(), nextValue.Field(i).Interface()) {
+			changed = append(changed, fieldKey(field))
+		}
+	}
+
+	return changed
+}
+
+func fieldKey(field reflect.StructField) string {
+	key, _, _ := strings.Cut(field.Tag.Get("yaml"), ",")
+	if key == "" || key == "-" {
+		return field.Name
+	}
+	return key
+}
@@ -0,0 +1,144 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+)
+
+const (
+	ModeDevelopment = "development"
+	ModeProduction  = "production"
+
+	defaultJWTSecret   = "some-secret-token"
+	minJWTSecretLength = 32
+
+	redacted = "[REDACTED]"
+)
+
+var dsnPasswordPattern = regexp.MustCompile(`(password\s*=\s*)('(?:[^'\\]|\\.)*'|\S+)`)
+
+// loadSecrets replaces secrets with the contents of their *_FILE variants,
+// which take precedence over the inline values from any source.
+func (cfg *Config) loadSecrets() error {
+	var errs []error
+
+	secrets := []struct {
+		path  string
+		value *string
+	}{
+		{path: cfg.JWTSecretTokenFile, value: &cfg.JWTSecretToken},
+		{path: cfg.DatabaseURIFile, value: &cfg.DatabaseURI},
+	}
+	for i := range cfg.Tenants {
+		secrets = append(secrets, struct {
+			path  string
+			value *string
+		}{path: cfg.Tenants[i].JWTSecretTokenFile, value: &cfg.Tenants[i].JWTSecretToken})
+	}
+	for _, secret := range secrets {
+		if secret.path == "" {
+			continue
+		}
+		value, err := readSecretFile(secret.path)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		*secret.value = value
+	}
+
+	return errors.Join(errs...)
+}
+
+func readSecretFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", fmt.Errorf("cannot read secret file: %w", err)
+	}
+
+	value := strings.TrimRight(string(data), "\r\n")
+	if value == "" {
+		return "", fmt.Errorf("secret file %v is empty", path)
+	}
+	return value, nil
+}
+
+// WeakJWTSecret reports whether tokens are signed with the default or a too
+// short secret.
+func (cfg *Config) WeakJWTSecret() bool {
+	return weakJWTSecret(cfg.JWTSecretToken)
+}
+
+func weakJWTSecret(secret string) bool {
+	return secret == defaultJWTSecret || len(secret) < minJWTSecretLength
+}
+
+func (cfg *Config) validateSecrets() []error {
+	var errs []error
+
+	switch cfg.Mode {
+	case ModeDevelopment:
+	case ModeProduction:
+		if cfg.JWTSecretToken == defaultJWTSecret {
+			errs = append(errs, errors.New("jwt-token must not be the default value in production mode"))
+		} else if len(cfg.JWTSecretToken) < minJWTSecretLength {
+			errs = append(errs, fmt.Errorf("jwt-token must be at least %d characters long in production mode", minJWTSecretLength))
+		}
+	default:
+		errs = append(errs, fmt.Errorf("unknown mode: %v", cfg.Mode))
+	}
+
+	return errs
+}
+
+// Redacted returns a copy of the configuration that is safe to log.
+func (cfg Config) Redacted() Config {
+	if cfg.JWTSecretToken != "" {
+		cfg.JWTSecretToken = redacted
+	}
+	cfg.DatabaseURI = redactDatabaseURI(cfg.DatabaseURI)
+	// The tenants are copied, the slice is shared with the original.
+	tenants := make([]Tenant, len(cfg.Tenants))
+	for i, t := range cfg.Tenants {
+		if t.JWTSecretToken != "" {
+			t.JWTSecretToken = redacted
+		}
+		tenants[i] = t
+	}
+	cfg.Tenants = tenants
+	return cfg
+}
+
+func (cfg Config) String() string {
+	type plain Config
+	return fmt.Sprintf("%+v", plain(cfg.Redacted()))
+}
+
+func (cfg Config) GoString() string {
+	return cfg.String()
+}
+
+// redactDatabaseURI hides the password of both URL and keyword/value
+// connection strings.
+func redactDatabaseURI(uri string) string {
+	if uri == "" {
+		return uri
+	}
+
+	if u, err := url.Parse(uri); err == nil && u.Scheme != "" {
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		if query := u.Query(); query.Has("password") {
+			query.Set("password", redacted)
+			u.RawQuery = query.Encode()
+		}
+		return u.String()
+	}
+
+	return dsnPasswordPattern.ReplaceAllString(uri, "${1}"+redacted)
+}
@@ -0,0 +1,204 @@
+package config
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"net"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/AndreyKuskov2/gophermart/internal/client"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/validator"
+)
+
+// Tenant is a loyalty program served by the deployment. Requests are matched
+// to a tenant by the X-Tenant-ID header, the host name or the tenant claim of
+// the token. Tenants are only read from the config file.
+type Tenant struct {
+	ID                   string           `yaml:"id" toml:"id"`
+	Hosts                []string         `yaml:"hosts" toml:"hosts"`
+	AccrualSystemAddress string           `yaml:"accrual_system_address" toml:"accrual_system_address"`
+	AccrualProvider      string           `yaml:"accrual_provider" toml:"accrual_provider"`
+	AccrualRoutes        []AccrualRoute   `yaml:"accrual_routes" toml:"accrual_routes"`
+	OrderNumber          *validator.Rules `yaml:"order_number" toml:"order_number"`
+	JWTSecretToken       string           `yaml:"jwt_token" toml:"jwt_token"`
+	JWTSecretTokenFile   string           `yaml:"jwt_token_file" toml:"jwt_token_file"`
+	AdminUserIDs         []int            `yaml:"admin_user_ids" toml:"admin_user_ids"`
+	PartnerUserIDs       []int            `yaml:"partner_user_ids" toml:"partner_user_ids"`
+}
+
+// AccrualRoute sends the orders of a tenant whose number starts with Prefix
+// to another accrual system, spoken to with Provider or, when empty, the
+// provider of the tenant.
+type AccrualRoute struct {
+	Prefix               string `yaml:"prefix" toml:"prefix"`
+	Provider             string `yaml:"provider" toml:"provider"`
+	AccrualSystemAddress string `yaml:"accrual_system_address" toml:"accrual_system_address"`
+}
+
+// OrderNumberRules are the rules the order numbers of the tenant t follow,
+// the top-level ones unless the tenant has its own.
+func (cfg *Config) OrderNumberRules(t Tenant) validator.Rules {
+	if t.OrderNumber != nil {
+		return *t.OrderNumber
+	}
+	return cfg.OrderNumber
+}
+
+// ProviderName is the accrual provider of the tenant, the gophermart
+// protocol unless set.
+func (t Tenant) ProviderName() string {
+	return cmp.Or(t.AccrualProvider, client.ProviderGophermart)
+}
+
+var tenantIDPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9_-]{0,63}$`)
+
+// defaultTenant is built from the top-level settings so that single-tenant
+// deployments keep working unchanged.
+func (cfg *Config) defaultTenant() Tenant {
+	return Tenant{
+		ID:                   tenant.DefaultID,
+		AccrualSystemAddress: cfg.AccrualSystemAddress,
+		AccrualProvider:      cfg.AccrualProvider,
+		AccrualRoutes:        cfg.AccrualRoutes,
+		JWTSecretToken:       cfg.JWTSecretToken,
+		AdminUserIDs:         cfg.AdminUserIDs,
+		PartnerUserIDs:       cfg.PartnerUserIDs,
+	}
+}
+
+// AllTenants returns the default tenant followed by the configured ones.
+func (cfg *Config) AllTenants() []Tenant {
+	return append([]Tenant{cfg.defaultTenant()}, cfg.Tenants...)
+}
+
+func (cfg *Config) TenantIDs() []string {
+	ids := []string{tenant.DefaultID}
+	for _, t := range cfg.Tenants {
+		ids = append(ids, t.ID)
+	}
+	return ids
+}
+
+func (cfg *Config) TenantByID(id string) (Tenant, bool) {
+	for _, t := range cfg.AllTenants() {
+		if t.ID == id {
+			return t, true
+		}
+	}
+	return Tenant{}, false
+}
+
+// TenantJWTSecret returns the key the tokens of the tenant are signed with
+// or an empty string for an unknown tenant.
+func (cfg *Config) TenantJWTSecret(id string) string {
+	t, _ := cfg.TenantByID(id)
+	return t.JWTSecretToken
+}
+
+// TenantByHost matches host, with or without a port, against the host names
+// of the configured tenants.
+func (cfg *Config) TenantByHost(host string) (Tenant, bool) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	for _, t := range cfg.Tenants {
+		for _, h := range t.Hosts {
+			if strings.EqualFold(h, host) {
+				return t, true
+			}
+		}
+	}
+	return Tenant{}, false
+}
+
+func (cfg *Config) validateTenants() []error {
+	var errs []error
+
+	ids := map[string]bool{tenant.DefaultID: true}
+	hosts := map[string]string{}
+	for i, t := range cfg.Tenants {
+		switch {
+		case t.ID == tenant.DefaultID:
+			errs = append(errs, fmt.Errorf("tenants[%d]: id %q is reserved", i, t.ID))
+		case !tenantIDPattern.MatchString(t.ID):
+			errs = append(errs, fmt.Errorf("tenants[%d]: invalid id %q", i, t.ID))
+		case ids[t.ID]:
+			errs = append(errs, fmt.Errorf("tenants[%d]: duplicate id %q", i, t.ID))
+		}
+		ids[t.ID] = true
+
+		for _, host := range t.Hosts {
+			host = strings.ToLower(host)
+			if other, ok := hosts[host]; ok {
+				errs = append(errs, fmt.Errorf("tenants[%d]: host %q is already used by tenant %q", i, host, other))
+			}
+			hosts[host] = t.ID
+		}
+		if t.AccrualSystemAddress == "" {
+			errs = append(errs, fmt.Errorf("tenants[%d]: accrual_system_address is required", i))
+		}
+		if t.OrderNumber != nil {
+			if _, err := t.OrderNumber.Validator(); err != nil {
+				errs = append(errs, fmt.Errorf("tenants[%d]: invalid order_number: %w", i, err))
+			}
+		}
+		if t.JWTSecretToken == "" {
+			errs = append(errs, fmt.Errorf("tenants[%d]: jwt_token is required", i))
+		} else if cfg.Mode == ModeProduction && weakJWTSecret(t.JWTSecretToken) {
+			errs = append(errs, fmt.Errorf("tenants[%d]: jwt_token must be at least %d characters long in production mode", i, minJWTSecretLength))
+		}
+	}
+
+	if len(errs) > 0 {
+		return []error{errors.Join(errs...)}
+	}
+	return nil
+}
+
+var accrualRoutePrefixPattern = regexp.MustCompile(`^[0-9]+$`)
+
+// validateAccrualProviders checks the providers and routes of every tenant,
+// the top-level ones of the default tenant included.
+func (cfg *Config) validateAccrualProviders() []error {
+	var errs []error
+
+	known := client.ProviderNames()
+	for i, t := range cfg.AllTenants() {
+		field := func(name string) string {
+			if i == 0 {
+				return name
+			}
+			return fmt.Sprintf("tenants[%d]: %s", i-1, name)
+		}
+
+		if !slices.Contains(known, t.ProviderName()) {
+			errs = append(errs, fmt.Errorf("%s: unknown provider %q, want one of %v", field("accrual_provider"), t.AccrualProvider, known))
+		}
+		prefixes := map[string]bool{}
+		for j, r := range t.AccrualRoutes {
+			route := field(fmt.Sprintf("accrual_routes[%d]", j))
+			switch {
+			case !accrualRoutePrefixPattern.MatchString(r.Prefix):
+				errs = append(errs, fmt.Errorf("%s: prefix must be digits, got %q", route, r.Prefix))
+			case prefixes[r.Prefix]:
+				errs = append(errs, fmt.Errorf("%s: duplicate prefix %q", route, r.Prefix))
+			}
+			prefixes[r.Prefix] = true
+			if r.Provider != "" && !slices.Contains(known, r.Provider) {
+				errs = append(errs, fmt.Errorf("%s: unknown provider %q, want one of %v", route, r.Provider, known))
+			}
+			if r.AccrualSystemAddress == "" {
+				errs = append(errs, fmt.Errorf("%s: accrual_system_address is required", route))
+			}
+		}
+	}
+
+	if len(errs) > 0 {
+		return []error{errors.Join(errs...)}
+	}
+	return nil
+}
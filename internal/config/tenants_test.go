@@ -0,0 +1,228 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/pkg/validator"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoad_Tenants(t *testing.T) {
+	acmeSecret := writeFile(t, "acme", strongSecret+"\n")
+	path := writeFile(t, "gophermart.yaml", fmt.Sprintf(`
+storage_type: memory
+accrual_system_address: http://accrual:8080
+jwt_token: default-secret
+tenants:
+  - id: acme
+    hosts: [Loyalty.Acme.Example]
+    accrual_system_address: http://acme:8080
+    jwt_token_file: %s
+  - id: globex
+    accrual_system_address: http://globex:8080
+    jwt_token: globex-secret
+`, acmeSecret))
+
+	cfg, err := Load([]string{"-c", path})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"default", "acme", "globex"}, cfg.TenantIDs())
+	assert.Equal(t, "default-secret", cfg.TenantJWTSecret("default"))
+	assert.Equal(t, strongSecret, cfg.TenantJWTSecret("acme"))
+	assert.Equal(t, "globex-secret", cfg.TenantJWTSecret("globex"))
+	assert.Empty(t, cfg.TenantJWTSecret("initech"))
+
+	defaultTenant, ok := cfg.TenantByID("default")
+	require.True(t, ok)
+	assert.Equal(t, "http://accrual:8080", defaultTenant.AccrualSystemAddress)
+
+	acme, ok := cfg.TenantByHost("loyalty.acme.example:443")
+	require.True(t, ok)
+	assert.Equal(t, "acme", acme.ID)
+	_, ok = cfg.TenantByHost("localhost:8000")
+	assert.False(t, ok)
+}
+
+func TestLoad_TenantRoles(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+storage_type: memory
+jwt_token: default-secret
+admin_user_ids: [1]
+partner_user_ids: [2]
+tenants:
+  - id: acme
+    accrual_system_address: http://acme:8080
+    jwt_token: acme-secret
+    admin_user_ids: [3]
+`)
+
+	cfg, err := Load([]string{"-c", path, "--partner-user-ids", "2,4"})
+	require.NoError(t, err)
+
+	assert.True(t, cfg.IsAdmin("default", 1))
+	assert.False(t, cfg.IsAdmin("default", 3))
+	assert.True(t, cfg.IsAdmin("acme", 3))
+	assert.False(t, cfg.IsAdmin("acme", 1), "rights of the default tenant stay there")
+	assert.True(t, cfg.IsPartner("default", 4))
+	assert.False(t, cfg.IsPartner("acme", 2))
+	assert.False(t, cfg.IsAdmin("initech", 1))
+}
+
+func TestLoad_InvalidTenants(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+storage_type: memory
+mode: production
+jwt_token: `+strongSecret+`
+tenants:
+  - id: default
+    accrual_system_address: http://a:8080
+    jwt_token: `+strongSecret+`
+  - id: Acme
+    accrual_system_address: http://a:8080
+    jwt_token: `+strongSecret+`
+  - id: globex
+    hosts: [globex.example]
+    jwt_token: short
+  - id: globex
+    hosts: [GLOBEX.example]
+    accrual_system_address: http://a:8080
+`)
+
+	_, err := Load([]string{"-c", path})
+	require.Error(t, err)
+
+	for _, message := range []string{
+		`tenants[0]: id "default" is reserved`,
+		`tenants[1]: invalid id "Acme"`,
+		`tenants[2]: accrual_system_address is required`,
+		`tenants[2]: jwt_token must be at least 32 characters long`,
+		`tenants[3]: duplicate id "globex"`,
+		`tenants[3]: host "globex.example" is already used by tenant "globex"`,
+		`tenants[3]: jwt_token is required`,
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestConfig_RedactedTenants(t *testing.T) {
+	cfg := Config{Tenants: []Tenant{{ID: "acme", JWTSecretToken: strongSecret}}}
+
+	assert.False(t, strings.Contains(cfg.String(), strongSecret), cfg.String())
+	assert.Equal(t, strongSecret, cfg.Tenants[0].JWTSecretToken, "the original config is not modified")
+}
+
+func TestLoad_AccrualProviders(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+storage_type: memory
+accrual_system_address: http://accrual:8080
+accrual_routes:
+  - prefix: "4"
+    provider: loyaltyhub
+    accrual_system_address: http://loyaltyhub:8080
+tenants:
+  - id: acme
+    accrual_system_address: http://acme:8080
+    accrual_provider: loyaltyhub
+    jwt_token: acme-secret
+`)
+
+	cfg, err := Load([]string{"-c", path})
+	require.NoError(t, err)
+
+	defaultTenant, ok := cfg.TenantByID("default")
+	require.True(t, ok)
+	assert.Equal(t, "gophermart", defaultTenant.ProviderName())
+	assert.Equal(t, []AccrualRoute{{Prefix: "4", Provider: "loyaltyhub", AccrualSystemAddress: "http://loyaltyhub:8080"}}, defaultTenant.AccrualRoutes)
+
+	acme, ok := cfg.TenantByID("acme")
+	require.True(t, ok)
+	assert.Equal(t, "loyaltyhub", acme.ProviderName())
+
+	cfg, err = Load([]string{"-c", path, "--accrual-provider", "loyaltyhub"})
+	require.NoError(t, err)
+	assert.Equal(t, "loyaltyhub", cfg.AccrualProvider)
+}
+
+func TestLoad_InvalidAccrualProviders(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+storage_type: memory
+accrual_provider: acme
+accrual_routes:
+  - prefix: 4x
+    accrual_system_address: http://a:8080
+  - prefix: "5"
+    provider: globex
+tenants:
+  - id: acme
+    accrual_system_address: http://a:8080
+    jwt_token: acme-secret
+    accrual_routes:
+      - prefix: "4"
+        accrual_system_address: http://a:8080
+      - prefix: "4"
+        accrual_system_address: http://b:8080
+`)
+
+	_, err := Load([]string{"-c", path})
+	require.Error(t, err)
+
+	for _, message := range []string{
+		`accrual_provider: unknown provider "acme"`,
+		`accrual_routes[0]: prefix must be digits, got "4x"`,
+		`accrual_routes[1]: unknown provider "globex"`,
+		`accrual_routes[1]: accrual_system_address is required`,
+		`tenants[0]: accrual_routes[1]: duplicate prefix "4"`,
+	} {
+		assert.Contains(t, err.Error(), message)
+	}
+}
+
+func TestLoad_OrderNumberRules(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+storage_type: memory
+order_number:
+  max_length: 20
+tenants:
+  - id: acme
+    accrual_system_address: http://acme:8080
+    jwt_token: acme-secret
+    order_number:
+      checksum: damm
+      prefixes: ["5"]
+  - id: globex
+    accrual_system_address: http://globex:8080
+    jwt_token: globex-secret
+`)
+
+	cfg, err := Load([]string{"-c", path})
+	require.NoError(t, err)
+
+	defaultTenant, _ := cfg.TenantByID("default")
+	assert.Equal(t, validator.Rules{Checksum: "luhn", MinLength: 1, MaxLength: 20}, cfg.OrderNumberRules(defaultTenant))
+	acme, _ := cfg.TenantByID("acme")
+	assert.Equal(t, validator.Rules{Checksum: "damm", Prefixes: []string{"5"}}, cfg.OrderNumberRules(acme))
+	globex, _ := cfg.TenantByID("globex")
+	assert.Equal(t, cfg.OrderNumber, cfg.OrderNumberRules(globex), "tenants without rules use the top-level ones")
+}
+
+func TestLoad_InvalidOrderNumberRules(t *testing.T) {
+	path := writeFile(t, "gophermart.yaml", `
+storage_type: memory
+order_number:
+  max_length: 100
+tenants:
+  - id: acme
+    accrual_system_address: http://acme:8080
+    jwt_token: acme-secret
+    order_number:
+      checksum: crc32
+`)
+
+	_, err := Load([]string{"-c", path})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "invalid order_number: min_length and max_length must be within 1 and 64")
+	assert.Contains(t, err.Error(), `tenants[0]: invalid order_number: unknown checksum "crc32"`)
+}
@@ -0,0 +1,68 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+const subscriberBuffer = 16
+
+type OrderStatusChanged struct {
+	UserID    int       `json:"-"`
+	Number    string    `json:"number"`
+	Status    string    `json:"status"`
+	Accrual   float32   `json:"accrual,omitempty"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// Hub fans out order status changes to subscribers of the order owner.
+// Slow subscribers never block publishers: events that do not fit into the
+// subscriber buffer are dropped.
+type Hub struct {
+	mu          sync.RWMutex
+	subscribers map[int]map[chan OrderStatusChanged]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		subscribers: make(map[int]map[chan OrderStatusChanged]struct{}),
+	}
+}
+
+func (h *Hub) Publish(event OrderStatusChanged) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	for ch := range h.subscribers[event.UserID] {
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
+
+// Subscribe returns a channel with status changes of the user's orders and
+// a function that cancels the subscription and closes the channel.
+func (h *Hub) Subscribe(userID int) (<-chan OrderStatusChanged, func()) {
+	ch := make(chan OrderStatusChanged, subscriberBuffer)
+
+	h.mu.Lock()
+	if h.subscribers[userID] == nil {
+		h.subscribers[userID] = make(map[chan OrderStatusChanged]struct{})
+	}
+	h.subscribers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			delete(h.subscribers[userID], ch)
+			if len(h.subscribers[userID]) == 0 {
+				delete(h.subscribers, userID)
+			}
+			h.mu.Unlock()
+			close(ch)
+		})
+	}
+}
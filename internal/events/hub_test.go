@@ -0,0 +1,59 @@
+package events
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHub_DeliversToOwnerOnly(t *testing.T) {
+	hub := NewHub()
+	alice, cancelAlice := hub.Subscribe(1)
+	defer cancelAlice()
+	bob, cancelBob := hub.Subscribe(2)
+	defer cancelBob()
+
+	hub.Publish(OrderStatusChanged{UserID: 1, Number: "79927398713", Status: "PROCESSED", Accrual: 500})
+
+	event := <-alice
+	assert.Equal(t, "79927398713", event.Number)
+	assert.Equal(t, float32(500), event.Accrual)
+	assert.Empty(t, bob)
+}
+
+func TestHub_MultipleSubscribers(t *testing.T) {
+	hub := NewHub()
+	first, cancelFirst := hub.Subscribe(1)
+	defer cancelFirst()
+	second, cancelSecond := hub.Subscribe(1)
+	defer cancelSecond()
+
+	hub.Publish(OrderStatusChanged{UserID: 1, Number: "79927398713", Status: "PROCESSING"})
+
+	assert.Equal(t, "PROCESSING", (<-first).Status)
+	assert.Equal(t, "PROCESSING", (<-second).Status)
+}
+
+func TestHub_CancelClosesChannel(t *testing.T) {
+	hub := NewHub()
+	ch, cancel := hub.Subscribe(1)
+	cancel()
+	cancel()
+
+	_, ok := <-ch
+	assert.False(t, ok)
+
+	hub.Publish(OrderStatusChanged{UserID: 1})
+	assert.Empty(t, hub.subscribers)
+}
+
+func TestHub_SlowSubscriberDoesNotBlock(t *testing.T) {
+	hub := NewHub()
+	ch, cancel := hub.Subscribe(1)
+	defer cancel()
+
+	for i := 0; i < subscriberBuffer*2; i++ {
+		hub.Publish(OrderStatusChanged{UserID: 1})
+	}
+	assert.Len(t, ch, subscriberBuffer)
+}
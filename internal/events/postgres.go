@@ -0,0 +1,105 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"go.uber.org/zap"
+)
+
+const (
+	NotifyChannel = "order_status_changed"
+
+	notifyTimeout  = 5 * time.Second
+	listenRetryGap = time.Second
+)
+
+// notification is the NOTIFY payload. Unlike OrderStatusChanged it carries
+// the user id, which is needed to route the event on the receiving side.
+type notification struct {
+	UserID    int       `json:"user_id"`
+	Number    string    `json:"number"`
+	Status    string    `json:"status"`
+	Accrual   float32   `json:"accrual"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// PostgresNotifier broadcasts order status changes to every gophermart
+// instance connected to the same database via LISTEN/NOTIFY. Each instance
+// runs Listen to deliver the broadcasted events to its local Hub.
+type PostgresNotifier struct {
+	pool *pgxpool.Pool
+	log  *logger.Logger
+}
+
+func NewPostgresNotifier(pool *pgxpool.Pool, log *logger.Logger) *PostgresNotifier {
+	return &PostgresNotifier{
+		pool: pool,
+		log:  log,
+	}
+}
+
+func (n *PostgresNotifier) Publish(event OrderStatusChanged) {
+	payload, err := json.Marshal(notification(event))
+	if err != nil {
+		n.log.Log.Error("cannot marshal order status change", zap.Error(err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+	defer cancel()
+
+	if _, err := n.pool.Exec(ctx, "SELECT pg_notify($1, $2)", NotifyChannel, string(payload)); err != nil {
+		n.log.Log.Error("cannot notify order status change", zap.String("order_number", event.Number), zap.Error(err))
+	}
+}
+
+// Listen delivers broadcasted events to hub until ctx is done. Lost
+// connections are re-established; events sent in the meantime are lost.
+func (n *PostgresNotifier) Listen(ctx context.Context, hub *Hub) {
+	for {
+		err := n.listen(ctx, hub)
+		if ctx.Err() != nil {
+			return
+		}
+		n.log.Log.Error("order status listener failed", zap.Error(err))
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(listenRetryGap):
+		}
+	}
+}
+
+func (n *PostgresNotifier) listen(ctx context.Context, hub *Hub) error {
+	pooled, err := n.pool.Acquire(ctx)
+	if err != nil {
+		return err
+	}
+	// The connection stays subscribed to the channel, so it must not go back
+	// to the pool.
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	if _, err := conn.Exec(ctx, "LISTEN "+NotifyChannel); err != nil {
+		return err
+	}
+
+	for {
+		msg, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return err
+		}
+
+		var event notification
+		if err := json.Unmarshal([]byte(msg.Payload), &event); err != nil {
+			n.log.Log.Error("cannot parse order status change", zap.Error(err))
+			continue
+		}
+		hub.Publish(OrderStatusChanged(event))
+	}
+}
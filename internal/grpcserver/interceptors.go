@@ -0,0 +1,205 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/gophermartpb"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+type contextKey string
+
+const (
+	contextClaims contextKey = "claims"
+
+	authorizationMetadata = "authorization"
+	userAgentMetadata     = "user-agent"
+	requestIDMetadata     = "x-request-id"
+	tenantMetadata        = "x-tenant-id"
+	authorityMetadata     = ":authority"
+)
+
+var publicMethods = map[string]bool{
+	gophermartpb.GophermartService_Register_FullMethodName: true,
+	gophermartpb.GophermartService_Login_FullMethodName:    true,
+}
+
+func claimsFromContext(ctx context.Context) (*jwt.JWTClaims, error) {
+	claims, ok := ctx.Value(contextClaims).(*jwt.JWTClaims)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "no authorization token")
+	}
+	return claims, nil
+}
+
+// resolveTenant attaches the tenant named by the x-tenant-id metadata or
+// matched by the authority to the context, like the HTTP TenantResolver.
+func resolveTenant(ctx context.Context, cfg *config.Config, log *logger.Logger) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	var t config.Tenant
+	var ok bool
+	if values := md.Get(tenantMetadata); len(values) > 0 && values[0] != "" {
+		if t, ok = cfg.TenantByID(values[0]); !ok {
+			log.Ctx(ctx).Debug("unknown tenant", zap.String("tenant", values[0]))
+			return nil, status.Error(codes.InvalidArgument, "unknown tenant")
+		}
+	} else if values := md.Get(authorityMetadata); len(values) > 0 {
+		t, ok = cfg.TenantByHost(values[0])
+	}
+
+	if ok {
+		ctx = tenant.WithID(ctx, t.ID)
+		ctx = log.WithFields(ctx, zap.String("tenant", t.ID))
+	}
+	return ctx, nil
+}
+
+func UnaryTenantInterceptor(cfg *config.Config, log *logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		ctx, err := resolveTenant(ctx, cfg, log)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func StreamTenantInterceptor(cfg *config.Config, log *logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := resolveTenant(ss.Context(), cfg, log)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, cfg *config.Config, log *logger.Logger) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	tokens := md.Get(authorizationMetadata)
+	if len(tokens) == 0 || tokens[0] == "" {
+		log.Ctx(ctx).Debug("no authorization token")
+		return nil, status.Error(codes.Unauthenticated, "no authorization token")
+	}
+
+	tenantID, claims, err := tenant.VerifyToken(ctx, tokens[0], cfg.TenantJWTSecret)
+	if err != nil {
+		log.Ctx(ctx).Debug("invalid token", zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	ctx = context.WithValue(ctx, contextClaims, claims)
+	if _, resolved := tenant.FromContext(ctx); !resolved {
+		ctx = tenant.WithID(ctx, tenantID)
+		ctx = log.WithFields(ctx, zap.String("tenant", tenantID))
+	}
+	return log.WithFields(ctx, zap.String("user_id", claims.Subject)), nil
+}
+
+func UnaryAuthInterceptor(cfg *config.Config, log *logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if publicMethods[info.FullMethod] {
+			return handler(ctx, req)
+		}
+		ctx, err := authenticate(ctx, cfg, log)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+func StreamAuthInterceptor(cfg *config.Config, log *logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		if publicMethods[info.FullMethod] {
+			return handler(srv, ss)
+		}
+		ctx, err := authenticate(ss.Context(), cfg, log)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// UnaryAuditInterceptor attaches the caller address, user agent and request
+// id to the context for audit events recorded by the services.
+func UnaryAuditInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		var metadataValues audit.Metadata
+		if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+			metadataValues.IP = p.Addr.String()
+			if host, _, err := net.SplitHostPort(metadataValues.IP); err == nil {
+				metadataValues.IP = host
+			}
+		}
+		md, _ := metadata.FromIncomingContext(ctx)
+		if values := md.Get(userAgentMetadata); len(values) > 0 {
+			metadataValues.UserAgent = values[0]
+		}
+		if values := md.Get(requestIDMetadata); len(values) > 0 {
+			metadataValues.RequestID = values[0]
+		}
+		return handler(audit.WithMetadata(ctx, metadataValues), req)
+	}
+}
+
+func UnaryLogInterceptor(log *logger.Logger) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		start := time.Now()
+		ctx = log.WithFields(ctx, zap.String("grpc_method", info.FullMethod))
+		resp, err := handler(ctx, req)
+		log.Ctx(ctx).Log(callLevel(err), "grpc request",
+			zap.String("code", status.Code(err).String()),
+			zap.Duration("duration", time.Since(start)),
+		)
+		return resp, err
+	}
+}
+
+func StreamLogInterceptor(log *logger.Logger) grpc.StreamServerInterceptor {
+	return func(srv any, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		start := time.Now()
+		ctx := log.WithFields(ss.Context(), zap.String("grpc_method", info.FullMethod))
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		log.Ctx(ctx).Log(callLevel(err), "grpc stream",
+			zap.String("code", status.Code(err).String()),
+			zap.Duration("duration", time.Since(start)),
+		)
+		return err
+	}
+}
+
+// callLevel logs failed calls at error level only when the server is at
+// fault; client errors are routine.
+func callLevel(err error) zapcore.Level {
+	switch status.Code(err) {
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		return zap.ErrorLevel
+	default:
+		return zap.InfoLevel
+	}
+}
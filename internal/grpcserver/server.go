@@ -0,0 +1,301 @@
+package grpcserver
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/gophermartpb"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+type GophermartUserServicer interface {
+	RegisterUserService(ctx context.Context, user models.UserCreditials) (int, error)
+	GetUserService(ctx context.Context, user models.UserCreditials) (int, error)
+	IssueTokenService(ctx context.Context, userID int, secret string) (string, error)
+}
+
+type GophermartOrderServicer interface {
+	CreateNewOrderService(ctx context.Context, orderNumber string, userID string) error
+	GetOrdersService(ctx context.Context, userID string) ([]models.Orders, error)
+}
+
+type GophermartBalanceServicer interface {
+	GetUserBalanceService(ctx context.Context, userID string) (*models.Balance, error)
+}
+
+type GophermartWithdrawServicer interface {
+	WithdrawBalanceService(ctx context.Context, userID string, withdrawBalance *models.WithdrawBalanceRequest) error
+	GetWithdrawalService(ctx context.Context, userID string) ([]models.WithdrawBalance, error)
+}
+
+type OrderEventSubscriber interface {
+	Subscribe(userID int) (<-chan events.OrderStatusChanged, func())
+}
+
+type Services struct {
+	User     GophermartUserServicer
+	Order    GophermartOrderServicer
+	Balance  GophermartBalanceServicer
+	Withdraw GophermartWithdrawServicer
+	Events   OrderEventSubscriber
+}
+
+type GophermartServer struct {
+	gophermartpb.UnimplementedGophermartServiceServer
+
+	services Services
+	cfg      *config.Config
+	log      *logger.Logger
+}
+
+func NewGophermartServer(services Services, cfg *config.Config, log *logger.Logger) *GophermartServer {
+	return &GophermartServer{
+		services: services,
+		cfg:      cfg,
+		log:      log,
+	}
+}
+
+// NewGRPCServer returns a grpc.Server with the gophermart service registered
+// and the audit, logging, tenant and auth interceptors installed.
+func NewGRPCServer(services Services, cfg *config.Config, log *logger.Logger) *grpc.Server {
+	server := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(UnaryAuditInterceptor(), UnaryLogInterceptor(log), UnaryTenantInterceptor(cfg, log), UnaryAuthInterceptor(cfg, log)),
+		grpc.ChainStreamInterceptor(StreamLogInterceptor(log), StreamTenantInterceptor(cfg, log), StreamAuthInterceptor(cfg, log)),
+	)
+	gophermartpb.RegisterGophermartServiceServer(server, NewGophermartServer(services, cfg, log))
+	return server
+}
+
+// Stop stops server gracefully, but cancels the calls still running after
+// timeout: WatchOrders streams only end when their clients go away.
+func Stop(server *grpc.Server, timeout time.Duration) {
+	stopped := make(chan struct{})
+	go func() {
+		server.GracefulStop()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(timeout):
+		server.Stop()
+		<-stopped
+	}
+}
+
+func (gs *GophermartServer) Register(ctx context.Context, req *gophermartpb.RegisterRequest) (*gophermartpb.RegisterResponse, error) {
+	user := models.UserCreditials{Login: req.GetLogin(), Password: req.GetPassword()}
+	if user.Login == "" || user.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "login and password are required")
+	}
+
+	userID, err := gs.services.User.RegisterUserService(ctx, user)
+	if err != nil {
+		gs.log.Ctx(ctx).Debug(err.Error())
+		if errors.Is(err, storage.ErrUserIsExist) {
+			return nil, status.Error(codes.AlreadyExists, "login is already taken")
+		}
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	token, err := gs.token(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &gophermartpb.RegisterResponse{Token: token}, nil
+}
+
+func (gs *GophermartServer) Login(ctx context.Context, req *gophermartpb.LoginRequest) (*gophermartpb.LoginResponse, error) {
+	user := models.UserCreditials{Login: req.GetLogin(), Password: req.GetPassword()}
+	if user.Login == "" || user.Password == "" {
+		return nil, status.Error(codes.InvalidArgument, "login and password are required")
+	}
+
+	userID, err := gs.services.User.GetUserService(ctx, user)
+	if err != nil {
+		gs.log.Ctx(ctx).Debug(err.Error())
+		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, storage.ErrInvalidData) {
+			return nil, status.Error(codes.Unauthenticated, "invalid login or password")
+		}
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	token, err := gs.token(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	return &gophermartpb.LoginResponse{Token: token}, nil
+}
+
+func (gs *GophermartServer) token(ctx context.Context, userID int) (string, error) {
+	token, err := gs.services.User.IssueTokenService(ctx, userID, gs.cfg.TenantJWTSecret(tenant.ID(ctx)))
+	if err != nil {
+		gs.log.Ctx(ctx).Error("cannot create jwt token")
+		return "", status.Error(codes.Internal, "")
+	}
+	return token, nil
+}
+
+func (gs *GophermartServer) UploadOrder(ctx context.Context, req *gophermartpb.UploadOrderRequest) (*gophermartpb.UploadOrderResponse, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gs.services.Order.CreateNewOrderService(ctx, req.GetNumber(), claims.Subject); err != nil {
+		gs.log.Ctx(ctx).Debug("failed to add order", zap.Error(err))
+		switch {
+		case errors.Is(err, service.ErrNumberIsNotCorrect):
+			return nil, status.Error(codes.InvalidArgument, "invalid order number")
+		case errors.Is(err, service.ErrOrderAlreadyExists):
+			return &gophermartpb.UploadOrderResponse{AlreadyUploaded: true}, nil
+		case errors.Is(err, service.ErrOrderAlreadyExistsForAnotherUser):
+			return nil, status.Error(codes.AlreadyExists, "order is uploaded by another user")
+		default:
+			return nil, status.Error(codes.Internal, "")
+		}
+	}
+
+	return &gophermartpb.UploadOrderResponse{}, nil
+}
+
+func (gs *GophermartServer) ListOrders(ctx context.Context, _ *gophermartpb.ListOrdersRequest) (*gophermartpb.ListOrdersResponse, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := gs.services.Order.GetOrdersService(ctx, claims.Subject)
+	if err != nil {
+		gs.log.Ctx(ctx).Debug(err.Error())
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	resp := &gophermartpb.ListOrdersResponse{Orders: make([]*gophermartpb.Order, 0, len(orders))}
+	for _, order := range orders {
+		resp.Orders = append(resp.Orders, &gophermartpb.Order{
+			Number:     order.Number,
+			Status:     order.Status,
+			Accrual:    float64(order.Accrual),
+			UploadedAt: timestamppb.New(order.UploadedAt),
+		})
+	}
+	return resp, nil
+}
+
+func (gs *GophermartServer) GetBalance(ctx context.Context, _ *gophermartpb.GetBalanceRequest) (*gophermartpb.GetBalanceResponse, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	balance, err := gs.services.Balance.GetUserBalanceService(ctx, claims.Subject)
+	if err != nil {
+		gs.log.Ctx(ctx).Debug(err.Error())
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	return &gophermartpb.GetBalanceResponse{
+		Current:   balance.Current,
+		Withdrawn: float64(balance.Withdrawn),
+	}, nil
+}
+
+func (gs *GophermartServer) Withdraw(ctx context.Context, req *gophermartpb.WithdrawRequest) (*gophermartpb.WithdrawResponse, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if req.GetOrder() == "" || req.GetSum() <= 0 {
+		return nil, status.Error(codes.InvalidArgument, "order and positive sum are required")
+	}
+
+	withdraw := &models.WithdrawBalanceRequest{Order: req.GetOrder(), Sum: float32(req.GetSum())}
+	if err := gs.services.Withdraw.WithdrawBalanceService(ctx, claims.Subject, withdraw); err != nil {
+		gs.log.Ctx(ctx).Debug("failed to withdraw balance", zap.Error(err))
+		switch {
+		case errors.Is(err, service.ErrInvalidWithdrawSum):
+			return nil, status.Error(codes.FailedPrecondition, "insufficient funds")
+		case errors.Is(err, service.ErrNumberIsNotCorrect):
+			return nil, status.Error(codes.InvalidArgument, "invalid order number")
+		default:
+			return nil, status.Error(codes.Internal, "")
+		}
+	}
+
+	return &gophermartpb.WithdrawResponse{}, nil
+}
+
+func (gs *GophermartServer) ListWithdrawals(ctx context.Context, _ *gophermartpb.ListWithdrawalsRequest) (*gophermartpb.ListWithdrawalsResponse, error) {
+	claims, err := claimsFromContext(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	withdrawals, err := gs.services.Withdraw.GetWithdrawalService(ctx, claims.Subject)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		gs.log.Ctx(ctx).Debug(err.Error())
+		return nil, status.Error(codes.Internal, "")
+	}
+
+	resp := &gophermartpb.ListWithdrawalsResponse{Withdrawals: make([]*gophermartpb.Withdrawal, 0, len(withdrawals))}
+	for _, withdrawal := range withdrawals {
+		resp.Withdrawals = append(resp.Withdrawals, &gophermartpb.Withdrawal{
+			Order:       withdrawal.OrderNumber,
+			Sum:         float64(withdrawal.Amount),
+			ProcessedAt: timestamppb.New(withdrawal.ProcessedAt),
+		})
+	}
+	return resp, nil
+}
+
+func (gs *GophermartServer) WatchOrders(_ *gophermartpb.WatchOrdersRequest, stream grpc.ServerStreamingServer[gophermartpb.WatchOrdersResponse]) error {
+	claims, err := claimsFromContext(stream.Context())
+	if err != nil {
+		return err
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		return status.Error(codes.Unauthenticated, "invalid token")
+	}
+
+	changes, cancel := gs.services.Events.Subscribe(userID)
+	defer cancel()
+
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case event, ok := <-changes:
+			if !ok {
+				return nil
+			}
+			err := stream.Send(&gophermartpb.WatchOrdersResponse{
+				Number:    event.Number,
+				Status:    event.Status,
+				Accrual:   float64(event.Accrual),
+				ChangedAt: timestamppb.New(event.ChangedAt),
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,282 @@
+package grpcserver
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/gophermartpb"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+type grpcTestEnv struct {
+	server  *grpc.Server
+	client  gophermartpb.GophermartServiceClient
+	storage *storage.Memory
+	hub     *events.Hub
+}
+
+func newGRPCTestEnv(t *testing.T) *grpcTestEnv {
+	t.Helper()
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	memory := storage.NewMemory()
+	hub := events.NewHub()
+	auditor := service.NewGophermartAuditService(memory, log)
+	server := NewGRPCServer(Services{
+		User:     service.NewGophermartUserService(memory, auditor, nil, log),
+		Order:    service.NewGophermartOrderService(memory, memory, nil, auditor, log),
+		Balance:  service.NewGophermartUserBalanceService(memory, nil, log),
+		Withdraw: service.NewGophermartWithdrawService(memory, memory, nil, auditor, log),
+		Events:   hub,
+	}, &config.Config{
+		JWTSecretToken: "test-secret",
+		Tenants:        []config.Tenant{{ID: "acme", JWTSecretToken: "acme-secret"}},
+	}, log)
+
+	listener := bufconn.Listen(1 << 20)
+	go server.Serve(listener)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return &grpcTestEnv{
+		server:  server,
+		client:  gophermartpb.NewGophermartServiceClient(conn),
+		storage: memory,
+		hub:     hub,
+	}
+}
+
+func (env *grpcTestEnv) register(t *testing.T, login string) context.Context {
+	t.Helper()
+	resp, err := env.client.Register(context.Background(), &gophermartpb.RegisterRequest{Login: login, Password: "password"})
+	require.NoError(t, err)
+	return metadata.AppendToOutgoingContext(context.Background(), authorizationMetadata, resp.GetToken())
+}
+
+func TestGophermartServer_Auth(t *testing.T) {
+	env := newGRPCTestEnv(t)
+
+	_, err := env.client.ListOrders(context.Background(), &gophermartpb.ListOrdersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), authorizationMetadata, "bad-token")
+	_, err = env.client.GetBalance(ctx, &gophermartpb.GetBalanceRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	env.register(t, "user")
+	_, err = env.client.Register(context.Background(), &gophermartpb.RegisterRequest{Login: "user", Password: "password"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	_, err = env.client.Login(context.Background(), &gophermartpb.LoginRequest{Login: "user", Password: "wrong"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	resp, err := env.client.Login(context.Background(), &gophermartpb.LoginRequest{Login: "user", Password: "password"})
+	require.NoError(t, err)
+	assert.NotEmpty(t, resp.GetToken())
+}
+
+func TestGophermartServer_Tenants(t *testing.T) {
+	env := newGRPCTestEnv(t)
+	acme := metadata.AppendToOutgoingContext(context.Background(), tenantMetadata, "acme")
+
+	_, err := env.client.Register(metadata.AppendToOutgoingContext(context.Background(), tenantMetadata, "initech"),
+		&gophermartpb.RegisterRequest{Login: "user", Password: "password"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	defaultCtx := env.register(t, "user")
+	resp, err := env.client.Register(acme, &gophermartpb.RegisterRequest{Login: "user", Password: "password"})
+	require.NoError(t, err, "logins are unique per tenant")
+	acmeCtx := metadata.AppendToOutgoingContext(context.Background(), authorizationMetadata, resp.GetToken())
+
+	_, err = env.client.UploadOrder(acmeCtx, &gophermartpb.UploadOrderRequest{Number: "79927398713"})
+	require.NoError(t, err)
+	_, err = env.client.UploadOrder(defaultCtx, &gophermartpb.UploadOrderRequest{Number: "79927398713"})
+	require.NoError(t, err, "order numbers are unique per tenant")
+
+	orders, err := env.client.ListOrders(acmeCtx, &gophermartpb.ListOrdersRequest{})
+	require.NoError(t, err)
+	assert.Len(t, orders.GetOrders(), 1)
+
+	_, err = env.client.ListOrders(metadata.AppendToOutgoingContext(defaultCtx, tenantMetadata, "acme"), &gophermartpb.ListOrdersRequest{})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err), "a token is only valid in its own tenant")
+}
+
+func TestGophermartServer_Orders(t *testing.T) {
+	env := newGRPCTestEnv(t)
+	ctx := env.register(t, "user")
+
+	resp, err := env.client.UploadOrder(ctx, &gophermartpb.UploadOrderRequest{Number: "12345678903"})
+	require.NoError(t, err)
+	assert.False(t, resp.GetAlreadyUploaded())
+
+	resp, err = env.client.UploadOrder(ctx, &gophermartpb.UploadOrderRequest{Number: "12345678903"})
+	require.NoError(t, err)
+	assert.True(t, resp.GetAlreadyUploaded())
+
+	_, err = env.client.UploadOrder(ctx, &gophermartpb.UploadOrderRequest{Number: "12345678904"})
+	assert.Equal(t, codes.InvalidArgument, status.Code(err))
+
+	_, err = env.client.UploadOrder(env.register(t, "other"), &gophermartpb.UploadOrderRequest{Number: "12345678903"})
+	assert.Equal(t, codes.AlreadyExists, status.Code(err))
+
+	orders, err := env.client.ListOrders(ctx, &gophermartpb.ListOrdersRequest{})
+	require.NoError(t, err)
+	require.Len(t, orders.GetOrders(), 1)
+	assert.Equal(t, "12345678903", orders.GetOrders()[0].GetNumber())
+	assert.Equal(t, "NEW", orders.GetOrders()[0].GetStatus())
+}
+
+func TestGophermartServer_Withdraw(t *testing.T) {
+	env := newGRPCTestEnv(t)
+	ctx := env.register(t, "user")
+
+	_, err := env.client.UploadOrder(ctx, &gophermartpb.UploadOrderRequest{Number: "12345678903"})
+	require.NoError(t, err)
+	accrual := float32(100)
+	require.NoError(t, env.storage.UpdateOrderStatus(context.Background(), "12345678903", "PROCESSED", &accrual, nil))
+
+	_, err = env.client.Withdraw(ctx, &gophermartpb.WithdrawRequest{Order: "2377225624", Sum: 500})
+	assert.Equal(t, codes.FailedPrecondition, status.Code(err))
+
+	_, err = env.client.Withdraw(ctx, &gophermartpb.WithdrawRequest{Order: "2377225624", Sum: 40})
+	require.NoError(t, err)
+
+	balance, err := env.client.GetBalance(ctx, &gophermartpb.GetBalanceRequest{})
+	require.NoError(t, err)
+	assert.InDelta(t, 60, balance.GetCurrent(), 0.001)
+	assert.InDelta(t, 40, balance.GetWithdrawn(), 0.001)
+
+	withdrawals, err := env.client.ListWithdrawals(ctx, &gophermartpb.ListWithdrawalsRequest{})
+	require.NoError(t, err)
+	require.Len(t, withdrawals.GetWithdrawals(), 1)
+	assert.Equal(t, "2377225624", withdrawals.GetWithdrawals()[0].GetOrder())
+}
+
+func TestGophermartServer_Audit(t *testing.T) {
+	env := newGRPCTestEnv(t)
+	env.register(t, "user")
+
+	ctx := metadata.AppendToOutgoingContext(context.Background(), requestIDMetadata, "req-42")
+	_, err := env.client.Login(ctx, &gophermartpb.LoginRequest{Login: "user", Password: "wrong"})
+	assert.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	events, err := env.storage.GetAuditEvents(context.Background(), models.AuditEventFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	assert.Equal(t, audit.EventLoginFailed, events[0].EventType)
+	assert.Equal(t, "req-42", events[0].RequestID)
+	assert.Contains(t, events[0].UserAgent, "grpc-go")
+	assert.JSONEq(t, `{"login":"user"}`, string(events[0].Details))
+	assert.Equal(t, audit.EventTokenIssued, events[1].EventType)
+	assert.Equal(t, audit.EventUserRegistered, events[2].EventType)
+
+	chain, err := env.storage.GetAuditChain(context.Background())
+	require.NoError(t, err)
+	assert.True(t, audit.Verify(chain).Valid)
+}
+
+func TestGophermartServer_WatchOrders(t *testing.T) {
+	env := newGRPCTestEnv(t)
+	ctx, cancel := context.WithTimeout(env.register(t, "user"), 5*time.Second)
+	defer cancel()
+
+	stream, err := env.client.WatchOrders(ctx, &gophermartpb.WatchOrdersRequest{})
+	require.NoError(t, err)
+
+	userID, err := env.storage.GetUserByLogin(context.Background(), models.UserCreditials{Login: "user", Password: "password"})
+	require.NoError(t, err)
+
+	// The subscription is registered asynchronously, keep publishing until
+	// the first event gets through.
+	received := make(chan *gophermartpb.WatchOrdersResponse, 1)
+	go func() {
+		event, err := stream.Recv()
+		if err == nil {
+			received <- event
+		}
+	}()
+
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case event := <-received:
+			assert.Equal(t, "12345678903", event.GetNumber())
+			assert.Equal(t, "PROCESSED", event.GetStatus())
+			assert.InDelta(t, 100, event.GetAccrual(), 0.001)
+			return
+		case <-ticker.C:
+			env.hub.Publish(events.OrderStatusChanged{UserID: userID, Number: "12345678903", Status: "PROCESSED", Accrual: 100, ChangedAt: time.Now()})
+		case <-ctx.Done():
+			t.Fatal("no order status change received")
+		}
+	}
+}
+
+func TestStop_CancelsWatchStreams(t *testing.T) {
+	env := newGRPCTestEnv(t)
+	stream, err := env.client.WatchOrders(env.register(t, "user"), &gophermartpb.WatchOrdersRequest{})
+	require.NoError(t, err)
+	userID, err := env.storage.GetUserByLogin(context.Background(), models.UserCreditials{Login: "user", Password: "password"})
+	require.NoError(t, err)
+
+	// Wait for the stream to be served, the first event getting through.
+	received := make(chan struct{})
+	go func() {
+		if _, err := stream.Recv(); err == nil {
+			close(received)
+		}
+	}()
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for waiting := true; waiting; {
+		select {
+		case <-received:
+			waiting = false
+		case <-ticker.C:
+			env.hub.Publish(events.OrderStatusChanged{UserID: userID, Number: "12345678903", Status: "NEW"})
+		case <-timeout:
+			t.Fatal("stream not served")
+		}
+	}
+
+	stopped := make(chan struct{})
+	go func() {
+		Stop(env.server, 50*time.Millisecond)
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not stop")
+	}
+	_, err = stream.Recv()
+	assert.Error(t, err)
+}
@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"archive/zip"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+const (
+	exportFormatJSON = "json"
+	exportFormatZIP  = "zip"
+)
+
+type GophermartAccountServicer interface {
+	GetProfileService(ctx context.Context, userID string) (*models.User, error)
+	UpdateProfileService(ctx context.Context, userID string, update models.UserProfileUpdate) (*models.User, error)
+	DeleteAccountService(ctx context.Context, userID string, password string) (*models.AccountDeletion, error)
+	ExportService(ctx context.Context, userID string) (*models.UserExport, error)
+}
+
+type GophermartAccountHandlers struct {
+	service GophermartAccountServicer
+	cfg     *config.Config
+	log     *logger.Logger
+}
+
+func NewGophermartAccountHandlers(service GophermartAccountServicer, cfg *config.Config, log *logger.Logger) *GophermartAccountHandlers {
+	return &GophermartAccountHandlers{
+		service: service,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+func (gh *GophermartAccountHandlers) GetProfileHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	user, err := gh.service.GetProfileService(r.Context(), claims.Subject)
+	if err != nil {
+		gh.userError(w, r, "failed to get profile", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, user)
+}
+
+func (gh *GophermartAccountHandlers) UpdateProfileHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	var update models.UserProfileUpdate
+	if err := render.Bind(r, &update); err != nil {
+		gh.log.Ctx(r.Context()).Debug("cannot parse body", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	user, err := gh.service.UpdateProfileService(r.Context(), claims.Subject, update)
+	if err != nil {
+		gh.userError(w, r, "failed to update profile", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, user)
+}
+
+func (gh *GophermartAccountHandlers) DeleteAccountHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	var request models.AccountDeletionRequest
+	if err := render.Bind(r, &request); err != nil {
+		gh.log.Ctx(r.Context()).Debug("cannot parse body", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	deletion, err := gh.service.DeleteAccountService(r.Context(), claims.Subject, request.Password)
+	if err != nil {
+		if errors.Is(err, service.ErrWrongPassword) {
+			gh.log.Ctx(r.Context()).Debug("failed to delete account", zap.Error(err))
+			render.Status(r, http.StatusForbidden)
+			render.PlainText(w, r, "")
+			return
+		}
+		gh.userError(w, r, "failed to delete account", err)
+		return
+	}
+
+	render.Status(r, http.StatusAccepted)
+	render.JSON(w, r, deletion)
+}
+
+func (gh *GophermartAccountHandlers) ExportHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exportFormatJSON
+	}
+	if format != exportFormatJSON && format != exportFormatZIP {
+		gh.log.Ctx(r.Context()).Debug("unknown export format", zap.String("format", format))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	export, err := gh.service.ExportService(r.Context(), claims.Subject)
+	if err != nil {
+		gh.userError(w, r, "failed to export user data", err)
+		return
+	}
+
+	if format == exportFormatJSON {
+		w.Header().Set("Content-Disposition", `attachment; filename="gophermart-export.json"`)
+		render.Status(r, http.StatusOK)
+		render.JSON(w, r, export)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="gophermart-export.zip"`)
+	w.WriteHeader(http.StatusOK)
+	if err := writeExportZIP(w, export); err != nil {
+		// The status is already sent, the client gets a truncated archive.
+		gh.log.Ctx(r.Context()).Error("failed to write export archive", zap.Error(err))
+	}
+}
+
+func (gh *GophermartAccountHandlers) userError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	if errors.Is(err, sql.ErrNoRows) {
+		gh.log.Ctx(r.Context()).Debug(msg, zap.Error(err))
+		render.Status(r, http.StatusNotFound)
+		render.PlainText(w, r, "")
+		return
+	}
+	gh.log.Ctx(r.Context()).Error(msg, zap.Error(err))
+	render.Status(r, http.StatusInternalServerError)
+	render.PlainText(w, r, "")
+}
+
+// writeExportZIP writes every part of export as a separate JSON file.
+func writeExportZIP(w io.Writer, export *models.UserExport) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data any
+	}{
+		{"profile.json", export.Profile},
+		{"orders.json", export.Orders},
+		{"withdrawals.json", export.Withdrawals},
+		{"transfers.json", export.Transfers},
+		{"bonuses.json", export.Bonuses},
+		{"referrals.json", export.Referrals},
+		{"tier_history.json", export.TierHistory},
+		{"clawbacks.json", export.Clawbacks},
+		{"audit_events.json", export.AuditEvents},
+	}
+	for _, file := range files {
+		header := &zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt}
+		fw, err := archive.CreateHeader(header)
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(fw)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return fmt.Errorf("cannot encode %v: %w", file.name, err)
+		}
+	}
+
+	return archive.Close()
+}
@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+type GophermartAuditServicer interface {
+	GetAuditEventsService(ctx context.Context, adminID string, filter models.AuditEventFilter) ([]models.AuditEvent, error)
+	VerifyAuditChainService(ctx context.Context, adminID string) (models.AuditChainStatus, error)
+}
+
+type GophermartAuditHandlers struct {
+	service GophermartAuditServicer
+	cfg     *config.Config
+	log     *logger.Logger
+}
+
+func NewGophermartAuditHandlers(service GophermartAuditServicer, cfg *config.Config, log *logger.Logger) *GophermartAuditHandlers {
+	return &GophermartAuditHandlers{
+		service: service,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+func (gh *GophermartAuditHandlers) GetAuditEventsHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	filter, err := parseAuditEventFilter(r.URL.Query())
+	if err != nil {
+		gh.log.Ctx(r.Context()).Debug("invalid audit filter", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	events, err := gh.service.GetAuditEventsService(r.Context(), claims.Subject, filter)
+	if err != nil {
+		gh.log.Ctx(r.Context()).Error("failed to get audit events", zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	if len(events) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, events)
+}
+
+func (gh *GophermartAuditHandlers) VerifyAuditChainHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	status, err := gh.service.VerifyAuditChainService(r.Context(), claims.Subject)
+	if err != nil {
+		gh.log.Ctx(r.Context()).Error("failed to verify audit chain", zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+		return
+	}
+	if !status.Valid {
+		gh.log.Ctx(r.Context()).Error("audit chain is broken", zap.Int64p("event_id", status.BrokenEventID))
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, status)
+}
+
+func parseAuditEventFilter(query url.Values) (models.AuditEventFilter, error) {
+	filter := models.AuditEventFilter{EventType: query.Get("type")}
+
+	if value := query.Get("user_id"); value != "" {
+		userID, err := strconv.Atoi(value)
+		if err != nil {
+			return filter, fmt.Errorf("invalid user_id: %w", err)
+		}
+		filter.UserID = &userID
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit <= 0 {
+			return filter, errors.New("limit must be a positive integer")
+		}
+		filter.Limit = limit
+	}
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %v: %w", name, err)
+			}
+			*target = &t
+		}
+	}
+
+	return filter, nil
+}
@@ -33,7 +33,7 @@ func NewGophermartBalanceHandlers(service GophermartBalanceServicer, cfg *config
 func (gh *GophermartBalanceHandlers) GetBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
 	if !ok {
-		gh.log.Log.Info("cannot get jwt claims")
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -41,9 +41,10 @@ func (gh *GophermartBalanceHandlers) GetBalanceHandler(w http.ResponseWriter, r
 
 	balance, err := gh.service.GetUserBalanceService(r.Context(), claims.Subject)
 	if err != nil {
-		gh.log.Log.Info(err.Error())
+		gh.log.Ctx(r.Context()).Error(err.Error())
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, "")
+		return
 	}
 
 	render.Status(r, http.StatusOK)
@@ -0,0 +1,202 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+type GophermartCampaignServicer interface {
+	GetCampaignsService(ctx context.Context) ([]models.Campaign, error)
+	GetCampaignService(ctx context.Context, campaignID int) (*models.Campaign, error)
+	CreateCampaignService(ctx context.Context, adminID string, request *models.CampaignRequest) (*models.Campaign, error)
+	UpdateCampaignService(ctx context.Context, adminID string, campaignID int, request *models.CampaignRequest) (*models.Campaign, error)
+	DeleteCampaignService(ctx context.Context, adminID string, campaignID int) error
+	DryRunCampaignService(ctx context.Context, request *models.CampaignDryRunRequest) (*models.CampaignPreview, error)
+}
+
+type GophermartCampaignHandlers struct {
+	service GophermartCampaignServicer
+	cfg     *config.Config
+	log     *logger.Logger
+}
+
+func NewGophermartCampaignHandlers(service GophermartCampaignServicer, cfg *config.Config, log *logger.Logger) *GophermartCampaignHandlers {
+	return &GophermartCampaignHandlers{
+		service: service,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+func (gh *GophermartCampaignHandlers) GetCampaignsHandler(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := gh.service.GetCampaignsService(r.Context())
+	if err != nil {
+		gh.log.Ctx(r.Context()).Error("failed to get campaigns", zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	if len(campaigns) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, campaigns)
+}
+
+func (gh *GophermartCampaignHandlers) GetCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	campaignID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		gh.log.Ctx(r.Context()).Debug("invalid campaign id", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	campaign, err := gh.service.GetCampaignService(r.Context(), campaignID)
+	if err != nil {
+		gh.writeError(w, r, "failed to get campaign", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, campaign)
+}
+
+func (gh *GophermartCampaignHandlers) CreateCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	var request models.CampaignRequest
+	if err := render.Bind(r, &request); err != nil {
+		gh.log.Ctx(r.Context()).Debug("cannot parse body", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	campaign, err := gh.service.CreateCampaignService(r.Context(), claims.Subject, &request)
+	if err != nil {
+		gh.writeError(w, r, "failed to create campaign", err)
+		return
+	}
+
+	render.Status(r, http.StatusCreated)
+	render.JSON(w, r, campaign)
+}
+
+func (gh *GophermartCampaignHandlers) UpdateCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	campaignID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		gh.log.Ctx(r.Context()).Debug("invalid campaign id", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	var request models.CampaignRequest
+	if err := render.Bind(r, &request); err != nil {
+		gh.log.Ctx(r.Context()).Debug("cannot parse body", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	campaign, err := gh.service.UpdateCampaignService(r.Context(), claims.Subject, campaignID, &request)
+	if err != nil {
+		gh.writeError(w, r, "failed to update campaign", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, campaign)
+}
+
+func (gh *GophermartCampaignHandlers) DeleteCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	campaignID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		gh.log.Ctx(r.Context()).Debug("invalid campaign id", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	if err := gh.service.DeleteCampaignService(r.Context(), claims.Subject, campaignID); err != nil {
+		gh.writeError(w, r, "failed to delete campaign", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (gh *GophermartCampaignHandlers) DryRunCampaignHandler(w http.ResponseWriter, r *http.Request) {
+	var request models.CampaignDryRunRequest
+	if err := render.Bind(r, &request); err != nil {
+		gh.log.Ctx(r.Context()).Debug("cannot parse body", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	preview, err := gh.service.DryRunCampaignService(r.Context(), &request)
+	if err != nil {
+		gh.writeError(w, r, "failed to preview campaign", err)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, preview)
+}
+
+func (gh *GophermartCampaignHandlers) writeError(w http.ResponseWriter, r *http.Request, msg string, err error) {
+	switch {
+	case errors.Is(err, service.ErrCampaignNotFound):
+		gh.log.Ctx(r.Context()).Debug(msg, zap.Error(err))
+		render.Status(r, http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidCampaign):
+		gh.log.Ctx(r.Context()).Debug(msg, zap.Error(err))
+		render.Status(r, http.StatusUnprocessableEntity)
+	case errors.Is(err, service.ErrInvalidPeriod):
+		gh.log.Ctx(r.Context()).Debug(msg, zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+	default:
+		gh.log.Ctx(r.Context()).Error(msg, zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+	}
+	render.PlainText(w, r, "")
+}
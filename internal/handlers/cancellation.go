@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+type GophermartCancelOrderServicer interface {
+	CancelUserOrderService(ctx context.Context, userID string, orderNumber string, reason string) (*models.CancelledOrder, error)
+	CancelOrderService(ctx context.Context, actorID string, cancelledBy string, orderNumber string, reason string) (*models.CancelledOrder, error)
+}
+
+type GophermartCancelOrderHandlers struct {
+	service GophermartCancelOrderServicer
+	cfg     *config.Config
+	log     *logger.Logger
+}
+
+func NewGophermartCancelOrderHandlers(service GophermartCancelOrderServicer, cfg *config.Config, log *logger.Logger) *GophermartCancelOrderHandlers {
+	return &GophermartCancelOrderHandlers{
+		service: service,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+func (gh *GophermartCancelOrderHandlers) CancelUserOrderHandler(w http.ResponseWriter, r *http.Request) {
+	gh.cancelOrder(w, r, models.CancelledByUser)
+}
+
+func (gh *GophermartCancelOrderHandlers) AdminCancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	gh.cancelOrder(w, r, models.CancelledByAdmin)
+}
+
+func (gh *GophermartCancelOrderHandlers) PartnerCancelOrderHandler(w http.ResponseWriter, r *http.Request) {
+	gh.cancelOrder(w, r, models.CancelledByPartner)
+}
+
+func (gh *GophermartCancelOrderHandlers) cancelOrder(w http.ResponseWriter, r *http.Request, cancelledBy string) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	// The reason is optional, so is the body.
+	var request models.CancelOrderRequest
+	if r.ContentLength != 0 {
+		if err := render.Bind(r, &request); err != nil {
+			gh.log.Ctx(r.Context()).Debug("cannot parse body", zap.Error(err))
+			render.Status(r, http.StatusBadRequest)
+			render.PlainText(w, r, "")
+			return
+		}
+	}
+
+	var (
+		cancelled *models.CancelledOrder
+		err       error
+	)
+	orderNumber := chi.URLParam(r, "number")
+	if cancelledBy == models.CancelledByUser {
+		cancelled, err = gh.service.CancelUserOrderService(r.Context(), claims.Subject, orderNumber, request.Reason)
+	} else {
+		cancelled, err = gh.service.CancelOrderService(r.Context(), claims.Subject, cancelledBy, orderNumber, request.Reason)
+	}
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrOrderNotFound):
+			gh.log.Ctx(r.Context()).Debug("failed to cancel order", zap.Error(err))
+			render.Status(r, http.StatusNotFound)
+		case errors.Is(err, service.ErrOrderNotCancellable):
+			gh.log.Ctx(r.Context()).Debug("failed to cancel order", zap.Error(err))
+			render.Status(r, http.StatusConflict)
+		case errors.Is(err, service.ErrInsufficientFunds):
+			gh.log.Ctx(r.Context()).Debug("failed to cancel order", zap.Error(err))
+			render.Status(r, http.StatusPaymentRequired)
+		default:
+			gh.log.Ctx(r.Context()).Error("failed to cancel order", zap.Error(err))
+			render.Status(r, http.StatusInternalServerError)
+		}
+		render.PlainText(w, r, "")
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, cancelled)
+}
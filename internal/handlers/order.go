@@ -13,6 +13,7 @@ import (
 	"github.com/AndreyKuskov2/gophermart/internal/service"
 	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/chi"
 	"github.com/go-chi/render"
 	"go.uber.org/zap"
 )
@@ -20,6 +21,7 @@ import (
 type GophermartOrderServicer interface {
 	CreateNewOrderService(ctx context.Context, orderNumber string, userID string) error
 	GetOrdersService(ctx context.Context, userID string) ([]models.Orders, error)
+	GetOrderService(ctx context.Context, userID string, orderNumber string) (*models.OrderDetails, error)
 }
 
 type GophermartOrderHandlers struct {
@@ -39,7 +41,7 @@ func NewGophermartOrderHandlers(service GophermartOrderServicer, cfg *config.Con
 func (gh *GophermartOrderHandlers) CreateNewOrderHandler(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
 	if !ok {
-		gh.log.Log.Info("cannot get jwt claims")
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -47,7 +49,7 @@ func (gh *GophermartOrderHandlers) CreateNewOrderHandler(w http.ResponseWriter,
 
 	body, err := io.ReadAll(r.Body)
 	if err != nil {
-		gh.log.Log.Info("cannot parse body")
+		gh.log.Ctx(r.Context()).Debug("cannot parse body")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -55,18 +57,21 @@ func (gh *GophermartOrderHandlers) CreateNewOrderHandler(w http.ResponseWriter,
 	defer r.Body.Close()
 
 	if err := gh.service.CreateNewOrderService(r.Context(), string(body), claims.Subject); err != nil {
-		gh.log.Log.Info("failed to add order", zap.Error(err))
 		switch {
 		case errors.Is(err, service.ErrNumberIsNotCorrect):
+			gh.log.Ctx(r.Context()).Debug("failed to add order", zap.Error(err))
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			return
 		case errors.Is(err, service.ErrOrderAlreadyExists):
+			gh.log.Ctx(r.Context()).Debug("failed to add order", zap.Error(err))
 			w.WriteHeader(http.StatusOK)
 			return
 		case errors.Is(err, service.ErrOrderAlreadyExistsForAnotherUser):
+			gh.log.Ctx(r.Context()).Debug("failed to add order", zap.Error(err))
 			w.WriteHeader(http.StatusConflict)
 			return
 		default:
+			gh.log.Ctx(r.Context()).Error("failed to add order", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -79,7 +84,7 @@ func (gh *GophermartOrderHandlers) CreateNewOrderHandler(w http.ResponseWriter,
 func (gh *GophermartOrderHandlers) GetOrdersHandler(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
 	if !ok {
-		gh.log.Log.Info("cannot get jwt claims")
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -87,16 +92,50 @@ func (gh *GophermartOrderHandlers) GetOrdersHandler(w http.ResponseWriter, r *ht
 
 	orders, err := gh.service.GetOrdersService(r.Context(), claims.Subject)
 	if err != nil {
-		gh.log.Log.Info(err.Error())
 		if errors.Is(err, sql.ErrNoRows) {
+			gh.log.Ctx(r.Context()).Debug(err.Error())
 			render.Status(r, http.StatusNoContent)
 			render.PlainText(w, r, "")
 			return
 		}
+		gh.log.Ctx(r.Context()).Error(err.Error())
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, "")
+		return
+	}
+
+	if len(orders) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
 	}
 
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, orders)
 }
+
+func (gh *GophermartOrderHandlers) GetOrderHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	order, err := gh.service.GetOrderService(r.Context(), claims.Subject, chi.URLParam(r, "number"))
+	if err != nil {
+		if errors.Is(err, service.ErrOrderNotFound) {
+			gh.log.Ctx(r.Context()).Debug("failed to get order", zap.Error(err))
+			render.Status(r, http.StatusNotFound)
+			render.PlainText(w, r, "")
+			return
+		}
+		gh.log.Ctx(r.Context()).Error("failed to get order", zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, order)
+}
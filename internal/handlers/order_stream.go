@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+const orderStreamHeartbeat = 15 * time.Second
+
+type OrderEventSubscriber interface {
+	Subscribe(userID int) (<-chan events.OrderStatusChanged, func())
+}
+
+type GophermartOrderStreamHandlers struct {
+	events OrderEventSubscriber
+	cfg    *config.Config
+	log    *logger.Logger
+}
+
+func NewGophermartOrderStreamHandlers(events OrderEventSubscriber, cfg *config.Config, log *logger.Logger) *GophermartOrderStreamHandlers {
+	return &GophermartOrderStreamHandlers{
+		events: events,
+		cfg:    cfg,
+		log:    log,
+	}
+}
+
+// OrderStreamHandler pushes status changes of the user's orders as
+// Server-Sent Events until the client disconnects.
+func (gh *GophermartOrderStreamHandlers) OrderStreamHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	userID, err := strconv.Atoi(claims.Subject)
+	if err != nil {
+		gh.log.Ctx(r.Context()).Debug("invalid user id in jwt claims")
+		render.Status(r, http.StatusUnauthorized)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		gh.log.Ctx(r.Context()).Error("response writer does not support streaming")
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	changes, cancel := gh.events.Subscribe(userID)
+	defer cancel()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	heartbeat := time.NewTicker(orderStreamHeartbeat)
+	defer heartbeat.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": heartbeat\n\n"); err != nil {
+				return
+			}
+		case event, ok := <-changes:
+			if !ok {
+				return
+			}
+			data, err := json.Marshal(event)
+			if err != nil {
+				gh.log.Ctx(r.Context()).Error("cannot marshal order status change", zap.Error(err))
+				continue
+			}
+			if _, err := fmt.Fprintf(w, "event: order\ndata: %s\n\n", data); err != nil {
+				return
+			}
+		}
+		flusher.Flush()
+	}
+}
@@ -0,0 +1,273 @@
+package handlers
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+const (
+	statementFormatJSON = "json"
+	statementFormatCSV  = "csv"
+
+	dateLayout = "2006-01-02"
+)
+
+type GophermartStatementServicer interface {
+	WriteStatementService(ctx context.Context, userID string, from, to time.Time, w service.StatementWriter) error
+}
+
+type GophermartStatementHandlers struct {
+	service GophermartStatementServicer
+	cfg     *config.Config
+	log     *logger.Logger
+}
+
+func NewGophermartStatementHandlers(service GophermartStatementServicer, cfg *config.Config, log *logger.Logger) *GophermartStatementHandlers {
+	return &GophermartStatementHandlers{
+		service: service,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+// statementPeriod is the half-open interval [from, to) of a statement. Dates
+// are midnights in location, which is also used to render timestamps.
+type statementPeriod struct {
+	from     time.Time
+	to       time.Time
+	location *time.Location
+}
+
+type statementWriter interface {
+	service.StatementWriter
+	// Started reports whether anything has been sent to the client.
+	Started() bool
+}
+
+func (gh *GophermartStatementHandlers) StatementHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	period, err := parseStatementPeriod(r.URL.Query(), time.Now())
+	if err != nil {
+		gh.log.Ctx(r.Context()).Debug("invalid statement period", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	var writer statementWriter
+	switch format := r.URL.Query().Get("format"); format {
+	case statementFormatJSON, "":
+		writer = &jsonStatementWriter{w: w, period: period}
+	case statementFormatCSV:
+		writer = &csvStatementWriter{w: w, period: period}
+	default:
+		gh.log.Ctx(r.Context()).Debug("unknown statement format", zap.String("format", format))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	err = gh.service.WriteStatementService(r.Context(), claims.Subject, period.from, period.to, writer)
+	switch {
+	case err == nil:
+	case errors.Is(err, service.ErrInvalidPeriod):
+		gh.log.Ctx(r.Context()).Debug("invalid statement period", zap.Error(err))
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+	case !writer.Started():
+		gh.log.Ctx(r.Context()).Error("failed to write statement", zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+	default:
+		// The status is already sent, the client gets a truncated statement.
+		gh.log.Ctx(r.Context()).Error("failed to write statement", zap.Error(err))
+	}
+}
+
+// parseStatementPeriod reads from and to as dates or RFC 3339 timestamps and
+// tz as an IANA time zone name. The period defaults to the current month.
+func parseStatementPeriod(query url.Values, now time.Time) (statementPeriod, error) {
+	period := statementPeriod{location: time.UTC}
+	if tz := query.Get("tz"); tz != "" {
+		location, err := time.LoadLocation(tz)
+		if err != nil {
+			return period, fmt.Errorf("invalid tz: %w", err)
+		}
+		period.location = location
+	}
+
+	now = now.In(period.location)
+	period.from = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, period.location)
+	period.to = period.from.AddDate(0, 1, 0)
+
+	for name, target := range map[string]*time.Time{"from": &period.from, "to": &period.to} {
+		value := query.Get(name)
+		if value == "" {
+			continue
+		}
+		t, err := time.ParseInLocation(dateLayout, value, period.location)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, value); err != nil {
+				return period, fmt.Errorf("invalid %v: %q", name, value)
+			}
+		}
+		*target = t
+	}
+
+	return period, nil
+}
+
+func (p statementPeriod) filename(ext string) string {
+	return fmt.Sprintf(`attachment; filename="statement-%v-%v.%v"`,
+		p.from.In(p.location).Format(dateLayout), p.to.In(p.location).Format(dateLayout), ext)
+}
+
+type jsonStatementWriter struct {
+	w       http.ResponseWriter
+	buf     *bufio.Writer
+	period  statementPeriod
+	entries int
+}
+
+func (sw *jsonStatementWriter) Started() bool {
+	return sw.buf != nil
+}
+
+func (sw *jsonStatementWriter) WriteOpening(balance float64) error {
+	sw.w.Header().Set("Content-Type", "application/json")
+	sw.w.Header().Set("Content-Disposition", sw.period.filename(statementFormatJSON))
+	sw.w.WriteHeader(http.StatusOK)
+	sw.buf = bufio.NewWriter(sw.w)
+
+	header, err := json.Marshal(struct {
+		From           time.Time `json:"from"`
+		To             time.Time `json:"to"`
+		Timezone       string    `json:"timezone"`
+		OpeningBalance float64   `json:"opening_balance"`
+	}{
+		From:           sw.period.from.In(sw.period.location),
+		To:             sw.period.to.In(sw.period.location),
+		Timezone:       sw.period.location.String(),
+		OpeningBalance: balance,
+	})
+	if err != nil {
+		return err
+	}
+	// The header object is reopened to append the streamed entries.
+	sw.buf.Write(header[:len(header)-1])
+	_, err = sw.buf.WriteString(`,"entries":[`)
+	return err
+}
+
+func (sw *jsonStatementWriter) WriteEntry(entry models.StatementEntry) error {
+	entry.At = entry.At.In(sw.period.location)
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	if sw.entries > 0 {
+		sw.buf.WriteByte(',')
+	}
+	sw.entries++
+	_, err = sw.buf.Write(data)
+	return err
+}
+
+func (sw *jsonStatementWriter) WriteSummary(summary models.StatementSummary) error {
+	data, err := json.Marshal(struct {
+		TotalAccrued        float64 `json:"total_accrued"`
+		TotalBonus          float64 `json:"total_bonus"`
+		TotalWithdrawn      float64 `json:"total_withdrawn"`
+		TotalTransferredIn  float64 `json:"total_transferred_in"`
+		TotalTransferredOut float64 `json:"total_transferred_out"`
+		TotalClawedBack     float64 `json:"total_clawed_back"`
+		ClosingBalance      float64 `json:"closing_balance"`
+	}{
+		TotalAccrued:        summary.TotalAccrued,
+		TotalBonus:          summary.TotalBonus,
+		TotalWithdrawn:      summary.TotalWithdrawn,
+		TotalTransferredIn:  summary.TotalTransferredIn,
+		TotalTransferredOut: summary.TotalTransferredOut,
+		TotalClawedBack:     summary.TotalClawedBack,
+		ClosingBalance:      summary.ClosingBalance,
+	})
+	if err != nil {
+		return err
+	}
+	sw.buf.WriteString("],")
+	sw.buf.Write(data[1:])
+	return sw.buf.Flush()
+}
+
+type csvStatementWriter struct {
+	w      http.ResponseWriter
+	csv    *csv.Writer
+	period statementPeriod
+}
+
+func (sw *csvStatementWriter) Started() bool {
+	return sw.csv != nil
+}
+
+func (sw *csvStatementWriter) WriteOpening(balance float64) error {
+	sw.w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	sw.w.Header().Set("Content-Disposition", sw.period.filename(statementFormatCSV))
+	sw.w.WriteHeader(http.StatusOK)
+	sw.csv = csv.NewWriter(sw.w)
+
+	sw.csv.Write([]string{"date", "type", "order", "counterparty", "amount", "balance"})
+	return sw.csv.Write([]string{sw.timestamp(sw.period.from), "opening_balance", "", "", "", formatAmount(balance)})
+}
+
+func (sw *csvStatementWriter) WriteEntry(entry models.StatementEntry) error {
+	return sw.csv.Write([]string{sw.timestamp(entry.At), entry.Type, entry.Order, entry.Counterparty, formatAmount(entry.Amount), formatAmount(entry.Balance)})
+}
+
+func (sw *csvStatementWriter) WriteSummary(summary models.StatementSummary) error {
+	end := sw.timestamp(sw.period.to)
+	sw.csv.Write([]string{end, "total_accrued", "", "", formatAmount(summary.TotalAccrued), ""})
+	sw.csv.Write([]string{end, "total_bonus", "", "", formatAmount(summary.TotalBonus), ""})
+	sw.csv.Write([]string{end, "total_withdrawn", "", "", formatAmount(-summary.TotalWithdrawn), ""})
+	sw.csv.Write([]string{end, "total_transferred_in", "", "", formatAmount(summary.TotalTransferredIn), ""})
+	sw.csv.Write([]string{end, "total_transferred_out", "", "", formatAmount(-summary.TotalTransferredOut), ""})
+	sw.csv.Write([]string{end, "total_clawed_back", "", "", formatAmount(-summary.TotalClawedBack), ""})
+	sw.csv.Write([]string{end, "closing_balance", "", "", "", formatAmount(summary.ClosingBalance)})
+	sw.csv.Flush()
+	return sw.csv.Error()
+}
+
+func (sw *csvStatementWriter) timestamp(t time.Time) string {
+	return t.In(sw.period.location).Format(time.RFC3339)
+}
+
+func formatAmount(amount float64) string {
+	if amount == 0 {
+		// Avoids printing negative zero.
+		amount = 0
+	}
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
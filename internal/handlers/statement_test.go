@@ -0,0 +1,73 @@
+package handlers
+
+import (
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseStatementPeriod(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	require.NoError(t, err)
+	// 2024-01-31 22:30 UTC is already February in Moscow.
+	now := time.Date(2024, 1, 31, 22, 30, 0, 0, time.UTC)
+
+	tests := []struct {
+		name     string
+		query    url.Values
+		wantFrom time.Time
+		wantTo   time.Time
+		wantErr  bool
+	}{
+		{
+			name:     "current month in UTC",
+			query:    url.Values{},
+			wantFrom: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "current month in tz",
+			query:    url.Values{"tz": {"Europe/Moscow"}},
+			wantFrom: time.Date(2024, 2, 1, 0, 0, 0, 0, moscow),
+			wantTo:   time.Date(2024, 3, 1, 0, 0, 0, 0, moscow),
+		},
+		{
+			name:     "dates are midnights in tz",
+			query:    url.Values{"from": {"2024-03-10"}, "to": {"2024-03-11"}, "tz": {"Europe/Moscow"}},
+			wantFrom: time.Date(2024, 3, 9, 21, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2024, 3, 10, 21, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "timestamps keep their offset",
+			query:    url.Values{"from": {"2024-03-10T12:00:00+05:00"}, "to": {"2024-03-11"}},
+			wantFrom: time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC),
+			wantTo:   time.Date(2024, 3, 11, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			name:    "unknown tz",
+			query:   url.Values{"tz": {"Mars/Olympus_Mons"}},
+			wantErr: true,
+		},
+		{
+			name:    "invalid date",
+			query:   url.Values{"to": {"10.03.2024"}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			period, err := parseStatementPeriod(tt.query, now)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.True(t, tt.wantFrom.Equal(period.from), "from: got %v", period.from)
+			assert.True(t, tt.wantTo.Equal(period.to), "to: got %v", period.to)
+		})
+	}
+}
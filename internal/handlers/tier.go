@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+type GophermartTierServicer interface {
+	GetTierStatusService(ctx context.Context, userID string) (*models.TierStatus, error)
+}
+
+type GophermartTierHandlers struct {
+	service GophermartTierServicer
+	cfg     *config.Config
+	log     *logger.Logger
+}
+
+func NewGophermartTierHandlers(service GophermartTierServicer, cfg *config.Config, log *logger.Logger) *GophermartTierHandlers {
+	return &GophermartTierHandlers{
+		service: service,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+func (gh *GophermartTierHandlers) GetTierHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	status, err := gh.service.GetTierStatusService(r.Context(), claims.Subject)
+	if err != nil {
+		gh.log.Ctx(r.Context()).Error("failed to get loyalty tier", zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, status)
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app/middlewares"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/go-chi/render"
+	"go.uber.org/zap"
+)
+
+type GophermartTransferServicer interface {
+	TransferService(ctx context.Context, userID string, request *models.TransferRequest) (*models.Transfer, error)
+	GetTransfersService(ctx context.Context, userID string) ([]models.Transfer, error)
+}
+
+type GophermartTransferHandlers struct {
+	service GophermartTransferServicer
+	cfg     *config.Config
+	log     *logger.Logger
+}
+
+func NewGophermartTransferHandlers(service GophermartTransferServicer, cfg *config.Config, log *logger.Logger) *GophermartTransferHandlers {
+	return &GophermartTransferHandlers{
+		service: service,
+		cfg:     cfg,
+		log:     log,
+	}
+}
+
+func (gh *GophermartTransferHandlers) TransferHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	var request models.TransferRequest
+	if err := render.Bind(r, &request); err != nil {
+		gh.log.Ctx(r.Context()).Debug("cannot parse body")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	transfer, err := gh.service.TransferService(r.Context(), claims.Subject, &request)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInsufficientFunds):
+			gh.log.Ctx(r.Context()).Debug("failed to transfer points", zap.Error(err))
+			w.WriteHeader(http.StatusPaymentRequired)
+		case errors.Is(err, service.ErrRecipientNotFound):
+			gh.log.Ctx(r.Context()).Debug("failed to transfer points", zap.Error(err))
+			w.WriteHeader(http.StatusNotFound)
+		case errors.Is(err, service.ErrInvalidTransfer), errors.Is(err, service.ErrSelfTransfer):
+			gh.log.Ctx(r.Context()).Debug("failed to transfer points", zap.Error(err))
+			w.WriteHeader(http.StatusUnprocessableEntity)
+		case errors.Is(err, service.ErrTransferLimitExceeded):
+			gh.log.Ctx(r.Context()).Debug("failed to transfer points", zap.Error(err))
+			// The limits are reset at the start of the next UTC day.
+			now := time.Now()
+			reset := service.TransferDayStart(now).AddDate(0, 0, 1)
+			w.Header().Set("Retry-After", strconv.Itoa(int(reset.Sub(now).Seconds())+1))
+			w.WriteHeader(http.StatusTooManyRequests)
+		default:
+			gh.log.Ctx(r.Context()).Error("failed to transfer points", zap.Error(err))
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, transfer)
+}
+
+func (gh *GophermartTransferHandlers) GetTransfersHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
+	if !ok {
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
+		render.Status(r, http.StatusBadRequest)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	transfers, err := gh.service.GetTransfersService(r.Context(), claims.Subject)
+	if err != nil {
+		gh.log.Ctx(r.Context()).Error("failed to get transfers", zap.Error(err))
+		render.Status(r, http.StatusInternalServerError)
+		render.PlainText(w, r, "")
+		return
+	}
+
+	if len(transfers) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	render.Status(r, http.StatusOK)
+	render.JSON(w, r, transfers)
+}
@@ -8,8 +8,9 @@ import (
 
 	"github.com/AndreyKuskov2/gophermart/internal/config"
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/service"
 	"github.com/AndreyKuskov2/gophermart/internal/storage"
-	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
 	"github.com/go-chi/render"
 )
@@ -17,6 +18,7 @@ import (
 type GophermartUserServicer interface {
 	RegisterUserService(ctx context.Context, user models.UserCreditials) (int, error)
 	GetUserService(ctx context.Context, user models.UserCreditials) (int, error)
+	IssueTokenService(ctx context.Context, userID int, secret string) (string, error)
 }
 
 type GophermartUserHandlers struct {
@@ -37,7 +39,7 @@ func (gh *GophermartUserHandlers) RegisterUserHandler(w http.ResponseWriter, r *
 	var user models.UserCreditials
 
 	if err := render.Bind(r, &user); err != nil {
-		gh.log.Log.Info("cannot parse body")
+		gh.log.Ctx(r.Context()).Debug("cannot parse body")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -45,20 +47,27 @@ func (gh *GophermartUserHandlers) RegisterUserHandler(w http.ResponseWriter, r *
 
 	userID, err := gh.service.RegisterUserService(r.Context(), user)
 	if err != nil {
-		gh.log.Log.Info(err.Error())
 		if errors.Is(err, storage.ErrUserIsExist) {
+			gh.log.Ctx(r.Context()).Debug(err.Error())
 			render.Status(r, http.StatusConflict)
 			render.PlainText(w, r, "")
 			return
 		}
+		if errors.Is(err, service.ErrReferralCodeNotFound) {
+			gh.log.Ctx(r.Context()).Debug(err.Error())
+			render.Status(r, http.StatusUnprocessableEntity)
+			render.PlainText(w, r, "")
+			return
+		}
+		gh.log.Ctx(r.Context()).Error(err.Error())
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, "")
 		return
 	}
 
-	jwtToken, err := jwt.CreateJwtToken(gh.cfg.JWTSecretToken, userID)
+	jwtToken, err := gh.service.IssueTokenService(r.Context(), userID, gh.cfg.TenantJWTSecret(tenant.ID(r.Context())))
 	if err != nil {
-		gh.log.Log.Info("cannot create jwt token")
+		gh.log.Ctx(r.Context()).Error("cannot create jwt token")
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, "")
 		return
@@ -73,7 +82,7 @@ func (gh *GophermartUserHandlers) LoginUserHandler(w http.ResponseWriter, r *htt
 	var user models.UserCreditials
 
 	if err := render.Bind(r, &user); err != nil {
-		gh.log.Log.Info("cannot parse body")
+		gh.log.Ctx(r.Context()).Debug("cannot parse body")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -81,20 +90,21 @@ func (gh *GophermartUserHandlers) LoginUserHandler(w http.ResponseWriter, r *htt
 
 	userID, err := gh.service.GetUserService(r.Context(), user)
 	if err != nil {
-		gh.log.Log.Info(err.Error())
 		if errors.Is(err, sql.ErrNoRows) || errors.Is(err, storage.ErrInvalidData) {
+			gh.log.Ctx(r.Context()).Debug(err.Error())
 			render.Status(r, http.StatusUnauthorized)
 			render.PlainText(w, r, "")
 			return
 		}
+		gh.log.Ctx(r.Context()).Error(err.Error())
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, "")
 		return
 	}
 
-	jwtToken, err := jwt.CreateJwtToken(gh.cfg.JWTSecretToken, userID)
+	jwtToken, err := gh.service.IssueTokenService(r.Context(), userID, gh.cfg.TenantJWTSecret(tenant.ID(r.Context())))
 	if err != nil {
-		gh.log.Log.Info("cannot create jwt token")
+		gh.log.Ctx(r.Context()).Error("cannot create jwt token")
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, "")
 		return
@@ -13,6 +13,7 @@ import (
 	"github.com/AndreyKuskov2/gophermart/internal/config"
 	"github.com/AndreyKuskov2/gophermart/internal/models"
 	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -33,6 +34,11 @@ func (m *MockGophermartUserServicer) GetUserService(ctx context.Context, user mo
 	return args.Int(0), args.Error(1)
 }
 
+// IssueTokenService creates a real token so that handlers return a valid one.
+func (m *MockGophermartUserServicer) IssueTokenService(ctx context.Context, userID int, secret string) (string, error) {
+	return jwt.CreateJwtToken(secret, userID)
+}
+
 func getTestConfig() *config.Config {
 	return &config.Config{
 		JWTSecretToken: "test-secret",
@@ -38,7 +38,7 @@ func NewGophermartWithdrawHandlers(service GophermartWithdrawServicer, cfg *conf
 func (gh *GophermartWithdrawHandlers) WithdrawBalanceHandler(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
 	if !ok {
-		gh.log.Log.Info("cannot get jwt claims")
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -46,22 +46,24 @@ func (gh *GophermartWithdrawHandlers) WithdrawBalanceHandler(w http.ResponseWrit
 
 	var withdrawBalance models.WithdrawBalanceRequest
 	if err := render.Bind(r, &withdrawBalance); err != nil {
-		gh.log.Log.Info("cannot parse body")
+		gh.log.Ctx(r.Context()).Debug("cannot parse body")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
 	}
 
 	if err := gh.service.WithdrawBalanceService(r.Context(), claims.Subject, &withdrawBalance); err != nil {
-		gh.log.Log.Info("failed to withdraw balance", zap.Error(err))
 		switch {
 		case errors.Is(err, service.ErrInvalidWithdrawSum):
+			gh.log.Ctx(r.Context()).Debug("failed to withdraw balance", zap.Error(err))
 			w.WriteHeader(http.StatusPaymentRequired)
 			return
 		case errors.Is(err, service.ErrNumberIsNotCorrect):
+			gh.log.Ctx(r.Context()).Debug("failed to withdraw balance", zap.Error(err))
 			w.WriteHeader(http.StatusUnprocessableEntity)
 			return
 		default:
+			gh.log.Ctx(r.Context()).Error("failed to withdraw balance", zap.Error(err))
 			w.WriteHeader(http.StatusInternalServerError)
 			return
 		}
@@ -71,7 +73,7 @@ func (gh *GophermartWithdrawHandlers) WithdrawBalanceHandler(w http.ResponseWrit
 func (gh *GophermartWithdrawHandlers) WithdrawAlsHandler(w http.ResponseWriter, r *http.Request) {
 	claims, ok := r.Context().Value(middlewares.ContextClaims).(*jwt.JWTClaims)
 	if !ok {
-		gh.log.Log.Info("cannot get jwt claims")
+		gh.log.Ctx(r.Context()).Debug("cannot get jwt claims")
 		render.Status(r, http.StatusBadRequest)
 		render.PlainText(w, r, "")
 		return
@@ -79,17 +81,23 @@ func (gh *GophermartWithdrawHandlers) WithdrawAlsHandler(w http.ResponseWriter,
 
 	withdrawAls, err := gh.service.GetWithdrawalService(r.Context(), claims.Subject)
 	if err != nil {
-		gh.log.Log.Info(err.Error())
 		if errors.Is(err, sql.ErrNoRows) {
+			gh.log.Ctx(r.Context()).Debug(err.Error())
 			render.Status(r, http.StatusNoContent)
 			render.PlainText(w, r, "")
 			return
 		}
+		gh.log.Ctx(r.Context()).Error(err.Error())
 		render.Status(r, http.StatusInternalServerError)
 		render.PlainText(w, r, "")
 		return
 	}
 
+	if len(withdrawAls) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
 	render.Status(r, http.StatusOK)
 	render.JSON(w, r, withdrawAls)
 }
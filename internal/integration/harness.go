@@ -0,0 +1,252 @@
+package integration
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/internal/app"
+	"github.com/AndreyKuskov2/gophermart/internal/config"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// Harness runs the full gophermart router in-process against a storage
+// backend and an accrual system mock. Besides the default tenant it serves
+// the tenants listed in Tenants, each with an accrual mock of its own. The
+// default tenant has the admin "admin" and the partner "partner", both with
+// the password "secret".
+type Harness struct {
+	t             *testing.T
+	URL           string
+	Accrual       *accrualmock.Server
+	TenantAccrual map[string]*accrualmock.Server
+	Storage       storage.Storager
+	Processor     *app.AccrualProcessor
+	Tiers         *app.TierRecalculator
+	Reconciler    *app.Reconciler
+
+	tenant string
+	host   string
+	ip     string
+}
+
+// Tenants are the extra tenants configured by the harness. Each one is
+// reachable by the X-Tenant-ID header or by its "<id>.test" host.
+var Tenants = []string{"acme", "globex"}
+
+type Response struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+}
+
+func NewMemory(t *testing.T) *Harness {
+	return New(t, storage.NewMemory())
+}
+
+// NewPostgres creates a fresh database on pg, applies the migrations and
+// returns a harness backed by it. The database is dropped on cleanup.
+func NewPostgres(t *testing.T, pg *Postgres) *Harness {
+	t.Helper()
+
+	dsn, drop, err := pg.CreateDatabase(context.Background())
+	require.NoError(t, err)
+	t.Cleanup(drop)
+
+	require.NoError(t, storage.MigrateUp(dsn))
+
+	db, err := storage.NewPostgres(dsn)
+	require.NoError(t, err)
+	t.Cleanup(db.Close)
+
+	return New(t, db)
+}
+
+func New(t *testing.T, s storage.Storager) *Harness {
+	t.Helper()
+
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	accrual := accrualmock.New()
+	accrualServer := httptest.NewServer(accrual)
+	t.Cleanup(accrualServer.Close)
+
+	cfg := &config.Config{
+		AccrualSystemAddress:  accrualServer.URL,
+		JWTSecretToken:        "integration-test-secret",
+		TrustedProxies:        []string{"127.0.0.1", "::1"},
+		WorkerCount:           4,
+		DeletionGraceDays:     30,
+		TransferDailyLimit:    500,
+		TransferDailyCount:    3,
+		ReferralReferrerBonus: 100,
+		ReferralRefereeBonus:  50,
+		TierWindowDays:        90,
+		ReconcileWindowHours:  24,
+		ReconcileAutoCorrect:  true,
+	}
+
+	tenantAccrual := make(map[string]*accrualmock.Server, len(Tenants))
+	for _, id := range Tenants {
+		mock := accrualmock.New()
+		mockServer := httptest.NewServer(mock)
+		t.Cleanup(mockServer.Close)
+
+		tenantAccrual[id] = mock
+		cfg.Tenants = append(cfg.Tenants, config.Tenant{
+			ID:                   id,
+			Hosts:                []string{id + ".test"},
+			AccrualSystemAddress: mockServer.URL,
+			JWTSecretToken:       "integration-test-secret-" + id,
+		})
+	}
+
+	for _, role := range []struct {
+		login string
+		ids   *[]int
+	}{{"admin", &cfg.AdminUserIDs}, {"partner", &cfg.PartnerUserIDs}} {
+		userID, err := s.CreateUser(context.Background(), models.UserCreditials{Login: role.login, Password: "secret"})
+		require.NoError(t, err)
+		*role.ids = append(*role.ids, userID)
+	}
+
+	hub := events.NewHub()
+	var publisher app.OrderEventPublisher = hub
+	if pg, ok := s.(*storage.Postgres); ok {
+		notifier := events.NewPostgresNotifier(pg.DB, log)
+		ctx, cancel := context.WithCancel(context.Background())
+		t.Cleanup(cancel)
+		go notifier.Listen(ctx, hub)
+		publisher = notifier
+	}
+
+	gophermart, err := app.NewApp(cfg, log, s, hub, publisher)
+	require.NoError(t, err)
+	gophermart.OnAPIResponseError = func(r *http.Request, err error) {
+		t.Errorf("%s %s: response does not match openapi specification: %v", r.Method, r.URL.Path, err)
+	}
+	server := httptest.NewServer(gophermart.GophermartRouter())
+	t.Cleanup(server.Close)
+
+	return &Harness{
+		t:             t,
+		URL:           server.URL,
+		Accrual:       accrual,
+		TenantAccrual: tenantAccrual,
+		Storage:       s,
+		Processor:     gophermart.Processor,
+		Tiers:         gophermart.Tiers,
+		Reconciler:    gophermart.Reconciler,
+	}
+}
+
+// WithTenant returns a copy of the harness whose requests carry the
+// X-Tenant-ID header.
+func (h *Harness) WithTenant(id string) *Harness {
+	tenantHarness := *h
+	tenantHarness.tenant = id
+	return &tenantHarness
+}
+
+// WithHost returns a copy of the harness whose requests are sent with the
+// given Host header.
+func (h *Harness) WithHost(host string) *Harness {
+	hostHarness := *h
+	hostHarness.host = host
+	return &hostHarness
+}
+
+// WithIP returns a copy of the harness whose requests appear to come from
+// ip by the X-Real-IP header, which the server trusts from the loopback
+// address the harness connects from.
+func (h *Harness) WithIP(ip string) *Harness {
+	ipHarness := *h
+	ipHarness.ip = ip
+	return &ipHarness
+}
+
+// ProcessAccruals polls the accrual mock once for every pending order.
+func (h *Harness) ProcessAccruals() {
+	h.Processor.ProcessPendingOrders(context.Background(), 4)
+}
+
+// RecalculateTiers runs the loyalty tier recalculation of every tenant once.
+func (h *Harness) RecalculateTiers() {
+	h.Tiers.Recalculate(context.Background())
+}
+
+// Reconcile compares the settled orders of every tenant with the accrual
+// mocks once, correcting the orders that differ.
+func (h *Harness) Reconcile() *models.ReconcileReport {
+	return h.Reconciler.Reconcile(context.Background())
+}
+
+func (h *Harness) Do(method, path, token, contentType, body string) *Response {
+	h.t.Helper()
+
+	request, err := http.NewRequest(method, h.URL+path, strings.NewReader(body))
+	require.NoError(h.t, err)
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if h.tenant != "" {
+		request.Header.Set(tenant.Header, h.tenant)
+	}
+	if h.host != "" {
+		request.Host = h.host
+	}
+	if h.ip != "" {
+		request.Header.Set("X-Real-IP", h.ip)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	require.NoError(h.t, err)
+	defer response.Body.Close()
+
+	responseBody, err := io.ReadAll(response.Body)
+	require.NoError(h.t, err)
+
+	return &Response{
+		StatusCode: response.StatusCode,
+		Header:     response.Header,
+		Body:       responseBody,
+	}
+}
+
+func (h *Harness) Register(login, password string) string {
+	h.t.Helper()
+
+	response := h.Do(http.MethodPost, "/api/user/register", "", "application/json",
+		`{"login":"`+login+`","password":"`+password+`"}`)
+	require.Equal(h.t, http.StatusOK, response.StatusCode)
+
+	token := response.Header.Get("Authorization")
+	require.NotEmpty(h.t, token)
+	return token
+}
+
+// Login returns the token of an existing user.
+func (h *Harness) Login(login, password string) string {
+	h.t.Helper()
+
+	response := h.Do(http.MethodPost, "/api/user/login", "", "application/json",
+		`{"login":"`+login+`","password":"`+password+`"}`)
+	require.Equal(h.t, http.StatusOK, response.StatusCode)
+
+	token := response.Header.Get("Authorization")
+	require.NotEmpty(h.t, token)
+	return token
+}
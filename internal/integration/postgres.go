@@ -0,0 +1,148 @@
+package integration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+var ErrPostgresUnavailable = errors.New("postgres is unavailable: set TEST_DATABASE_URI or install initdb and pg_ctl")
+
+// Postgres is a server used by integration tests. It is either an existing
+// server from TEST_DATABASE_URI or a disposable cluster started from local
+// binaries found in POSTGRES_BIN_DIR, PATH or /usr/lib/postgresql/*/bin.
+type Postgres struct {
+	adminDSN string
+	dataDir  string
+	pgCtl    string
+}
+
+func StartPostgres() (*Postgres, error) {
+	if dsn := os.Getenv("TEST_DATABASE_URI"); dsn != "" {
+		return &Postgres{adminDSN: dsn}, nil
+	}
+
+	initdb, pgCtl, err := findPostgresBinaries()
+	if err != nil {
+		return nil, err
+	}
+
+	dataDir, err := os.MkdirTemp("", "gophermart-pg-")
+	if err != nil {
+		return nil, err
+	}
+
+	init := exec.Command(initdb, "-D", dataDir, "-U", "postgres", "--auth=trust", "--no-sync", "-E", "UTF8")
+	if out, err := init.CombinedOutput(); err != nil {
+		os.RemoveAll(dataDir)
+		return nil, fmt.Errorf("initdb failed: %v: %s", err, out)
+	}
+
+	port, err := freePort()
+	if err != nil {
+		os.RemoveAll(dataDir)
+		return nil, err
+	}
+
+	options := fmt.Sprintf("-p %d -k %s -c listen_addresses=127.0.0.1 -c fsync=off", port, dataDir)
+	start := exec.Command(pgCtl, "-D", dataDir, "-l", filepath.Join(dataDir, "postgres.log"), "-o", options, "-w", "start")
+	if out, err := start.CombinedOutput(); err != nil {
+		os.RemoveAll(dataDir)
+		return nil, fmt.Errorf("pg_ctl start failed: %v: %s", err, out)
+	}
+
+	return &Postgres{
+		adminDSN: fmt.Sprintf("postgres://postgres@127.0.0.1:%d/postgres?sslmode=disable", port),
+		dataDir:  dataDir,
+		pgCtl:    pgCtl,
+	}, nil
+}
+
+// Stop shuts down a cluster started by StartPostgres. It does nothing for
+// servers configured with TEST_DATABASE_URI.
+func (p *Postgres) Stop() {
+	if p.dataDir == "" {
+		return
+	}
+	exec.Command(p.pgCtl, "-D", p.dataDir, "-m", "immediate", "-w", "stop").Run()
+	os.RemoveAll(p.dataDir)
+}
+
+// CreateDatabase creates an empty database and returns its DSN together
+// with a function that drops it.
+func (p *Postgres) CreateDatabase(ctx context.Context) (string, func(), error) {
+	dsn, err := url.Parse(p.adminDSN)
+	if err != nil {
+		return "", nil, fmt.Errorf("TEST_DATABASE_URI must be an URL: %v", err)
+	}
+
+	conn, err := pgx.Connect(ctx, p.adminDSN)
+	if err != nil {
+		return "", nil, err
+	}
+	defer conn.Close(ctx)
+
+	name := fmt.Sprintf("gophermart_test_%d", time.Now().UnixNano())
+	if _, err := conn.Exec(ctx, "CREATE DATABASE "+name); err != nil {
+		return "", nil, err
+	}
+
+	drop := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+
+		conn, err := pgx.Connect(ctx, p.adminDSN)
+		if err != nil {
+			return
+		}
+		defer conn.Close(ctx)
+		conn.Exec(ctx, "DROP DATABASE IF EXISTS "+name+" WITH (FORCE)")
+	}
+
+	dsn.Path = "/" + name
+	return dsn.String(), drop, nil
+}
+
+func findPostgresBinaries() (string, string, error) {
+	dirs := []string{}
+	if dir := os.Getenv("POSTGRES_BIN_DIR"); dir != "" {
+		dirs = append(dirs, dir)
+	}
+	if initdb, err := exec.LookPath("initdb"); err == nil {
+		dirs = append(dirs, filepath.Dir(initdb))
+	}
+	if matches, err := filepath.Glob("/usr/lib/postgresql/*/bin"); err == nil {
+		dirs = append(dirs, matches...)
+	}
+
+	for _, dir := range dirs {
+		initdb := filepath.Join(dir, "initdb")
+		pgCtl := filepath.Join(dir, "pg_ctl")
+		if isExecutable(initdb) && isExecutable(pgCtl) {
+			return initdb, pgCtl, nil
+		}
+	}
+	return "", "", ErrPostgresUnavailable
+}
+
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && !info.IsDir() && info.Mode()&0o111 != 0
+}
+
+func freePort() (int, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return 0, err
+	}
+	defer listener.Close()
+	return listener.Addr().(*net.TCPAddr).Port, nil
+}
@@ -0,0 +1,1066 @@
+package integration
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var postgres *Postgres
+
+func TestMain(m *testing.M) {
+	pg, err := StartPostgres()
+	if err != nil && !errors.Is(err, ErrPostgresUnavailable) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	postgres = pg
+
+	code := m.Run()
+	if postgres != nil {
+		postgres.Stop()
+	}
+	os.Exit(code)
+}
+
+func forEachBackend(t *testing.T, scenario func(t *testing.T, h *Harness)) {
+	t.Run("memory", func(t *testing.T) {
+		scenario(t, NewMemory(t))
+	})
+	t.Run("postgres", func(t *testing.T) {
+		if postgres == nil {
+			t.Skip(ErrPostgresUnavailable.Error())
+		}
+		scenario(t, NewPostgres(t, postgres))
+	})
+}
+
+func decodeJSON[T any](t *testing.T, response *Response) T {
+	t.Helper()
+	var value T
+	require.NoError(t, json.Unmarshal(response.Body, &value))
+	return value
+}
+
+func TestScenario_RegisterAndLogin(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		h.Register("alice", "secret")
+
+		response := h.Do(http.MethodPost, "/api/user/register", "", "application/json", `{"login":"alice","password":"other"}`)
+		assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/register", "", "application/json", `{"login":"bob"}`)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"secret"}`)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		assert.NotEmpty(t, response.Header.Get("Authorization"))
+
+		response = h.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"wrong"}`)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"nobody","password":"secret"}`)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+	})
+}
+
+func TestScenario_UploadOrders(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		alice := h.Register("alice", "secret")
+		bob := h.Register("bob", "secret")
+
+		response := h.Do(http.MethodGet, "/api/user/orders", alice, "", "")
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/orders", "", "text/plain", "79927398713")
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/balance/withdraw", "", "application/json", `{"order":1}`)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode, "authentication comes before validation")
+
+		response = h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398713")
+		assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398713")
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/orders", bob, "text/plain", "79927398713")
+		assert.Equal(t, http.StatusConflict, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398710")
+		assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "12345678903")
+		assert.Equal(t, http.StatusAccepted, response.StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/orders", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		orders := decodeJSON[[]models.Orders](t, response)
+		require.Len(t, orders, 2)
+		assert.Equal(t, "12345678903", orders[0].Number)
+		assert.Equal(t, "NEW", orders[0].Status)
+
+		response = h.Do(http.MethodGet, "/api/user/orders/79927398713", bob, "", "")
+		assert.Equal(t, http.StatusNotFound, response.StatusCode)
+	})
+}
+
+func TestScenario_AccrualBalanceAndWithdrawals(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		token := h.Register("alice", "secret")
+		h.Accrual.Script("79927398713", accrualmock.Registered(), accrualmock.Processing(), accrualmock.Processed(729.98))
+		h.Accrual.Script("12345678903", accrualmock.Invalid())
+
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713").StatusCode)
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "12345678903").StatusCode)
+
+		for i := 0; i < 3; i++ {
+			h.ProcessAccruals()
+		}
+
+		response := h.Do(http.MethodGet, "/api/user/orders/79927398713", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		details := decodeJSON[models.OrderDetails](t, response)
+		assert.Equal(t, "PROCESSED", details.Status)
+		assert.InDelta(t, 729.98, details.Accrual, 0.001)
+		require.Len(t, details.History, 3)
+		assert.Equal(t, "PROCESSING", details.History[1].Status)
+
+		response = h.Do(http.MethodGet, "/api/user/orders/12345678903", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "INVALID", decodeJSON[models.OrderDetails](t, response).Status)
+
+		response = h.Do(http.MethodGet, "/api/user/balance", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.InDelta(t, 729.98, balance.Current, 0.001)
+		assert.Zero(t, balance.Withdrawn)
+
+		response = h.Do(http.MethodGet, "/api/user/withdrawals", token, "", "")
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225624","sum":751}`)
+		assert.Equal(t, http.StatusPaymentRequired, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225625","sum":10}`)
+		assert.Equal(t, http.StatusUnprocessableEntity, response.StatusCode)
+
+		response = h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225624","sum":700}`)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/balance", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance = decodeJSON[models.Balance](t, response)
+		assert.InDelta(t, 29.98, balance.Current, 0.001)
+		assert.InDelta(t, 700, balance.Withdrawn, 0.001)
+
+		response = h.Do(http.MethodGet, "/api/user/withdrawals", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		withdrawals := decodeJSON[[]models.WithdrawBalance](t, response)
+		require.Len(t, withdrawals, 1)
+		assert.Equal(t, "2377225624", withdrawals[0].OrderNumber)
+		assert.InDelta(t, 700, withdrawals[0].Amount, 0.001)
+	})
+}
+
+func TestScenario_ConcurrentWithdrawals(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		token := h.Register("alice", "secret")
+		h.Accrual.Script("79927398713", accrualmock.Processed(500))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+
+		const attempts = 20
+		var wg sync.WaitGroup
+		codes := make(chan int, attempts)
+		for i := 0; i < attempts; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				codes <- h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225624","sum":100}`).StatusCode
+			}()
+		}
+		wg.Wait()
+		close(codes)
+
+		counts := map[int]int{}
+		for code := range codes {
+			counts[code]++
+		}
+		assert.Equal(t, map[int]int{http.StatusOK: 5, http.StatusPaymentRequired: attempts - 5}, counts)
+
+		response := h.Do(http.MethodGet, "/api/user/balance", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.InDelta(t, 0, balance.Current, 0.001)
+		assert.InDelta(t, 500, balance.Withdrawn, 0.001)
+	})
+}
+
+func TestScenario_ConcurrentWithdrawalsOfDifferentUsers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		tokens := []string{h.Register("alice", "secret"), h.Register("bob", "secret")}
+		numbers := []string{"79927398713", "12345678903"}
+		for i, token := range tokens {
+			h.Accrual.Script(numbers[i], accrualmock.Processed(100))
+			require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", numbers[i]).StatusCode)
+		}
+		h.ProcessAccruals()
+
+		var wg sync.WaitGroup
+		for _, token := range tokens {
+			for i := 0; i < 4; i++ {
+				wg.Add(1)
+				go func(token string) {
+					defer wg.Done()
+					h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225624","sum":50}`)
+				}(token)
+			}
+		}
+		wg.Wait()
+
+		for _, token := range tokens {
+			response := h.Do(http.MethodGet, "/api/user/balance", token, "", "")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			balance := decodeJSON[models.Balance](t, response)
+			assert.InDelta(t, 0, balance.Current, 0.001)
+			assert.InDelta(t, 100, balance.Withdrawn, 0.001)
+		}
+	})
+}
+
+func TestScenario_AuditLog(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		adminToken := h.Login("admin", "secret")
+		token := h.Register("alice", "secret")
+		h.Accrual.Script("79927398713", accrualmock.Processed(500))
+
+		require.Equal(t, http.StatusUnauthorized, h.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"wrong"}`).StatusCode)
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+		require.Equal(t, http.StatusOK, h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225624","sum":100}`).StatusCode)
+
+		assert.Equal(t, http.StatusUnauthorized, h.Do(http.MethodGet, "/api/admin/audit", "", "", "").StatusCode)
+		assert.Equal(t, http.StatusForbidden, h.Do(http.MethodGet, "/api/admin/audit", token, "", "").StatusCode)
+		assert.Equal(t, http.StatusBadRequest, h.Do(http.MethodGet, "/api/admin/audit?from=yesterday", adminToken, "", "").StatusCode)
+
+		response := h.Do(http.MethodGet, "/api/admin/audit?type=balance.withdrawn", adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		withdrawals := decodeJSON[[]models.AuditEvent](t, response)
+		require.Len(t, withdrawals, 1)
+		assert.Equal(t, "127.0.0.1", withdrawals[0].IP)
+		assert.Equal(t, "Go-http-client/1.1", withdrawals[0].UserAgent)
+		assert.NotEmpty(t, withdrawals[0].RequestID)
+		assert.JSONEq(t, `{"order":"2377225624","sum":100}`, string(withdrawals[0].Details))
+		require.NotNil(t, withdrawals[0].UserID)
+
+		response = h.Do(http.MethodGet, "/api/admin/audit?user_id="+strconv.Itoa(*withdrawals[0].UserID), adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		var types []string
+		for _, event := range decodeJSON[[]models.AuditEvent](t, response) {
+			types = append(types, event.EventType)
+		}
+		assert.Equal(t, []string{audit.EventWithdrawal, audit.EventOrderUploaded, audit.EventTokenIssued, audit.EventUserRegistered}, types)
+
+		response = h.Do(http.MethodGet, "/api/admin/audit?type=user.login_failed&limit=1", adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		failed := decodeJSON[[]models.AuditEvent](t, response)
+		require.Len(t, failed, 1)
+		assert.Nil(t, failed[0].UserID)
+		assert.JSONEq(t, `{"login":"alice"}`, string(failed[0].Details))
+
+		response = h.Do(http.MethodGet, "/api/admin/audit/verify", adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		status := decodeJSON[models.AuditChainStatus](t, response)
+		assert.True(t, status.Valid)
+		assert.Positive(t, status.Checked)
+
+		response = h.Do(http.MethodGet, "/api/admin/audit?type=admin.audit_queried", adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Len(t, decodeJSON[[]models.AuditEvent](t, response), 4, "admin queries are audited")
+	})
+}
+
+func TestScenario_AdminRightsGoByUserID(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		// Logins are unique per tenant only, so "admin" can be registered on
+		// another tenant without its rights.
+		acme := h.WithTenant("acme")
+		for _, login := range []string{"admin", "partner"} {
+			token := acme.Register(login, "secret")
+			assert.Equal(t, http.StatusForbidden, acme.Do(http.MethodGet, "/api/admin/audit", token, "", "").StatusCode)
+			assert.Equal(t, http.StatusForbidden, acme.Do(http.MethodPost, "/api/partner/orders/79927398713/cancel", token, "", "").StatusCode)
+		}
+
+		admin := h.Login("admin", "secret")
+		assert.Equal(t, http.StatusOK, h.Do(http.MethodGet, "/api/admin/audit", admin, "", "").StatusCode)
+	})
+}
+
+func TestScenario_ProfileExportAndDeletion(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		token := h.Register("alice", "secret")
+		h.Accrual.Script("79927398713", accrualmock.Processed(500))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+		require.Equal(t, http.StatusOK, h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225624","sum":100}`).StatusCode)
+		h.Register("bob", "secret")
+		require.Equal(t, http.StatusOK, h.Do(http.MethodPost, "/api/user/balance/transfer", token, "application/json", `{"recipient":"bob","sum":50}`).StatusCode)
+
+		response := h.Do(http.MethodGet, "/api/user/profile", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		profile := decodeJSON[models.User](t, response)
+		assert.Equal(t, "alice", profile.Login)
+		assert.Empty(t, profile.Email)
+
+		assert.Equal(t, http.StatusBadRequest, h.Do(http.MethodPatch, "/api/user/profile", token, "application/json", `{}`).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, h.Do(http.MethodPatch, "/api/user/profile", token, "application/json", `{"email":"not an email"}`).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, h.Do(http.MethodPatch, "/api/user/profile", token, "application/json", `{"login":"bob"}`).StatusCode)
+
+		response = h.Do(http.MethodPatch, "/api/user/profile", token, "application/json", `{"email":"alice@example.com","display_name":"Alice"}`)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		profile = decodeJSON[models.User](t, response)
+		assert.Equal(t, "alice@example.com", profile.Email)
+		assert.Equal(t, "Alice", profile.DisplayName)
+
+		response = h.Do(http.MethodGet, "/api/user/export", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		export := decodeJSON[models.UserExport](t, response)
+		assert.Equal(t, "alice@example.com", export.Profile.Email)
+		require.Len(t, export.Orders, 1)
+		assert.Equal(t, "PROCESSED", export.Orders[0].Status)
+		assert.NotEmpty(t, export.Orders[0].History)
+		require.Len(t, export.Withdrawals, 1)
+		assert.Equal(t, "2377225624", export.Withdrawals[0].OrderNumber)
+		require.Len(t, export.Transfers, 1)
+		assert.Equal(t, "bob", export.Transfers[0].Counterparty)
+		assert.NotNil(t, export.Bonuses)
+		assert.NotNil(t, export.Referrals)
+		assert.NotNil(t, export.TierHistory)
+		assert.NotNil(t, export.Clawbacks)
+		require.NotEmpty(t, export.AuditEvents)
+		assert.Equal(t, audit.EventDataExported, export.AuditEvents[0].EventType)
+		assert.Equal(t, audit.EventUserRegistered, export.AuditEvents[len(export.AuditEvents)-1].EventType)
+
+		response = h.Do(http.MethodGet, "/api/user/export?format=zip", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "application/zip", response.Header.Get("Content-Type"))
+		archive, err := zip.NewReader(bytes.NewReader(response.Body), int64(len(response.Body)))
+		require.NoError(t, err)
+		var names []string
+		for _, file := range archive.File {
+			names = append(names, file.Name)
+		}
+		assert.Equal(t, []string{"profile.json", "orders.json", "withdrawals.json", "transfers.json", "bonuses.json", "referrals.json", "tier_history.json", "clawbacks.json", "audit_events.json"}, names)
+
+		assert.Equal(t, http.StatusBadRequest, h.Do(http.MethodGet, "/api/user/export?format=xml", token, "", "").StatusCode)
+
+		assert.Equal(t, http.StatusBadRequest, h.Do(http.MethodDelete, "/api/user", token, "application/json", `{}`).StatusCode)
+		assert.Equal(t, http.StatusForbidden, h.Do(http.MethodDelete, "/api/user", token, "application/json", `{"password":"wrong"}`).StatusCode)
+
+		response = h.Do(http.MethodDelete, "/api/user", token, "application/json", `{"password":"secret"}`)
+		require.Equal(t, http.StatusAccepted, response.StatusCode)
+		deletion := decodeJSON[models.AccountDeletion](t, response)
+		assert.WithinDuration(t, deletion.DeletedAt.Add(30*24*time.Hour), deletion.PurgeAt, time.Second)
+
+		response = h.Do(http.MethodGet, "/api/user/profile", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.NotNil(t, decodeJSON[models.User](t, response).DeletedAt)
+
+		// Logging in during the grace period cancels the deletion.
+		response = h.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"secret"}`)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		token = response.Header.Get("Authorization")
+		response = h.Do(http.MethodGet, "/api/user/profile", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Nil(t, decodeJSON[models.User](t, response).DeletedAt)
+
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodDelete, "/api/user", token, "application/json", `{"password":"secret"}`).StatusCode)
+		purged, err := h.Storage.PurgeDeletedUsers(context.Background(), time.Now())
+		require.NoError(t, err)
+		assert.Len(t, purged, 1)
+
+		assert.Equal(t, http.StatusNotFound, h.Do(http.MethodGet, "/api/user/profile", token, "", "").StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, h.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"secret"}`).StatusCode)
+		_, err = h.Storage.GetOrderByNumber(context.Background(), "79927398713")
+		assert.Error(t, err)
+	})
+}
+
+func TestScenario_Transfers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		alice := h.Register("alice", "secret")
+		bob := h.Register("bob", "secret")
+		h.Accrual.Script("79927398713", accrualmock.Processed(600))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+
+		response := h.Do(http.MethodGet, "/api/user/transfers", alice, "", "")
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+		transfer := func(token, body string) *Response {
+			return h.Do(http.MethodPost, "/api/user/balance/transfer", token, "application/json", body)
+		}
+
+		response = transfer(alice, `{"recipient":"bob","sum":100,"memo":"happy birthday"}`)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		sent := decodeJSON[models.Transfer](t, response)
+		assert.Equal(t, models.TransferSent, sent.Direction)
+		assert.Equal(t, "bob", sent.Counterparty)
+		assert.InDelta(t, 100, sent.Amount, 0.001)
+
+		assert.Equal(t, http.StatusBadRequest, transfer(alice, `{"sum":1}`).StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, transfer("", `{"recipient":"bob","sum":1}`).StatusCode)
+		assert.Equal(t, http.StatusNotFound, transfer(alice, `{"recipient":"carol","sum":1}`).StatusCode)
+		assert.Equal(t, http.StatusUnprocessableEntity, transfer(alice, `{"recipient":"alice","sum":1}`).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, transfer(alice, `{"recipient":"bob","sum":-1}`).StatusCode)
+		assert.Equal(t, http.StatusPaymentRequired, transfer(bob, `{"recipient":"alice","sum":101}`).StatusCode)
+		assert.Equal(t, http.StatusTooManyRequests, transfer(alice, `{"recipient":"bob","sum":401}`).StatusCode, "over the daily sum")
+
+		require.Equal(t, http.StatusOK, transfer(bob, `{"recipient":"alice","sum":40}`).StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/balance", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.InDelta(t, 540, balance.Current, 0.001)
+		assert.InDelta(t, 40, balance.TransferredIn, 0.001)
+		assert.InDelta(t, 100, balance.TransferredOut, 0.001)
+
+		// Received points can be spent like accrued ones.
+		response = h.Do(http.MethodPost, "/api/user/balance/withdraw", bob, "application/json", `{"order":"2377225624","sum":60}`)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/transfers", bob, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		transfers := decodeJSON[[]models.Transfer](t, response)
+		require.Len(t, transfers, 2)
+		assert.Equal(t, models.TransferSent, transfers[0].Direction)
+		assert.Equal(t, "alice", transfers[0].Counterparty)
+		assert.Equal(t, models.TransferReceived, transfers[1].Direction)
+		assert.Equal(t, "happy birthday", transfers[1].Memo)
+
+		require.Equal(t, http.StatusOK, transfer(alice, `{"recipient":"bob","sum":1}`).StatusCode)
+		require.Equal(t, http.StatusOK, transfer(alice, `{"recipient":"bob","sum":1}`).StatusCode)
+		response = transfer(alice, `{"recipient":"bob","sum":1}`)
+		assert.Equal(t, http.StatusTooManyRequests, response.StatusCode, "over the daily count")
+		retryAfter, err := strconv.Atoi(response.Header.Get("Retry-After"))
+		require.NoError(t, err)
+		assert.True(t, retryAfter > 0 && retryAfter <= 24*60*60+1, retryAfter)
+
+		response = h.Do(http.MethodGet, "/api/user/statement", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		statement := decodeJSON[struct {
+			Entries             []models.StatementEntry `json:"entries"`
+			TotalTransferredIn  float64                 `json:"total_transferred_in"`
+			TotalTransferredOut float64                 `json:"total_transferred_out"`
+			ClosingBalance      float64                 `json:"closing_balance"`
+		}](t, response)
+		require.Len(t, statement.Entries, 5)
+		assert.Equal(t, models.StatementTransferOut, statement.Entries[1].Type)
+		assert.Equal(t, "bob", statement.Entries[1].Counterparty)
+		assert.Equal(t, 40.0, statement.TotalTransferredIn)
+		assert.Equal(t, 102.0, statement.TotalTransferredOut)
+		assert.Equal(t, 538.0, statement.ClosingBalance)
+	})
+}
+
+func TestScenario_Campaigns(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		admin := h.Login("admin", "secret")
+		alice := h.Register("alice", "secret")
+
+		create := func(token, body string) *Response {
+			return h.Do(http.MethodPost, "/api/admin/campaigns", token, "application/json", body)
+		}
+
+		assert.Equal(t, http.StatusNoContent, h.Do(http.MethodGet, "/api/admin/campaigns", admin, "", "").StatusCode)
+		assert.Equal(t, http.StatusForbidden, create(alice, `{"name":"Welcome","rule":{"type":"first_order","amount":50}}`).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, create(admin, `{"rule":{"type":"first_order","amount":50}}`).StatusCode)
+		assert.Equal(t, http.StatusUnprocessableEntity, create(admin, `{"name":"Double","rule":{"type":"multiplier","multiplier":1}}`).StatusCode)
+
+		response := create(admin, `{"name":"Welcome","rule":{"type":"first_order","amount":50}}`)
+		require.Equal(t, http.StatusCreated, response.StatusCode)
+		welcome := decodeJSON[models.Campaign](t, response)
+		assert.True(t, welcome.Enabled)
+		response = create(admin, `{"name":"Double","rule":{"type":"multiplier","multiplier":2},"monthly_cap":120}`)
+		require.Equal(t, http.StatusCreated, response.StatusCode)
+		double := decodeJSON[models.Campaign](t, response)
+
+		// The first order earns both bonuses, the second one only what is left
+		// of the monthly cap of the multiplier.
+		h.Accrual.Script("79927398713", accrualmock.Processed(100))
+		h.Accrual.Script("12345678903", accrualmock.Processed(100))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "12345678903").StatusCode)
+		h.ProcessAccruals()
+		h.ProcessAccruals()
+
+		response = h.Do(http.MethodGet, "/api/user/balance", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.InDelta(t, 370, balance.Current, 0.001)
+		assert.InDelta(t, 170, balance.Bonus, 0.001)
+
+		response = h.Do(http.MethodGet, "/api/user/statement", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		totals := decodeJSON[struct {
+			TotalAccrued float64 `json:"total_accrued"`
+			TotalBonus   float64 `json:"total_bonus"`
+		}](t, response)
+		assert.Equal(t, float64(170), totals.TotalBonus)
+		assert.Equal(t, float64(200), totals.TotalAccrued)
+
+		response = h.Do(http.MethodPost, "/api/admin/campaigns/dry-run", admin, "application/json",
+			`{"campaign":{"name":"Triple","rule":{"type":"multiplier","multiplier":3},"monthly_cap":300}}`)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		preview := decodeJSON[models.CampaignPreview](t, response)
+		assert.Equal(t, 2, preview.Orders)
+		assert.Equal(t, 1, preview.Users)
+		assert.Equal(t, float64(300), preview.TotalBonus)
+		require.Len(t, preview.Bonuses, 2)
+		assert.Equal(t, float64(100), preview.Bonuses[1].Amount, "the preview applies the cap")
+		assert.Equal(t, http.StatusUnprocessableEntity, h.Do(http.MethodPost, "/api/admin/campaigns/dry-run", admin, "application/json",
+			`{"campaign":{"name":"Nothing","rule":{"type":"first_order"}}}`).StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/admin/campaigns", admin, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Len(t, decodeJSON[[]models.Campaign](t, response), 2)
+
+		path := "/api/admin/campaigns/" + strconv.Itoa(welcome.CampaignID)
+		response = h.Do(http.MethodPut, path, admin, "application/json", `{"name":"Welcome back","rule":{"type":"first_order","amount":10},"enabled":false}`)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		updated := decodeJSON[models.Campaign](t, response)
+		assert.False(t, updated.Enabled)
+		assert.True(t, welcome.StartsAt.Equal(updated.StartsAt))
+
+		response = h.Do(http.MethodGet, path, admin, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "Welcome back", decodeJSON[models.Campaign](t, response).Name)
+
+		assert.Equal(t, http.StatusNoContent, h.Do(http.MethodDelete, "/api/admin/campaigns/"+strconv.Itoa(double.CampaignID), admin, "", "").StatusCode)
+		assert.Equal(t, http.StatusNotFound, h.Do(http.MethodGet, "/api/admin/campaigns/"+strconv.Itoa(double.CampaignID), admin, "", "").StatusCode)
+		assert.Equal(t, http.StatusNotFound, h.Do(http.MethodDelete, "/api/admin/campaigns/"+strconv.Itoa(double.CampaignID), admin, "", "").StatusCode)
+		assert.Equal(t, http.StatusBadRequest, h.Do(http.MethodGet, "/api/admin/campaigns/first", admin, "", "").StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/balance", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.InDelta(t, 370, decodeJSON[models.Balance](t, response).Current, 0.001, "bonuses outlive their campaign")
+
+		response = h.Do(http.MethodGet, "/api/admin/audit?type=balance.bonus_granted", admin, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Len(t, decodeJSON[[]models.AuditEvent](t, response), 3)
+		response = h.Do(http.MethodGet, "/api/admin/audit?type=admin.campaign_changed", admin, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Len(t, decodeJSON[[]models.AuditEvent](t, response), 4)
+	})
+}
+
+func TestScenario_Statement(t *testing.T) {
+	type statement struct {
+		Timezone       string                  `json:"timezone"`
+		OpeningBalance float64                 `json:"opening_balance"`
+		Entries        []models.StatementEntry `json:"entries"`
+		TotalAccrued   float64                 `json:"total_accrued"`
+		TotalWithdrawn float64                 `json:"total_withdrawn"`
+		ClosingBalance float64                 `json:"closing_balance"`
+	}
+
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		token := h.Register("alice", "secret")
+		h.Accrual.Script("79927398713", accrualmock.Processed(500))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+		require.Equal(t, http.StatusOK, h.Do(http.MethodPost, "/api/user/balance/withdraw", token, "application/json", `{"order":"2377225624","sum":100.25}`).StatusCode)
+
+		moscow, err := time.LoadLocation("Europe/Moscow")
+		require.NoError(t, err)
+		now := time.Now().In(moscow)
+		get := func(query url.Values) *Response {
+			return h.Do(http.MethodGet, "/api/user/statement?"+query.Encode(), token, "", "")
+		}
+
+		response := get(url.Values{
+			"from": {now.Add(-time.Hour).Format(time.RFC3339)},
+			"to":   {now.Add(time.Hour).Format(time.RFC3339)},
+			"tz":   {"Europe/Moscow"},
+		})
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		result := decodeJSON[statement](t, response)
+		assert.Equal(t, "Europe/Moscow", result.Timezone)
+		assert.Equal(t, float64(0), result.OpeningBalance)
+		require.Len(t, result.Entries, 2)
+		assert.Equal(t, models.StatementAccrual, result.Entries[0].Type)
+		assert.Equal(t, float64(500), result.Entries[0].Balance)
+		assert.Equal(t, models.StatementWithdrawal, result.Entries[1].Type)
+		assert.Equal(t, -100.25, result.Entries[1].Amount)
+		assert.Equal(t, 399.75, result.Entries[1].Balance)
+		_, offset := result.Entries[1].At.Zone()
+		assert.Equal(t, 3*60*60, offset, "timestamps are rendered in tz")
+		assert.Equal(t, float64(500), result.TotalAccrued)
+		assert.Equal(t, 100.25, result.TotalWithdrawn)
+		assert.Equal(t, 399.75, result.ClosingBalance)
+
+		// Dates are midnights in tz, the movements belong to today there.
+		today := now.Format("2006-01-02")
+		tomorrow := now.AddDate(0, 0, 1).Format("2006-01-02")
+		response = get(url.Values{"from": {today}, "to": {tomorrow}, "tz": {"Europe/Moscow"}})
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Len(t, decodeJSON[statement](t, response).Entries, 2)
+
+		response = get(url.Values{"from": {tomorrow}, "to": {now.AddDate(0, 0, 2).Format("2006-01-02")}, "tz": {"Europe/Moscow"}})
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		result = decodeJSON[statement](t, response)
+		assert.Empty(t, result.Entries)
+		assert.Equal(t, 399.75, result.OpeningBalance)
+		assert.Equal(t, 399.75, result.ClosingBalance)
+
+		response = get(url.Values{"from": {today}, "to": {tomorrow}, "tz": {"Europe/Moscow"}, "format": {"csv"}})
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, "text/csv; charset=utf-8", response.Header.Get("Content-Type"))
+		records, err := csv.NewReader(bytes.NewReader(response.Body)).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 11)
+		assert.Equal(t, []string{"date", "type", "order", "counterparty", "amount", "balance"}, records[0])
+		assert.Equal(t, []string{today + "T00:00:00+03:00", "opening_balance", "", "", "", "0.00"}, records[1])
+		assert.Equal(t, []string{"accrual", "79927398713", "", "500.00", "500.00"}, records[2][1:])
+		assert.Equal(t, []string{"withdrawal", "2377225624", "", "-100.25", "399.75"}, records[3][1:])
+		assert.Equal(t, []string{tomorrow + "T00:00:00+03:00", "total_accrued", "", "", "500.00", ""}, records[4])
+		assert.Equal(t, []string{"total_bonus", "", "", "0.00", ""}, records[5][1:])
+		assert.Equal(t, []string{"total_withdrawn", "", "", "-100.25", ""}, records[6][1:])
+		assert.Equal(t, []string{"total_transferred_in", "", "", "0.00", ""}, records[7][1:])
+		assert.Equal(t, []string{"total_transferred_out", "", "", "0.00", ""}, records[8][1:])
+		assert.Equal(t, []string{"total_clawed_back", "", "", "0.00", ""}, records[9][1:])
+		assert.Equal(t, []string{"closing_balance", "", "", "", "399.75"}, records[10][1:])
+
+		assert.Equal(t, http.StatusBadRequest, get(url.Values{"tz": {"Mars/Olympus_Mons"}}).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, get(url.Values{"from": {"yesterday"}}).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, get(url.Values{"from": {tomorrow}, "to": {today}}).StatusCode)
+		assert.Equal(t, http.StatusBadRequest, get(url.Values{"format": {"xml"}}).StatusCode)
+		assert.Equal(t, http.StatusUnauthorized, h.Do(http.MethodGet, "/api/user/statement", "", "", "").StatusCode)
+	})
+}
+
+func TestScenario_OrderStatusStream(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		alice := h.Register("alice", "secret")
+		bob := h.Register("bob", "secret")
+
+		response := h.Do(http.MethodGet, "/api/user/orders/stream", "", "", "")
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		request, err := http.NewRequestWithContext(ctx, http.MethodGet, h.URL+"/api/user/orders/stream", nil)
+		require.NoError(t, err)
+		request.Header.Set("Authorization", alice)
+		stream, err := http.DefaultClient.Do(request)
+		require.NoError(t, err)
+		defer stream.Body.Close()
+		require.Equal(t, http.StatusOK, stream.StatusCode)
+		assert.Equal(t, "text/event-stream", stream.Header.Get("Content-Type"))
+
+		h.Accrual.Script("12345678903", accrualmock.Processed(100))
+		h.Accrual.Script("79927398713", accrualmock.Processed(500))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", bob, "text/plain", "12345678903").StatusCode)
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+
+		scanner := bufio.NewScanner(stream.Body)
+		for scanner.Scan() {
+			data, ok := strings.CutPrefix(scanner.Text(), "data: ")
+			if !ok {
+				continue
+			}
+			var event events.OrderStatusChanged
+			require.NoError(t, json.Unmarshal([]byte(data), &event))
+			assert.Equal(t, "79927398713", event.Number)
+			assert.Equal(t, "PROCESSED", event.Status)
+			assert.InDelta(t, 500, event.Accrual, 0.001)
+			return
+		}
+		t.Fatalf("stream ended without events: %v", scanner.Err())
+	})
+}
+
+func TestScenario_Tenants(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		acme := h.WithTenant("acme")
+		globex := h.WithHost("globex.test")
+
+		acmeAlice := acme.Register("alice", "secret")
+		globexAlice := globex.Register("alice", "other")
+		defaultAlice := h.Register("alice", "third")
+
+		response := acme.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"other"}`)
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		response = globex.Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"other"}`)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+
+		response = h.WithTenant("initech").Do(http.MethodPost, "/api/user/login", "", "application/json", `{"login":"alice","password":"secret"}`)
+		assert.Equal(t, http.StatusBadRequest, response.StatusCode)
+
+		// A token only works within the tenant that issued it.
+		response = globex.Do(http.MethodGet, "/api/user/orders", acmeAlice, "", "")
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+		response = h.WithTenant("globex").Do(http.MethodGet, "/api/user/orders", defaultAlice, "", "")
+		assert.Equal(t, http.StatusUnauthorized, response.StatusCode)
+
+		h.TenantAccrual["acme"].Script("79927398713", accrualmock.Processed(100))
+		h.TenantAccrual["globex"].Script("79927398713", accrualmock.Processed(250))
+		h.Accrual.Script("79927398713", accrualmock.Processed(999))
+
+		require.Equal(t, http.StatusAccepted, acme.Do(http.MethodPost, "/api/user/orders", acmeAlice, "text/plain", "79927398713").StatusCode)
+		require.Equal(t, http.StatusAccepted, globex.Do(http.MethodPost, "/api/user/orders", globexAlice, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+
+		assert.Equal(t, 1, h.TenantAccrual["acme"].Calls("79927398713"))
+		assert.Equal(t, 1, h.TenantAccrual["globex"].Calls("79927398713"))
+		assert.Zero(t, h.Accrual.Calls("79927398713"))
+
+		// Without a header or a known host the tenant comes from the token.
+		response = h.Do(http.MethodGet, "/api/user/balance", acmeAlice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.InDelta(t, 100, decodeJSON[models.Balance](t, response).Current, 0.001)
+
+		response = globex.Do(http.MethodGet, "/api/user/balance", globexAlice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.InDelta(t, 250, decodeJSON[models.Balance](t, response).Current, 0.001)
+
+		response = h.Do(http.MethodGet, "/api/user/orders", defaultAlice, "", "")
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+		response = acme.Do(http.MethodPost, "/api/user/balance/withdraw", acmeAlice, "application/json", `{"order":"2377225624","sum":60}`)
+		assert.Equal(t, http.StatusOK, response.StatusCode)
+		response = globex.Do(http.MethodGet, "/api/user/withdrawals", globexAlice, "", "")
+		assert.Equal(t, http.StatusNoContent, response.StatusCode)
+
+		response = globex.Do(http.MethodGet, "/api/user/balance", globexAlice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.InDelta(t, 250, decodeJSON[models.Balance](t, response).Current, 0.001)
+	})
+}
+
+func TestScenario_Referrals(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		alice := h.WithIP("10.0.0.1").Register("alice", "secret")
+
+		response := h.WithIP("10.0.0.1").Do(http.MethodGet, "/api/user/referrals", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		summary := decodeJSON[models.ReferralSummary](t, response)
+		require.NotEmpty(t, summary.Code)
+		assert.Empty(t, summary.Referrals)
+
+		register := func(ip, login, code string) *Response {
+			return h.WithIP(ip).Do(http.MethodPost, "/api/user/register", "", "application/json",
+				`{"login":"`+login+`","password":"secret","referral_code":"`+code+`"}`)
+		}
+		assert.Equal(t, http.StatusUnprocessableEntity, register("10.0.0.2", "bob", "MISSING2").StatusCode)
+
+		response = register("10.0.0.2", "bob", strings.ToLower(summary.Code))
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		bob := response.Header.Get("Authorization")
+		// Signups from the address of alice or of bob are not rewarded.
+		require.Equal(t, http.StatusOK, register("10.0.0.1", "mallory", summary.Code).StatusCode)
+		require.Equal(t, http.StatusOK, register("10.0.0.2", "carol", summary.Code).StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/referrals", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		again := decodeJSON[models.ReferralSummary](t, response)
+		assert.Equal(t, summary.Code, again.Code, "the code is kept")
+		assert.Equal(t, 1, again.Pending)
+		assert.Equal(t, 2, again.Rejected)
+		require.Len(t, again.Referrals, 3)
+		assert.Equal(t, "carol", again.Referrals[0].Referee)
+		assert.Equal(t, models.ReferralSameIP, again.Referrals[0].Reason)
+
+		// Only the first processed order of bob rewards the referral.
+		h.Accrual.Script("79927398713", accrualmock.Processed(10))
+		h.Accrual.Script("12345678903", accrualmock.Processed(20))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", bob, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", bob, "text/plain", "12345678903").StatusCode)
+		h.ProcessAccruals()
+		h.ProcessAccruals()
+
+		response = h.Do(http.MethodGet, "/api/user/balance", bob, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.InDelta(t, 80, balance.Current, 0.001)
+		assert.InDelta(t, 50, balance.Bonus, 0.001)
+
+		response = h.Do(http.MethodGet, "/api/user/balance", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance = decodeJSON[models.Balance](t, response)
+		assert.InDelta(t, 100, balance.Current, 0.001)
+
+		response = h.Do(http.MethodGet, "/api/user/referrals", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		summary = decodeJSON[models.ReferralSummary](t, response)
+		assert.Equal(t, 1, summary.Rewarded)
+		assert.Equal(t, 0, summary.Pending)
+		assert.Equal(t, float64(100), summary.TotalBonus)
+
+		response = h.Do(http.MethodGet, "/api/user/statement", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		statement := decodeJSON[struct {
+			Entries    []models.StatementEntry `json:"entries"`
+			TotalBonus float64                 `json:"total_bonus"`
+		}](t, response)
+		require.Len(t, statement.Entries, 1)
+		assert.Equal(t, models.StatementReferral, statement.Entries[0].Type)
+		assert.Equal(t, "bob", statement.Entries[0].Counterparty)
+		assert.Equal(t, float64(100), statement.TotalBonus)
+
+		response = h.Do(http.MethodGet, "/api/user/export", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		export := decodeJSON[models.UserExport](t, response)
+		require.Len(t, export.Referrals, 3)
+		assert.Equal(t, "bob", export.Referrals[2].Referee)
+		assert.Equal(t, models.ReferralRewarded, export.Referrals[2].Status)
+	})
+}
+
+func TestScenario_LoyaltyTiers(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		alice := h.Register("alice", "secret")
+		bob := h.Register("bob", "secret")
+
+		tierOf := func(token string) models.TierStatus {
+			t.Helper()
+			response := h.Do(http.MethodGet, "/api/user/tier", token, "", "")
+			require.Equal(t, http.StatusOK, response.StatusCode)
+			return decodeJSON[models.TierStatus](t, response)
+		}
+		status := tierOf(alice)
+		assert.Equal(t, "bronze", status.Tier, "users hold the lowest tier until the first recalculation")
+		assert.Equal(t, "silver", status.NextTier)
+		assert.Equal(t, float64(1000), status.NextTierRemaining)
+		assert.Equal(t, 90, status.WindowDays)
+		assert.Empty(t, status.History)
+
+		// Orders processed before the recalculation earn no tier bonus.
+		h.Accrual.Script("79927398713", accrualmock.Processed(1200))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+		h.RecalculateTiers()
+
+		status = tierOf(alice)
+		assert.Equal(t, "silver", status.Tier)
+		assert.Equal(t, 1.1, status.Multiplier)
+		assert.Equal(t, float64(1200), status.Accrued)
+		assert.Equal(t, "gold", status.NextTier)
+		assert.Equal(t, float64(3800), status.NextTierRemaining)
+		require.Len(t, status.History, 1)
+		assert.Equal(t, "silver", status.History[0].To)
+		assert.Equal(t, "bronze", tierOf(bob).Tier)
+
+		h.Accrual.Script("12345678903", accrualmock.Processed(100))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "12345678903").StatusCode)
+		h.ProcessAccruals()
+		h.ProcessAccruals()
+
+		response := h.Do(http.MethodGet, "/api/user/balance", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.Equal(t, "silver", balance.Tier)
+		assert.InDelta(t, 10, balance.Bonus, 0.001)
+		assert.InDelta(t, 1310, balance.Current, 0.001)
+
+		response = h.Do(http.MethodGet, "/api/user/statement", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		statement := decodeJSON[struct {
+			Entries []models.StatementEntry `json:"entries"`
+		}](t, response)
+		var bonuses []models.StatementEntry
+		for _, entry := range statement.Entries {
+			if entry.Type == models.StatementBonus {
+				bonuses = append(bonuses, entry)
+			}
+		}
+		require.Len(t, bonuses, 1)
+		assert.Equal(t, "12345678903", bonuses[0].Order)
+
+		// A recalculation that keeps the tier adds no history.
+		h.RecalculateTiers()
+		assert.Len(t, tierOf(alice).History, 1)
+
+		response = h.Do(http.MethodGet, "/api/user/export", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		export := decodeJSON[models.UserExport](t, response)
+		require.Len(t, export.TierHistory, 1)
+		assert.Equal(t, "silver", export.TierHistory[0].To)
+		require.Len(t, export.Bonuses, 1)
+		assert.Equal(t, "silver", export.Bonuses[0].Tier)
+	})
+}
+
+func TestScenario_Reconciliation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		adminToken := h.Login("admin", "secret")
+		token := h.Register("alice", "secret")
+		h.Accrual.Script("79927398713", accrualmock.Processed(500))
+		h.Accrual.Script("12345678903", accrualmock.Invalid())
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "79927398713").StatusCode)
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", token, "text/plain", "12345678903").StatusCode)
+		h.ProcessAccruals()
+
+		report := h.Reconcile()
+		assert.Equal(t, 2, report.Checked)
+		assert.Empty(t, report.Mismatches)
+
+		// The accrual system revised its result after the order was settled.
+		h.Accrual.Script("12345678903", accrualmock.Processed(300))
+		report = h.Reconcile()
+		require.Len(t, report.Mismatches, 1)
+		assert.Equal(t, "12345678903", report.Mismatches[0].Order)
+		assert.Equal(t, "INVALID", report.Mismatches[0].LocalStatus)
+		assert.True(t, report.Mismatches[0].Corrected)
+
+		response := h.Do(http.MethodGet, "/api/user/balance", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		assert.Equal(t, float64(800), decodeJSON[models.Balance](t, response).Current)
+
+		response = h.Do(http.MethodGet, "/api/admin/audit?type=order.reconciled", adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		corrections := decodeJSON[[]models.AuditEvent](t, response)
+		require.Len(t, corrections, 1)
+		assert.JSONEq(t, `{"order":"12345678903","status":"INVALID","accrual":0,"remote_status":"PROCESSED","remote_accrual":300}`, string(corrections[0].Details))
+
+		// A processed order the accrual system invalidates has its accrual
+		// clawed back rather than dropped from the balance.
+		h.Accrual.Script("79927398713", accrualmock.Invalid())
+		report = h.Reconcile()
+		require.Len(t, report.Mismatches, 1)
+		assert.True(t, report.Mismatches[0].Corrected)
+		response = h.Do(http.MethodGet, "/api/user/balance", token, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.Equal(t, float64(300), balance.Current)
+		assert.Equal(t, float32(500), balance.ClawedBack)
+		assert.Empty(t, h.Reconcile().Mismatches)
+
+		assert.Equal(t, http.StatusForbidden, h.Do(http.MethodGet, "/api/admin/metrics", token, "", "").StatusCode)
+		response = h.Do(http.MethodGet, "/api/admin/metrics", adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		metrics := decodeJSON[struct {
+			Reconciliation map[string]int `json:"reconciliation"`
+		}](t, response)
+		assert.Positive(t, metrics.Reconciliation["runs"])
+		assert.Zero(t, metrics.Reconciliation["last_mismatches"])
+	})
+}
+
+func TestScenario_OrderCancellation(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, h *Harness) {
+		adminToken := h.Login("admin", "secret")
+		partnerToken := h.Login("partner", "secret")
+		alice := h.Register("alice", "secret")
+		bob := h.Register("bob", "secret")
+
+		cancel := func(path, token, body string) *Response {
+			contentType := ""
+			if body != "" {
+				contentType = "application/json"
+			}
+			return h.Do(http.MethodPost, path, token, contentType, body)
+		}
+
+		// Orders can be cancelled by their user until the accrual system
+		// picks them up.
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "12345678903").StatusCode)
+		assert.Equal(t, http.StatusNotFound, cancel("/api/user/orders/12345678903/cancel", bob, "").StatusCode)
+		response := cancel("/api/user/orders/12345678903/cancel", alice, `{"reason":"changed my mind"}`)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		cancelled := decodeJSON[models.CancelledOrder](t, response)
+		assert.Equal(t, models.OrderCancelled, cancelled.Status)
+		assert.Equal(t, "NEW", cancelled.PreviousStatus)
+		assert.Equal(t, models.CancelledByUser, cancelled.CancelledBy)
+		assert.Zero(t, cancelled.Clawback)
+		assert.Equal(t, http.StatusConflict, cancel("/api/user/orders/12345678903/cancel", alice, "").StatusCode)
+
+		h.Accrual.Script("12345678903", accrualmock.Processed(100))
+		h.Accrual.Script("79927398713", accrualmock.Processed(500))
+		require.Equal(t, http.StatusAccepted, h.Do(http.MethodPost, "/api/user/orders", alice, "text/plain", "79927398713").StatusCode)
+		h.ProcessAccruals()
+		assert.Equal(t, http.StatusConflict, cancel("/api/user/orders/79927398713/cancel", alice, "").StatusCode, "processed orders are cancelled by admins and partners")
+
+		response = h.Do(http.MethodGet, "/api/user/orders", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		orders := decodeJSON[[]models.Orders](t, response)
+		require.Len(t, orders, 2)
+		assert.Equal(t, "PROCESSED", orders[0].Status)
+		assert.Equal(t, models.OrderCancelled, orders[1].Status, "cancelled orders are not polled")
+
+		require.Equal(t, http.StatusOK, h.Do(http.MethodPost, "/api/user/balance/withdraw", alice, "application/json", `{"order":"2377225624","sum":400}`).StatusCode)
+
+		// The goods were returned after the points were spent: the default
+		// policy takes the balance below zero.
+		assert.Equal(t, http.StatusForbidden, cancel("/api/partner/orders/79927398713/cancel", alice, "").StatusCode)
+		assert.Equal(t, http.StatusForbidden, cancel("/api/admin/orders/79927398713/cancel", partnerToken, "").StatusCode)
+		assert.Equal(t, http.StatusNotFound, cancel("/api/partner/orders/4561261212345467/cancel", partnerToken, "").StatusCode)
+		response = cancel("/api/partner/orders/79927398713/cancel", partnerToken, `{"reason":"goods returned"}`)
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		cancelled = decodeJSON[models.CancelledOrder](t, response)
+		assert.Equal(t, "PROCESSED", cancelled.PreviousStatus)
+		assert.Equal(t, models.CancelledByPartner, cancelled.CancelledBy)
+		assert.Equal(t, 500.0, cancelled.Clawback)
+		assert.Zero(t, cancelled.WrittenOff)
+		assert.Equal(t, http.StatusConflict, cancel("/api/admin/orders/79927398713/cancel", adminToken, "").StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/balance", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		balance := decodeJSON[models.Balance](t, response)
+		assert.Equal(t, -400.0, balance.Current)
+		assert.Equal(t, float32(500), balance.ClawedBack)
+		assert.Equal(t, http.StatusPaymentRequired, h.Do(http.MethodPost, "/api/user/balance/withdraw", alice, "application/json", `{"order":"2377225624","sum":1}`).StatusCode)
+
+		response = h.Do(http.MethodGet, "/api/user/statement", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		statement := decodeJSON[struct {
+			Entries         []models.StatementEntry `json:"entries"`
+			TotalClawedBack float64                 `json:"total_clawed_back"`
+			ClosingBalance  float64                 `json:"closing_balance"`
+		}](t, response)
+		require.Len(t, statement.Entries, 3)
+		assert.Equal(t, models.StatementClawback, statement.Entries[2].Type)
+		assert.Equal(t, "79927398713", statement.Entries[2].Order)
+		assert.Equal(t, 500.0, statement.TotalClawedBack)
+		assert.Equal(t, -400.0, statement.ClosingBalance)
+
+		response = h.Do(http.MethodGet, "/api/admin/audit?type=order.cancelled", adminToken, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		events := decodeJSON[[]models.AuditEvent](t, response)
+		require.Len(t, events, 2)
+		assert.JSONEq(t, `{"order":"79927398713","user_id":`+strconv.Itoa(orders[0].UserID)+`,"previous_status":"PROCESSED","clawback":500,"written_off":0,"cancelled_by":"partner","reason":"goods returned"}`, string(events[0].Details))
+
+		response = h.Do(http.MethodGet, "/api/user/export", alice, "", "")
+		require.Equal(t, http.StatusOK, response.StatusCode)
+		export := decodeJSON[models.UserExport](t, response)
+		require.Len(t, export.Clawbacks, 1, "the cancellation of the new order took nothing back")
+		assert.Equal(t, "79927398713", export.Clawbacks[0].OrderNumber)
+		assert.Equal(t, 500.0, export.Clawbacks[0].Amount)
+		assert.Equal(t, models.CancelledByPartner, export.Clawbacks[0].CancelledBy)
+		assert.Equal(t, "goods returned", export.Clawbacks[0].Reason)
+	})
+}
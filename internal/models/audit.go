@@ -0,0 +1,35 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type AuditEvent struct {
+	EventID   int64           `json:"id"`
+	EventType string          `json:"type"`
+	UserID    *int            `json:"user_id,omitempty"`
+	IP        string          `json:"ip,omitempty"`
+	UserAgent string          `json:"user_agent,omitempty"`
+	RequestID string          `json:"request_id,omitempty"`
+	Details   json.RawMessage `json:"details,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+	PrevHash  string          `json:"prev_hash"`
+	Hash      string          `json:"hash"`
+	TenantID  string          `json:"-"`
+}
+
+// AuditEventFilter selects audit events; a zero Limit returns all of them.
+type AuditEventFilter struct {
+	UserID    *int
+	EventType string
+	From      *time.Time
+	To        *time.Time
+	Limit     int
+}
+
+type AuditChainStatus struct {
+	Valid         bool   `json:"valid"`
+	Checked       int    `json:"checked"`
+	BrokenEventID *int64 `json:"broken_event_id,omitempty"`
+}
@@ -1,6 +1,15 @@
 package models
 
+// Balance is the current balance of a user: accruals, campaign bonuses,
+// referral rewards and received transfers less withdrawals, sent transfers
+// and clawbacks of cancelled orders. Bonus covers campaign and tier bonuses
+// and referral rewards; Tier is the loyalty tier of the user.
 type Balance struct {
-	Current   float64 `json:"current"`
-	Withdrawn float32 `json:"withdrawn"`
+	Current        float64 `json:"current"`
+	Withdrawn      float32 `json:"withdrawn"`
+	TransferredIn  float32 `json:"transferred_in"`
+	TransferredOut float32 `json:"transferred_out"`
+	Bonus          float32 `json:"bonus"`
+	ClawedBack     float32 `json:"clawed_back"`
+	Tier           string  `json:"tier,omitempty"`
 }
@@ -0,0 +1,114 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// CampaignRule is the rule of a campaign, see the campaign package. Only the
+// fields of its type are used.
+type CampaignRule struct {
+	Type       string   `json:"type"`
+	Multiplier float64  `json:"multiplier,omitempty"`
+	Weekdays   []string `json:"weekdays,omitempty"`
+	Timezone   string   `json:"timezone,omitempty"`
+	Amount     float64  `json:"amount,omitempty"`
+}
+
+// Campaign grants bonuses for the orders uploaded between StartsAt and
+// EndsAt. A zero MonthlyCap leaves the bonuses of a user uncapped.
+type Campaign struct {
+	CampaignID int          `json:"id"`
+	Name       string       `json:"name"`
+	Rule       CampaignRule `json:"rule"`
+	MonthlyCap float64      `json:"monthly_cap"`
+	StartsAt   time.Time    `json:"starts_at"`
+	EndsAt     *time.Time   `json:"ends_at,omitempty"`
+	Enabled    bool         `json:"enabled"`
+	CreatedAt  time.Time    `json:"created_at"`
+	TenantID   string       `json:"-"`
+}
+
+type CampaignRequest struct {
+	Name       string       `json:"name"`
+	Rule       CampaignRule `json:"rule"`
+	MonthlyCap float64      `json:"monthly_cap"`
+	StartsAt   *time.Time   `json:"starts_at,omitempty"`
+	EndsAt     *time.Time   `json:"ends_at,omitempty"`
+	Enabled    *bool        `json:"enabled,omitempty"`
+}
+
+func (cr *CampaignRequest) Bind(r *http.Request) error {
+	if cr.Name == "" {
+		return fmt.Errorf("name field is required")
+	}
+	if cr.Rule.Type == "" {
+		return fmt.Errorf("rule type field is required")
+	}
+	return nil
+}
+
+// Campaign returns the campaign described by the request. Campaigns start
+// at now and are enabled unless the request says otherwise.
+func (cr *CampaignRequest) Campaign(now time.Time) *Campaign {
+	campaign := &Campaign{
+		Name:       cr.Name,
+		Rule:       cr.Rule,
+		MonthlyCap: cr.MonthlyCap,
+		StartsAt:   now,
+		EndsAt:     cr.EndsAt,
+		Enabled:    true,
+	}
+	if cr.StartsAt != nil {
+		campaign.StartsAt = *cr.StartsAt
+	}
+	if cr.Enabled != nil {
+		campaign.Enabled = *cr.Enabled
+	}
+	return campaign
+}
+
+// CampaignDryRunRequest previews a campaign against the orders processed
+// in [From, To).
+type CampaignDryRunRequest struct {
+	Campaign CampaignRequest `json:"campaign"`
+	From     *time.Time      `json:"from,omitempty"`
+	To       *time.Time      `json:"to,omitempty"`
+}
+
+func (dr *CampaignDryRunRequest) Bind(r *http.Request) error {
+	return dr.Campaign.Bind(r)
+}
+
+// Bonus is the part of a campaign or of a loyalty tier granted for an order
+// on top of its accrual. CampaignID is zero for tier bonuses and once the
+// campaign is deleted; Tier is only set for tier bonuses.
+type Bonus struct {
+	BonusID     int       `json:"-"`
+	UserID      int       `json:"user_id"`
+	OrderNumber string    `json:"order"`
+	CampaignID  int       `json:"campaign_id,omitempty"`
+	Tier        string    `json:"tier,omitempty"`
+	Amount      float64   `json:"amount"`
+	CreatedAt   time.Time `json:"created_at"`
+	TenantID    string    `json:"-"`
+}
+
+// BonusLimit restricts the bonuses a campaign grants to a user. A zero
+// MonthlyCap disables the cap.
+type BonusLimit struct {
+	MonthlyCap  float64
+	OncePerUser bool
+}
+
+// CampaignPreview is the outcome of a dry run: the bonuses a campaign would
+// have granted for the processed orders of a period.
+type CampaignPreview struct {
+	From       time.Time `json:"from"`
+	To         time.Time `json:"to"`
+	Orders     int       `json:"orders"`
+	Users      int       `json:"users"`
+	TotalBonus float64   `json:"total_bonus"`
+	Bonuses    []Bonus   `json:"bonuses"`
+}
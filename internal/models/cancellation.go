@@ -0,0 +1,81 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// OrderCancelled is the status of an order cancelled by its user, an admin
+// or a partner. Cancelled orders are no longer polled or reconciled.
+const OrderCancelled = "CANCELLED"
+
+// Who cancelled an order. CancelledByReconciler takes back what a processed
+// order earned when the accrual system invalidated it.
+const (
+	CancelledByUser       = "user"
+	CancelledByAdmin      = "admin"
+	CancelledByPartner    = "partner"
+	CancelledByReconciler = "reconciler"
+)
+
+// Negative balance policies decide what happens when the balance of a user
+// does not cover the clawback of a cancelled order: ClawbackAllow lets the
+// balance go negative, ClawbackCap takes back no more than the balance and
+// writes off the rest, ClawbackReject refuses the cancellation.
+const (
+	ClawbackAllow  = "allow"
+	ClawbackCap    = "cap"
+	ClawbackReject = "reject"
+)
+
+var ClawbackPolicies = []string{ClawbackAllow, ClawbackCap, ClawbackReject}
+
+type CancelOrderRequest struct {
+	Reason string `json:"reason,omitempty"`
+}
+
+func (cr *CancelOrderRequest) Bind(r *http.Request) error {
+	if len(cr.Reason) > 200 {
+		return fmt.Errorf("reason is longer than 200 characters")
+	}
+	return nil
+}
+
+// OrderCancellation cancels order Number of UserID provided it still has
+// Status; Policy is the negative balance policy the clawback follows.
+type OrderCancellation struct {
+	Number      string
+	UserID      int
+	Status      string
+	Policy      string
+	CancelledBy string
+	Reason      string
+}
+
+// CancelledOrder is the outcome of a cancellation. Clawback is what was taken
+// back from the balance, the accrual of the order, the bonuses granted for it
+// and the referral reward it earned, less WrittenOff.
+type CancelledOrder struct {
+	Number         string    `json:"number"`
+	Status         string    `json:"status"`
+	PreviousStatus string    `json:"previous_status"`
+	Clawback       float64   `json:"clawback"`
+	WrittenOff     float64   `json:"written_off"`
+	CancelledBy    string    `json:"cancelled_by"`
+	Reason         string    `json:"reason,omitempty"`
+	CancelledAt    time.Time `json:"cancelled_at"`
+}
+
+// Clawback is a stored clawback of a cancelled order.
+type Clawback struct {
+	ClawbackID  int       `json:"-"`
+	UserID      int       `json:"-"`
+	OrderNumber string    `json:"order"`
+	Amount      float64   `json:"amount"`
+	WrittenOff  float64   `json:"written_off"`
+	CancelledBy string    `json:"cancelled_by"`
+	Reason      string    `json:"reason,omitempty"`
+	CreatedAt   time.Time `json:"created_at"`
+	TenantID    string    `json:"-"`
+}
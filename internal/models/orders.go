@@ -1,6 +1,9 @@
 package models
 
-import "time"
+import (
+	"encoding/json"
+	"time"
+)
 
 type Orders struct {
 	OrderID    int       `json:"order_id"`
@@ -9,4 +12,20 @@ type Orders struct {
 	Accrual    float32   `json:"accrual"`
 	UploadedAt time.Time `json:"uploaded_at"`
 	UserID     int       `json:"user_id"`
+	TenantID   string    `json:"-"`
+}
+
+type OrderStatusHistory struct {
+	HistoryID   int             `json:"-"`
+	OrderNumber string          `json:"-"`
+	Status      string          `json:"status"`
+	Accrual     *float32        `json:"accrual,omitempty"`
+	RawResponse json.RawMessage `json:"raw_response,omitempty"`
+	ChangedAt   time.Time       `json:"changed_at"`
+	TenantID    string          `json:"-"`
+}
+
+type OrderDetails struct {
+	Orders
+	History []OrderStatusHistory `json:"history"`
 }
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// ReconcileMismatch is an order whose status or accrual differs from what the
+// accrual system holds for it. RemoteStatus is empty when the accrual system
+// does not know the order.
+type ReconcileMismatch struct {
+	TenantID      string
+	Order         string
+	UserID        int
+	LocalStatus   string
+	LocalAccrual  float32
+	RemoteStatus  string
+	RemoteAccrual float32
+	Corrected     bool
+}
+
+// ReconcileReport is the result of a reconciliation run. Failed counts the
+// orders that could not be looked up.
+type ReconcileReport struct {
+	StartedAt  time.Time
+	Checked    int
+	Failed     int
+	Corrected  int
+	Mismatches []ReconcileMismatch
+}
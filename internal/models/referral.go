@@ -0,0 +1,58 @@
+package models
+
+import "time"
+
+const (
+	ReferralPending  = "pending"
+	ReferralRewarded = "rewarded"
+	ReferralRejected = "rejected"
+
+	// ReferralSameIP rejects a referral made from the address of the
+	// referrer or of another user they referred.
+	ReferralSameIP = "same_ip"
+)
+
+// ReferralCode is the code a user shares to refer others; IP is the address
+// it was created from.
+type ReferralCode struct {
+	UserID    int
+	Code      string
+	IP        string
+	CreatedAt time.Time
+	TenantID  string
+}
+
+// Referral links a referred user to their referrer. Referee is the login of
+// the referred user and is empty once that user is purged. Rewards are set
+// when the first order of the referee is processed.
+type Referral struct {
+	ReferralID    int        `json:"-"`
+	ReferrerID    int        `json:"-"`
+	RefereeID     int        `json:"-"`
+	Referee       string     `json:"referee"`
+	Status        string     `json:"status"`
+	Reason        string     `json:"reason,omitempty"`
+	IP            string     `json:"-"`
+	OrderNumber   string     `json:"-"`
+	ReferrerBonus float64    `json:"bonus"`
+	RefereeBonus  float64    `json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+	RewardedAt    *time.Time `json:"rewarded_at,omitempty"`
+	TenantID      string     `json:"-"`
+}
+
+// ReferralReward is what both parties of a referral get.
+type ReferralReward struct {
+	ReferrerBonus float64
+	RefereeBonus  float64
+}
+
+// ReferralSummary describes the referrals made by a user.
+type ReferralSummary struct {
+	Code       string     `json:"code"`
+	Pending    int        `json:"pending"`
+	Rewarded   int        `json:"rewarded"`
+	Rejected   int        `json:"rejected"`
+	TotalBonus float64    `json:"total_bonus"`
+	Referrals  []Referral `json:"referrals"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import "time"
+
+const (
+	StatementAccrual     = "accrual"
+	StatementWithdrawal  = "withdrawal"
+	StatementTransferIn  = "transfer_in"
+	StatementTransferOut = "transfer_out"
+	StatementBonus       = "bonus"
+	StatementReferral    = "referral"
+	StatementClawback    = "clawback"
+)
+
+// StatementEntry is a movement of the balance. Amount is negative for
+// withdrawals, sent transfers and clawbacks of cancelled orders and Balance is the running balance after
+// the movement. Transfers and referral rewards have no order but the login of
+// the other user.
+type StatementEntry struct {
+	Type         string    `json:"type"`
+	Order        string    `json:"order"`
+	Counterparty string    `json:"counterparty,omitempty"`
+	Amount       float64   `json:"amount"`
+	Balance      float64   `json:"balance"`
+	At           time.Time `json:"at"`
+}
+
+type StatementSummary struct {
+	OpeningBalance      float64 `json:"opening_balance"`
+	TotalAccrued        float64 `json:"total_accrued"`
+	TotalBonus          float64 `json:"total_bonus"`
+	TotalWithdrawn      float64 `json:"total_withdrawn"`
+	TotalTransferredIn  float64 `json:"total_transferred_in"`
+	TotalTransferredOut float64 `json:"total_transferred_out"`
+	TotalClawedBack     float64 `json:"total_clawed_back"`
+	ClosingBalance      float64 `json:"closing_balance"`
+}
@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// UserTier is the loyalty tier of a user as of the last recalculation and
+// the points the user accrued over the rolling window then.
+type UserTier struct {
+	UserID    int
+	Tier      string
+	Accrued   float64
+	UpdatedAt time.Time
+	TenantID  string
+}
+
+// UserAccrual is what a user accrued over the rolling window.
+type UserAccrual struct {
+	UserID  int
+	Accrued float64
+}
+
+// TierChange is an entry of the tier history of a user. From is empty for
+// the first tier the user was given.
+type TierChange struct {
+	From      string    `json:"from,omitempty"`
+	To        string    `json:"to"`
+	Accrued   float64   `json:"accrued"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// TierStatus describes the tier of a user. Users that were not recalculated
+// yet hold the lowest tier with nothing accrued.
+type TierStatus struct {
+	Tier              string       `json:"tier"`
+	Multiplier        float64      `json:"multiplier"`
+	Accrued           float64      `json:"accrued"`
+	WindowDays        int          `json:"window_days"`
+	NextTier          string       `json:"next_tier,omitempty"`
+	NextTierRemaining float64      `json:"next_tier_remaining,omitempty"`
+	UpdatedAt         *time.Time   `json:"updated_at,omitempty"`
+	History           []TierChange `json:"history"`
+}
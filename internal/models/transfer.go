@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+const (
+	TransferSent     = "sent"
+	TransferReceived = "received"
+)
+
+type TransferRequest struct {
+	Recipient string  `json:"recipient"`
+	Sum       float32 `json:"sum"`
+	Memo      string  `json:"memo,omitempty"`
+}
+
+func (tr *TransferRequest) Bind(r *http.Request) error {
+	if tr.Recipient == "" {
+		return fmt.Errorf("recipient field is required")
+	}
+	if tr.Sum == 0 {
+		return fmt.Errorf("sum field is required")
+	}
+	return nil
+}
+
+// Transfer moves points from one user to another. Direction and Counterparty
+// describe it from the point of view of the user it was read for; the
+// counterparty is empty once the other user is purged.
+type Transfer struct {
+	TransferID   int       `json:"id"`
+	SenderID     string    `json:"-"`
+	RecipientID  string    `json:"-"`
+	Direction    string    `json:"direction"`
+	Counterparty string    `json:"counterparty"`
+	Amount       float32   `json:"sum"`
+	Memo         string    `json:"memo,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+	TenantID     string    `json:"-"`
+}
+
+// TransferLimit caps the transfers a user sends per day. A zero value
+// disables the limit.
+type TransferLimit struct {
+	MaxAmount float64
+	MaxCount  int
+}
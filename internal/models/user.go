@@ -3,11 +3,18 @@ package models
 import (
 	"fmt"
 	"net/http"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
 )
 
+// UserCreditials are used to register and to log in; ReferralCode is only
+// read on registration.
 type UserCreditials struct {
-	Login    string `json:"login"`
-	Password string `json:"password"`
+	Login        string `json:"login"`
+	Password     string `json:"password"`
+	ReferralCode string `json:"referral_code,omitempty"`
 }
 
 func (uc *UserCreditials) Bind(r *http.Request) error {
@@ -19,3 +26,78 @@ func (uc *UserCreditials) Bind(r *http.Request) error {
 	}
 	return nil
 }
+
+type User struct {
+	UserID      int        `json:"user_id"`
+	Login       string     `json:"login"`
+	Email       string     `json:"email"`
+	DisplayName string     `json:"display_name"`
+	CreatedAt   time.Time  `json:"created_at"`
+	DeletedAt   *time.Time `json:"deleted_at,omitempty"`
+}
+
+const (
+	maxEmailLength       = 254
+	maxDisplayNameLength = 128
+)
+
+// UserProfileUpdate changes the fields that are set; an empty string clears
+// a field.
+type UserProfileUpdate struct {
+	Email       *string `json:"email"`
+	DisplayName *string `json:"display_name"`
+}
+
+func (pu *UserProfileUpdate) Bind(r *http.Request) error {
+	if pu.Email == nil && pu.DisplayName == nil {
+		return fmt.Errorf("nothing to update")
+	}
+	if pu.Email != nil && *pu.Email != "" {
+		if len(*pu.Email) > maxEmailLength {
+			return fmt.Errorf("email is too long")
+		}
+		address, err := mail.ParseAddress(*pu.Email)
+		if err != nil || address.Address != *pu.Email {
+			return fmt.Errorf("email is not valid")
+		}
+	}
+	if pu.DisplayName != nil {
+		if utf8.RuneCountInString(*pu.DisplayName) > maxDisplayNameLength {
+			return fmt.Errorf("display name is too long")
+		}
+		if strings.TrimSpace(*pu.DisplayName) != *pu.DisplayName {
+			return fmt.Errorf("display name has leading or trailing spaces")
+		}
+	}
+	return nil
+}
+
+type AccountDeletionRequest struct {
+	Password string `json:"password"`
+}
+
+func (dr *AccountDeletionRequest) Bind(r *http.Request) error {
+	if dr.Password == "" {
+		return fmt.Errorf("password field is required")
+	}
+	return nil
+}
+
+type AccountDeletion struct {
+	DeletedAt time.Time `json:"deleted_at"`
+	PurgeAt   time.Time `json:"purge_at"`
+}
+
+// UserExport is the bundle of everything stored about a user.
+type UserExport struct {
+	ExportedAt  time.Time         `json:"exported_at"`
+	Profile     User              `json:"profile"`
+	Orders      []OrderDetails    `json:"orders"`
+	Withdrawals []WithdrawBalance `json:"withdrawals"`
+	Transfers   []Transfer        `json:"transfers"`
+	Bonuses     []Bonus           `json:"bonuses"`
+	Referrals   []Referral        `json:"referrals"`
+	TierHistory []TierChange      `json:"tier_history"`
+	Clawbacks   []Clawback        `json:"clawbacks"`
+	AuditEvents []AuditEvent      `json:"audit_events"`
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"time"
@@ -27,10 +28,13 @@ type WithdrawBalance struct {
 	OrderNumber  string    `json:"order"`
 	Amount       float32   `json:"sum"`
 	ProcessedAt  time.Time `json:"processed_at"`
+	TenantID     string    `json:"-"`
 }
 
 type AccrualResponse struct {
 	Order   string  `json:"order"`
 	Status  string  `json:"status"`
 	Accrual float32 `json:"accrual,omitempty"`
+
+	Raw json.RawMessage `json:"-"`
 }
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+)
+
+type GophermartAccountStorager interface {
+	GetUserByID(ctx context.Context, userID string) (*models.User, error)
+	GetUserByLogin(ctx context.Context, user models.UserCreditials) (int, error)
+	UpdateUserProfile(ctx context.Context, userID string, update models.UserProfileUpdate) (*models.User, error)
+	DeleteUser(ctx context.Context, userID string, at time.Time) (time.Time, error)
+	PurgeDeletedUsers(ctx context.Context, before time.Time) ([]int, error)
+	GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error)
+	GetOrderStatusHistory(ctx context.Context, orderNumber string) ([]models.OrderStatusHistory, error)
+	GetWithdrawalByUserID(ctx context.Context, userID string) ([]models.WithdrawBalance, error)
+	GetTransfersByUserID(ctx context.Context, userID string) ([]models.Transfer, error)
+	GetBonusesByUserID(ctx context.Context, userID string) ([]models.Bonus, error)
+	GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]models.Referral, error)
+	GetTierHistory(ctx context.Context, userID int) ([]models.TierChange, error)
+	GetClawbacksByUserID(ctx context.Context, userID int) ([]models.Clawback, error)
+	GetAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]models.AuditEvent, error)
+}
+
+// GophermartAccountService manages the profile of a user, the deletion of
+// the account and the export of the user's data. Deleted accounts are kept
+// for gracePeriod, during which logging in cancels the deletion.
+type GophermartAccountService struct {
+	storage     GophermartAccountStorager
+	auditor     GophermartAuditor
+	gracePeriod time.Duration
+	log         *logger.Logger
+}
+
+func NewGophermartAccountService(storage GophermartAccountStorager, auditor GophermartAuditor, gracePeriod time.Duration, log *logger.Logger) *GophermartAccountService {
+	return &GophermartAccountService{
+		storage:     storage,
+		auditor:     auditor,
+		gracePeriod: gracePeriod,
+		log:         log,
+	}
+}
+
+func (gs *GophermartAccountService) GetProfileService(ctx context.Context, userID string) (*models.User, error) {
+	return gs.storage.GetUserByID(ctx, userID)
+}
+
+func (gs *GophermartAccountService) UpdateProfileService(ctx context.Context, userID string, update models.UserProfileUpdate) (*models.User, error) {
+	user, err := gs.storage.UpdateUserProfile(ctx, userID, update)
+	if err != nil {
+		return nil, err
+	}
+
+	// Only the names of the changed fields are audited, not their values.
+	var fields []string
+	if update.Email != nil {
+		fields = append(fields, "email")
+	}
+	if update.DisplayName != nil {
+		fields = append(fields, "display_name")
+	}
+	gs.auditor.Record(ctx, audit.EventProfileUpdated, userID, map[string]any{"fields": fields})
+	return user, nil
+}
+
+func (gs *GophermartAccountService) DeleteAccountService(ctx context.Context, userID string, password string) (*models.AccountDeletion, error) {
+	user, err := gs.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := gs.storage.GetUserByLogin(ctx, models.UserCreditials{Login: user.Login, Password: password}); err != nil {
+		if errors.Is(err, storage.ErrInvalidData) {
+			return nil, ErrWrongPassword
+		}
+		return nil, err
+	}
+
+	deletedAt, err := gs.storage.DeleteUser(ctx, userID, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	deletion := &models.AccountDeletion{
+		DeletedAt: deletedAt,
+		PurgeAt:   deletedAt.Add(gs.gracePeriod),
+	}
+	gs.auditor.Record(ctx, audit.EventDeletionRequested, userID, map[string]any{"purge_at": deletion.PurgeAt})
+	return deletion, nil
+}
+
+// PurgeDeletedAccountsService removes the accounts whose grace period has
+// passed and returns their number.
+func (gs *GophermartAccountService) PurgeDeletedAccountsService(ctx context.Context) (int, error) {
+	purged, err := gs.storage.PurgeDeletedUsers(ctx, time.Now().Add(-gs.gracePeriod))
+	if err != nil {
+		return 0, err
+	}
+	for _, userID := range purged {
+		gs.auditor.Record(ctx, audit.EventUserPurged, strconv.Itoa(userID), nil)
+	}
+	return len(purged), nil
+}
+
+func (gs *GophermartAccountService) ExportService(ctx context.Context, userID string) (*models.UserExport, error) {
+	user, err := gs.storage.GetUserByID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	orders, err := gs.storage.GetOrdersByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	details := make([]models.OrderDetails, 0, len(orders))
+	for _, order := range orders {
+		history, err := gs.storage.GetOrderStatusHistory(ctx, order.Number)
+		if err != nil {
+			return nil, err
+		}
+		details = append(details, models.OrderDetails{Orders: order, History: history})
+	}
+
+	withdrawals, err := gs.storage.GetWithdrawalByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if withdrawals == nil {
+		withdrawals = []models.WithdrawBalance{}
+	}
+
+	transfers, err := gs.storage.GetTransfersByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if transfers == nil {
+		transfers = []models.Transfer{}
+	}
+
+	bonuses, err := gs.storage.GetBonusesByUserID(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	if bonuses == nil {
+		bonuses = []models.Bonus{}
+	}
+
+	referrals, err := gs.storage.GetReferralsByReferrerID(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if referrals == nil {
+		referrals = []models.Referral{}
+	}
+
+	tierHistory, err := gs.storage.GetTierHistory(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if tierHistory == nil {
+		tierHistory = []models.TierChange{}
+	}
+
+	clawbacks, err := gs.storage.GetClawbacksByUserID(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if clawbacks == nil {
+		clawbacks = []models.Clawback{}
+	}
+
+	// The export itself is recorded first so that it is part of the bundle.
+	gs.auditor.Record(ctx, audit.EventDataExported, userID, nil)
+	events, err := gs.storage.GetAuditEvents(ctx, models.AuditEventFilter{UserID: &user.UserID})
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.UserExport{
+		ExportedAt:  time.Now(),
+		Profile:     *user,
+		Orders:      details,
+		Withdrawals: withdrawals,
+		Transfers:   transfers,
+		Bonuses:     bonuses,
+		Referrals:   referrals,
+		TierHistory: tierHistory,
+		Clawbacks:   clawbacks,
+		AuditEvents: events,
+	}, nil
+}
@@ -0,0 +1,211 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+type MockGophermartAccountStorager struct {
+	mock.Mock
+}
+
+func (m *MockGophermartAccountStorager) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	args := m.Called(ctx, userID)
+	user, _ := args.Get(0).(*models.User)
+	return user, args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetUserByLogin(ctx context.Context, user models.UserCreditials) (int, error) {
+	args := m.Called(ctx, user)
+	return args.Int(0), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) UpdateUserProfile(ctx context.Context, userID string, update models.UserProfileUpdate) (*models.User, error) {
+	args := m.Called(ctx, userID, update)
+	user, _ := args.Get(0).(*models.User)
+	return user, args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) DeleteUser(ctx context.Context, userID string, at time.Time) (time.Time, error) {
+	args := m.Called(ctx, userID, at)
+	return args.Get(0).(time.Time), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) PurgeDeletedUsers(ctx context.Context, before time.Time) ([]int, error) {
+	args := m.Called(ctx, before)
+	return args.Get(0).([]int), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Orders), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetOrderStatusHistory(ctx context.Context, orderNumber string) ([]models.OrderStatusHistory, error) {
+	args := m.Called(ctx, orderNumber)
+	return args.Get(0).([]models.OrderStatusHistory), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetWithdrawalByUserID(ctx context.Context, userID string) ([]models.WithdrawBalance, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.WithdrawBalance), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetTransfersByUserID(ctx context.Context, userID string) ([]models.Transfer, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Transfer), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetBonusesByUserID(ctx context.Context, userID string) ([]models.Bonus, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Bonus), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]models.Referral, error) {
+	args := m.Called(ctx, referrerID)
+	return args.Get(0).([]models.Referral), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetTierHistory(ctx context.Context, userID int) ([]models.TierChange, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.TierChange), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetClawbacksByUserID(ctx context.Context, userID int) ([]models.Clawback, error) {
+	args := m.Called(ctx, userID)
+	return args.Get(0).([]models.Clawback), args.Error(1)
+}
+
+func (m *MockGophermartAccountStorager) GetAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]models.AuditEvent, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+// recordingAuditor keeps the types of the recorded events.
+type recordingAuditor struct {
+	events []string
+}
+
+func (ra *recordingAuditor) Record(ctx context.Context, eventType string, userID string, details map[string]any) {
+	ra.events = append(ra.events, eventType)
+}
+
+func TestGophermartAccountService_UpdateProfileService(t *testing.T) {
+	mockStorage := &MockGophermartAccountStorager{}
+	auditor := &recordingAuditor{}
+	service := NewGophermartAccountService(mockStorage, auditor, time.Hour, nil)
+	ctx := context.Background()
+
+	email := "alice@example.com"
+	update := models.UserProfileUpdate{Email: &email}
+	mockStorage.On("UpdateUserProfile", ctx, "1", update).Return(&models.User{UserID: 1, Email: email}, nil).Once()
+
+	user, err := service.UpdateProfileService(ctx, "1", update)
+	require.NoError(t, err)
+	assert.Equal(t, email, user.Email)
+	assert.Equal(t, []string{audit.EventProfileUpdated}, auditor.events)
+
+	mockStorage.On("UpdateUserProfile", ctx, "1", update).Return(nil, errors.New("db error")).Once()
+	_, err = service.UpdateProfileService(ctx, "1", update)
+	assert.Error(t, err)
+	assert.Len(t, auditor.events, 1, "failed updates are not audited")
+}
+
+func TestGophermartAccountService_DeleteAccountService(t *testing.T) {
+	mockStorage := &MockGophermartAccountStorager{}
+	auditor := &recordingAuditor{}
+	service := NewGophermartAccountService(mockStorage, auditor, 24*time.Hour, nil)
+	ctx := context.Background()
+
+	mockStorage.On("GetUserByID", ctx, "1").Return(&models.User{UserID: 1, Login: "alice"}, nil)
+	mockStorage.On("GetUserByLogin", ctx, models.UserCreditials{Login: "alice", Password: "wrong"}).Return(0, storage.ErrInvalidData)
+	mockStorage.On("GetUserByLogin", ctx, models.UserCreditials{Login: "alice", Password: "secret"}).Return(1, nil)
+
+	_, err := service.DeleteAccountService(ctx, "1", "wrong")
+	assert.ErrorIs(t, err, ErrWrongPassword)
+	mockStorage.AssertNotCalled(t, "DeleteUser", mock.Anything, mock.Anything, mock.Anything)
+
+	deletedAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	mockStorage.On("DeleteUser", ctx, "1", mock.Anything).Return(deletedAt, nil)
+
+	deletion, err := service.DeleteAccountService(ctx, "1", "secret")
+	require.NoError(t, err)
+	assert.Equal(t, deletedAt, deletion.DeletedAt)
+	assert.Equal(t, deletedAt.Add(24*time.Hour), deletion.PurgeAt)
+	assert.Equal(t, []string{audit.EventDeletionRequested}, auditor.events)
+}
+
+func TestGophermartAccountService_PurgeDeletedAccountsService(t *testing.T) {
+	mockStorage := &MockGophermartAccountStorager{}
+	auditor := &recordingAuditor{}
+	service := NewGophermartAccountService(mockStorage, auditor, 24*time.Hour, nil)
+	ctx := context.Background()
+
+	mockStorage.On("PurgeDeletedUsers", ctx, mock.MatchedBy(func(before time.Time) bool {
+		return time.Until(before) < -23*time.Hour
+	})).Return([]int{3, 5}, nil)
+
+	purged, err := service.PurgeDeletedAccountsService(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, 2, purged)
+	assert.Equal(t, []string{audit.EventUserPurged, audit.EventUserPurged}, auditor.events)
+}
+
+func TestGophermartAccountService_ExportService(t *testing.T) {
+	mockStorage := &MockGophermartAccountStorager{}
+	auditor := &recordingAuditor{}
+	service := NewGophermartAccountService(mockStorage, auditor, time.Hour, nil)
+	ctx := context.Background()
+
+	userID := 1
+	mockStorage.On("GetUserByID", ctx, "1").Return(&models.User{UserID: userID, Login: "alice"}, nil)
+	mockStorage.On("GetOrdersByUserID", ctx, "1").Return([]models.Orders{{Number: "79927398713", Status: "NEW"}}, nil)
+	mockStorage.On("GetOrderStatusHistory", ctx, "79927398713").Return([]models.OrderStatusHistory{{Status: "NEW"}}, nil)
+	mockStorage.On("GetWithdrawalByUserID", ctx, "1").Return([]models.WithdrawBalance(nil), nil)
+	mockStorage.On("GetBonusesByUserID", ctx, "1").Return([]models.Bonus(nil), nil)
+	mockStorage.On("GetClawbacksByUserID", ctx, userID).Return([]models.Clawback(nil), nil)
+	mockStorage.On("GetTierHistory", ctx, userID).Return([]models.TierChange{{From: "bronze", To: "silver", Accrued: 1200}}, nil)
+	mockStorage.On("GetReferralsByReferrerID", ctx, userID).Return([]models.Referral{{Referee: "bob", Status: models.ReferralPending}}, nil)
+	mockStorage.On("GetTransfersByUserID", ctx, "1").Return([]models.Transfer{{TransferID: 1, Direction: models.TransferSent, Counterparty: "bob", Amount: 10}}, nil)
+	mockStorage.On("GetAuditEvents", ctx, models.AuditEventFilter{UserID: &userID}).Return([]models.AuditEvent{{EventType: audit.EventDataExported}}, nil)
+
+	export, err := service.ExportService(ctx, "1")
+	require.NoError(t, err)
+	assert.Equal(t, "alice", export.Profile.Login)
+	require.Len(t, export.Orders, 1)
+	assert.Len(t, export.Orders[0].History, 1)
+	assert.NotNil(t, export.Withdrawals)
+	assert.Len(t, export.Transfers, 1)
+	assert.NotNil(t, export.Bonuses)
+	assert.Len(t, export.Referrals, 1)
+	assert.Len(t, export.TierHistory, 1)
+	assert.NotNil(t, export.Clawbacks)
+	assert.Empty(t, export.Clawbacks)
+	assert.Len(t, export.AuditEvents, 1)
+	assert.Equal(t, []string{audit.EventDataExported}, auditor.events)
+}
+
+func TestGophermartUserService_GetUserService_CancelsDeletion(t *testing.T) {
+	mockStorage := &MockGophermartUserStorager{}
+	auditor := &recordingAuditor{}
+	service := NewGophermartUserService(mockStorage, auditor, nil, nil)
+	ctx := context.Background()
+
+	user := models.UserCreditials{Login: "alice", Password: "secret"}
+	mockStorage.On("GetUserByLogin", ctx, user).Return(1, nil)
+	mockStorage.On("RestoreUser", ctx, "1").Return(true, nil)
+
+	userID, err := service.GetUserService(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, 1, userID)
+	assert.Equal(t, []string{audit.EventLoginSucceeded, audit.EventDeletionCancelled}, auditor.events)
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+// GophermartAuditor records audit events. Recording never fails the
+// operation being audited; errors are logged.
+type GophermartAuditor interface {
+	Record(ctx context.Context, eventType string, userID string, details map[string]any)
+}
+
+type GophermartAuditStorager interface {
+	AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	GetAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]models.AuditEvent, error)
+	GetAuditChain(ctx context.Context) ([]models.AuditEvent, error)
+}
+
+type GophermartAuditService struct {
+	storage GophermartAuditStorager
+	log     *logger.Logger
+}
+
+func NewGophermartAuditService(storage GophermartAuditStorager, log *logger.Logger) *GophermartAuditService {
+	return &GophermartAuditService{
+		storage: storage,
+		log:     log,
+	}
+}
+
+func (gs *GophermartAuditService) Record(ctx context.Context, eventType string, userID string, details map[string]any) {
+	metadata := audit.MetadataFromContext(ctx)
+	event := &models.AuditEvent{
+		EventType: eventType,
+		UserID:    audit.UserID(userID),
+		IP:        metadata.IP,
+		UserAgent: metadata.UserAgent,
+		RequestID: metadata.RequestID,
+		CreatedAt: time.Now(),
+	}
+	if len(details) > 0 {
+		data, err := json.Marshal(details)
+		if err != nil {
+			gs.log.Ctx(ctx).Error("cannot encode audit details", zap.String("event_type", eventType), zap.Error(err))
+			return
+		}
+		event.Details = data
+	}
+
+	// The audit trail must survive a cancelled request.
+	if err := gs.storage.AppendAuditEvent(context.WithoutCancel(ctx), event); err != nil {
+		gs.log.Ctx(ctx).Error("cannot record audit event", zap.String("event_type", eventType), zap.Error(err))
+	}
+}
+
+// GetAuditEventsService returns the events matching filter, newest first.
+// The query itself is audited as an action of the admin adminID.
+func (gs *GophermartAuditService) GetAuditEventsService(ctx context.Context, adminID string, filter models.AuditEventFilter) ([]models.AuditEvent, error) {
+	if filter.Limit <= 0 {
+		filter.Limit = defaultAuditLimit
+	}
+	if filter.Limit > maxAuditLimit {
+		filter.Limit = maxAuditLimit
+	}
+
+	details := map[string]any{"limit": filter.Limit}
+	if filter.UserID != nil {
+		details["user_id"] = *filter.UserID
+	}
+	if filter.EventType != "" {
+		details["type"] = filter.EventType
+	}
+	if filter.From != nil {
+		details["from"] = *filter.From
+	}
+	if filter.To != nil {
+		details["to"] = *filter.To
+	}
+	gs.Record(ctx, audit.EventAdminAudit, adminID, details)
+
+	return gs.storage.GetAuditEvents(ctx, filter)
+}
+
+func (gs *GophermartAuditService) VerifyAuditChainService(ctx context.Context, adminID string) (models.AuditChainStatus, error) {
+	events, err := gs.storage.GetAuditChain(ctx)
+	if err != nil {
+		return models.AuditChainStatus{}, err
+	}
+	status := audit.Verify(events)
+	gs.Record(ctx, audit.EventAdminVerify, adminID, map[string]any{"valid": status.Valid, "checked": status.Checked})
+	return status, nil
+}
@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// nopAuditor is used by the tests of services that record audit events.
+type nopAuditor struct{}
+
+func (nopAuditor) Record(ctx context.Context, eventType string, userID string, details map[string]any) {
+}
+
+type MockGophermartAuditStorager struct {
+	mock.Mock
+}
+
+func (m *MockGophermartAuditStorager) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	args := m.Called(ctx, event)
+	return args.Error(0)
+}
+
+func (m *MockGophermartAuditStorager) GetAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]models.AuditEvent, error) {
+	args := m.Called(ctx, filter)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func (m *MockGophermartAuditStorager) GetAuditChain(ctx context.Context) ([]models.AuditEvent, error) {
+	args := m.Called(ctx)
+	return args.Get(0).([]models.AuditEvent), args.Error(1)
+}
+
+func TestGophermartAuditService_Record(t *testing.T) {
+	mockStorage := &MockGophermartAuditStorager{}
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+	service := NewGophermartAuditService(mockStorage, log)
+
+	var recorded *models.AuditEvent
+	mockStorage.On("AppendAuditEvent", mock.Anything, mock.Anything).Run(func(args mock.Arguments) {
+		recorded = args.Get(1).(*models.AuditEvent)
+	}).Return(nil)
+
+	ctx := audit.WithMetadata(context.Background(), audit.Metadata{IP: "10.0.0.1", UserAgent: "curl/8.0", RequestID: "req-1"})
+	service.Record(ctx, audit.EventWithdrawal, "7", map[string]any{"order": "2377225624", "sum": 50})
+
+	require.NotNil(t, recorded)
+	assert.Equal(t, audit.EventWithdrawal, recorded.EventType)
+	require.NotNil(t, recorded.UserID)
+	assert.Equal(t, 7, *recorded.UserID)
+	assert.Equal(t, "10.0.0.1", recorded.IP)
+	assert.Equal(t, "curl/8.0", recorded.UserAgent)
+	assert.Equal(t, "req-1", recorded.RequestID)
+	assert.JSONEq(t, `{"order":"2377225624","sum":50}`, string(recorded.Details))
+	assert.False(t, recorded.CreatedAt.IsZero())
+}
+
+func TestGophermartAuditService_Record_StorageError(t *testing.T) {
+	mockStorage := &MockGophermartAuditStorager{}
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+	service := NewGophermartAuditService(mockStorage, log)
+
+	mockStorage.On("AppendAuditEvent", mock.Anything, mock.Anything).Return(errors.New("db error"))
+
+	assert.NotPanics(t, func() {
+		service.Record(context.Background(), audit.EventLoginFailed, "", nil)
+	})
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartAuditService_GetAuditEventsService_Limit(t *testing.T) {
+	mockStorage := &MockGophermartAuditStorager{}
+	service := NewGophermartAuditService(mockStorage, nil)
+	ctx := context.Background()
+
+	mockStorage.On("AppendAuditEvent", mock.Anything, mock.MatchedBy(func(event *models.AuditEvent) bool {
+		return event.EventType == audit.EventAdminAudit && *event.UserID == 1
+	})).Return(nil).Twice()
+	mockStorage.On("GetAuditEvents", ctx, models.AuditEventFilter{Limit: defaultAuditLimit}).Return([]models.AuditEvent{}, nil)
+	mockStorage.On("GetAuditEvents", ctx, models.AuditEventFilter{Limit: maxAuditLimit}).Return([]models.AuditEvent{}, nil)
+
+	_, err := service.GetAuditEventsService(ctx, "1", models.AuditEventFilter{})
+	assert.NoError(t, err)
+	_, err = service.GetAuditEventsService(ctx, "1", models.AuditEventFilter{Limit: 5000})
+	assert.NoError(t, err)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartAuditService_VerifyAuditChainService(t *testing.T) {
+	mockStorage := &MockGophermartAuditStorager{}
+	service := NewGophermartAuditService(mockStorage, nil)
+	ctx := context.Background()
+
+	mockStorage.On("GetAuditChain", ctx).Return([]models.AuditEvent(nil), errors.New("db error")).Once()
+	_, err := service.VerifyAuditChainService(ctx, "1")
+	assert.Error(t, err)
+
+	mockStorage.On("GetAuditChain", ctx).Return([]models.AuditEvent{}, nil).Once()
+	mockStorage.On("AppendAuditEvent", mock.Anything, mock.Anything).Return(nil).Once()
+	status, err := service.VerifyAuditChainService(ctx, "1")
+	assert.NoError(t, err)
+	assert.Equal(t, models.AuditChainStatus{Valid: true}, status)
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tier"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
 )
 
@@ -11,18 +12,36 @@ type GophermartUserBalanceStorager interface {
 	GetUserBalance(ctx context.Context, userID string) (*models.Balance, error)
 }
 
+// GophermartTierer returns the loyalty tier a user holds.
+type GophermartTierer interface {
+	GetUserTierService(ctx context.Context, userID string) (tier.Tier, error)
+}
+
+// GophermartUserBalanceService returns balances together with the loyalty
+// tier of the user, if tiers is not nil.
 type GophermartUserBalanceService struct {
 	storage GophermartUserBalanceStorager
+	tiers   GophermartTierer
 	log     *logger.Logger
 }
 
-func NewGophermartUserBalanceService(storage GophermartUserBalanceStorager, log *logger.Logger) *GophermartUserBalanceService {
+func NewGophermartUserBalanceService(storage GophermartUserBalanceStorager, tiers GophermartTierer, log *logger.Logger) *GophermartUserBalanceService {
 	return &GophermartUserBalanceService{
 		storage: storage,
+		tiers:   tiers,
 		log:     log,
 	}
 }
 
 func (gs *GophermartUserBalanceService) GetUserBalanceService(ctx context.Context, userID string) (*models.Balance, error) {
-	return gs.storage.GetUserBalance(ctx, userID)
+	balance, err := gs.storage.GetUserBalance(ctx, userID)
+	if err != nil || gs.tiers == nil {
+		return balance, err
+	}
+	current, err := gs.tiers.GetUserTierService(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	balance.Tier = current.Name
+	return balance, nil
 }
@@ -6,6 +6,7 @@ import (
 	"testing"
 
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tier"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
@@ -27,7 +28,7 @@ func TestNewGophermartUserBalanceService(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	assert.NotNil(t, service)
 	assert.Equal(t, mockStorage, service.storage)
@@ -39,7 +40,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_Success(t *testing.T
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -65,7 +66,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_ZeroBalance(t *testi
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx := context.Background()
 	userID := "456"
@@ -91,7 +92,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_NegativeBalance(t *t
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx := context.Background()
 	userID := "789"
@@ -117,7 +118,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_Error(t *testing.T)
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx := context.Background()
 	userID := "999"
@@ -138,7 +139,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_DatabaseError(t *tes
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx := context.Background()
 	userID := "111"
@@ -159,7 +160,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_EmptyUserID(t *testi
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx := context.Background()
 	userID := ""
@@ -178,7 +179,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_EmptyUserID(t *testi
 func TestGophermartUserBalanceService_WithNilLogger(t *testing.T) {
 	mockStorage := &MockGophermartUserBalanceStorager{}
 
-	service := NewGophermartUserBalanceService(mockStorage, nil)
+	service := NewGophermartUserBalanceService(mockStorage, nil, nil)
 
 	assert.NotNil(t, service)
 	assert.Equal(t, mockStorage, service.storage)
@@ -190,7 +191,7 @@ func TestGophermartUserBalanceService_ContextCancellation(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel the context immediately
@@ -213,7 +214,7 @@ func TestGophermartUserBalanceService_GetUserBalanceService_LargeNumbers(t *test
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserBalanceService(mockStorage, log)
+	service := NewGophermartUserBalanceService(mockStorage, nil, log)
 
 	ctx := context.Background()
 	userID := "999999"
@@ -233,3 +234,27 @@ func TestGophermartUserBalanceService_GetUserBalanceService_LargeNumbers(t *test
 	assert.Equal(t, float32(500000.50), balance.Withdrawn)
 	mockStorage.AssertExpectations(t)
 }
+
+type staticTierer struct {
+	tier tier.Tier
+	err  error
+}
+
+func (st staticTierer) GetUserTierService(ctx context.Context, userID string) (tier.Tier, error) {
+	return st.tier, st.err
+}
+
+func TestGophermartUserBalanceService_GetUserBalanceService_Tier(t *testing.T) {
+	mockStorage := &MockGophermartUserBalanceStorager{}
+	ctx := context.Background()
+	mockStorage.On("GetUserBalance", ctx, "123").Return(&models.Balance{Current: 100}, nil)
+
+	service := NewGophermartUserBalanceService(mockStorage, staticTierer{tier: tier.Tier{Name: "silver"}}, nil)
+	balance, err := service.GetUserBalanceService(ctx, "123")
+	assert.NoError(t, err)
+	assert.Equal(t, "silver", balance.Tier)
+
+	service = NewGophermartUserBalanceService(mockStorage, staticTierer{err: errors.New("db error")}, nil)
+	_, err = service.GetUserBalanceService(ctx, "123")
+	assert.Error(t, err)
+}
@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/campaign"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const defaultDryRunPeriod = 30 * 24 * time.Hour
+
+type GophermartCampaignStorager interface {
+	CreateCampaign(ctx context.Context, campaign *models.Campaign) error
+	GetCampaigns(ctx context.Context) ([]models.Campaign, error)
+	GetCampaign(ctx context.Context, campaignID int) (*models.Campaign, error)
+	UpdateCampaign(ctx context.Context, campaign *models.Campaign) error
+	DeleteCampaign(ctx context.Context, campaignID int) error
+	CreateBonus(ctx context.Context, bonus *models.Bonus, limit models.BonusLimit, since time.Time) error
+	GetProcessedOrders(ctx context.Context, before time.Time) ([]models.Orders, error)
+	GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error)
+}
+
+// GophermartCampaignService manages the bonus campaigns of a tenant and
+// grants their bonuses when orders are processed.
+type GophermartCampaignService struct {
+	storage GophermartCampaignStorager
+	auditor GophermartAuditor
+	log     *logger.Logger
+}
+
+func NewGophermartCampaignService(storage GophermartCampaignStorager, auditor GophermartAuditor, log *logger.Logger) *GophermartCampaignService {
+	return &GophermartCampaignService{
+		storage: storage,
+		auditor: auditor,
+		log:     log,
+	}
+}
+
+func (gs *GophermartCampaignService) GetCampaignsService(ctx context.Context) ([]models.Campaign, error) {
+	return gs.storage.GetCampaigns(ctx)
+}
+
+func (gs *GophermartCampaignService) GetCampaignService(ctx context.Context, campaignID int) (*models.Campaign, error) {
+	c, err := gs.storage.GetCampaign(ctx, campaignID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrCampaignNotFound
+	}
+	return c, err
+}
+
+func (gs *GophermartCampaignService) CreateCampaignService(ctx context.Context, adminID string, request *models.CampaignRequest) (*models.Campaign, error) {
+	c := request.Campaign(time.Now())
+	if err := campaign.Validate(*c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCampaign, err)
+	}
+	if err := gs.storage.CreateCampaign(ctx, c); err != nil {
+		return nil, err
+	}
+	gs.auditor.Record(ctx, audit.EventAdminCampaign, adminID, map[string]any{"action": "created", "campaign_id": c.CampaignID})
+	return c, nil
+}
+
+// UpdateCampaignService replaces the campaign campaignID. It keeps its start
+// unless the request has one.
+func (gs *GophermartCampaignService) UpdateCampaignService(ctx context.Context, adminID string, campaignID int, request *models.CampaignRequest) (*models.Campaign, error) {
+	current, err := gs.GetCampaignService(ctx, campaignID)
+	if err != nil {
+		return nil, err
+	}
+
+	c := request.Campaign(current.StartsAt)
+	c.CampaignID = campaignID
+	if err := campaign.Validate(*c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCampaign, err)
+	}
+	if err := gs.storage.UpdateCampaign(ctx, c); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrCampaignNotFound
+		}
+		return nil, err
+	}
+	gs.auditor.Record(ctx, audit.EventAdminCampaign, adminID, map[string]any{"action": "updated", "campaign_id": campaignID})
+	return c, nil
+}
+
+// DeleteCampaignService deletes the campaign campaignID. The bonuses it has
+// granted stay.
+func (gs *GophermartCampaignService) DeleteCampaignService(ctx context.Context, adminID string, campaignID int) error {
+	if err := gs.storage.DeleteCampaign(ctx, campaignID); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrCampaignNotFound
+		}
+		return err
+	}
+	gs.auditor.Record(ctx, audit.EventAdminCampaign, adminID, map[string]any{"action": "deleted", "campaign_id": campaignID})
+	return nil
+}
+
+// DryRunCampaignService previews the campaign of the request against the
+// orders processed in its period, by default the last 30 days. Nothing is
+// stored.
+func (gs *GophermartCampaignService) DryRunCampaignService(ctx context.Context, request *models.CampaignDryRunRequest) (*models.CampaignPreview, error) {
+	now := time.Now()
+	to := now
+	if request.To != nil {
+		to = *request.To
+	}
+	from := to.Add(-defaultDryRunPeriod)
+	if request.From != nil {
+		from = *request.From
+	}
+	if !from.Before(to) {
+		return nil, ErrInvalidPeriod
+	}
+
+	c := request.Campaign.Campaign(from)
+	if err := campaign.Validate(*c); err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidCampaign, err)
+	}
+
+	orders, err := gs.storage.GetProcessedOrders(ctx, to)
+	if err != nil {
+		return nil, err
+	}
+	preview := campaign.Preview(*c, orders, from, to)
+	return &preview, nil
+}
+
+// ApplyCampaignsService grants the bonuses of the active campaigns for an
+// order that has just been processed. Campaigns that already rewarded the
+// order or reached their limits for the user are skipped, so it is safe to
+// apply them again.
+func (gs *GophermartCampaignService) ApplyCampaignsService(ctx context.Context, order models.Orders) error {
+	campaigns, err := gs.storage.GetCampaigns(ctx)
+	if err != nil {
+		return err
+	}
+	var active []models.Campaign
+	for _, c := range campaigns {
+		if campaign.Active(c, order.UploadedAt) {
+			active = append(active, c)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+
+	userID := strconv.Itoa(order.UserID)
+	orders, err := gs.storage.GetOrdersByUserID(ctx, userID)
+	if err != nil {
+		return err
+	}
+	facts := campaign.Facts{Order: order}
+	for _, o := range orders {
+		if o.Status == order.Status && o.Number != order.Number && o.UploadedAt.Before(order.UploadedAt) {
+			facts.PreviousOrders++
+		}
+	}
+
+	since := campaign.MonthStart(time.Now())
+	var errs []error
+	for _, c := range active {
+		bonus := &models.Bonus{
+			UserID:      order.UserID,
+			OrderNumber: order.Number,
+			CampaignID:  c.CampaignID,
+			Amount:      campaign.Evaluate(c, facts),
+		}
+		if bonus.Amount <= 0 {
+			continue
+		}
+		if err := gs.storage.CreateBonus(ctx, bonus, campaign.Limit(c), since); err != nil {
+			if errors.Is(err, storage.ErrBonusIsExist) || errors.Is(err, storage.ErrBonusLimitReached) {
+				gs.log.Ctx(ctx).Debug("bonus not granted", zap.Int("campaign_id", c.CampaignID), zap.String("order_number", order.Number), zap.Error(err))
+				continue
+			}
+			errs = append(errs, fmt.Errorf("campaign %d: %w", c.CampaignID, err))
+			continue
+		}
+		gs.auditor.Record(ctx, audit.EventBonusGranted, userID, map[string]any{
+			"campaign_id": c.CampaignID,
+			"order":       order.Number,
+			"sum":         bonus.Amount,
+		})
+	}
+	return errors.Join(errs...)
+}
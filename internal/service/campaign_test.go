@@ -0,0 +1,220 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/campaign"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGophermartCampaignStorager is a mock implementation of GophermartCampaignStorager
+type MockGophermartCampaignStorager struct {
+	mock.Mock
+}
+
+func (m *MockGophermartCampaignStorager) CreateCampaign(ctx context.Context, c *models.Campaign) error {
+	args := m.Called(ctx, c)
+	return args.Error(0)
+}
+
+func (m *MockGophermartCampaignStorager) GetCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	args := m.Called(ctx)
+	campaigns, _ := args.Get(0).([]models.Campaign)
+	return campaigns, args.Error(1)
+}
+
+func (m *MockGophermartCampaignStorager) GetCampaign(ctx context.Context, campaignID int) (*models.Campaign, error) {
+	args := m.Called(ctx, campaignID)
+	c, _ := args.Get(0).(*models.Campaign)
+	return c, args.Error(1)
+}
+
+func (m *MockGophermartCampaignStorager) UpdateCampaign(ctx context.Context, c *models.Campaign) error {
+	args := m.Called(ctx, c)
+	return args.Error(0)
+}
+
+func (m *MockGophermartCampaignStorager) DeleteCampaign(ctx context.Context, campaignID int) error {
+	args := m.Called(ctx, campaignID)
+	return args.Error(0)
+}
+
+func (m *MockGophermartCampaignStorager) CreateBonus(ctx context.Context, bonus *models.Bonus, limit models.BonusLimit, since time.Time) error {
+	args := m.Called(ctx, bonus, limit, since)
+	return args.Error(0)
+}
+
+func (m *MockGophermartCampaignStorager) GetProcessedOrders(ctx context.Context, before time.Time) ([]models.Orders, error) {
+	args := m.Called(ctx, before)
+	orders, _ := args.Get(0).([]models.Orders)
+	return orders, args.Error(1)
+}
+
+func (m *MockGophermartCampaignStorager) GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error) {
+	args := m.Called(ctx, userID)
+	orders, _ := args.Get(0).([]models.Orders)
+	return orders, args.Error(1)
+}
+
+func TestGophermartCampaignService_CreateCampaignService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	mockStorage := &MockGophermartCampaignStorager{}
+	mockStorage.On("CreateCampaign", ctx, mock.MatchedBy(func(c *models.Campaign) bool {
+		return c.Name == "Weekend" && c.Enabled && !c.StartsAt.IsZero()
+	})).Run(func(args mock.Arguments) {
+		args.Get(1).(*models.Campaign).CampaignID = 3
+	}).Return(nil)
+
+	service := NewGophermartCampaignService(mockStorage, nopAuditor{}, log)
+	c, err := service.CreateCampaignService(ctx, "1", &models.CampaignRequest{
+		Name: "Weekend",
+		Rule: models.CampaignRule{Type: campaign.RuleMultiplier, Multiplier: 2, Weekdays: []string{"saturday"}},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 3, c.CampaignID)
+
+	_, err = service.CreateCampaignService(ctx, "1", &models.CampaignRequest{
+		Name: "Weekend",
+		Rule: models.CampaignRule{Type: campaign.RuleMultiplier, Multiplier: 0.5},
+	})
+	assert.ErrorIs(t, err, ErrInvalidCampaign)
+	mockStorage.AssertNumberOfCalls(t, "CreateCampaign", 1)
+}
+
+func TestGophermartCampaignService_UpdateCampaignService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	startsAt := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	mockStorage := &MockGophermartCampaignStorager{}
+	mockStorage.On("GetCampaign", ctx, 3).Return(&models.Campaign{CampaignID: 3, StartsAt: startsAt}, nil)
+	mockStorage.On("GetCampaign", ctx, 4).Return(nil, sql.ErrNoRows)
+	mockStorage.On("UpdateCampaign", ctx, mock.MatchedBy(func(c *models.Campaign) bool {
+		return c.CampaignID == 3 && c.StartsAt.Equal(startsAt) && !c.Enabled
+	})).Return(nil)
+
+	service := NewGophermartCampaignService(mockStorage, nopAuditor{}, log)
+	disabled := false
+	request := &models.CampaignRequest{Name: "Welcome", Rule: models.CampaignRule{Type: campaign.RuleFirstOrder, Amount: 10}, Enabled: &disabled}
+	c, err := service.UpdateCampaignService(ctx, "1", 3, request)
+	require.NoError(t, err)
+	assert.Equal(t, startsAt, c.StartsAt, "the start is kept")
+
+	_, err = service.UpdateCampaignService(ctx, "1", 4, request)
+	assert.ErrorIs(t, err, ErrCampaignNotFound)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartCampaignService_DeleteCampaignService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	mockStorage := &MockGophermartCampaignStorager{}
+	mockStorage.On("DeleteCampaign", ctx, 3).Return(nil)
+	mockStorage.On("DeleteCampaign", ctx, 4).Return(sql.ErrNoRows)
+
+	service := NewGophermartCampaignService(mockStorage, nopAuditor{}, log)
+	assert.NoError(t, service.DeleteCampaignService(ctx, "1", 3))
+	assert.ErrorIs(t, service.DeleteCampaignService(ctx, "1", 4), ErrCampaignNotFound)
+}
+
+func TestGophermartCampaignService_DryRunCampaignService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	mockStorage := &MockGophermartCampaignStorager{}
+	mockStorage.On("GetProcessedOrders", ctx, to).Return([]models.Orders{
+		{Number: "1", UserID: 1, Status: "PROCESSED", Accrual: 10, UploadedAt: from.Add(time.Hour)},
+		{Number: "2", UserID: 1, Status: "PROCESSED", Accrual: 10, UploadedAt: from.Add(2 * time.Hour)},
+	}, nil)
+
+	service := NewGophermartCampaignService(mockStorage, nopAuditor{}, log)
+	request := &models.CampaignDryRunRequest{
+		Campaign: models.CampaignRequest{Name: "Welcome", Rule: models.CampaignRule{Type: campaign.RuleFirstOrder, Amount: 25}},
+		From:     &from,
+		To:       &to,
+	}
+	preview, err := service.DryRunCampaignService(ctx, request)
+	require.NoError(t, err)
+	assert.Equal(t, 2, preview.Orders)
+	assert.Equal(t, float64(25), preview.TotalBonus)
+	mockStorage.AssertNotCalled(t, "CreateBonus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	request.From, request.To = &to, &from
+	_, err = service.DryRunCampaignService(ctx, request)
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+}
+
+func TestGophermartCampaignService_ApplyCampaignsService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	startsAt := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	uploadedAt := time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC)
+	campaigns := []models.Campaign{
+		{CampaignID: 1, Name: "Weekend", Rule: models.CampaignRule{Type: campaign.RuleMultiplier, Multiplier: 3}, MonthlyCap: 100, StartsAt: startsAt, Enabled: true},
+		{CampaignID: 2, Name: "Welcome", Rule: models.CampaignRule{Type: campaign.RuleFirstOrder, Amount: 50}, StartsAt: startsAt, Enabled: true},
+		{CampaignID: 3, Name: "Disabled", Rule: models.CampaignRule{Type: campaign.RuleFirstOrder, Amount: 50}, StartsAt: startsAt},
+		{CampaignID: 4, Name: "Later", Rule: models.CampaignRule{Type: campaign.RuleFirstOrder, Amount: 50}, StartsAt: uploadedAt.Add(time.Hour), Enabled: true},
+	}
+	order := models.Orders{Number: "79927398713", UserID: 7, Status: "PROCESSED", Accrual: 40, UploadedAt: uploadedAt}
+
+	mockStorage := &MockGophermartCampaignStorager{}
+	mockStorage.On("GetCampaigns", ctx).Return(campaigns, nil)
+	mockStorage.On("GetOrdersByUserID", ctx, "7").Return([]models.Orders{order}, nil)
+	mockStorage.On("CreateBonus", ctx, mock.MatchedBy(func(bonus *models.Bonus) bool {
+		return bonus.CampaignID == 1 && bonus.Amount == 80 && bonus.OrderNumber == order.Number && bonus.UserID == 7
+	}), models.BonusLimit{MonthlyCap: 100}, mock.Anything).Return(nil)
+	mockStorage.On("CreateBonus", ctx, mock.MatchedBy(func(bonus *models.Bonus) bool {
+		return bonus.CampaignID == 2 && bonus.Amount == 50
+	}), models.BonusLimit{OncePerUser: true}, mock.Anything).Return(storage.ErrBonusLimitReached)
+
+	service := NewGophermartCampaignService(mockStorage, nopAuditor{}, log)
+	require.NoError(t, service.ApplyCampaignsService(ctx, order), "limits reached are not errors")
+	mockStorage.AssertExpectations(t)
+	mockStorage.AssertNumberOfCalls(t, "CreateBonus", 2)
+}
+
+func TestGophermartCampaignService_ApplyCampaignsService_NotFirstOrder(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	uploadedAt := time.Date(2026, 3, 7, 12, 0, 0, 0, time.UTC)
+	order := models.Orders{Number: "79927398713", UserID: 7, Status: "PROCESSED", Accrual: 40, UploadedAt: uploadedAt}
+
+	mockStorage := &MockGophermartCampaignStorager{}
+	mockStorage.On("GetCampaigns", ctx).Return([]models.Campaign{
+		{CampaignID: 2, Name: "Welcome", Rule: models.CampaignRule{Type: campaign.RuleFirstOrder, Amount: 50}, StartsAt: uploadedAt.AddDate(0, -1, 0), Enabled: true},
+	}, nil)
+	mockStorage.On("GetOrdersByUserID", ctx, "7").Return([]models.Orders{
+		order,
+		{Number: "12345678903", UserID: 7, Status: "PROCESSED", UploadedAt: uploadedAt.Add(-time.Hour)},
+	}, nil)
+
+	service := NewGophermartCampaignService(mockStorage, nopAuditor{}, log)
+	require.NoError(t, service.ApplyCampaignsService(ctx, order))
+	mockStorage.AssertNotCalled(t, "CreateBonus", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+
+	failing := &MockGophermartCampaignStorager{}
+	failing.On("GetCampaigns", ctx).Return(nil, errors.New("connection lost"))
+	assert.Error(t, NewGophermartCampaignService(failing, nopAuditor{}, log).ApplyCampaignsService(ctx, order))
+}
@@ -0,0 +1,131 @@
+package service
+
+import (
+	"cmp"
+	"context"
+	"database/sql"
+	"errors"
+	"strconv"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+)
+
+type GophermartCancelOrderStorager interface {
+	GetOrderByNumber(ctx context.Context, orderNumber string) (*models.Orders, error)
+	CancelOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error)
+}
+
+type GophermartOrderEventPublisher interface {
+	Publish(event events.OrderStatusChanged)
+}
+
+// GophermartCancelOrderService cancels orders, e.g. when the goods were
+// returned. Orders that earned points have them clawed back following the
+// negative balance policy, see models.ClawbackAllow.
+type GophermartCancelOrderService struct {
+	storage GophermartCancelOrderStorager
+	policy  string
+	events  GophermartOrderEventPublisher
+	auditor GophermartAuditor
+	log     *logger.Logger
+}
+
+func NewGophermartCancelOrderService(storage GophermartCancelOrderStorager, policy string, events GophermartOrderEventPublisher, auditor GophermartAuditor, log *logger.Logger) *GophermartCancelOrderService {
+	return &GophermartCancelOrderService{
+		storage: storage,
+		policy:  cmp.Or(policy, models.ClawbackAllow),
+		events:  events,
+		auditor: auditor,
+		log:     log,
+	}
+}
+
+// CancelUserOrderService cancels an order of the user the accrual system
+// has not picked up yet.
+func (gs *GophermartCancelOrderService) CancelUserOrderService(ctx context.Context, userID string, orderNumber string, reason string) (*models.CancelledOrder, error) {
+	order, err := gs.getOrder(ctx, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	currentUser, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != currentUser {
+		return nil, ErrOrderNotFound
+	}
+	if order.Status != "NEW" {
+		return nil, ErrOrderNotCancellable
+	}
+
+	return gs.cancel(ctx, userID, order, models.CancelledByUser, reason)
+}
+
+// CancelOrderService cancels any order of the tenant that is not cancelled
+// yet on behalf of an admin or a partner, cancelledBy telling which.
+func (gs *GophermartCancelOrderService) CancelOrderService(ctx context.Context, actorID string, cancelledBy string, orderNumber string, reason string) (*models.CancelledOrder, error) {
+	order, err := gs.getOrder(ctx, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+	if order.Status == models.OrderCancelled {
+		return nil, ErrOrderNotCancellable
+	}
+
+	return gs.cancel(ctx, actorID, order, cancelledBy, reason)
+}
+
+func (gs *GophermartCancelOrderService) getOrder(ctx context.Context, orderNumber string) (*models.Orders, error) {
+	order, err := gs.storage.GetOrderByNumber(ctx, orderNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+	return order, nil
+}
+
+func (gs *GophermartCancelOrderService) cancel(ctx context.Context, actorID string, order *models.Orders, cancelledBy string, reason string) (*models.CancelledOrder, error) {
+	cancelled, err := gs.storage.CancelOrder(ctx, models.OrderCancellation{
+		Number:      order.Number,
+		UserID:      order.UserID,
+		Status:      order.Status,
+		Policy:      gs.policy,
+		CancelledBy: cancelledBy,
+		Reason:      reason,
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, storage.ErrOrderStatusChanged):
+			return nil, ErrOrderNotCancellable
+		case errors.Is(err, storage.ErrInsufficientFunds):
+			return nil, ErrInsufficientFunds
+		}
+		return nil, err
+	}
+
+	gs.auditor.Record(ctx, audit.EventOrderCancelled, actorID, map[string]any{
+		"order":           order.Number,
+		"user_id":         order.UserID,
+		"previous_status": cancelled.PreviousStatus,
+		"clawback":        cancelled.Clawback,
+		"written_off":     cancelled.WrittenOff,
+		"cancelled_by":    cancelledBy,
+		"reason":          reason,
+	})
+	if gs.events != nil {
+		gs.events.Publish(events.OrderStatusChanged{
+			UserID:    order.UserID,
+			Number:    order.Number,
+			Status:    models.OrderCancelled,
+			ChangedAt: cancelled.CancelledAt,
+		})
+	}
+	return cancelled, nil
+}
@@ -0,0 +1,142 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/events"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGophermartCancelOrderStorager is a mock implementation of GophermartCancelOrderStorager
+type MockGophermartCancelOrderStorager struct {
+	mock.Mock
+}
+
+func (m *MockGophermartCancelOrderStorager) GetOrderByNumber(ctx context.Context, orderNumber string) (*models.Orders, error) {
+	args := m.Called(ctx, orderNumber)
+	order, _ := args.Get(0).(*models.Orders)
+	return order, args.Error(1)
+}
+
+func (m *MockGophermartCancelOrderStorager) CancelOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error) {
+	args := m.Called(ctx, cancellation)
+	cancelled, _ := args.Get(0).(*models.CancelledOrder)
+	return cancelled, args.Error(1)
+}
+
+type recordingPublisher struct {
+	events []events.OrderStatusChanged
+}
+
+func (p *recordingPublisher) Publish(event events.OrderStatusChanged) {
+	p.events = append(p.events, event)
+}
+
+func TestGophermartCancelOrderService_CancelUserOrderService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	mockStorage := &MockGophermartCancelOrderStorager{}
+	mockStorage.On("GetOrderByNumber", ctx, "12345678903").Return(&models.Orders{Number: "12345678903", Status: "NEW", UserID: 1}, nil)
+	mockStorage.On("CancelOrder", ctx, models.OrderCancellation{
+		Number: "12345678903", UserID: 1, Status: "NEW", Policy: models.ClawbackAllow, CancelledBy: models.CancelledByUser, Reason: "changed my mind",
+	}).Return(&models.CancelledOrder{Number: "12345678903", Status: models.OrderCancelled, PreviousStatus: "NEW", CancelledAt: time.Now()}, nil)
+	publisher := &recordingPublisher{}
+
+	cancelled, err := NewGophermartCancelOrderService(mockStorage, "", publisher, nopAuditor{}, log).
+		CancelUserOrderService(ctx, "1", "12345678903", "changed my mind")
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderCancelled, cancelled.Status)
+	require.Len(t, publisher.events, 1)
+	assert.Equal(t, 1, publisher.events[0].UserID)
+	assert.Equal(t, models.OrderCancelled, publisher.events[0].Status)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartCancelOrderService_CancelUserOrderService_Errors(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		order     *models.Orders
+		getErr    error
+		cancelErr error
+		wantErr   error
+	}{
+		{name: "missing order", getErr: sql.ErrNoRows, wantErr: ErrOrderNotFound},
+		{name: "order of another user", order: &models.Orders{Number: "12345678903", Status: "NEW", UserID: 2}, wantErr: ErrOrderNotFound},
+		{name: "order picked up", order: &models.Orders{Number: "12345678903", Status: "PROCESSING", UserID: 1}, wantErr: ErrOrderNotCancellable},
+		{name: "order processed", order: &models.Orders{Number: "12345678903", Status: "PROCESSED", UserID: 1}, wantErr: ErrOrderNotCancellable},
+		{name: "status changed meanwhile", order: &models.Orders{Number: "12345678903", Status: "NEW", UserID: 1}, cancelErr: storage.ErrOrderStatusChanged, wantErr: ErrOrderNotCancellable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := &MockGophermartCancelOrderStorager{}
+			mockStorage.On("GetOrderByNumber", mock.Anything, "12345678903").Return(tt.order, tt.getErr)
+			mockStorage.On("CancelOrder", mock.Anything, mock.Anything).Return(nil, tt.cancelErr)
+
+			_, err := NewGophermartCancelOrderService(mockStorage, models.ClawbackAllow, nil, nopAuditor{}, log).
+				CancelUserOrderService(context.Background(), "1", "12345678903", "")
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.cancelErr == nil {
+				mockStorage.AssertNotCalled(t, "CancelOrder", mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestGophermartCancelOrderService_CancelOrderService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	mockStorage := &MockGophermartCancelOrderStorager{}
+	mockStorage.On("GetOrderByNumber", ctx, "79927398713").Return(&models.Orders{Number: "79927398713", Status: "PROCESSED", Accrual: 500, UserID: 2}, nil)
+	mockStorage.On("CancelOrder", ctx, models.OrderCancellation{
+		Number: "79927398713", UserID: 2, Status: "PROCESSED", Policy: models.ClawbackCap, CancelledBy: models.CancelledByPartner, Reason: "returned",
+	}).Return(&models.CancelledOrder{Number: "79927398713", Status: models.OrderCancelled, PreviousStatus: "PROCESSED", Clawback: 200, WrittenOff: 300}, nil)
+
+	cancelled, err := NewGophermartCancelOrderService(mockStorage, models.ClawbackCap, nil, nopAuditor{}, log).
+		CancelOrderService(ctx, "7", models.CancelledByPartner, "79927398713", "returned")
+	require.NoError(t, err)
+	assert.InDelta(t, 200, cancelled.Clawback, 0.001)
+	assert.InDelta(t, 300, cancelled.WrittenOff, 0.001)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartCancelOrderService_CancelOrderService_Errors(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name      string
+		status    string
+		cancelErr error
+		wantErr   error
+	}{
+		{name: "already cancelled", status: models.OrderCancelled, wantErr: ErrOrderNotCancellable},
+		{name: "rejected by the policy", status: "PROCESSED", cancelErr: storage.ErrInsufficientFunds, wantErr: ErrInsufficientFunds},
+		{name: "status changed meanwhile", status: "PROCESSING", cancelErr: storage.ErrOrderStatusChanged, wantErr: ErrOrderNotCancellable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := &MockGophermartCancelOrderStorager{}
+			mockStorage.On("GetOrderByNumber", mock.Anything, "79927398713").Return(&models.Orders{Number: "79927398713", Status: tt.status, UserID: 2}, nil)
+			mockStorage.On("CancelOrder", mock.Anything, mock.Anything).Return(nil, tt.cancelErr)
+
+			_, err := NewGophermartCancelOrderService(mockStorage, models.ClawbackReject, nil, nopAuditor{}, log).
+				CancelOrderService(context.Background(), "7", models.CancelledByAdmin, "79927398713", "")
+			assert.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+}
@@ -7,4 +7,18 @@ var (
 	ErrOrderAlreadyExists               = errors.New("order already exists")
 	ErrOrderAlreadyExistsForAnotherUser = errors.New("order already exists for another user")
 	ErrInvalidWithdrawSum               = errors.New("invalid withdraw sum")
+	ErrOrderNotFound                    = errors.New("order not found")
+	ErrOrderNotCancellable              = errors.New("order cannot be cancelled")
+	ErrWrongPassword                    = errors.New("wrong password")
+	ErrInvalidPeriod                    = errors.New("period start must be before its end")
+	ErrNoSigningKey                     = errors.New("no token signing key for the tenant")
+	ErrInsufficientFunds                = errors.New("insufficient funds")
+	ErrInvalidTransfer                  = errors.New("invalid transfer sum or memo")
+	ErrRecipientNotFound                = errors.New("recipient not found")
+	ErrSelfTransfer                     = errors.New("cannot transfer to oneself")
+	ErrTransferLimitExceeded            = errors.New("daily transfer limit exceeded")
+	ErrCampaignNotFound                 = errors.New("campaign not found")
+	ErrInvalidCampaign                  = errors.New("invalid campaign")
+	ErrReferralCodeNotFound             = errors.New("referral code not found")
+	ErrSelfReferral                     = errors.New("cannot refer oneself")
 )
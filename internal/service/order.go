@@ -6,15 +6,17 @@ import (
 	"errors"
 	"strconv"
 
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
-	"github.com/AndreyKuskov2/gophermart/pkg/validator"
 	"go.uber.org/zap"
 )
 
 type GophermartGetOrderStorager interface {
 	GetOrderByNumber(ctx context.Context, orderNumber string) (*models.Orders, error)
 	GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error)
+	GetOrderStatusHistory(ctx context.Context, orderNumber string) ([]models.OrderStatusHistory, error)
 }
 
 type GophermartCreateOrderStorager interface {
@@ -24,20 +26,24 @@ type GophermartCreateOrderStorager interface {
 type GophermartOrderService struct {
 	getStorage    GophermartGetOrderStorager
 	createStorage GophermartCreateOrderStorager
+	numbers       OrderNumberValidators
+	auditor       GophermartAuditor
 	log           *logger.Logger
 }
 
-func NewGophermartOrderService(getStorage GophermartGetOrderStorager, createStorage GophermartCreateOrderStorager, log *logger.Logger) *GophermartOrderService {
+func NewGophermartOrderService(getStorage GophermartGetOrderStorager, createStorage GophermartCreateOrderStorager, numbers OrderNumberValidators, auditor GophermartAuditor, log *logger.Logger) *GophermartOrderService {
 	return &GophermartOrderService{
 		getStorage:    getStorage,
 		createStorage: createStorage,
+		numbers:       numbers,
+		auditor:       auditor,
 		log:           log,
 	}
 }
 
 func (gs *GophermartOrderService) CreateNewOrderService(ctx context.Context, orderNumber string, userID string) error {
-	if !validator.LuhnAlgorith(orderNumber) {
-		gs.log.Log.Info(ErrNumberIsNotCorrect.Error(), zap.String("order_number", orderNumber))
+	if err := gs.numbers.Validate(ctx, orderNumber); err != nil {
+		gs.log.Ctx(ctx).Debug(ErrNumberIsNotCorrect.Error(), zap.String("order_number", orderNumber), zap.Error(err))
 		return ErrNumberIsNotCorrect
 	}
 
@@ -51,11 +57,7 @@ func (gs *GophermartOrderService) CreateNewOrderService(ctx context.Context, ord
 		return err
 	}
 	if order != nil {
-		if order.UserID == currentUser {
-			return ErrOrderAlreadyExists
-		} else {
-			return ErrOrderAlreadyExistsForAnotherUser
-		}
+		return orderOwnerError(order, currentUser)
 	}
 
 	newOrder := &models.Orders{
@@ -64,12 +66,55 @@ func (gs *GophermartOrderService) CreateNewOrderService(ctx context.Context, ord
 		UserID: currentUser,
 	}
 	if err := gs.createStorage.CreateNewOrder(ctx, newOrder); err != nil {
+		if errors.Is(err, storage.ErrOrderIsExist) {
+			order, getErr := gs.getStorage.GetOrderByNumber(ctx, orderNumber)
+			if getErr != nil {
+				return getErr
+			}
+			return orderOwnerError(order, currentUser)
+		}
 		return err
 	}
+	gs.auditor.Record(ctx, audit.EventOrderUploaded, userID, map[string]any{"order": orderNumber})
 
 	return nil
 }
 
+func orderOwnerError(order *models.Orders, userID int) error {
+	if order.UserID == userID {
+		return ErrOrderAlreadyExists
+	}
+	return ErrOrderAlreadyExistsForAnotherUser
+}
+
 func (gs *GophermartOrderService) GetOrdersService(ctx context.Context, userID string) ([]models.Orders, error) {
 	return gs.getStorage.GetOrdersByUserID(ctx, userID)
 }
+
+func (gs *GophermartOrderService) GetOrderService(ctx context.Context, userID string, orderNumber string) (*models.OrderDetails, error) {
+	order, err := gs.getStorage.GetOrderByNumber(ctx, orderNumber)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrOrderNotFound
+		}
+		return nil, err
+	}
+
+	currentUser, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+	if order.UserID != currentUser {
+		return nil, ErrOrderNotFound
+	}
+
+	history, err := gs.getStorage.GetOrderStatusHistory(ctx, orderNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.OrderDetails{
+		Orders:  *order,
+		History: history,
+	}, nil
+}
@@ -7,7 +7,10 @@ import (
 	"testing"
 
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/AndreyKuskov2/gophermart/pkg/validator"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -29,6 +32,12 @@ func (m *MockGetOrderStorager) GetOrdersByUserID(ctx context.Context, userID str
 	return orders, args.Error(1)
 }
 
+func (m *MockGetOrderStorager) GetOrderStatusHistory(ctx context.Context, orderNumber string) ([]models.OrderStatusHistory, error) {
+	args := m.Called(ctx, orderNumber)
+	history, _ := args.Get(0).([]models.OrderStatusHistory)
+	return history, args.Error(1)
+}
+
 // Mock for GophermartCreateOrderStorager
 type MockCreateOrderStorager struct {
 	mock.Mock
@@ -43,7 +52,7 @@ func TestCreateNewOrderService_Success(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	orderNumber := "79927398713" // valid Luhn
@@ -62,7 +71,7 @@ func TestCreateNewOrderService_LuhnFail(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	orderNumber := "1234567890" // invalid Luhn
@@ -72,11 +81,41 @@ func TestCreateNewOrderService_LuhnFail(t *testing.T) {
 	assert.ErrorIs(t, err, ErrNumberIsNotCorrect)
 }
 
+func TestCreateNewOrderService_EmptyNumber(t *testing.T) {
+	getStorage := &MockGetOrderStorager{}
+	createStorage := &MockCreateOrderStorager{}
+	log, _ := logger.NewLogger()
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
+
+	err := service.CreateNewOrderService(context.Background(), "", "1")
+	assert.ErrorIs(t, err, ErrNumberIsNotCorrect)
+	getStorage.AssertNotCalled(t, "GetOrderByNumber", mock.Anything, mock.Anything)
+}
+
+func TestCreateNewOrderService_TenantValidators(t *testing.T) {
+	getStorage := &MockGetOrderStorager{}
+	createStorage := &MockCreateOrderStorager{}
+	log, _ := logger.NewLogger()
+	damm := validator.All(validator.Prefixes("5"), validator.Damm())
+	service := NewGophermartOrderService(getStorage, createStorage, OrderNumberValidators{"acme": damm}, nopAuditor{}, log)
+
+	acme := tenant.WithID(context.Background(), "acme")
+	assert.ErrorIs(t, service.CreateNewOrderService(acme, "79927398713", "1"), ErrNumberIsNotCorrect, "a valid Luhn number is not a valid Damm one")
+
+	getStorage.On("GetOrderByNumber", acme, "5724").Return(nil, sql.ErrNoRows)
+	createStorage.On("CreateNewOrder", acme, mock.AnythingOfType("*models.Orders")).Return(nil)
+	assert.NoError(t, service.CreateNewOrderService(acme, "5724", "1"))
+
+	assert.ErrorIs(t, service.CreateNewOrderService(context.Background(), "5724", "1"), ErrNumberIsNotCorrect, "other tenants keep the default rules")
+	getStorage.AssertExpectations(t)
+	createStorage.AssertExpectations(t)
+}
+
 func TestCreateNewOrderService_OrderAlreadyExists_SameUser(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	orderNumber := "79927398713"
@@ -94,7 +133,7 @@ func TestCreateNewOrderService_OrderAlreadyExists_AnotherUser(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	orderNumber := "79927398713"
@@ -112,7 +151,7 @@ func TestCreateNewOrderService_GetOrderByNumberError(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	orderNumber := "79927398713"
@@ -130,7 +169,7 @@ func TestCreateNewOrderService_CreateNewOrderError(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	orderNumber := "79927398713"
@@ -144,11 +183,31 @@ func TestCreateNewOrderService_CreateNewOrderError(t *testing.T) {
 	createStorage.AssertExpectations(t)
 }
 
+func TestCreateNewOrderService_ConcurrentInsertByAnotherUser(t *testing.T) {
+	getStorage := &MockGetOrderStorager{}
+	createStorage := &MockCreateOrderStorager{}
+	log, _ := logger.NewLogger()
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
+
+	ctx := context.Background()
+	orderNumber := "79927398713"
+	userID := "1"
+
+	getStorage.On("GetOrderByNumber", ctx, orderNumber).Return(nil, sql.ErrNoRows).Once()
+	createStorage.On("CreateNewOrder", ctx, mock.AnythingOfType("*models.Orders")).Return(storage.ErrOrderIsExist)
+	getStorage.On("GetOrderByNumber", ctx, orderNumber).Return(&models.Orders{Number: orderNumber, UserID: 2}, nil).Once()
+
+	err := service.CreateNewOrderService(ctx, orderNumber, userID)
+	assert.ErrorIs(t, err, ErrOrderAlreadyExistsForAnotherUser)
+	getStorage.AssertExpectations(t)
+	createStorage.AssertExpectations(t)
+}
+
 func TestCreateNewOrderService_InvalidUserID(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	orderNumber := "79927398713"
@@ -164,7 +223,7 @@ func TestGetOrdersService_Success(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "1"
@@ -182,7 +241,7 @@ func TestGetOrdersService_Error(t *testing.T) {
 	getStorage := &MockGetOrderStorager{}
 	createStorage := &MockCreateOrderStorager{}
 	log, _ := logger.NewLogger()
-	service := NewGophermartOrderService(getStorage, createStorage, log)
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "1"
@@ -195,3 +254,65 @@ func TestGetOrdersService_Error(t *testing.T) {
 	assert.Nil(t, result)
 	getStorage.AssertExpectations(t)
 }
+
+func TestGetOrderService_Success(t *testing.T) {
+	getStorage := &MockGetOrderStorager{}
+	createStorage := &MockCreateOrderStorager{}
+	log, _ := logger.NewLogger()
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
+
+	ctx := context.Background()
+	orderNumber := "79927398713"
+	userID := "1"
+	order := &models.Orders{OrderID: 1, Number: orderNumber, Status: "PROCESSED", Accrual: 500, UserID: 1}
+	accrual := float32(500)
+	history := []models.OrderStatusHistory{
+		{Status: "NEW"},
+		{Status: "PROCESSING"},
+		{Status: "PROCESSED", Accrual: &accrual, RawResponse: []byte(`{"order":"79927398713","status":"PROCESSED","accrual":500}`)},
+	}
+
+	getStorage.On("GetOrderByNumber", ctx, orderNumber).Return(order, nil)
+	getStorage.On("GetOrderStatusHistory", ctx, orderNumber).Return(history, nil)
+
+	result, err := service.GetOrderService(ctx, userID, orderNumber)
+	assert.NoError(t, err)
+	assert.Equal(t, *order, result.Orders)
+	assert.Equal(t, history, result.History)
+	getStorage.AssertExpectations(t)
+}
+
+func TestGetOrderService_NotFound(t *testing.T) {
+	getStorage := &MockGetOrderStorager{}
+	createStorage := &MockCreateOrderStorager{}
+	log, _ := logger.NewLogger()
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
+
+	ctx := context.Background()
+	orderNumber := "79927398713"
+
+	getStorage.On("GetOrderByNumber", ctx, orderNumber).Return(nil, sql.ErrNoRows)
+
+	result, err := service.GetOrderService(ctx, "1", orderNumber)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	assert.Nil(t, result)
+	getStorage.AssertExpectations(t)
+}
+
+func TestGetOrderService_AnotherUser(t *testing.T) {
+	getStorage := &MockGetOrderStorager{}
+	createStorage := &MockCreateOrderStorager{}
+	log, _ := logger.NewLogger()
+	service := NewGophermartOrderService(getStorage, createStorage, nil, nopAuditor{}, log)
+
+	ctx := context.Background()
+	orderNumber := "79927398713"
+	order := &models.Orders{Number: orderNumber, UserID: 2}
+
+	getStorage.On("GetOrderByNumber", ctx, orderNumber).Return(order, nil)
+
+	result, err := service.GetOrderService(ctx, "1", orderNumber)
+	assert.ErrorIs(t, err, ErrOrderNotFound)
+	assert.Nil(t, result)
+	getStorage.AssertNotCalled(t, "GetOrderStatusHistory", ctx, orderNumber)
+}
@@ -0,0 +1,209 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// Ambiguous characters like 0 and O are left out so that codes can be
+	// read out and typed in.
+	referralCodeAlphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	referralCodeLength   = 8
+	referralCodeAttempts = 5
+)
+
+type GophermartReferralStorager interface {
+	EnsureReferralCode(ctx context.Context, code *models.ReferralCode) error
+	GetReferralCode(ctx context.Context, code string) (*models.ReferralCode, error)
+	CreateReferral(ctx context.Context, referral *models.Referral) error
+	GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]models.Referral, error)
+	RewardReferral(ctx context.Context, refereeID int, orderNumber string, reward models.ReferralReward) (*models.Referral, error)
+}
+
+// GophermartReferralService hands out referral codes and rewards both the
+// referrer and the referred user with reward once the first order of the
+// referred user is processed. Referrals made from the address of the
+// referrer or of another user they referred are recorded as rejected and
+// never rewarded.
+type GophermartReferralService struct {
+	storage GophermartReferralStorager
+	auditor GophermartAuditor
+	reward  models.ReferralReward
+	log     *logger.Logger
+}
+
+func NewGophermartReferralService(storage GophermartReferralStorager, auditor GophermartAuditor, reward models.ReferralReward, log *logger.Logger) *GophermartReferralService {
+	return &GophermartReferralService{
+		storage: storage,
+		auditor: auditor,
+		reward:  reward,
+		log:     log,
+	}
+}
+
+// FindReferrerService returns the referral code code of a user who is not
+// scheduled for deletion. Codes are not case sensitive.
+func (gs *GophermartReferralService) FindReferrerService(ctx context.Context, code string) (*models.ReferralCode, error) {
+	referralCode, err := gs.storage.GetReferralCode(ctx, strings.ToUpper(strings.TrimSpace(code)))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, ErrReferralCodeNotFound
+	}
+	return referralCode, err
+}
+
+// ReferService records that the user refereeID signed up with code.
+func (gs *GophermartReferralService) ReferService(ctx context.Context, code *models.ReferralCode, refereeID int) error {
+	if code.UserID == refereeID {
+		return ErrSelfReferral
+	}
+
+	referral := &models.Referral{
+		ReferrerID: code.UserID,
+		RefereeID:  refereeID,
+		Status:     models.ReferralPending,
+		IP:         audit.MetadataFromContext(ctx).IP,
+	}
+	sameIP, err := gs.sameIP(ctx, code, referral.IP)
+	if err != nil {
+		return err
+	}
+	if sameIP {
+		referral.Status, referral.Reason = models.ReferralRejected, models.ReferralSameIP
+	}
+
+	if err := gs.storage.CreateReferral(ctx, referral); err != nil {
+		if errors.Is(err, storage.ErrSelfReferral) {
+			return ErrSelfReferral
+		}
+		return err
+	}
+
+	event := audit.EventReferralCreated
+	if referral.Status == models.ReferralRejected {
+		event = audit.EventReferralRejected
+		gs.log.Ctx(ctx).Info("referral rejected", zap.Int("referrer_id", referral.ReferrerID), zap.String("reason", referral.Reason))
+	}
+	gs.auditor.Record(ctx, event, strconv.Itoa(refereeID), map[string]any{
+		"referrer_id": strconv.Itoa(referral.ReferrerID),
+		"reason":      referral.Reason,
+	})
+	return nil
+}
+
+// sameIP reports whether ip is the address code was created from or the
+// address another user referred with code signed up from.
+func (gs *GophermartReferralService) sameIP(ctx context.Context, code *models.ReferralCode, ip string) (bool, error) {
+	if ip == "" {
+		return false, nil
+	}
+	if ip == code.IP {
+		return true, nil
+	}
+	referrals, err := gs.storage.GetReferralsByReferrerID(ctx, code.UserID)
+	if err != nil {
+		return false, err
+	}
+	for _, r := range referrals {
+		if r.IP == ip {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// RewardReferralService rewards the pending referral of the owner of an
+// order that has just been processed. A referral is rewarded exactly once,
+// for the first processed order of the referred user.
+func (gs *GophermartReferralService) RewardReferralService(ctx context.Context, order models.Orders) error {
+	if order.Status != "PROCESSED" {
+		return nil
+	}
+	referral, err := gs.storage.RewardReferral(ctx, order.UserID, order.Number, gs.reward)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil
+		}
+		return err
+	}
+
+	gs.auditor.Record(ctx, audit.EventReferralRewarded, strconv.Itoa(referral.ReferrerID), map[string]any{
+		"referee_id": strconv.Itoa(referral.RefereeID),
+		"sum":        referral.ReferrerBonus,
+	})
+	gs.auditor.Record(ctx, audit.EventReferralRewarded, strconv.Itoa(referral.RefereeID), map[string]any{
+		"referrer_id": strconv.Itoa(referral.ReferrerID),
+		"order":       referral.OrderNumber,
+		"sum":         referral.RefereeBonus,
+	})
+	return nil
+}
+
+// GetReferralsService returns the referral code of the user, creating it on
+// first use, and the referrals made with it.
+func (gs *GophermartReferralService) GetReferralsService(ctx context.Context, userID string) (*models.ReferralSummary, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+	code, err := gs.ensureReferralCode(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	referrals, err := gs.storage.GetReferralsByReferrerID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &models.ReferralSummary{Code: code.Code, Referrals: referrals}
+	for _, r := range referrals {
+		switch r.Status {
+		case models.ReferralPending:
+			summary.Pending++
+		case models.ReferralRewarded:
+			summary.Rewarded++
+			summary.TotalBonus = roundCents(summary.TotalBonus + r.ReferrerBonus)
+		case models.ReferralRejected:
+			summary.Rejected++
+		}
+	}
+	return summary, nil
+}
+
+func (gs *GophermartReferralService) ensureReferralCode(ctx context.Context, userID int) (*models.ReferralCode, error) {
+	var err error
+	for range referralCodeAttempts {
+		code := &models.ReferralCode{
+			UserID: userID,
+			Code:   NewReferralCode(),
+			IP:     audit.MetadataFromContext(ctx).IP,
+		}
+		if err = gs.storage.EnsureReferralCode(ctx, code); err == nil {
+			return code, nil
+		}
+		if !errors.Is(err, storage.ErrReferralCodeIsExist) {
+			return nil, err
+		}
+	}
+	return nil, err
+}
+
+// NewReferralCode returns a random referral code.
+func NewReferralCode() string {
+	b := make([]byte, referralCodeLength)
+	rand.Read(b)
+	for i := range b {
+		b[i] = referralCodeAlphabet[int(b[i])%len(referralCodeAlphabet)]
+	}
+	return string(b)
+}
@@ -0,0 +1,170 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGophermartReferralStorager is a mock implementation of GophermartReferralStorager
+type MockGophermartReferralStorager struct {
+	mock.Mock
+}
+
+func (m *MockGophermartReferralStorager) EnsureReferralCode(ctx context.Context, code *models.ReferralCode) error {
+	args := m.Called(ctx, code)
+	return args.Error(0)
+}
+
+func (m *MockGophermartReferralStorager) GetReferralCode(ctx context.Context, code string) (*models.ReferralCode, error) {
+	args := m.Called(ctx, code)
+	referralCode, _ := args.Get(0).(*models.ReferralCode)
+	return referralCode, args.Error(1)
+}
+
+func (m *MockGophermartReferralStorager) CreateReferral(ctx context.Context, referral *models.Referral) error {
+	args := m.Called(ctx, referral)
+	return args.Error(0)
+}
+
+func (m *MockGophermartReferralStorager) GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]models.Referral, error) {
+	args := m.Called(ctx, referrerID)
+	referrals, _ := args.Get(0).([]models.Referral)
+	return referrals, args.Error(1)
+}
+
+func (m *MockGophermartReferralStorager) RewardReferral(ctx context.Context, refereeID int, orderNumber string, reward models.ReferralReward) (*models.Referral, error) {
+	args := m.Called(ctx, refereeID, orderNumber, reward)
+	referral, _ := args.Get(0).(*models.Referral)
+	return referral, args.Error(1)
+}
+
+var testReferralReward = models.ReferralReward{ReferrerBonus: 100, RefereeBonus: 50}
+
+func TestGophermartReferralService_FindReferrerService(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := &MockGophermartReferralStorager{}
+	mockStorage.On("GetReferralCode", ctx, "ALICE234").Return(&models.ReferralCode{UserID: 1, Code: "ALICE234"}, nil)
+	mockStorage.On("GetReferralCode", ctx, "MISSING2").Return(nil, sql.ErrNoRows)
+	service := NewGophermartReferralService(mockStorage, nopAuditor{}, testReferralReward, nil)
+
+	code, err := service.FindReferrerService(ctx, " alice234 ")
+	require.NoError(t, err)
+	assert.Equal(t, 1, code.UserID)
+
+	_, err = service.FindReferrerService(ctx, "missing2")
+	assert.ErrorIs(t, err, ErrReferralCodeNotFound)
+}
+
+func TestGophermartReferralService_ReferService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+	code := &models.ReferralCode{UserID: 1, Code: "ALICE234", IP: "10.0.0.1"}
+
+	tests := []struct {
+		name      string
+		ip        string
+		referrals []models.Referral
+		status    string
+		reason    string
+		event     string
+	}{
+		{name: "new address", ip: "10.0.0.2", referrals: []models.Referral{{IP: "10.0.0.3"}}, status: models.ReferralPending, event: audit.EventReferralCreated},
+		{name: "address of the referrer", ip: "10.0.0.1", status: models.ReferralRejected, reason: models.ReferralSameIP, event: audit.EventReferralRejected},
+		{name: "address of another referee", ip: "10.0.0.3", referrals: []models.Referral{{IP: "10.0.0.3"}}, status: models.ReferralRejected, reason: models.ReferralSameIP, event: audit.EventReferralRejected},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := audit.WithMetadata(context.Background(), audit.Metadata{IP: tt.ip})
+			mockStorage := &MockGophermartReferralStorager{}
+			mockStorage.On("GetReferralsByReferrerID", ctx, 1).Return(tt.referrals, nil).Maybe()
+			mockStorage.On("CreateReferral", ctx, mock.MatchedBy(func(r *models.Referral) bool {
+				return r.ReferrerID == 1 && r.RefereeID == 2 && r.IP == tt.ip && r.Status == tt.status && r.Reason == tt.reason
+			})).Return(nil)
+			auditor := &recordingAuditor{}
+			service := NewGophermartReferralService(mockStorage, auditor, testReferralReward, log)
+
+			require.NoError(t, service.ReferService(ctx, code, 2))
+			assert.Equal(t, []string{tt.event}, auditor.events)
+			mockStorage.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGophermartReferralService_ReferService_Self(t *testing.T) {
+	mockStorage := &MockGophermartReferralStorager{}
+	service := NewGophermartReferralService(mockStorage, nopAuditor{}, testReferralReward, nil)
+
+	err := service.ReferService(context.Background(), &models.ReferralCode{UserID: 1}, 1)
+	assert.ErrorIs(t, err, ErrSelfReferral)
+	mockStorage.AssertNotCalled(t, "CreateReferral", mock.Anything, mock.Anything)
+}
+
+func TestGophermartReferralService_RewardReferralService(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	mockStorage := &MockGophermartReferralStorager{}
+	mockStorage.On("RewardReferral", ctx, 2, "79927398713", testReferralReward).Return(&models.Referral{
+		ReferrerID: 1, RefereeID: 2, OrderNumber: "79927398713", ReferrerBonus: 100, RefereeBonus: 50, RewardedAt: &now,
+	}, nil).Once()
+	mockStorage.On("RewardReferral", ctx, 2, "12345678903", testReferralReward).Return(nil, sql.ErrNoRows).Once()
+	auditor := &recordingAuditor{}
+	service := NewGophermartReferralService(mockStorage, auditor, testReferralReward, nil)
+
+	require.NoError(t, service.RewardReferralService(ctx, models.Orders{Number: "2377225624", UserID: 2, Status: "PROCESSING"}))
+	require.NoError(t, service.RewardReferralService(ctx, models.Orders{Number: "79927398713", UserID: 2, Status: "PROCESSED"}))
+	require.NoError(t, service.RewardReferralService(ctx, models.Orders{Number: "12345678903", UserID: 2, Status: "PROCESSED"}),
+		"orders of users without a pending referral are ignored")
+
+	assert.Equal(t, []string{audit.EventReferralRewarded, audit.EventReferralRewarded}, auditor.events)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartReferralService_GetReferralsService(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := &MockGophermartReferralStorager{}
+	mockStorage.On("EnsureReferralCode", ctx, mock.Anything).Return(storage.ErrReferralCodeIsExist).Once()
+	mockStorage.On("EnsureReferralCode", ctx, mock.MatchedBy(func(c *models.ReferralCode) bool {
+		return c.UserID == 1 && len(c.Code) == referralCodeLength
+	})).Return(nil).Once()
+	mockStorage.On("GetReferralsByReferrerID", ctx, 1).Return([]models.Referral{
+		{Status: models.ReferralRewarded, ReferrerBonus: 100},
+		{Status: models.ReferralRewarded, ReferrerBonus: 100.5},
+		{Status: models.ReferralPending},
+		{Status: models.ReferralRejected, Reason: models.ReferralSameIP},
+	}, nil)
+	service := NewGophermartReferralService(mockStorage, nopAuditor{}, testReferralReward, nil)
+
+	summary, err := service.GetReferralsService(ctx, "1")
+	require.NoError(t, err)
+	assert.Len(t, summary.Code, referralCodeLength, "a colliding code is replaced")
+	assert.Equal(t, 2, summary.Rewarded)
+	assert.Equal(t, 1, summary.Pending)
+	assert.Equal(t, 1, summary.Rejected)
+	assert.InDelta(t, 200.5, summary.TotalBonus, 0.001)
+	assert.Len(t, summary.Referrals, 4)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestNewReferralCode(t *testing.T) {
+	seen := map[string]bool{}
+	for range 100 {
+		code := NewReferralCode()
+		require.Len(t, code, referralCodeLength)
+		for _, r := range code {
+			assert.True(t, strings.ContainsRune(referralCodeAlphabet, r), "unexpected %q in %v", r, code)
+		}
+		seen[code] = true
+	}
+	assert.Greater(t, len(seen), 90)
+}
@@ -0,0 +1,86 @@
+package service
+
+import (
+	"context"
+	"math"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+)
+
+type GophermartStatementStorager interface {
+	GetBalanceAt(ctx context.Context, userID string, at time.Time) (float64, error)
+	StreamStatementEntries(ctx context.Context, userID string, from, to time.Time, fn func(models.StatementEntry) error) error
+}
+
+// StatementWriter renders a statement as it is produced: WriteOpening is
+// called first, then WriteEntry for every movement and WriteSummary last.
+type StatementWriter interface {
+	WriteOpening(balance float64) error
+	WriteEntry(entry models.StatementEntry) error
+	WriteSummary(summary models.StatementSummary) error
+}
+
+type GophermartStatementService struct {
+	storage GophermartStatementStorager
+	log     *logger.Logger
+}
+
+func NewGophermartStatementService(storage GophermartStatementStorager, log *logger.Logger) *GophermartStatementService {
+	return &GophermartStatementService{
+		storage: storage,
+		log:     log,
+	}
+}
+
+// WriteStatementService writes the movements of the user in [from, to) with
+// the running balance. Amounts are rounded to cents before they are summed
+// so that the rows always add up to the totals.
+func (gs *GophermartStatementService) WriteStatementService(ctx context.Context, userID string, from, to time.Time, w StatementWriter) error {
+	if !from.Before(to) {
+		return ErrInvalidPeriod
+	}
+
+	opening, err := gs.storage.GetBalanceAt(ctx, userID, from)
+	if err != nil {
+		return err
+	}
+
+	summary := models.StatementSummary{OpeningBalance: roundCents(opening)}
+	if err := w.WriteOpening(summary.OpeningBalance); err != nil {
+		return err
+	}
+
+	balance := summary.OpeningBalance
+	err = gs.storage.StreamStatementEntries(ctx, userID, from, to, func(entry models.StatementEntry) error {
+		entry.Amount = roundCents(entry.Amount)
+		switch {
+		case entry.Type == models.StatementTransferIn:
+			summary.TotalTransferredIn = roundCents(summary.TotalTransferredIn + entry.Amount)
+		case entry.Type == models.StatementTransferOut:
+			summary.TotalTransferredOut = roundCents(summary.TotalTransferredOut - entry.Amount)
+		case entry.Type == models.StatementBonus, entry.Type == models.StatementReferral:
+			summary.TotalBonus = roundCents(summary.TotalBonus + entry.Amount)
+		case entry.Type == models.StatementClawback:
+			summary.TotalClawedBack = roundCents(summary.TotalClawedBack - entry.Amount)
+		case entry.Amount >= 0:
+			summary.TotalAccrued = roundCents(summary.TotalAccrued + entry.Amount)
+		default:
+			summary.TotalWithdrawn = roundCents(summary.TotalWithdrawn - entry.Amount)
+		}
+		balance = roundCents(balance + entry.Amount)
+		entry.Balance = balance
+		return w.WriteEntry(entry)
+	})
+	if err != nil {
+		return err
+	}
+
+	summary.ClosingBalance = balance
+	return w.WriteSummary(summary)
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
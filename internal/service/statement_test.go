@@ -0,0 +1,186 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGophermartStatementStorager is a mock implementation of GophermartStatementStorager
+type MockGophermartStatementStorager struct {
+	mock.Mock
+	entries []models.StatementEntry
+}
+
+func (m *MockGophermartStatementStorager) GetBalanceAt(ctx context.Context, userID string, at time.Time) (float64, error) {
+	args := m.Called(ctx, userID, at)
+	return args.Get(0).(float64), args.Error(1)
+}
+
+func (m *MockGophermartStatementStorager) StreamStatementEntries(ctx context.Context, userID string, from, to time.Time, fn func(models.StatementEntry) error) error {
+	args := m.Called(ctx, userID, from, to)
+	for _, entry := range m.entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return args.Error(0)
+}
+
+type recordingStatementWriter struct {
+	opening float64
+	entries []models.StatementEntry
+	summary *models.StatementSummary
+}
+
+func (w *recordingStatementWriter) WriteOpening(balance float64) error {
+	w.opening = balance
+	return nil
+}
+
+func (w *recordingStatementWriter) WriteEntry(entry models.StatementEntry) error {
+	w.entries = append(w.entries, entry)
+	return nil
+}
+
+func (w *recordingStatementWriter) WriteSummary(summary models.StatementSummary) error {
+	w.summary = &summary
+	return nil
+}
+
+func TestGophermartStatementService_WriteStatementService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	mockStorage := &MockGophermartStatementStorager{entries: []models.StatementEntry{
+		{Type: models.StatementAccrual, Order: "79927398713", Amount: 100.104999, At: from.Add(time.Hour)},
+		{Type: models.StatementWithdrawal, Order: "2377225624", Amount: -40.5, At: from.Add(2 * time.Hour)},
+		{Type: models.StatementAccrual, Order: "12345678903", Amount: 0.1, At: from.Add(3 * time.Hour)},
+		{Type: models.StatementClawback, Order: "79927398713", Amount: -20.4, At: from.Add(4 * time.Hour)},
+	}}
+	mockStorage.On("GetBalanceAt", ctx, "1", from).Return(10.2, nil)
+	mockStorage.On("StreamStatementEntries", ctx, "1", from, to).Return(nil)
+
+	w := &recordingStatementWriter{}
+	err = NewGophermartStatementService(mockStorage, log).WriteStatementService(ctx, "1", from, to, w)
+	require.NoError(t, err)
+
+	assert.Equal(t, 10.2, w.opening)
+	require.Len(t, w.entries, 4)
+	assert.Equal(t, 100.1, w.entries[0].Amount)
+	assert.Equal(t, 110.3, w.entries[0].Balance)
+	assert.Equal(t, -40.5, w.entries[1].Amount)
+	assert.Equal(t, 69.8, w.entries[1].Balance)
+	assert.Equal(t, 69.9, w.entries[2].Balance)
+	assert.Equal(t, 49.5, w.entries[3].Balance)
+
+	require.NotNil(t, w.summary)
+	assert.Equal(t, models.StatementSummary{
+		OpeningBalance:  10.2,
+		TotalAccrued:    100.2,
+		TotalWithdrawn:  40.5,
+		TotalClawedBack: 20.4,
+		ClosingBalance:  49.5,
+	}, *w.summary)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartStatementService_WriteStatementService_InvalidPeriod(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	mockStorage := &MockGophermartStatementStorager{}
+	at := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	err = NewGophermartStatementService(mockStorage, log).WriteStatementService(context.Background(), "1", at, at, &recordingStatementWriter{})
+	assert.ErrorIs(t, err, ErrInvalidPeriod)
+	mockStorage.AssertNotCalled(t, "GetBalanceAt", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestGophermartStatementService_WriteStatementService_StorageError(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+	storageErr := errors.New("connection lost")
+
+	mockStorage := &MockGophermartStatementStorager{}
+	mockStorage.On("GetBalanceAt", ctx, "1", from).Return(0.0, nil)
+	mockStorage.On("StreamStatementEntries", ctx, "1", from, to).Return(storageErr)
+
+	w := &recordingStatementWriter{}
+	err = NewGophermartStatementService(mockStorage, log).WriteStatementService(ctx, "1", from, to, w)
+	assert.ErrorIs(t, err, storageErr)
+	assert.Nil(t, w.summary)
+}
+
+func TestGophermartStatementService_WriteStatementService_Transfers(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	mockStorage := &MockGophermartStatementStorager{entries: []models.StatementEntry{
+		{Type: models.StatementTransferIn, Counterparty: "bob", Amount: 20, At: from.Add(time.Hour)},
+		{Type: models.StatementTransferOut, Counterparty: "carol", Amount: -5.5, At: from.Add(2 * time.Hour)},
+		{Type: models.StatementWithdrawal, Order: "2377225624", Amount: -4.5, At: from.Add(3 * time.Hour)},
+	}}
+	mockStorage.On("GetBalanceAt", ctx, "1", from).Return(0.0, nil)
+	mockStorage.On("StreamStatementEntries", ctx, "1", from, to).Return(nil)
+
+	w := &recordingStatementWriter{}
+	err = NewGophermartStatementService(mockStorage, log).WriteStatementService(ctx, "1", from, to, w)
+	require.NoError(t, err)
+
+	require.NotNil(t, w.summary)
+	assert.Equal(t, models.StatementSummary{
+		TotalWithdrawn:      4.5,
+		TotalTransferredIn:  20,
+		TotalTransferredOut: 5.5,
+		ClosingBalance:      10,
+	}, *w.summary)
+}
+
+func TestGophermartStatementService_WriteStatementService_Bonuses(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	from := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := from.AddDate(0, 1, 0)
+
+	mockStorage := &MockGophermartStatementStorager{entries: []models.StatementEntry{
+		{Type: models.StatementAccrual, Order: "79927398713", Amount: 100, At: from.Add(time.Hour)},
+		{Type: models.StatementBonus, Order: "79927398713", Amount: 100, At: from.Add(time.Hour)},
+		{Type: models.StatementBonus, Order: "79927398713", Amount: 12.345, At: from.Add(time.Hour)},
+		{Type: models.StatementReferral, Counterparty: "bob", Amount: 50, At: from.Add(2 * time.Hour)},
+	}}
+	mockStorage.On("GetBalanceAt", ctx, "1", from).Return(0.0, nil)
+	mockStorage.On("StreamStatementEntries", ctx, "1", from, to).Return(nil)
+
+	w := &recordingStatementWriter{}
+	err = NewGophermartStatementService(mockStorage, log).WriteStatementService(ctx, "1", from, to, w)
+	require.NoError(t, err)
+
+	require.NotNil(t, w.summary)
+	assert.Equal(t, models.StatementSummary{
+		TotalAccrued:   100,
+		TotalBonus:     162.35,
+		ClosingBalance: 262.35,
+	}, *w.summary)
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tier"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+type GophermartTierStorager interface {
+	GetAccruedSince(ctx context.Context, since time.Time) ([]models.UserAccrual, error)
+	GetUserTier(ctx context.Context, userID int) (*models.UserTier, error)
+	SetUserTier(ctx context.Context, userTier *models.UserTier) (*models.TierChange, error)
+	GetTierHistory(ctx context.Context, userID int) ([]models.TierChange, error)
+	CreateTierBonus(ctx context.Context, bonus *models.Bonus) error
+}
+
+// GophermartTierService assigns the loyalty tiers of a tenant from what the
+// users accrued over the rolling window and grants the tier bonus of the
+// orders processed while the users hold a tier. Tiers are only changed by
+// RecalculateTiersService; users that were not recalculated yet hold the
+// lowest tier. The default tiers are used when tiers is empty.
+type GophermartTierService struct {
+	storage GophermartTierStorager
+	auditor GophermartAuditor
+	tiers   []tier.Tier
+	window  time.Duration
+	log     *logger.Logger
+}
+
+func NewGophermartTierService(storage GophermartTierStorager, auditor GophermartAuditor, tiers []tier.Tier, window time.Duration, log *logger.Logger) *GophermartTierService {
+	if len(tiers) == 0 {
+		tiers = tier.Defaults()
+	}
+	return &GophermartTierService{
+		storage: storage,
+		auditor: auditor,
+		tiers:   tiers,
+		window:  window,
+		log:     log,
+	}
+}
+
+// RecalculateTiersService assigns every user of the tenant of the context
+// the tier their accruals over the window entitle them to and returns how
+// many users changed tier.
+func (gs *GophermartTierService) RecalculateTiersService(ctx context.Context) (int, error) {
+	accruals, err := gs.storage.GetAccruedSince(ctx, time.Now().Add(-gs.window))
+	if err != nil {
+		return 0, err
+	}
+
+	changed := 0
+	var errs []error
+	for _, accrual := range accruals {
+		current, _ := tier.For(gs.tiers, accrual.Accrued)
+		change, err := gs.storage.SetUserTier(ctx, &models.UserTier{
+			UserID:  accrual.UserID,
+			Tier:    current.Name,
+			Accrued: roundCents(accrual.Accrued),
+		})
+		if err != nil {
+			// The user was purged since the accruals were read.
+			if errors.Is(err, sql.ErrNoRows) {
+				continue
+			}
+			errs = append(errs, fmt.Errorf("user %d: %w", accrual.UserID, err))
+			continue
+		}
+		if change == nil {
+			continue
+		}
+
+		changed++
+		gs.auditor.Record(ctx, audit.EventTierChanged, strconv.Itoa(accrual.UserID), map[string]any{
+			"from":    change.From,
+			"to":      change.To,
+			"accrued": change.Accrued,
+		})
+	}
+	return changed, errors.Join(errs...)
+}
+
+// GetUserTierService returns the tier the user holds. A tier that is no
+// longer configured is replaced by the one the accruals of its last
+// recalculation entitle the user to.
+func (gs *GophermartTierService) GetUserTierService(ctx context.Context, userID string) (tier.Tier, error) {
+	current, _, err := gs.userTier(ctx, userID)
+	return current, err
+}
+
+// GetTierStatusService returns the tier of the user, how far the next tier
+// is and the tier history.
+func (gs *GophermartTierService) GetTierStatusService(ctx context.Context, userID string) (*models.TierStatus, error) {
+	current, userTier, err := gs.userTier(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+	history, err := gs.storage.GetTierHistory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	status := &models.TierStatus{
+		Tier:       current.Name,
+		Multiplier: current.Multiplier,
+		WindowDays: int(gs.window / (24 * time.Hour)),
+		History:    history,
+	}
+	if userTier != nil {
+		status.Accrued = userTier.Accrued
+		status.UpdatedAt = &userTier.UpdatedAt
+	}
+	if _, next := tier.For(gs.tiers, current.MinAccrual); next != nil {
+		status.NextTier = next.Name
+		status.NextTierRemaining = roundCents(max(next.MinAccrual-status.Accrued, 0))
+	}
+	return status, nil
+}
+
+// CreditTierBonusService grants the bonus of the tier the owner of an order
+// that has just been processed holds. An order gets at most one tier bonus.
+func (gs *GophermartTierService) CreditTierBonusService(ctx context.Context, order models.Orders) error {
+	if order.Status != "PROCESSED" || order.Accrual <= 0 {
+		return nil
+	}
+	userID := strconv.Itoa(order.UserID)
+	current, err := gs.GetUserTierService(ctx, userID)
+	if err != nil {
+		return err
+	}
+	bonus := &models.Bonus{
+		UserID:      order.UserID,
+		OrderNumber: order.Number,
+		Tier:        current.Name,
+		Amount:      tier.Bonus(current, order.Accrual),
+	}
+	if bonus.Amount <= 0 {
+		return nil
+	}
+
+	if err := gs.storage.CreateTierBonus(ctx, bonus); err != nil {
+		if errors.Is(err, storage.ErrBonusIsExist) {
+			gs.log.Ctx(ctx).Debug("tier bonus not granted", zap.String("order_number", order.Number), zap.Error(err))
+			return nil
+		}
+		return err
+	}
+	gs.auditor.Record(ctx, audit.EventBonusGranted, userID, map[string]any{
+		"tier":  bonus.Tier,
+		"order": order.Number,
+		"sum":   bonus.Amount,
+	})
+	return nil
+}
+
+// userTier returns the tier the user holds and what was stored at the last
+// recalculation, nil if there was none.
+func (gs *GophermartTierService) userTier(ctx context.Context, userID string) (tier.Tier, *models.UserTier, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return tier.Tier{}, nil, err
+	}
+	userTier, err := gs.storage.GetUserTier(ctx, id)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return gs.tiers[0], nil, nil
+		}
+		return tier.Tier{}, nil, err
+	}
+	if current, ok := tier.Find(gs.tiers, userTier.Tier); ok {
+		return current, userTier, nil
+	}
+	current, _ := tier.For(gs.tiers, userTier.Accrued)
+	return current, userTier, nil
+}
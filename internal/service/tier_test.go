@@ -0,0 +1,175 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tier"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGophermartTierStorager is a mock implementation of GophermartTierStorager
+type MockGophermartTierStorager struct {
+	mock.Mock
+}
+
+func (m *MockGophermartTierStorager) GetAccruedSince(ctx context.Context, since time.Time) ([]models.UserAccrual, error) {
+	args := m.Called(ctx, since)
+	accruals, _ := args.Get(0).([]models.UserAccrual)
+	return accruals, args.Error(1)
+}
+
+func (m *MockGophermartTierStorager) GetUserTier(ctx context.Context, userID int) (*models.UserTier, error) {
+	args := m.Called(ctx, userID)
+	userTier, _ := args.Get(0).(*models.UserTier)
+	return userTier, args.Error(1)
+}
+
+func (m *MockGophermartTierStorager) SetUserTier(ctx context.Context, userTier *models.UserTier) (*models.TierChange, error) {
+	args := m.Called(ctx, userTier)
+	change, _ := args.Get(0).(*models.TierChange)
+	return change, args.Error(1)
+}
+
+func (m *MockGophermartTierStorager) GetTierHistory(ctx context.Context, userID int) ([]models.TierChange, error) {
+	args := m.Called(ctx, userID)
+	history, _ := args.Get(0).([]models.TierChange)
+	return history, args.Error(1)
+}
+
+func (m *MockGophermartTierStorager) CreateTierBonus(ctx context.Context, bonus *models.Bonus) error {
+	args := m.Called(ctx, bonus)
+	return args.Error(0)
+}
+
+const testTierWindow = 90 * 24 * time.Hour
+
+func TestGophermartTierService_RecalculateTiersService(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := &MockGophermartTierStorager{}
+	auditor := &recordingAuditor{}
+	service := NewGophermartTierService(mockStorage, auditor, tier.Defaults(), testTierWindow, nil)
+
+	mockStorage.On("GetAccruedSince", ctx, mock.MatchedBy(func(since time.Time) bool {
+		return time.Since(since) > testTierWindow-time.Minute && time.Since(since) < testTierWindow+time.Minute
+	})).Return([]models.UserAccrual{{UserID: 1, Accrued: 1200}, {UserID: 2, Accrued: 10}, {UserID: 3, Accrued: 6000}, {UserID: 4}}, nil)
+	setTier := func(userID int, name string) *mock.Call {
+		return mockStorage.On("SetUserTier", ctx, mock.MatchedBy(func(userTier *models.UserTier) bool {
+			return userTier.UserID == userID && userTier.Tier == name
+		}))
+	}
+	setTier(1, "silver").Return(&models.TierChange{From: "bronze", To: "silver", Accrued: 1200}, nil)
+	setTier(2, "bronze").Return(nil, nil)
+	setTier(3, "gold").Return(nil, errors.New("database is down"))
+	setTier(4, "bronze").Return(nil, sql.ErrNoRows)
+
+	changed, err := service.RecalculateTiersService(ctx)
+	assert.ErrorContains(t, err, "database is down", "errors are reported after every user is recalculated")
+	assert.Equal(t, 1, changed)
+	assert.Equal(t, []string{audit.EventTierChanged}, auditor.events)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartTierService_GetTierStatusService(t *testing.T) {
+	ctx := context.Background()
+	updatedAt := time.Now()
+	history := []models.TierChange{{From: "bronze", To: "silver", Accrued: 1200}}
+
+	tests := []struct {
+		name     string
+		userTier *models.UserTier
+		err      error
+		want     models.TierStatus
+	}{
+		{
+			name: "not recalculated yet",
+			err:  sql.ErrNoRows,
+			want: models.TierStatus{Tier: "bronze", Multiplier: 1, WindowDays: 90, NextTier: "silver", NextTierRemaining: 1000, History: history},
+		},
+		{
+			name:     "silver",
+			userTier: &models.UserTier{Tier: "silver", Accrued: 1200.5, UpdatedAt: updatedAt},
+			want: models.TierStatus{Tier: "silver", Multiplier: 1.1, Accrued: 1200.5, WindowDays: 90, NextTier: "gold", NextTierRemaining: 3799.5,
+				UpdatedAt: &updatedAt, History: history},
+		},
+		{
+			name:     "highest tier",
+			userTier: &models.UserTier{Tier: "gold", Accrued: 9000, UpdatedAt: updatedAt},
+			want:     models.TierStatus{Tier: "gold", Multiplier: 1.25, Accrued: 9000, WindowDays: 90, UpdatedAt: &updatedAt, History: history},
+		},
+		{
+			name:     "tier no longer configured",
+			userTier: &models.UserTier{Tier: "platinum", Accrued: 1500, UpdatedAt: updatedAt},
+			want: models.TierStatus{Tier: "silver", Multiplier: 1.1, Accrued: 1500, WindowDays: 90, NextTier: "gold", NextTierRemaining: 3500,
+				UpdatedAt: &updatedAt, History: history},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := &MockGophermartTierStorager{}
+			mockStorage.On("GetUserTier", ctx, 7).Return(tt.userTier, tt.err)
+			mockStorage.On("GetTierHistory", ctx, 7).Return(history, nil)
+			service := NewGophermartTierService(mockStorage, nopAuditor{}, tier.Defaults(), testTierWindow, nil)
+
+			status, err := service.GetTierStatusService(ctx, "7")
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, *status)
+		})
+	}
+}
+
+func TestGophermartTierService_CreditTierBonusService(t *testing.T) {
+	ctx := context.Background()
+	processed := models.Orders{Number: "79927398713", UserID: 7, Status: "PROCESSED", Accrual: 500}
+
+	mockStorage := &MockGophermartTierStorager{}
+	auditor := &recordingAuditor{}
+	mockStorage.On("GetUserTier", ctx, 7).Return(&models.UserTier{Tier: "gold"}, nil)
+	mockStorage.On("CreateTierBonus", ctx, &models.Bonus{UserID: 7, OrderNumber: "79927398713", Tier: "gold", Amount: 125}).Return(nil).Once()
+	service := NewGophermartTierService(mockStorage, auditor, tier.Defaults(), testTierWindow, nil)
+
+	require.NoError(t, service.CreditTierBonusService(ctx, processed))
+	assert.Equal(t, []string{audit.EventBonusGranted}, auditor.events)
+	mockStorage.AssertExpectations(t)
+
+	invalid := processed
+	invalid.Status = "INVALID"
+	require.NoError(t, service.CreditTierBonusService(ctx, invalid))
+	mockStorage.AssertNumberOfCalls(t, "CreateTierBonus", 1)
+}
+
+func TestGophermartTierService_CreditTierBonusService_NoBonus(t *testing.T) {
+	ctx := context.Background()
+	processed := models.Orders{Number: "79927398713", UserID: 7, Status: "PROCESSED", Accrual: 500}
+
+	t.Run("lowest tier", func(t *testing.T) {
+		mockStorage := &MockGophermartTierStorager{}
+		mockStorage.On("GetUserTier", ctx, 7).Return(nil, sql.ErrNoRows)
+		service := NewGophermartTierService(mockStorage, nopAuditor{}, tier.Defaults(), testTierWindow, nil)
+
+		require.NoError(t, service.CreditTierBonusService(ctx, processed))
+		mockStorage.AssertNotCalled(t, "CreateTierBonus", mock.Anything, mock.Anything)
+	})
+
+	t.Run("already granted", func(t *testing.T) {
+		log, err := logger.NewLogger()
+		require.NoError(t, err)
+		mockStorage := &MockGophermartTierStorager{}
+		auditor := &recordingAuditor{}
+		mockStorage.On("GetUserTier", ctx, 7).Return(&models.UserTier{Tier: "silver"}, nil)
+		mockStorage.On("CreateTierBonus", ctx, mock.Anything).Return(storage.ErrBonusIsExist)
+		service := NewGophermartTierService(mockStorage, auditor, tier.Defaults(), testTierWindow, log)
+
+		require.NoError(t, service.CreditTierBonusService(ctx, processed))
+		assert.Empty(t, auditor.events)
+	})
+}
@@ -0,0 +1,83 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
+)
+
+const maxTransferMemoLength = 200
+
+type GophermartTransferStorager interface {
+	CreateTransfer(ctx context.Context, transfer *models.Transfer, limit models.TransferLimit, since time.Time) error
+	GetTransfersByUserID(ctx context.Context, userID string) ([]models.Transfer, error)
+}
+
+// GophermartTransferService moves points between users of a tenant. The sum
+// and the number of transfers a user sends are capped by limit per UTC day.
+type GophermartTransferService struct {
+	storage GophermartTransferStorager
+	auditor GophermartAuditor
+	limit   models.TransferLimit
+	log     *logger.Logger
+}
+
+func NewGophermartTransferService(storage GophermartTransferStorager, auditor GophermartAuditor, limit models.TransferLimit, log *logger.Logger) *GophermartTransferService {
+	return &GophermartTransferService{
+		storage: storage,
+		auditor: auditor,
+		limit:   limit,
+		log:     log,
+	}
+}
+
+func (gs *GophermartTransferService) TransferService(ctx context.Context, userID string, request *models.TransferRequest) (*models.Transfer, error) {
+	if request.Sum <= 0 || utf8.RuneCountInString(request.Memo) > maxTransferMemoLength {
+		gs.log.Ctx(ctx).Debug(ErrInvalidTransfer.Error(), zap.Float32("sum", request.Sum))
+		return nil, ErrInvalidTransfer
+	}
+
+	transfer := &models.Transfer{
+		SenderID:     userID,
+		Counterparty: request.Recipient,
+		Amount:       request.Sum,
+		Memo:         request.Memo,
+	}
+	if err := gs.storage.CreateTransfer(ctx, transfer, gs.limit, TransferDayStart(time.Now())); err != nil {
+		switch {
+		case errors.Is(err, storage.ErrInsufficientFunds):
+			return nil, ErrInsufficientFunds
+		case errors.Is(err, storage.ErrRecipientNotFound):
+			return nil, ErrRecipientNotFound
+		case errors.Is(err, storage.ErrSelfTransfer):
+			return nil, ErrSelfTransfer
+		case errors.Is(err, storage.ErrTransferLimitExceeded):
+			return nil, ErrTransferLimitExceeded
+		}
+		return nil, err
+	}
+	gs.auditor.Record(ctx, audit.EventTransfer, userID, map[string]any{
+		"recipient_id": transfer.RecipientID,
+		"sum":          transfer.Amount,
+	})
+
+	return transfer, nil
+}
+
+func (gs *GophermartTransferService) GetTransfersService(ctx context.Context, userID string) ([]models.Transfer, error) {
+	return gs.storage.GetTransfersByUserID(ctx, userID)
+}
+
+// TransferDayStart returns the start of the UTC day of now, when the daily
+// transfer limits were last reset.
+func TransferDayStart(now time.Time) time.Time {
+	now = now.UTC()
+	return time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,89 @@
+package service
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+)
+
+// MockGophermartTransferStorager is a mock implementation of GophermartTransferStorager
+type MockGophermartTransferStorager struct {
+	mock.Mock
+}
+
+func (m *MockGophermartTransferStorager) CreateTransfer(ctx context.Context, transfer *models.Transfer, limit models.TransferLimit, since time.Time) error {
+	args := m.Called(ctx, transfer, limit, since)
+	return args.Error(0)
+}
+
+func (m *MockGophermartTransferStorager) GetTransfersByUserID(ctx context.Context, userID string) ([]models.Transfer, error) {
+	args := m.Called(ctx, userID)
+	transfers, _ := args.Get(0).([]models.Transfer)
+	return transfers, args.Error(1)
+}
+
+func TestGophermartTransferService_TransferService(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	limit := models.TransferLimit{MaxAmount: 1000, MaxCount: 10}
+	mockStorage := &MockGophermartTransferStorager{}
+	mockStorage.On("CreateTransfer", ctx, mock.MatchedBy(func(transfer *models.Transfer) bool {
+		return transfer.SenderID == "1" && transfer.Counterparty == "bob" && transfer.Amount == 25 && transfer.Memo == "gift"
+	}), limit, TransferDayStart(time.Now())).Run(func(args mock.Arguments) {
+		args.Get(1).(*models.Transfer).RecipientID = "2"
+	}).Return(nil)
+
+	transfer, err := NewGophermartTransferService(mockStorage, nopAuditor{}, limit, log).
+		TransferService(ctx, "1", &models.TransferRequest{Recipient: "bob", Sum: 25, Memo: "gift"})
+	require.NoError(t, err)
+	assert.Equal(t, "2", transfer.RecipientID)
+	mockStorage.AssertExpectations(t)
+}
+
+func TestGophermartTransferService_TransferService_Errors(t *testing.T) {
+	log, err := logger.NewLogger()
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		request    models.TransferRequest
+		storageErr error
+		wantErr    error
+	}{
+		{name: "negative sum", request: models.TransferRequest{Recipient: "bob", Sum: -1}, wantErr: ErrInvalidTransfer},
+		{name: "long memo", request: models.TransferRequest{Recipient: "bob", Sum: 1, Memo: strings.Repeat("ы", 201)}, wantErr: ErrInvalidTransfer},
+		{name: "insufficient funds", request: models.TransferRequest{Recipient: "bob", Sum: 1}, storageErr: storage.ErrInsufficientFunds, wantErr: ErrInsufficientFunds},
+		{name: "unknown recipient", request: models.TransferRequest{Recipient: "bob", Sum: 1}, storageErr: storage.ErrRecipientNotFound, wantErr: ErrRecipientNotFound},
+		{name: "self transfer", request: models.TransferRequest{Recipient: "alice", Sum: 1}, storageErr: storage.ErrSelfTransfer, wantErr: ErrSelfTransfer},
+		{name: "limit exceeded", request: models.TransferRequest{Recipient: "bob", Sum: 1}, storageErr: storage.ErrTransferLimitExceeded, wantErr: ErrTransferLimitExceeded},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockStorage := &MockGophermartTransferStorager{}
+			mockStorage.On("CreateTransfer", mock.Anything, mock.Anything, mock.Anything, mock.Anything).Return(tt.storageErr)
+
+			_, err := NewGophermartTransferService(mockStorage, nopAuditor{}, models.TransferLimit{}, log).
+				TransferService(context.Background(), "1", &tt.request)
+			assert.ErrorIs(t, err, tt.wantErr)
+			if tt.storageErr == nil {
+				mockStorage.AssertNotCalled(t, "CreateTransfer", mock.Anything, mock.Anything, mock.Anything, mock.Anything)
+			}
+		})
+	}
+}
+
+func TestTransferDayStart(t *testing.T) {
+	moscow := time.FixedZone("MSK", 3*60*60)
+	now := time.Date(2024, 3, 1, 1, 30, 0, 0, moscow)
+	assert.Equal(t, time.Date(2024, 2, 29, 0, 0, 0, 0, time.UTC), TransferDayStart(now))
+}
@@ -2,32 +2,102 @@ package service
 
 import (
 	"context"
+	"strconv"
 
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"go.uber.org/zap"
 )
 
 type GophermartUserStorager interface {
 	CreateUser(ctx context.Context, user models.UserCreditials) (int, error)
 	GetUserByLogin(ctx context.Context, user models.UserCreditials) (int, error)
+	RestoreUser(ctx context.Context, userID string) (bool, error)
+}
+
+// GophermartReferrer records the referral of users who register with a
+// referral code.
+type GophermartReferrer interface {
+	FindReferrerService(ctx context.Context, code string) (*models.ReferralCode, error)
+	ReferService(ctx context.Context, code *models.ReferralCode, refereeID int) error
 }
 
 type GophermartUserService struct {
-	storage GophermartUserStorager
-	log     *logger.Logger
+	storage   GophermartUserStorager
+	auditor   GophermartAuditor
+	referrals GophermartReferrer
+	log       *logger.Logger
 }
 
-func NewGophermartUserService(storage GophermartUserStorager, log *logger.Logger) *GophermartUserService {
+// NewGophermartUserService creates the user service; referral codes are
+// ignored on registration when referrals is nil.
+func NewGophermartUserService(storage GophermartUserStorager, auditor GophermartAuditor, referrals GophermartReferrer, log *logger.Logger) *GophermartUserService {
 	return &GophermartUserService{
-		storage: storage,
-		log:     log,
+		storage:   storage,
+		auditor:   auditor,
+		referrals: referrals,
+		log:       log,
 	}
 }
 
+// RegisterUserService creates the user and records its referral. An unknown
+// referral code fails the registration with ErrReferralCodeNotFound, while
+// a referral that cannot be recorded does not.
 func (gs *GophermartUserService) RegisterUserService(ctx context.Context, user models.UserCreditials) (int, error) {
-	return gs.storage.CreateUser(ctx, user)
+	var code *models.ReferralCode
+	if user.ReferralCode != "" && gs.referrals != nil {
+		var err error
+		if code, err = gs.referrals.FindReferrerService(ctx, user.ReferralCode); err != nil {
+			return 0, err
+		}
+	}
+
+	userID, err := gs.storage.CreateUser(ctx, user)
+	if err != nil {
+		return 0, err
+	}
+	gs.auditor.Record(ctx, audit.EventUserRegistered, strconv.Itoa(userID), map[string]any{"login": user.Login})
+
+	if code != nil {
+		if err := gs.referrals.ReferService(ctx, code, userID); err != nil {
+			gs.log.Ctx(ctx).Error("failed to record referral", zap.Int("user_id", userID), zap.Error(err))
+		}
+	}
+	return userID, nil
 }
 
 func (gs *GophermartUserService) GetUserService(ctx context.Context, user models.UserCreditials) (int, error) {
-	return gs.storage.GetUserByLogin(ctx, user)
+	userID, err := gs.storage.GetUserByLogin(ctx, user)
+	if err != nil {
+		gs.auditor.Record(ctx, audit.EventLoginFailed, "", map[string]any{"login": user.Login})
+		return 0, err
+	}
+	gs.auditor.Record(ctx, audit.EventLoginSucceeded, strconv.Itoa(userID), nil)
+
+	// Logging in during the grace period cancels a scheduled deletion.
+	restored, err := gs.storage.RestoreUser(ctx, strconv.Itoa(userID))
+	if err != nil {
+		return 0, err
+	}
+	if restored {
+		gs.auditor.Record(ctx, audit.EventDeletionCancelled, strconv.Itoa(userID), nil)
+	}
+	return userID, nil
+}
+
+// IssueTokenService signs a token of the user for the tenant of ctx with
+// secret, the key of that tenant.
+func (gs *GophermartUserService) IssueTokenService(ctx context.Context, userID int, secret string) (string, error) {
+	if secret == "" {
+		return "", ErrNoSigningKey
+	}
+	token, err := jwt.CreateTenantJwtToken(secret, userID, tenant.ID(ctx))
+	if err != nil {
+		return "", err
+	}
+	gs.auditor.Record(ctx, audit.EventTokenIssued, strconv.Itoa(userID), nil)
+	return token, nil
 }
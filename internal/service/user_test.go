@@ -26,12 +26,17 @@ func (m *MockGophermartUserStorager) GetUserByLogin(ctx context.Context, user mo
 	return args.Int(0), args.Error(1)
 }
 
+func (m *MockGophermartUserStorager) RestoreUser(ctx context.Context, userID string) (bool, error) {
+	args := m.Called(ctx, userID)
+	return args.Bool(0), args.Error(1)
+}
+
 func TestNewGophermartUserService(t *testing.T) {
 	mockStorage := &MockGophermartUserStorager{}
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	assert.NotNil(t, service)
 	assert.Equal(t, mockStorage, service.storage)
@@ -43,7 +48,7 @@ func TestGophermartUserService_RegisterUserService_Success(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	ctx := context.Background()
 	user := models.UserCreditials{
@@ -66,7 +71,7 @@ func TestGophermartUserService_RegisterUserService_Error(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	ctx := context.Background()
 	user := models.UserCreditials{
@@ -90,7 +95,7 @@ func TestGophermartUserService_GetUserService_Success(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	ctx := context.Background()
 	user := models.UserCreditials{
@@ -100,6 +105,7 @@ func TestGophermartUserService_GetUserService_Success(t *testing.T) {
 
 	expectedUserID := 123
 	mockStorage.On("GetUserByLogin", ctx, user).Return(expectedUserID, nil)
+	mockStorage.On("RestoreUser", ctx, "123").Return(false, nil)
 
 	userID, err := service.GetUserService(ctx, user)
 
@@ -113,7 +119,7 @@ func TestGophermartUserService_GetUserService_Error(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	ctx := context.Background()
 	user := models.UserCreditials{
@@ -137,7 +143,7 @@ func TestGophermartUserService_RegisterUserService_EmptyCredentials(t *testing.T
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	ctx := context.Background()
 	user := models.UserCreditials{
@@ -161,7 +167,7 @@ func TestGophermartUserService_GetUserService_EmptyCredentials(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	ctx := context.Background()
 	user := models.UserCreditials{
@@ -183,7 +189,7 @@ func TestGophermartUserService_GetUserService_EmptyCredentials(t *testing.T) {
 func TestGophermartUserService_WithNilLogger(t *testing.T) {
 	mockStorage := &MockGophermartUserStorager{}
 
-	service := NewGophermartUserService(mockStorage, nil)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, nil)
 
 	assert.NotNil(t, service)
 	assert.Equal(t, mockStorage, service.storage)
@@ -195,7 +201,7 @@ func TestGophermartUserService_ContextCancellation(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartUserService(mockStorage, log)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, nil, log)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel the context immediately
@@ -215,3 +221,52 @@ func TestGophermartUserService_ContextCancellation(t *testing.T) {
 	assert.Equal(t, 0, userID)
 	mockStorage.AssertExpectations(t)
 }
+
+// MockGophermartReferrer is a mock implementation of GophermartReferrer
+type MockGophermartReferrer struct {
+	mock.Mock
+}
+
+func (m *MockGophermartReferrer) FindReferrerService(ctx context.Context, code string) (*models.ReferralCode, error) {
+	args := m.Called(ctx, code)
+	referralCode, _ := args.Get(0).(*models.ReferralCode)
+	return referralCode, args.Error(1)
+}
+
+func (m *MockGophermartReferrer) ReferService(ctx context.Context, code *models.ReferralCode, refereeID int) error {
+	args := m.Called(ctx, code, refereeID)
+	return args.Error(0)
+}
+
+func TestGophermartUserService_RegisterUserService_Referral(t *testing.T) {
+	log, err := logger.NewLogger()
+	assert.NoError(t, err)
+	ctx := context.Background()
+	code := &models.ReferralCode{UserID: 1, Code: "ALICE234"}
+
+	mockStorage := &MockGophermartUserStorager{}
+	referrer := &MockGophermartReferrer{}
+	user := models.UserCreditials{Login: "bob", Password: "secret", ReferralCode: "ALICE234"}
+	referrer.On("FindReferrerService", ctx, "ALICE234").Return(code, nil)
+	mockStorage.On("CreateUser", ctx, user).Return(2, nil)
+	referrer.On("ReferService", ctx, code, 2).Return(errors.New("database is down"))
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, referrer, log)
+
+	userID, err := service.RegisterUserService(ctx, user)
+	assert.NoError(t, err, "failing to record the referral does not fail the registration")
+	assert.Equal(t, 2, userID)
+	mockStorage.AssertExpectations(t)
+	referrer.AssertExpectations(t)
+}
+
+func TestGophermartUserService_RegisterUserService_UnknownReferralCode(t *testing.T) {
+	ctx := context.Background()
+	mockStorage := &MockGophermartUserStorager{}
+	referrer := &MockGophermartReferrer{}
+	referrer.On("FindReferrerService", ctx, "MISSING2").Return(nil, ErrReferralCodeNotFound)
+	service := NewGophermartUserService(mockStorage, nopAuditor{}, referrer, nil)
+
+	_, err := service.RegisterUserService(ctx, models.UserCreditials{Login: "bob", Password: "secret", ReferralCode: "MISSING2"})
+	assert.ErrorIs(t, err, ErrReferralCodeNotFound)
+	mockStorage.AssertNotCalled(t, "CreateUser", mock.Anything, mock.Anything)
+}
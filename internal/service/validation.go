@@ -0,0 +1,23 @@
+package service
+
+import (
+	"context"
+
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/AndreyKuskov2/gophermart/pkg/validator"
+)
+
+var defaultOrderNumberValidator = validator.Default()
+
+// OrderNumberValidators map tenant ids to the validators of the order
+// numbers of the tenants. Tenants without one, like all of them with nil
+// OrderNumberValidators, get validator.Default.
+type OrderNumberValidators map[string]validator.Validator
+
+// Validate checks orderNumber by the validator of the tenant of ctx.
+func (v OrderNumberValidators) Validate(ctx context.Context, orderNumber string) error {
+	if numbers, ok := v[tenant.ID(ctx)]; ok {
+		return numbers.Validate(orderNumber)
+	}
+	return defaultOrderNumberValidator.Validate(orderNumber)
+}
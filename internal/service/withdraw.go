@@ -2,10 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
 
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
-	"github.com/AndreyKuskov2/gophermart/pkg/validator"
 	"go.uber.org/zap"
 )
 
@@ -17,20 +19,24 @@ type GophermartWithdrawStorager interface {
 type GophermartWithdrawService struct {
 	storage GophermartWithdrawStorager
 	balance GophermartUserBalanceStorager
+	numbers OrderNumberValidators
+	auditor GophermartAuditor
 	log     *logger.Logger
 }
 
-func NewGophermartWithdrawService(storage GophermartWithdrawStorager, balance GophermartUserBalanceStorager, log *logger.Logger) *GophermartWithdrawService {
+func NewGophermartWithdrawService(storage GophermartWithdrawStorager, balance GophermartUserBalanceStorager, numbers OrderNumberValidators, auditor GophermartAuditor, log *logger.Logger) *GophermartWithdrawService {
 	return &GophermartWithdrawService{
 		storage: storage,
 		balance: balance,
+		numbers: numbers,
+		auditor: auditor,
 		log:     log,
 	}
 }
 
 func (gs *GophermartWithdrawService) WithdrawBalanceService(ctx context.Context, userID string, withdrawBalance *models.WithdrawBalanceRequest) error {
-	if !validator.LuhnAlgorith(withdrawBalance.Order) {
-		gs.log.Log.Info(ErrNumberIsNotCorrect.Error(), zap.String("order_number", withdrawBalance.Order))
+	if err := gs.numbers.Validate(ctx, withdrawBalance.Order); err != nil {
+		gs.log.Ctx(ctx).Debug(ErrNumberIsNotCorrect.Error(), zap.String("order_number", withdrawBalance.Order), zap.Error(err))
 		return ErrNumberIsNotCorrect
 	}
 
@@ -49,8 +55,15 @@ func (gs *GophermartWithdrawService) WithdrawBalanceService(ctx context.Context,
 		Amount:      withdrawBalance.Sum,
 	}
 	if err := gs.storage.CreateWithdrawal(ctx, withdrawal); err != nil {
+		if errors.Is(err, storage.ErrInsufficientFunds) {
+			return ErrInvalidWithdrawSum
+		}
 		return err
 	}
+	gs.auditor.Record(ctx, audit.EventWithdrawal, userID, map[string]any{
+		"order": withdrawBalance.Order,
+		"sum":   withdrawBalance.Sum,
+	})
 
 	return nil
 }
@@ -6,7 +6,10 @@ import (
 	"testing"
 
 	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
 	"github.com/AndreyKuskov2/gophermart/pkg/logger"
+	"github.com/AndreyKuskov2/gophermart/pkg/validator"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 )
@@ -33,7 +36,7 @@ func TestNewGophermartWithdrawService(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	assert.NotNil(t, service)
 	assert.Equal(t, mockWithdrawStorage, service.storage)
@@ -47,7 +50,7 @@ func TestGophermartWithdrawService_WithdrawBalanceService_Success(t *testing.T)
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -77,7 +80,7 @@ func TestGophermartWithdrawService_WithdrawBalanceService_InvalidOrderNumber(t *
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -91,13 +94,27 @@ func TestGophermartWithdrawService_WithdrawBalanceService_InvalidOrderNumber(t *
 	assert.ErrorIs(t, err, ErrNumberIsNotCorrect)
 }
 
+func TestGophermartWithdrawService_WithdrawBalanceService_Validators(t *testing.T) {
+	mockWithdrawStorage := &MockGophermartWithdrawStorager{}
+	mockBalanceStorage := &MockGophermartUserBalanceStorager{}
+	log, err := logger.NewLogger()
+	assert.NoError(t, err)
+
+	verhoeff := validator.Verhoeff()
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, OrderNumberValidators{tenant.DefaultID: verhoeff}, nopAuditor{}, log)
+
+	err = service.WithdrawBalanceService(context.Background(), "123", &models.WithdrawBalanceRequest{Order: "79927398713", Sum: 50})
+	assert.ErrorIs(t, err, ErrNumberIsNotCorrect)
+	mockBalanceStorage.AssertNotCalled(t, "GetUserBalance", mock.Anything, mock.Anything)
+}
+
 func TestGophermartWithdrawService_WithdrawBalanceService_InsufficientBalance(t *testing.T) {
 	mockWithdrawStorage := &MockGophermartWithdrawStorager{}
 	mockBalanceStorage := &MockGophermartUserBalanceStorager{}
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -125,7 +142,7 @@ func TestGophermartWithdrawService_WithdrawBalanceService_ExactBalance(t *testin
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -155,7 +172,7 @@ func TestGophermartWithdrawService_WithdrawBalanceService_GetBalanceError(t *tes
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -179,7 +196,7 @@ func TestGophermartWithdrawService_WithdrawBalanceService_CreateWithdrawalError(
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -210,7 +227,7 @@ func TestGophermartWithdrawService_WithdrawBalanceService_ZeroAmount(t *testing.
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -240,7 +257,7 @@ func TestGophermartWithdrawService_GetWithdrawalService_Success(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -275,7 +292,7 @@ func TestGophermartWithdrawService_GetWithdrawalService_EmptyList(t *testing.T)
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -297,7 +314,7 @@ func TestGophermartWithdrawService_GetWithdrawalService_Error(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx := context.Background()
 	userID := "123"
@@ -317,7 +334,7 @@ func TestGophermartWithdrawService_WithNilLogger(t *testing.T) {
 	mockWithdrawStorage := &MockGophermartWithdrawStorager{}
 	mockBalanceStorage := &MockGophermartUserBalanceStorager{}
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, nil)
 
 	assert.NotNil(t, service)
 	assert.Equal(t, mockWithdrawStorage, service.storage)
@@ -331,7 +348,7 @@ func TestGophermartWithdrawService_ContextCancellation(t *testing.T) {
 	log, err := logger.NewLogger()
 	assert.NoError(t, err)
 
-	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, log)
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
 
 	ctx, cancel := context.WithCancel(context.Background())
 	cancel() // Cancel the context immediately
@@ -351,3 +368,27 @@ func TestGophermartWithdrawService_ContextCancellation(t *testing.T) {
 	assert.Equal(t, expectedError, err)
 	mockBalanceStorage.AssertExpectations(t)
 }
+
+func TestGophermartWithdrawService_WithdrawBalanceService_InsufficientFundsOnCreate(t *testing.T) {
+	mockWithdrawStorage := &MockGophermartWithdrawStorager{}
+	mockBalanceStorage := &MockGophermartUserBalanceStorager{}
+	log, err := logger.NewLogger()
+	assert.NoError(t, err)
+
+	service := NewGophermartWithdrawService(mockWithdrawStorage, mockBalanceStorage, nil, nopAuditor{}, log)
+
+	ctx := context.Background()
+	userID := "123"
+	withdrawRequest := &models.WithdrawBalanceRequest{
+		Order: "79927398713",
+		Sum:   50.0,
+	}
+
+	mockBalanceStorage.On("GetUserBalance", ctx, userID).Return(&models.Balance{Current: 100.0}, nil)
+	mockWithdrawStorage.On("CreateWithdrawal", ctx, mock.AnythingOfType("*models.WithdrawBalance")).Return(storage.ErrInsufficientFunds)
+
+	err = service.WithdrawBalanceService(ctx, userID, withdrawRequest)
+
+	assert.ErrorIs(t, err, ErrInvalidWithdrawSum)
+	mockWithdrawStorage.AssertExpectations(t)
+}
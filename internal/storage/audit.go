@@ -0,0 +1,116 @@
+package storage
+
+import (
+	"context"
+	"errors"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *Postgres) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	// Appends are serialized so that every event links to its predecessor.
+	if _, err := tx.Exec(ctx, lockAuditChain); err != nil {
+		return err
+	}
+
+	var prevHash string
+	if err := tx.QueryRow(ctx, getLastAuditHash).Scan(&prevHash); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return err
+	}
+
+	event.TenantID = tenant.ID(ctx)
+	event.CreatedAt = audit.Timestamp(event.CreatedAt)
+	event.PrevHash = prevHash
+	event.Hash = audit.Hash(prevHash, event)
+
+	var details any
+	if len(event.Details) > 0 {
+		details = string(event.Details)
+	}
+	if err := tx.QueryRow(ctx, createAuditEvent,
+		event.EventType, event.UserID, event.IP, event.UserAgent, event.RequestID,
+		details, event.CreatedAt, event.PrevHash, event.Hash, event.TenantID,
+	).Scan(&event.EventID); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
+
+func (db *Postgres) GetAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]models.AuditEvent, error) {
+	rows, err := db.DB.Query(ctx, getAuditEvents, filter.UserID, filter.EventType, filter.From, filter.To, filter.Limit, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.AuditEvent])
+}
+
+func (db *Postgres) GetAuditChain(ctx context.Context) ([]models.AuditEvent, error) {
+	rows, err := db.DB.Query(ctx, getAuditEventsChain)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.AuditEvent])
+}
+
+func (m *Memory) AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	prevHash := ""
+	if len(m.auditEvents) > 0 {
+		prevHash = m.auditEvents[len(m.auditEvents)-1].Hash
+	}
+
+	m.nextAuditEventID++
+	event.EventID = m.nextAuditEventID
+	event.TenantID = tenant.ID(ctx)
+	event.CreatedAt = audit.Timestamp(event.CreatedAt)
+	event.PrevHash = prevHash
+	event.Hash = audit.Hash(prevHash, event)
+	m.auditEvents = append(m.auditEvents, *event)
+	return nil
+}
+
+func (m *Memory) GetAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]models.AuditEvent, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := []models.AuditEvent{}
+	for i := len(m.auditEvents) - 1; i >= 0 && (filter.Limit == 0 || len(events) < filter.Limit); i-- {
+		event := m.auditEvents[i]
+		switch {
+		case event.TenantID != tenantID:
+		case filter.UserID != nil && (event.UserID == nil || *event.UserID != *filter.UserID):
+		case filter.EventType != "" && event.EventType != filter.EventType:
+		case filter.From != nil && event.CreatedAt.Before(*filter.From):
+		case filter.To != nil && !event.CreatedAt.Before(*filter.To):
+		default:
+			events = append(events, event)
+		}
+	}
+	return events, nil
+}
+
+func (m *Memory) GetAuditChain(ctx context.Context) ([]models.AuditEvent, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	events := make([]models.AuditEvent, len(m.auditEvents))
+	copy(events, m.auditEvents)
+	return events, nil
+}
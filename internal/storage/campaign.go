@@ -0,0 +1,293 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/campaign"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *Postgres) CreateCampaign(ctx context.Context, c *models.Campaign) error {
+	c.TenantID = tenant.ID(ctx)
+	return db.DB.QueryRow(ctx, createCampaign, c.Name, c.Rule, c.MonthlyCap, c.StartsAt, c.EndsAt, c.Enabled, c.TenantID).Scan(&c.CampaignID, &c.CreatedAt)
+}
+
+func (db *Postgres) GetCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	rows, err := db.DB.Query(ctx, getCampaigns, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Campaign, error) {
+		return scanCampaign(ctx, row)
+	})
+}
+
+func (db *Postgres) GetCampaign(ctx context.Context, campaignID int) (*models.Campaign, error) {
+	c, err := scanCampaign(ctx, db.DB.QueryRow(ctx, getCampaign, campaignID, tenant.ID(ctx)))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("campaign not found: %w", sql.ErrNoRows)
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (db *Postgres) UpdateCampaign(ctx context.Context, c *models.Campaign) error {
+	c.TenantID = tenant.ID(ctx)
+	err := db.DB.QueryRow(ctx, updateCampaign, c.CampaignID, c.Name, c.Rule, c.MonthlyCap, c.StartsAt, c.EndsAt, c.Enabled, c.TenantID).Scan(&c.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("campaign not found: %w", sql.ErrNoRows)
+	}
+	return err
+}
+
+func (db *Postgres) DeleteCampaign(ctx context.Context, campaignID int) error {
+	tag, err := db.DB.Exec(ctx, deleteCampaign, campaignID, tenant.ID(ctx))
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("campaign not found: %w", sql.ErrNoRows)
+	}
+	return nil
+}
+
+func (db *Postgres) CreateBonus(ctx context.Context, bonus *models.Bonus, limit models.BonusLimit, since time.Time) error {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	if err := tx.QueryRow(ctx, lockUserForUpdate, bonus.UserID, tenant.ID(ctx)).Scan(&userID); err != nil {
+		return err
+	}
+
+	var exists bool
+	if err := tx.QueryRow(ctx, checkBonusIsExists, bonus.OrderNumber, bonus.CampaignID, tenant.ID(ctx)).Scan(&exists); err != nil {
+		return err
+	}
+	if exists {
+		return ErrBonusIsExist
+	}
+
+	var count int
+	var granted float64
+	if err := tx.QueryRow(ctx, getGrantedBonuses, bonus.UserID, bonus.CampaignID, tenant.ID(ctx), since).Scan(&count, &granted); err != nil {
+		return err
+	}
+	if err := limitBonus(bonus, limit, count, granted); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow(ctx, createBonus, bonus.UserID, bonus.OrderNumber, bonus.CampaignID, bonus.Amount, tenant.ID(ctx)).Scan(&bonus.BonusID, &bonus.CreatedAt); err != nil {
+		return err
+	}
+	bonus.TenantID = tenant.ID(ctx)
+	return tx.Commit(ctx)
+}
+
+func (db *Postgres) GetBonusesByUserID(ctx context.Context, userID string) ([]models.Bonus, error) {
+	rows, err := db.DB.Query(ctx, getBonusesByUserID, userID, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Bonus, error) {
+		bonus := models.Bonus{TenantID: tenant.ID(ctx)}
+		err := row.Scan(&bonus.BonusID, &bonus.UserID, &bonus.OrderNumber, &bonus.CampaignID, &bonus.Tier, &bonus.Amount, &bonus.CreatedAt)
+		return bonus, err
+	})
+}
+
+func (db *Postgres) GetProcessedOrders(ctx context.Context, before time.Time) ([]models.Orders, error) {
+	rows, err := db.DB.Query(ctx, getProcessedOrders, statusProcessed, before, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Orders])
+}
+
+func scanCampaign(ctx context.Context, row pgx.Row) (models.Campaign, error) {
+	c := models.Campaign{TenantID: tenant.ID(ctx)}
+	err := row.Scan(&c.CampaignID, &c.Name, &c.Rule, &c.MonthlyCap, &c.StartsAt, &c.EndsAt, &c.Enabled, &c.CreatedAt)
+	return c, err
+}
+
+func (m *Memory) CreateCampaign(ctx context.Context, c *models.Campaign) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.nextCampaignID++
+	c.CampaignID = m.nextCampaignID
+	c.CreatedAt = time.Now()
+	c.TenantID = tenant.ID(ctx)
+
+	stored := *c
+	m.campaigns = append(m.campaigns, &stored)
+	return nil
+}
+
+func (m *Memory) GetCampaigns(ctx context.Context) ([]models.Campaign, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	campaigns := []models.Campaign{}
+	for _, c := range m.campaigns {
+		if c.TenantID == tenantID {
+			campaigns = append(campaigns, *c)
+		}
+	}
+	return campaigns, nil
+}
+
+func (m *Memory) GetCampaign(ctx context.Context, campaignID int) (*models.Campaign, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	i, err := m.findCampaign(tenant.ID(ctx), campaignID)
+	if err != nil {
+		return nil, err
+	}
+	c := *m.campaigns[i]
+	return &c, nil
+}
+
+func (m *Memory) UpdateCampaign(ctx context.Context, c *models.Campaign) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.findCampaign(tenant.ID(ctx), c.CampaignID)
+	if err != nil {
+		return err
+	}
+	c.CreatedAt = m.campaigns[i].CreatedAt
+	c.TenantID = m.campaigns[i].TenantID
+
+	stored := *c
+	m.campaigns[i] = &stored
+	return nil
+}
+
+func (m *Memory) DeleteCampaign(ctx context.Context, campaignID int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.findCampaign(tenant.ID(ctx), campaignID)
+	if err != nil {
+		return err
+	}
+	m.campaigns = append(m.campaigns[:i], m.campaigns[i+1:]...)
+	for _, bonus := range m.bonuses {
+		if bonus.CampaignID == campaignID {
+			bonus.CampaignID = 0
+		}
+	}
+	return nil
+}
+
+func (m *Memory) CreateBonus(ctx context.Context, bonus *models.Bonus, limit models.BonusLimit, since time.Time) error {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findUser(tenantID, strconv.Itoa(bonus.UserID)); err != nil {
+		return err
+	}
+	if m.findOrder(tenantID, bonus.OrderNumber) == nil {
+		return fmt.Errorf("order not found: %w", sql.ErrNoRows)
+	}
+
+	var count int
+	var granted float64
+	for _, b := range m.bonuses {
+		if b.TenantID != tenantID || b.CampaignID != bonus.CampaignID {
+			continue
+		}
+		if b.OrderNumber == bonus.OrderNumber {
+			return ErrBonusIsExist
+		}
+		if b.UserID == bonus.UserID {
+			count++
+			if !b.CreatedAt.Before(since) {
+				granted += b.Amount
+			}
+		}
+	}
+	if err := limitBonus(bonus, limit, count, granted); err != nil {
+		return err
+	}
+
+	m.nextBonusID++
+	bonus.BonusID = m.nextBonusID
+	bonus.CreatedAt = time.Now()
+	bonus.TenantID = tenantID
+
+	stored := *bonus
+	m.bonuses = append(m.bonuses, &stored)
+	return nil
+}
+
+func (m *Memory) GetBonusesByUserID(ctx context.Context, userID string) ([]models.Bonus, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	bonuses := []models.Bonus{}
+	for i := len(m.bonuses) - 1; i >= 0; i-- {
+		bonus := m.bonuses[i]
+		if bonus.TenantID == tenantID && strconv.Itoa(bonus.UserID) == userID {
+			bonuses = append(bonuses, *bonus)
+		}
+	}
+	return bonuses, nil
+}
+
+func (m *Memory) GetProcessedOrders(ctx context.Context, before time.Time) ([]models.Orders, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orders := []models.Orders{}
+	for _, order := range m.orders {
+		if order.TenantID == tenantID && order.Status == statusProcessed && order.UploadedAt.Before(before) {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+func (m *Memory) findCampaign(tenantID string, campaignID int) (int, error) {
+	for i, c := range m.campaigns {
+		if c.TenantID == tenantID && c.CampaignID == campaignID {
+			return i, nil
+		}
+	}
+	return 0, fmt.Errorf("campaign not found: %w", sql.ErrNoRows)
+}
+
+// limitBonus clamps the amount of bonus to what limit leaves of it for a user
+// who has got count bonuses of the campaign, granted of them this month.
+func limitBonus(bonus *models.Bonus, limit models.BonusLimit, count int, granted float64) error {
+	if limit.OncePerUser && count > 0 {
+		return ErrBonusLimitReached
+	}
+	bonus.Amount = campaign.Capped(limit, granted, bonus.Amount)
+	if bonus.Amount <= 0 {
+		return ErrBonusLimitReached
+	}
+	return nil
+}
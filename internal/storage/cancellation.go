@@ -0,0 +1,275 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *Postgres) CancelOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error) {
+	return db.reverseOrder(ctx, cancellation, statusCancelled)
+}
+
+func (db *Postgres) InvalidateOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error) {
+	return db.reverseOrder(ctx, unrefusable(cancellation), statusInvalid)
+}
+
+// reverseOrder moves the order to status and claws back what it earned,
+// less what earlier clawbacks of the order already took.
+func (db *Postgres) reverseOrder(ctx context.Context, cancellation models.OrderCancellation, status string) (*models.CancelledOrder, error) {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	// The referral rewards of an order are set once, so the referrer can be
+	// looked up before both users are locked in the order of their ids.
+	var referral models.Referral
+	err = tx.QueryRow(ctx, getOrderReferral, cancellation.UserID, cancellation.Number, tenant.ID(ctx)).
+		Scan(&referral.ReferrerID, &referral.ReferrerBonus, &referral.RefereeBonus)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	rows, err := tx.Query(ctx, lockUsersForUpdate, []int{cancellation.UserID, referral.ReferrerID}, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	locked, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return nil, err
+	}
+	if !slices.Contains(locked, cancellation.UserID) {
+		return nil, fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+
+	var accrual float64
+	err = tx.QueryRow(ctx, cancelOrder, status, cancellation.Number, cancellation.UserID, tenant.ID(ctx), cancellation.Status).Scan(&accrual)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, ErrOrderStatusChanged
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var bonuses, clawedBack float64
+	if err := tx.QueryRow(ctx, getOrderBonusSum, cancellation.Number, cancellation.UserID, tenant.ID(ctx)).Scan(&bonuses); err != nil {
+		return nil, err
+	}
+	if err := tx.QueryRow(ctx, getOrderClawbackSum, cancellation.Number, cancellation.UserID, tenant.ID(ctx)).Scan(&clawedBack); err != nil {
+		return nil, err
+	}
+	balance, err := queryUserBalance(ctx, tx, strconv.Itoa(cancellation.UserID))
+	if err != nil {
+		return nil, err
+	}
+	cancelled, err := settleClawback(cancellation, status, accrual+bonuses+referral.RefereeBonus-clawedBack, balance.Current)
+	if err != nil {
+		return nil, err
+	}
+	if err := insertClawback(ctx, tx, cancellation, cancellation.UserID, cancelled); err != nil {
+		return nil, err
+	}
+
+	// A purged referrer keeps nothing to take back from.
+	if referral.ReferrerBonus > 0 && slices.Contains(locked, referral.ReferrerID) {
+		var clawedBack float64
+		if err := tx.QueryRow(ctx, getOrderClawbackSum, cancellation.Number, referral.ReferrerID, tenant.ID(ctx)).Scan(&clawedBack); err != nil {
+			return nil, err
+		}
+		balance, err := queryUserBalance(ctx, tx, strconv.Itoa(referral.ReferrerID))
+		if err != nil {
+			return nil, err
+		}
+		reversed, _ := settleClawback(unrefusable(cancellation), status, referral.ReferrerBonus-clawedBack, balance.Current)
+		if err := insertClawback(ctx, tx, cancellation, referral.ReferrerID, reversed); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec(ctx, createOrderStatusHistory, cancellation.Number, status, nil, nil, tenant.ID(ctx)); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return cancelled, nil
+}
+
+// insertClawback records what settled took back from the user, if anything.
+func insertClawback(ctx context.Context, tx pgx.Tx, cancellation models.OrderCancellation, userID int, settled *models.CancelledOrder) error {
+	if settled.Clawback <= 0 && settled.WrittenOff <= 0 {
+		return nil
+	}
+	return tx.QueryRow(ctx, createClawback,
+		userID, cancellation.Number, settled.Clawback, settled.WrittenOff, cancellation.CancelledBy, cancellation.Reason, tenant.ID(ctx),
+	).Scan(&settled.CancelledAt)
+}
+
+func (db *Postgres) GetClawbacksByUserID(ctx context.Context, userID int) ([]models.Clawback, error) {
+	rows, err := db.DB.Query(ctx, getClawbacksByUserID, userID, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Clawback, error) {
+		clawback := models.Clawback{TenantID: tenant.ID(ctx)}
+		err := row.Scan(&clawback.ClawbackID, &clawback.UserID, &clawback.OrderNumber, &clawback.Amount, &clawback.WrittenOff, &clawback.CancelledBy, &clawback.Reason, &clawback.CreatedAt)
+		return clawback, err
+	})
+}
+
+func (m *Memory) CancelOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error) {
+	return m.reverseOrder(ctx, cancellation, statusCancelled)
+}
+
+func (m *Memory) InvalidateOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error) {
+	return m.reverseOrder(ctx, unrefusable(cancellation), statusInvalid)
+}
+
+func (m *Memory) reverseOrder(ctx context.Context, cancellation models.OrderCancellation, status string) (*models.CancelledOrder, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findUser(tenantID, strconv.Itoa(cancellation.UserID)); err != nil {
+		return nil, err
+	}
+	order := m.findOrder(tenantID, cancellation.Number)
+	if order == nil || order.UserID != cancellation.UserID || order.Status != cancellation.Status {
+		return nil, ErrOrderStatusChanged
+	}
+
+	due := float64(order.Accrual)
+	for _, bonus := range m.bonuses {
+		if bonus.TenantID == tenantID && bonus.UserID == cancellation.UserID && bonus.OrderNumber == cancellation.Number {
+			due += bonus.Amount
+		}
+	}
+	referral := m.findOrderReferral(tenantID, cancellation.UserID, cancellation.Number)
+	if referral != nil {
+		due += referral.RefereeBonus
+	}
+	due -= m.orderClawbackSum(tenantID, cancellation.UserID, cancellation.Number)
+
+	order.Status = status
+	cancelled, err := settleClawback(cancellation, status, due, m.balance(tenantID, cancellation.UserID).Current)
+	if err != nil {
+		order.Status = cancellation.Status
+		return nil, err
+	}
+	m.appendClawback(tenantID, cancellation, cancellation.UserID, cancelled)
+
+	if referral != nil && referral.ReferrerBonus > 0 {
+		if _, err := m.findUser(tenantID, strconv.Itoa(referral.ReferrerID)); err == nil {
+			due := referral.ReferrerBonus - m.orderClawbackSum(tenantID, referral.ReferrerID, cancellation.Number)
+			reversed, _ := settleClawback(unrefusable(cancellation), status, due, m.balance(tenantID, referral.ReferrerID).Current)
+			m.appendClawback(tenantID, cancellation, referral.ReferrerID, reversed)
+		}
+	}
+	m.appendHistory(tenantID, cancellation.Number, status, nil, nil)
+	return cancelled, nil
+}
+
+// findOrderReferral returns the rewarded referral of the referee that was
+// rewarded for the order, nil when there is none.
+func (m *Memory) findOrderReferral(tenantID string, refereeID int, orderNumber string) *models.Referral {
+	for _, referral := range m.referrals {
+		if referral.TenantID == tenantID && referral.RefereeID == refereeID && referral.OrderNumber == orderNumber && referral.RewardedAt != nil {
+			return referral
+		}
+	}
+	return nil
+}
+
+// orderClawbackSum returns what the clawbacks of the order took from the
+// user, written off parts included.
+func (m *Memory) orderClawbackSum(tenantID string, userID int, orderNumber string) float64 {
+	var sum float64
+	for _, clawback := range m.clawbacks {
+		if clawback.TenantID == tenantID && clawback.UserID == userID && clawback.OrderNumber == orderNumber {
+			sum += clawback.Amount + clawback.WrittenOff
+		}
+	}
+	return sum
+}
+
+func (m *Memory) appendClawback(tenantID string, cancellation models.OrderCancellation, userID int, settled *models.CancelledOrder) {
+	if settled.Clawback <= 0 && settled.WrittenOff <= 0 {
+		return
+	}
+	m.nextClawbackID++
+	m.clawbacks = append(m.clawbacks, &models.Clawback{
+		ClawbackID:  m.nextClawbackID,
+		UserID:      userID,
+		OrderNumber: cancellation.Number,
+		Amount:      settled.Clawback,
+		WrittenOff:  settled.WrittenOff,
+		CancelledBy: cancellation.CancelledBy,
+		Reason:      cancellation.Reason,
+		CreatedAt:   settled.CancelledAt,
+		TenantID:    tenantID,
+	})
+}
+
+func (m *Memory) GetClawbacksByUserID(ctx context.Context, userID int) ([]models.Clawback, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	clawbacks := []models.Clawback{}
+	for i := len(m.clawbacks) - 1; i >= 0; i-- {
+		clawback := m.clawbacks[i]
+		if clawback.TenantID == tenantID && clawback.UserID == userID {
+			clawbacks = append(clawbacks, *clawback)
+		}
+	}
+	return clawbacks, nil
+}
+
+// unrefusable is the cancellation for the clawbacks that cannot refuse it:
+// those of the referrer rewarded for someone else's order and those of an
+// order the accrual system invalidated. The reject policy caps them instead.
+func unrefusable(cancellation models.OrderCancellation) models.OrderCancellation {
+	if cancellation.Policy == models.ClawbackReject {
+		cancellation.Policy = models.ClawbackCap
+	}
+	return cancellation
+}
+
+// settleClawback takes due back from balance, the balance with the accrual
+// of the order moved to status, following the negative balance policy of the
+// cancellation.
+func settleClawback(cancellation models.OrderCancellation, status string, due, balance float64) (*models.CancelledOrder, error) {
+	due = max(due, 0)
+	cancelled := &models.CancelledOrder{
+		Number:         cancellation.Number,
+		Status:         status,
+		PreviousStatus: cancellation.Status,
+		Clawback:       due,
+		CancelledBy:    cancellation.CancelledBy,
+		Reason:         cancellation.Reason,
+		CancelledAt:    time.Now(),
+	}
+	if due <= 0 || balance >= due {
+		return cancelled, nil
+	}
+
+	switch cancellation.Policy {
+	case models.ClawbackReject:
+		return nil, ErrInsufficientFunds
+	case models.ClawbackCap:
+		cancelled.Clawback = max(balance, 0)
+		cancelled.WrittenOff = due - cancelled.Clawback
+	}
+	return cancelled, nil
+}
@@ -4,3 +4,14 @@ import "errors"
 
 var ErrUserIsExist = errors.New("user is exist")
 var ErrInvalidData = errors.New("invalid data")
+var ErrOrderIsExist = errors.New("order is exist")
+var ErrInsufficientFunds = errors.New("insufficient funds")
+var ErrRecipientNotFound = errors.New("recipient not found")
+var ErrSelfTransfer = errors.New("cannot transfer to oneself")
+var ErrTransferLimitExceeded = errors.New("daily transfer limit exceeded")
+var ErrBonusIsExist = errors.New("bonus is exist")
+var ErrBonusLimitReached = errors.New("bonus limit reached")
+var ErrReferralCodeIsExist = errors.New("referral code is exist")
+var ErrReferralIsExist = errors.New("referral is exist")
+var ErrSelfReferral = errors.New("cannot refer oneself")
+var ErrOrderStatusChanged = errors.New("order status changed")
@@ -0,0 +1,530 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type memoryUser struct {
+	tenantID     string
+	userID       int
+	login        string
+	passwordHash []byte
+	email        string
+	displayName  string
+	createdAt    time.Time
+	deletedAt    *time.Time
+}
+
+func (u *memoryUser) model() *models.User {
+	user := &models.User{
+		UserID:      u.userID,
+		Login:       u.login,
+		Email:       u.email,
+		DisplayName: u.displayName,
+		CreatedAt:   u.createdAt,
+	}
+	if u.deletedAt != nil {
+		deletedAt := *u.deletedAt
+		user.DeletedAt = &deletedAt
+	}
+	return user
+}
+
+// memoryKey identifies a login, an order number or a user id within a tenant.
+type memoryKey struct {
+	tenantID string
+	name     string
+}
+
+type Memory struct {
+	mu sync.RWMutex
+
+	users       map[memoryKey]*memoryUser
+	orders      []*models.Orders
+	history     map[memoryKey][]models.OrderStatusHistory
+	withdrawals []*models.WithdrawBalance
+	transfers   []*models.Transfer
+	campaigns   []*models.Campaign
+	bonuses     []*models.Bonus
+	clawbacks   []*models.Clawback
+	auditEvents []models.AuditEvent
+
+	referralCodes []*models.ReferralCode
+	referrals     []*models.Referral
+
+	tiers       map[memoryKey]*models.UserTier
+	tierHistory map[memoryKey][]models.TierChange
+
+	nextUserID       int
+	nextOrderID      int
+	nextHistoryID    int
+	nextWithdrawalID int
+	nextTransferID   int
+	nextCampaignID   int
+	nextBonusID      int
+	nextReferralID   int
+	nextClawbackID   int
+	nextAuditEventID int64
+}
+
+var _ Storager = (*Memory)(nil)
+
+func NewMemory() *Memory {
+	return &Memory{
+		users:   make(map[memoryKey]*memoryUser),
+		history: make(map[memoryKey][]models.OrderStatusHistory),
+
+		tiers:       make(map[memoryKey]*models.UserTier),
+		tierHistory: make(map[memoryKey][]models.TierChange),
+	}
+}
+
+func (m *Memory) Close() {}
+
+func (m *Memory) CreateUser(ctx context.Context, user models.UserCreditials) (int, error) {
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return 0, fmt.Errorf("cannot hashing password: %v", err)
+	}
+
+	key := memoryKey{tenantID: tenant.ID(ctx), name: user.Login}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.users[key]; ok {
+		return 0, ErrUserIsExist
+	}
+
+	m.nextUserID++
+	m.users[key] = &memoryUser{
+		tenantID:     key.tenantID,
+		userID:       m.nextUserID,
+		login:        user.Login,
+		passwordHash: passwordHash,
+		createdAt:    time.Now(),
+	}
+	return m.nextUserID, nil
+}
+
+func (m *Memory) GetUserByLogin(ctx context.Context, user models.UserCreditials) (int, error) {
+	m.mu.RLock()
+	u, ok := m.users[memoryKey{tenantID: tenant.ID(ctx), name: user.Login}]
+	m.mu.RUnlock()
+	if !ok {
+		return 0, fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+
+	if err := bcrypt.CompareHashAndPassword(u.passwordHash, []byte(user.Password)); err != nil {
+		return 0, ErrInvalidData
+	}
+	return u.userID, nil
+}
+
+func (m *Memory) CreateNewOrder(ctx context.Context, order *models.Orders) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	if m.findOrder(tenantID, order.Number) != nil {
+		return ErrOrderIsExist
+	}
+	if _, err := m.findUser(tenantID, strconv.Itoa(order.UserID)); err != nil {
+		return err
+	}
+
+	m.nextOrderID++
+	newOrder := &models.Orders{
+		OrderID:    m.nextOrderID,
+		Number:     order.Number,
+		Status:     order.Status,
+		Accrual:    order.Accrual,
+		UploadedAt: time.Now(),
+		UserID:     order.UserID,
+		TenantID:   tenantID,
+	}
+	m.orders = append(m.orders, newOrder)
+	m.appendHistory(tenantID, newOrder.Number, newOrder.Status, nil, nil)
+	return nil
+}
+
+func (m *Memory) GetOrderByNumber(ctx context.Context, orderNumber string) (*models.Orders, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	order := m.findOrder(tenant.ID(ctx), orderNumber)
+	if order == nil {
+		return nil, sql.ErrNoRows
+	}
+	result := *order
+	return &result, nil
+}
+
+func (m *Memory) GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	orders := []models.Orders{}
+	for i := len(m.orders) - 1; i >= 0; i-- {
+		if m.orders[i].TenantID == tenantID && m.orders[i].UserID == id {
+			orders = append(orders, *m.orders[i])
+		}
+	}
+	return orders, nil
+}
+
+func (m *Memory) GetOrderStatusHistory(ctx context.Context, orderNumber string) ([]models.OrderStatusHistory, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	key := memoryKey{tenantID: tenant.ID(ctx), name: orderNumber}
+	history := make([]models.OrderStatusHistory, len(m.history[key]))
+	copy(history, m.history[key])
+	return history, nil
+}
+
+func (m *Memory) GetPendingOrders(ctx context.Context) ([]models.Orders, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenantID := tenant.ID(ctx)
+	orders := []models.Orders{}
+	for _, order := range m.orders {
+		if order.TenantID == tenantID && (order.Status == "NEW" || order.Status == "PROCESSING") {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+func (m *Memory) GetSettledOrders(ctx context.Context, since time.Time) ([]models.Orders, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	tenantID := tenant.ID(ctx)
+	orders := []models.Orders{}
+	for i := len(m.orders) - 1; i >= 0; i-- {
+		order := m.orders[i]
+		if order.TenantID == tenantID && (order.Status == statusProcessed || order.Status == statusInvalid) && !order.UploadedAt.Before(since) {
+			orders = append(orders, *order)
+		}
+	}
+	return orders, nil
+}
+
+func (m *Memory) UpdateOrderStatus(ctx context.Context, orderNumber, status string, accrual *float32, rawResponse json.RawMessage) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	order := m.findOrder(tenantID, orderNumber)
+	if order == nil || order.Status == statusCancelled {
+		return ErrOrderStatusChanged
+	}
+
+	var newAccrual float32
+	if accrual != nil {
+		newAccrual = *accrual
+	}
+	if order.Status == status && order.Accrual == newAccrual {
+		return ErrOrderStatusChanged
+	}
+
+	order.Status = status
+	order.Accrual = newAccrual
+	m.appendHistory(tenantID, orderNumber, status, accrual, rawResponse)
+	return nil
+}
+
+func (m *Memory) GetUserBalance(ctx context.Context, userID string) (*models.Balance, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.balance(tenant.ID(ctx), id), nil
+}
+
+func (m *Memory) CreateWithdrawal(ctx context.Context, withdrawal *models.WithdrawBalance) error {
+	id, err := strconv.Atoi(withdrawal.UserID)
+	if err != nil {
+		return err
+	}
+
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findUser(tenantID, withdrawal.UserID); err != nil {
+		return err
+	}
+	if m.balance(tenantID, id).Current < float64(withdrawal.Amount) {
+		return ErrInsufficientFunds
+	}
+
+	m.nextWithdrawalID++
+	m.withdrawals = append(m.withdrawals, &models.WithdrawBalance{
+		WithdrawalID: m.nextWithdrawalID,
+		UserID:       withdrawal.UserID,
+		OrderNumber:  withdrawal.OrderNumber,
+		Amount:       withdrawal.Amount,
+		ProcessedAt:  time.Now(),
+		TenantID:     tenantID,
+	})
+	return nil
+}
+
+func (m *Memory) GetWithdrawalByUserID(ctx context.Context, userID string) ([]models.WithdrawBalance, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	withdrawals := []models.WithdrawBalance{}
+	for i := len(m.withdrawals) - 1; i >= 0; i-- {
+		if m.withdrawals[i].TenantID == tenantID && m.withdrawals[i].UserID == userID {
+			withdrawals = append(withdrawals, *m.withdrawals[i])
+		}
+	}
+	return withdrawals, nil
+}
+
+func (m *Memory) findOrder(tenantID, orderNumber string) *models.Orders {
+	for _, order := range m.orders {
+		if order.TenantID == tenantID && order.Number == orderNumber {
+			return order
+		}
+	}
+	return nil
+}
+
+func (m *Memory) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	u, err := m.findUser(tenant.ID(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	return u.model(), nil
+}
+
+func (m *Memory) UpdateUserProfile(ctx context.Context, userID string, update models.UserProfileUpdate) (*models.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, err := m.findUser(tenant.ID(ctx), userID)
+	if err != nil {
+		return nil, err
+	}
+	if update.Email != nil {
+		u.email = *update.Email
+	}
+	if update.DisplayName != nil {
+		u.displayName = *update.DisplayName
+	}
+	return u.model(), nil
+}
+
+func (m *Memory) DeleteUser(ctx context.Context, userID string, at time.Time) (time.Time, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, err := m.findUser(tenant.ID(ctx), userID)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if u.deletedAt == nil {
+		u.deletedAt = &at
+	}
+	return *u.deletedAt, nil
+}
+
+func (m *Memory) RestoreUser(ctx context.Context, userID string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	u, err := m.findUser(tenant.ID(ctx), userID)
+	if err != nil {
+		return false, err
+	}
+	restored := u.deletedAt != nil
+	u.deletedAt = nil
+	return restored, nil
+}
+
+func (m *Memory) PurgeDeletedUsers(ctx context.Context, before time.Time) ([]int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tenantID := tenant.ID(ctx)
+	purged := []int{}
+	for key, u := range m.users {
+		if key.tenantID != tenantID || u.deletedAt == nil || u.deletedAt.After(before) {
+			continue
+		}
+		delete(m.users, key)
+		purged = append(purged, u.userID)
+
+		orders := m.orders[:0]
+		for _, order := range m.orders {
+			if order.UserID == u.userID {
+				delete(m.history, memoryKey{tenantID: order.TenantID, name: order.Number})
+				continue
+			}
+			orders = append(orders, order)
+		}
+		m.orders = orders
+
+		withdrawals := m.withdrawals[:0]
+		for _, withdrawal := range m.withdrawals {
+			if withdrawal.UserID != strconv.Itoa(u.userID) {
+				withdrawals = append(withdrawals, withdrawal)
+			}
+		}
+		m.withdrawals = withdrawals
+
+		bonuses := m.bonuses[:0]
+		for _, bonus := range m.bonuses {
+			if bonus.TenantID != tenantID || bonus.UserID != u.userID {
+				bonuses = append(bonuses, bonus)
+			}
+		}
+		m.bonuses = bonuses
+
+		clawbacks := m.clawbacks[:0]
+		for _, clawback := range m.clawbacks {
+			if clawback.TenantID != tenantID || clawback.UserID != u.userID {
+				clawbacks = append(clawbacks, clawback)
+			}
+		}
+		m.clawbacks = clawbacks
+
+		codes := m.referralCodes[:0]
+		for _, code := range m.referralCodes {
+			if code.TenantID != tenantID || code.UserID != u.userID {
+				codes = append(codes, code)
+			}
+		}
+		m.referralCodes = codes
+
+		delete(m.tiers, memoryKey{tenantID: tenantID, name: strconv.Itoa(u.userID)})
+		delete(m.tierHistory, memoryKey{tenantID: tenantID, name: strconv.Itoa(u.userID)})
+	}
+	return purged, nil
+}
+
+func (m *Memory) findUser(tenantID, userID string) (*memoryUser, error) {
+	id, err := strconv.Atoi(userID)
+	if err != nil {
+		return nil, err
+	}
+	for _, u := range m.users {
+		if u.tenantID == tenantID && u.userID == id {
+			return u, nil
+		}
+	}
+	return nil, fmt.Errorf("user not found: %w", sql.ErrNoRows)
+}
+
+func (m *Memory) appendHistory(tenantID, orderNumber, status string, accrual *float32, rawResponse json.RawMessage) {
+	m.nextHistoryID++
+	entry := models.OrderStatusHistory{
+		HistoryID:   m.nextHistoryID,
+		OrderNumber: orderNumber,
+		Status:      status,
+		RawResponse: rawResponse,
+		ChangedAt:   time.Now(),
+		TenantID:    tenantID,
+	}
+	if accrual != nil {
+		value := *accrual
+		entry.Accrual = &value
+	}
+	key := memoryKey{tenantID: tenantID, name: orderNumber}
+	m.history[key] = append(m.history[key], entry)
+}
+
+// processedAt returns when the order was first processed, falling back to
+// its upload time like the Postgres queries do.
+func (m *Memory) processedAt(tenantID string, order *models.Orders) time.Time {
+	for _, entry := range m.history[memoryKey{tenantID: tenantID, name: order.Number}] {
+		if entry.Status == statusProcessed {
+			return entry.ChangedAt
+		}
+	}
+	return order.UploadedAt
+}
+
+func (m *Memory) balance(tenantID string, userID int) *models.Balance {
+	var accrued, bonuses, withdrawn, received, sent, clawedBack float64
+	for _, order := range m.orders {
+		if order.TenantID == tenantID && order.UserID == userID && (order.Status == statusProcessed || slices.Contains(reversedStatuses, order.Status)) {
+			accrued += float64(order.Accrual)
+		}
+	}
+	for _, bonus := range m.bonuses {
+		if bonus.TenantID == tenantID && bonus.UserID == userID {
+			bonuses += bonus.Amount
+		}
+	}
+	for _, referral := range m.referrals {
+		if referral.TenantID != tenantID {
+			continue
+		}
+		if amount, _, ok := referralReward(referral, userID); ok {
+			bonuses += amount
+		}
+	}
+	for _, withdrawal := range m.withdrawals {
+		if withdrawal.TenantID == tenantID && withdrawal.UserID == strconv.Itoa(userID) {
+			withdrawn += float64(withdrawal.Amount)
+		}
+	}
+	for _, transfer := range m.transfers {
+		if transfer.TenantID != tenantID {
+			continue
+		}
+		switch strconv.Itoa(userID) {
+		case transfer.RecipientID:
+			received += float64(transfer.Amount)
+		case transfer.SenderID:
+			sent += float64(transfer.Amount)
+		}
+	}
+	for _, clawback := range m.clawbacks {
+		if clawback.TenantID == tenantID && clawback.UserID == userID {
+			clawedBack += clawback.Amount
+		}
+	}
+	return &models.Balance{
+		Current:        accrued + bonuses - withdrawn + received - sent - clawedBack,
+		Withdrawn:      float32(withdrawn),
+		TransferredIn:  float32(received),
+		TransferredOut: float32(sent),
+		Bonus:          float32(bonuses),
+		ClawedBack:     float32(clawedBack),
+	}
+}
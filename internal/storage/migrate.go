@@ -0,0 +1,53 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/AndreyKuskov2/gophermart/migrations"
+	"github.com/golang-migrate/migrate/v4"
+	"github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/jackc/pgx/v5/stdlib"
+)
+
+func NewMigrator(dbURI string) (*migrate.Migrate, error) {
+	db, err := sql.Open("pgx", dbURI)
+	if err != nil {
+		return nil, fmt.Errorf("cannot open database: %v", err)
+	}
+
+	driver, err := postgres.WithInstance(db, &postgres.Config{})
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("cannot create migration driver: %v", err)
+	}
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		driver.Close()
+		return nil, fmt.Errorf("cannot open embedded migrations: %v", err)
+	}
+
+	m, err := migrate.NewWithInstance("iofs", source, "postgres", driver)
+	if err != nil {
+		source.Close()
+		driver.Close()
+		return nil, fmt.Errorf("cannot create migration instance: %v", err)
+	}
+	return m, nil
+}
+
+func MigrateUp(dbURI string) error {
+	m, err := NewMigrator(dbURI)
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return fmt.Errorf("cannot to apply migrations: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package storage_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/internal/integration"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/storage/storagetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPostgresConformance(t *testing.T) {
+	postgres, err := integration.StartPostgres()
+	if errors.Is(err, integration.ErrPostgresUnavailable) {
+		t.Skip(err.Error())
+	}
+	require.NoError(t, err)
+	t.Cleanup(postgres.Stop)
+
+	// Every subtest gets a database of its own: truncating would miss the
+	// tables added later and cannot clear the append-only audit log.
+	storagetest.RunConformance(t, func(t *testing.T) storage.Storager {
+		dsn, drop, err := postgres.CreateDatabase(context.Background())
+		require.NoError(t, err)
+		t.Cleanup(drop)
+		require.NoError(t, storage.MigrateUp(dsn))
+
+		db, err := storage.NewPostgres(dsn)
+		require.NoError(t, err)
+		t.Cleanup(db.Close)
+		return db
+	})
+}
@@ -1,23 +1,160 @@
 package storage
 
+// Every query that reads or changes tenant data is scoped by the tenant of
+// the context, see tenant.ID.
 const (
 	// register and login
-	createNewUser          = "INSERT INTO users(login, password) VALUES ($1, $2) RETURNING user_id;"
-	checkUserIsExists      = "SELECT user_id FROM users WHERE login = $1;"
-	getUserPasswordByLogin = "SELECT user_id, password FROM users WHERE login = $1;"
+	createNewUser          = "INSERT INTO users(login, password, tenant_id) VALUES ($1, $2, $3) RETURNING user_id;"
+	checkUserIsExists      = "SELECT user_id FROM users WHERE login = $1 AND tenant_id = $2;"
+	getUserPasswordByLogin = "SELECT user_id, password FROM users WHERE login = $1 AND tenant_id = $2;"
+	getUserByID            = "SELECT user_id, login, email, display_name, created_at, deleted_at FROM users WHERE user_id = $1 AND tenant_id = $2;"
+
+	// profile and account deletion
+	updateUserProfile = "UPDATE users SET email = COALESCE($2, email), display_name = COALESCE($3, display_name) WHERE user_id = $1 AND tenant_id = $4 RETURNING user_id, login, email, display_name, created_at, deleted_at;"
+	markUserDeleted   = "UPDATE users SET deleted_at = COALESCE(deleted_at, $2) WHERE user_id = $1 AND tenant_id = $3 RETURNING deleted_at;"
+	restoreUser       = "UPDATE users SET deleted_at = NULL WHERE user_id = $1 AND tenant_id = $2 AND deleted_at IS NOT NULL;"
+	purgeDeletedUsers = "DELETE FROM users WHERE deleted_at <= $1 AND tenant_id = $2 RETURNING user_id;"
 
 	//
-	createOrder       = "INSERT INTO orders(number, status, accrual, user_id) VALUES ($1, $2, $3, $4);"
-	getOrderByNumber  = "SELECT * FROM orders WHERE number = $1;"
-	getOrdersByUserID = "SELECT * FROM orders WHERE user_id = $1;"
+	createOrder       = "INSERT INTO orders(number, status, accrual, user_id, tenant_id) VALUES ($1, $2, $3, $4, $5);"
+	getOrderByNumber  = "SELECT * FROM orders WHERE number = $1 AND tenant_id = $2;"
+	getOrdersByUserID = "SELECT * FROM orders WHERE user_id = $1 AND tenant_id = $2 ORDER BY uploaded_at DESC, order_id DESC;"
 	getUserBalance    = `SELECT
-	  COALESCE(accrual_sum, 0) - COALESCE(withdrawn_sum, 0) AS current,
-	  COALESCE(withdrawn_sum, 0) AS withdrawn
+	  COALESCE(accrual_sum, 0) + COALESCE(bonus_sum, 0) + COALESCE(referral_sum, 0) - COALESCE(withdrawn_sum, 0) + COALESCE(received_sum, 0) - COALESCE(sent_sum, 0) - COALESCE(clawback_sum, 0) AS current,
+	  COALESCE(withdrawn_sum, 0) AS withdrawn,
+	  COALESCE(received_sum, 0) AS transferred_in,
+	  COALESCE(sent_sum, 0) AS transferred_out,
+	  COALESCE(bonus_sum, 0) + COALESCE(referral_sum, 0) AS bonus,
+	  COALESCE(clawback_sum, 0) AS clawed_back
 	FROM
-	  (SELECT SUM(accrual) AS accrual_sum FROM orders WHERE user_id = $1 AND status = $2) o,
-	  (SELECT SUM(amount) AS withdrawn_sum FROM withdrawals WHERE user_id = $1) w`
-	createWithdraw        = "INSERT INTO withdrawals(user_id, order_number, amount) VALUES ($1, $2, $3);"
-	getWithdrawalByUserID = "SELECT * FROM withdrawals WHERE user_id = $1;"
-	getPendingOrders      = "SELECT * FROM orders WHERE status IN ($1, $2);"
-	updateOrderStatus     = "UPDATE orders SET status = $1, accrual = $2 WHERE number = $3;"
+	  (SELECT SUM(accrual) AS accrual_sum FROM orders WHERE user_id = $1 AND (status = $2 OR status = ANY($4)) AND tenant_id = $3) o,
+	  (SELECT SUM(amount) AS bonus_sum FROM bonuses WHERE user_id = $1 AND tenant_id = $3) b,
+	  (SELECT SUM(CASE WHEN referrer_id = $1 THEN referrer_bonus ELSE referee_bonus END) AS referral_sum FROM referrals
+	    WHERE (referrer_id = $1 OR referee_id = $1) AND rewarded_at IS NOT NULL AND tenant_id = $3) r,
+	  (SELECT SUM(amount) AS withdrawn_sum FROM withdrawals WHERE user_id = $1 AND tenant_id = $3) w,
+	  (SELECT SUM(amount) AS received_sum FROM transfers WHERE recipient_id = $1 AND tenant_id = $3) ti,
+	  (SELECT SUM(amount) AS sent_sum FROM transfers WHERE sender_id = $1 AND tenant_id = $3) tout,
+	  (SELECT SUM(amount) AS clawback_sum FROM clawbacks WHERE user_id = $1 AND tenant_id = $3) c`
+	lockUserForUpdate     = "SELECT user_id FROM users WHERE user_id = $1 AND tenant_id = $2 FOR UPDATE;"
+	createWithdraw        = "INSERT INTO withdrawals(user_id, order_number, amount, tenant_id) VALUES ($1, $2, $3, $4);"
+	getWithdrawalByUserID = "SELECT * FROM withdrawals WHERE user_id = $1 AND tenant_id = $2 ORDER BY processed_at DESC, withdrawal_id DESC;"
+	getPendingOrders      = "SELECT * FROM orders WHERE status IN ($1, $2) AND tenant_id = $3;"
+	getSettledOrders      = "SELECT * FROM orders WHERE status IN ($1, $2) AND uploaded_at::TIMESTAMPTZ >= $3 AND tenant_id = $4 ORDER BY uploaded_at DESC, order_id DESC;"
+	updateOrderStatus     = "UPDATE orders SET status = $1, accrual = COALESCE($2::FLOAT, 0) WHERE number = $3 AND tenant_id = $4 AND status <> $5 AND (status <> $1 OR accrual IS DISTINCT FROM COALESCE($2::FLOAT, 0));"
+
+	// transfers; both users are locked in the order of their ids so that
+	// transfers in opposite directions cannot deadlock
+	getTransferRecipientID = "SELECT user_id FROM users WHERE login = $1 AND tenant_id = $2 AND deleted_at IS NULL;"
+	lockUsersForUpdate     = "SELECT user_id FROM users WHERE user_id = ANY($1) AND tenant_id = $2 ORDER BY user_id FOR UPDATE;"
+	getSentTransfersSince  = "SELECT COUNT(*), COALESCE(SUM(amount), 0) FROM transfers WHERE sender_id = $1 AND tenant_id = $2 AND created_at >= $3;"
+	createTransfer         = "INSERT INTO transfers(sender_id, recipient_id, amount, memo, tenant_id) VALUES ($1, $2, $3, $4, $5) RETURNING transfer_id, created_at;"
+	getTransfersByUserID   = `SELECT t.transfer_id, t.sender_id::TEXT, t.recipient_id::TEXT,
+	  CASE WHEN t.sender_id = $1 THEN $3 ELSE $4 END,
+	  COALESCE(u.login, ''), t.amount, t.memo, t.created_at
+	FROM transfers t
+	  LEFT JOIN users u ON u.tenant_id = t.tenant_id AND u.user_id = CASE WHEN t.sender_id = $1 THEN t.recipient_id ELSE t.sender_id END
+	WHERE t.tenant_id = $2 AND (t.sender_id = $1 OR t.recipient_id = $1)
+	ORDER BY t.created_at DESC, t.transfer_id DESC;`
+
+	// statement; accruals are dated by the first transition to PROCESSED, the
+	// accruals of reversed orders are offset by their clawbacks and
+	// timestamps are converted using the session time zone they were written in
+	statementMovements = `WITH movements AS (
+	  SELECT $2::TEXT AS type, o.number, ''::TEXT AS counterparty, o.accrual AS amount,
+	    COALESCE((SELECT MIN(h.changed_at) FROM order_status_history h WHERE h.tenant_id = o.tenant_id AND h.order_number = o.number AND h.status = $3), o.uploaded_at)::TIMESTAMPTZ AS at,
+	    o.order_id AS id
+	  FROM orders o WHERE o.user_id = $1 AND (o.status = $3 OR (o.status = ANY($10) AND o.accrual > 0)) AND o.tenant_id = $5
+	  UNION ALL
+	  SELECT $4::TEXT, order_number, '', -amount, processed_at::TIMESTAMPTZ, withdrawal_id FROM withdrawals WHERE user_id = $1 AND tenant_id = $5
+	  UNION ALL
+	  SELECT $6::TEXT, '', COALESCE(u.login, ''), t.amount, t.created_at, t.transfer_id
+	  FROM transfers t LEFT JOIN users u ON u.tenant_id = t.tenant_id AND u.user_id = t.sender_id
+	  WHERE t.recipient_id = $1 AND t.tenant_id = $5
+	  UNION ALL
+	  SELECT $7::TEXT, '', COALESCE(u.login, ''), -t.amount, t.created_at, t.transfer_id
+	  FROM transfers t LEFT JOIN users u ON u.tenant_id = t.tenant_id AND u.user_id = t.recipient_id
+	  WHERE t.sender_id = $1 AND t.tenant_id = $5
+	  UNION ALL
+	  SELECT $8::TEXT, order_number, '', amount, created_at, bonus_id FROM bonuses WHERE user_id = $1 AND tenant_id = $5
+	  UNION ALL
+	  SELECT $9::TEXT, '', COALESCE(u.login, ''), r.amount, r.rewarded_at, r.referral_id
+	  FROM (SELECT *, CASE WHEN referrer_id = $1 THEN referrer_bonus ELSE referee_bonus END AS amount,
+	      CASE WHEN referrer_id = $1 THEN referee_id ELSE referrer_id END AS counterparty_id
+	    FROM referrals WHERE (referrer_id = $1 OR referee_id = $1) AND rewarded_at IS NOT NULL AND tenant_id = $5) r
+	    LEFT JOIN users u ON u.tenant_id = r.tenant_id AND u.user_id = r.counterparty_id
+	  WHERE r.amount > 0
+	  UNION ALL
+	  SELECT $11::TEXT, order_number, '', -amount, created_at, clawback_id FROM clawbacks WHERE user_id = $1 AND tenant_id = $5 AND amount > 0
+	)`
+	getBalanceAt          = statementMovements + " SELECT COALESCE(SUM(amount), 0) FROM movements WHERE at < $12;"
+	getStatementMovements = statementMovements + " SELECT type, number, counterparty, amount, at FROM movements WHERE at >= $12 AND at < $13 ORDER BY at, type, id;"
+
+	// campaigns and bonuses; bonuses are granted under the lock of the user
+	// so that concurrent grants cannot exceed the limits of a campaign
+	createCampaign     = "INSERT INTO campaigns(name, rule, monthly_cap, starts_at, ends_at, enabled, tenant_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING campaign_id, created_at;"
+	getCampaigns       = "SELECT campaign_id, name, rule, monthly_cap, starts_at, ends_at, enabled, created_at FROM campaigns WHERE tenant_id = $1 ORDER BY campaign_id;"
+	getCampaign        = "SELECT campaign_id, name, rule, monthly_cap, starts_at, ends_at, enabled, created_at FROM campaigns WHERE campaign_id = $1 AND tenant_id = $2;"
+	updateCampaign     = "UPDATE campaigns SET name = $2, rule = $3, monthly_cap = $4, starts_at = $5, ends_at = $6, enabled = $7 WHERE campaign_id = $1 AND tenant_id = $8 RETURNING created_at;"
+	deleteCampaign     = "DELETE FROM campaigns WHERE campaign_id = $1 AND tenant_id = $2;"
+	checkBonusIsExists = "SELECT EXISTS (SELECT 1 FROM bonuses WHERE order_number = $1 AND campaign_id = $2 AND tenant_id = $3);"
+	getGrantedBonuses  = "SELECT COUNT(*), COALESCE(SUM(amount) FILTER (WHERE created_at >= $4), 0) FROM bonuses WHERE user_id = $1 AND campaign_id = $2 AND tenant_id = $3;"
+	createBonus        = "INSERT INTO bonuses(user_id, order_number, campaign_id, amount, tenant_id) VALUES ($1, $2, $3, $4, $5) RETURNING bonus_id, created_at;"
+	getBonusesByUserID = "SELECT bonus_id, user_id, order_number, COALESCE(campaign_id, 0), tier, amount, created_at FROM bonuses WHERE user_id = $1 AND tenant_id = $2 ORDER BY created_at DESC, bonus_id DESC;"
+	getProcessedOrders = "SELECT * FROM orders WHERE status = $1 AND uploaded_at::TIMESTAMPTZ < $2 AND tenant_id = $3 ORDER BY uploaded_at, order_id;"
+
+	// referrals; a referral is rewarded by the update that moves it out of
+	// pending, so concurrent updates reward it at most once
+	ensureReferralCode = `WITH created AS (
+	  INSERT INTO referral_codes(user_id, code, ip, tenant_id) VALUES ($1, $2, $3, $4) ON CONFLICT (tenant_id, user_id) DO NOTHING RETURNING code, ip, created_at
+	) SELECT code, ip, created_at FROM created
+	UNION ALL SELECT code, ip, created_at FROM referral_codes WHERE user_id = $1 AND tenant_id = $4 LIMIT 1;`
+	getReferralCode = `SELECT c.user_id, c.code, c.ip, c.created_at FROM referral_codes c
+	  JOIN users u ON u.tenant_id = c.tenant_id AND u.user_id = c.user_id
+	WHERE c.code = $1 AND c.tenant_id = $2 AND u.deleted_at IS NULL;`
+	createReferral           = "INSERT INTO referrals(referrer_id, referee_id, status, reason, ip, tenant_id) VALUES ($1, $2, $3, $4, $5, $6) RETURNING referral_id, created_at;"
+	getReferralsByReferrerID = `SELECT r.referral_id, r.referrer_id, r.referee_id, COALESCE(u.login, ''), r.status, r.reason, r.ip, r.order_number,
+	  r.referrer_bonus, r.referee_bonus, r.created_at, r.rewarded_at
+	FROM referrals r LEFT JOIN users u ON u.tenant_id = r.tenant_id AND u.user_id = r.referee_id
+	WHERE r.referrer_id = $1 AND r.tenant_id = $2
+	ORDER BY r.created_at DESC, r.referral_id DESC;`
+	rewardReferral = `UPDATE referrals SET status = $3, order_number = $4, referrer_bonus = $5, referee_bonus = $6, rewarded_at = NOW()
+	WHERE referee_id = $1 AND tenant_id = $2 AND status = $7
+	RETURNING referral_id, referrer_id, status, reason, ip, created_at, rewarded_at;`
+
+	// loyalty tiers; tiers are set under the lock of the user so that the
+	// history records every change exactly once
+	getAccruedSince = `SELECT u.user_id, COALESCE(SUM(o.accrual), 0) FROM users u
+	  LEFT JOIN orders o ON o.tenant_id = u.tenant_id AND o.user_id = u.user_id AND o.status = $1
+	    AND COALESCE((SELECT MIN(h.changed_at) FROM order_status_history h
+	      WHERE h.tenant_id = o.tenant_id AND h.order_number = o.number AND h.status = $1), o.uploaded_at)::TIMESTAMPTZ >= $2
+	WHERE u.tenant_id = $3 AND u.deleted_at IS NULL
+	GROUP BY u.user_id ORDER BY u.user_id;`
+	getUserTier     = "SELECT tier, accrued, updated_at FROM user_tiers WHERE user_id = $1 AND tenant_id = $2;"
+	getUserTierName = "SELECT tier FROM user_tiers WHERE user_id = $1 AND tenant_id = $2;"
+	upsertUserTier  = `INSERT INTO user_tiers(user_id, tier, accrued, tenant_id) VALUES ($1, $2, $3, $4)
+	ON CONFLICT (tenant_id, user_id) DO UPDATE SET tier = EXCLUDED.tier, accrued = EXCLUDED.accrued, updated_at = NOW()
+	RETURNING updated_at;`
+	createTierHistory = "INSERT INTO tier_history(user_id, from_tier, to_tier, accrued, tenant_id) VALUES ($1, $2, $3, $4, $5) RETURNING changed_at;"
+	getTierHistory    = "SELECT from_tier, to_tier, accrued, changed_at FROM tier_history WHERE user_id = $1 AND tenant_id = $2 ORDER BY changed_at DESC, history_id DESC;"
+	createTierBonus   = "INSERT INTO bonuses(user_id, order_number, tier, amount, tenant_id) VALUES ($1, $2, $3, $4, $5) RETURNING bonus_id, created_at;"
+
+	// order cancellation; the order changes its status under the lock of its
+	// user, so the clawback is settled against a balance nothing else moves
+	cancelOrder          = "UPDATE orders SET status = $1 WHERE number = $2 AND user_id = $3 AND tenant_id = $4 AND status = $5 RETURNING COALESCE(accrual, 0);"
+	getOrderBonusSum     = "SELECT COALESCE(SUM(amount), 0) FROM bonuses WHERE order_number = $1 AND user_id = $2 AND tenant_id = $3;"
+	getOrderClawbackSum  = "SELECT COALESCE(SUM(amount + written_off), 0) FROM clawbacks WHERE order_number = $1 AND user_id = $2 AND tenant_id = $3;"
+	getOrderReferral     = "SELECT referrer_id, referrer_bonus, referee_bonus FROM referrals WHERE referee_id = $1 AND order_number = $2 AND tenant_id = $3 AND rewarded_at IS NOT NULL;"
+	createClawback       = "INSERT INTO clawbacks(user_id, order_number, amount, written_off, cancelled_by, reason, tenant_id) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING created_at;"
+	getClawbacksByUserID = "SELECT clawback_id, user_id, order_number, amount, written_off, cancelled_by, reason, created_at FROM clawbacks WHERE user_id = $1 AND tenant_id = $2 ORDER BY created_at DESC, clawback_id DESC;"
+
+	// order status history
+	createOrderStatusHistory = "INSERT INTO order_status_history(order_number, status, accrual, raw_response, tenant_id) VALUES ($1, $2, $3, $4, $5);"
+	getOrderStatusHistory    = "SELECT * FROM order_status_history WHERE order_number = $1 AND tenant_id = $2 ORDER BY changed_at, history_id;"
+
+	// audit events
+	lockAuditChain      = "SELECT pg_advisory_xact_lock(hashtext('audit_events'));"
+	getLastAuditHash    = "SELECT hash FROM audit_events ORDER BY event_id DESC LIMIT 1;"
+	createAuditEvent    = "INSERT INTO audit_events(event_type, user_id, ip, user_agent, request_id, details, created_at, prev_hash, hash, tenant_id) VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10) RETURNING event_id;"
+	getAuditEvents      = "SELECT * FROM audit_events WHERE tenant_id = $6 AND ($1::INTEGER IS NULL OR user_id = $1) AND ($2 = '' OR event_type = $2) AND ($3::TIMESTAMPTZ IS NULL OR created_at >= $3) AND ($4::TIMESTAMPTZ IS NULL OR created_at < $4) ORDER BY event_id DESC LIMIT NULLIF($5, 0);"
+	getAuditEventsChain = "SELECT * FROM audit_events ORDER BY event_id;"
 )
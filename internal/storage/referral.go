@@ -0,0 +1,211 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *Postgres) EnsureReferralCode(ctx context.Context, code *models.ReferralCode) error {
+	code.TenantID = tenant.ID(ctx)
+	err := db.DB.QueryRow(ctx, ensureReferralCode, code.UserID, code.Code, code.IP, code.TenantID).Scan(&code.Code, &code.IP, &code.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrReferralCodeIsExist
+	}
+	return err
+}
+
+func (db *Postgres) GetReferralCode(ctx context.Context, code string) (*models.ReferralCode, error) {
+	referralCode := models.ReferralCode{TenantID: tenant.ID(ctx)}
+	err := db.DB.QueryRow(ctx, getReferralCode, code, tenant.ID(ctx)).Scan(&referralCode.UserID, &referralCode.Code, &referralCode.IP, &referralCode.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("referral code not found: %w", sql.ErrNoRows)
+		}
+		return nil, err
+	}
+	return &referralCode, nil
+}
+
+func (db *Postgres) CreateReferral(ctx context.Context, referral *models.Referral) error {
+	if referral.ReferrerID == referral.RefereeID {
+		return ErrSelfReferral
+	}
+	referral.TenantID = tenant.ID(ctx)
+	err := db.DB.QueryRow(ctx, createReferral, referral.ReferrerID, referral.RefereeID, referral.Status, referral.Reason, referral.IP, referral.TenantID).Scan(&referral.ReferralID, &referral.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrReferralIsExist
+	}
+	return err
+}
+
+func (db *Postgres) GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]models.Referral, error) {
+	rows, err := db.DB.Query(ctx, getReferralsByReferrerID, referrerID, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Referral, error) {
+		referral := models.Referral{TenantID: tenant.ID(ctx)}
+		err := row.Scan(&referral.ReferralID, &referral.ReferrerID, &referral.RefereeID, &referral.Referee, &referral.Status, &referral.Reason,
+			&referral.IP, &referral.OrderNumber, &referral.ReferrerBonus, &referral.RefereeBonus, &referral.CreatedAt, &referral.RewardedAt)
+		return referral, err
+	})
+}
+
+func (db *Postgres) RewardReferral(ctx context.Context, refereeID int, orderNumber string, reward models.ReferralReward) (*models.Referral, error) {
+	referral := models.Referral{
+		RefereeID:     refereeID,
+		OrderNumber:   orderNumber,
+		ReferrerBonus: reward.ReferrerBonus,
+		RefereeBonus:  reward.RefereeBonus,
+		TenantID:      tenant.ID(ctx),
+	}
+	err := db.DB.QueryRow(ctx, rewardReferral, refereeID, referral.TenantID, models.ReferralRewarded, orderNumber,
+		reward.ReferrerBonus, reward.RefereeBonus, models.ReferralPending,
+	).Scan(&referral.ReferralID, &referral.ReferrerID, &referral.Status, &referral.Reason, &referral.IP, &referral.CreatedAt, &referral.RewardedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("pending referral not found: %w", sql.ErrNoRows)
+		}
+		return nil, err
+	}
+	return &referral, nil
+}
+
+func (m *Memory) EnsureReferralCode(ctx context.Context, code *models.ReferralCode) error {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findUser(tenantID, strconv.Itoa(code.UserID)); err != nil {
+		return err
+	}
+	for _, c := range m.referralCodes {
+		if c.TenantID != tenantID {
+			continue
+		}
+		if c.UserID == code.UserID {
+			*code = *c
+			return nil
+		}
+		if c.Code == code.Code {
+			return ErrReferralCodeIsExist
+		}
+	}
+
+	code.CreatedAt = time.Now()
+	code.TenantID = tenantID
+	stored := *code
+	m.referralCodes = append(m.referralCodes, &stored)
+	return nil
+}
+
+func (m *Memory) GetReferralCode(ctx context.Context, code string) (*models.ReferralCode, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	for _, c := range m.referralCodes {
+		if c.TenantID != tenantID || c.Code != code {
+			continue
+		}
+		if u, err := m.findUser(tenantID, strconv.Itoa(c.UserID)); err != nil || u.deletedAt != nil {
+			break
+		}
+		referralCode := *c
+		return &referralCode, nil
+	}
+	return nil, fmt.Errorf("referral code not found: %w", sql.ErrNoRows)
+}
+
+func (m *Memory) CreateReferral(ctx context.Context, referral *models.Referral) error {
+	if referral.ReferrerID == referral.RefereeID {
+		return ErrSelfReferral
+	}
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.referrals {
+		if r.TenantID == tenantID && r.RefereeID == referral.RefereeID {
+			return ErrReferralIsExist
+		}
+	}
+
+	m.nextReferralID++
+	referral.ReferralID = m.nextReferralID
+	referral.CreatedAt = time.Now()
+	referral.TenantID = tenantID
+
+	stored := *referral
+	stored.Referee = ""
+	m.referrals = append(m.referrals, &stored)
+	return nil
+}
+
+func (m *Memory) GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]models.Referral, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	referrals := []models.Referral{}
+	for i := len(m.referrals) - 1; i >= 0; i-- {
+		referral := *m.referrals[i]
+		if referral.TenantID != tenantID || referral.ReferrerID != referrerID {
+			continue
+		}
+		if referee, err := m.findUser(tenantID, strconv.Itoa(referral.RefereeID)); err == nil {
+			referral.Referee = referee.login
+		}
+		referrals = append(referrals, referral)
+	}
+	return referrals, nil
+}
+
+func (m *Memory) RewardReferral(ctx context.Context, refereeID int, orderNumber string, reward models.ReferralReward) (*models.Referral, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, r := range m.referrals {
+		if r.TenantID != tenantID || r.RefereeID != refereeID || r.Status != models.ReferralPending {
+			continue
+		}
+		now := time.Now()
+		r.Status = models.ReferralRewarded
+		r.OrderNumber = orderNumber
+		r.ReferrerBonus, r.RefereeBonus = reward.ReferrerBonus, reward.RefereeBonus
+		r.RewardedAt = &now
+
+		referral := *r
+		return &referral, nil
+	}
+	return nil, fmt.Errorf("pending referral not found: %w", sql.ErrNoRows)
+}
+
+// referralReward returns what the rewarded referral r gave the user and the
+// id of the other party.
+func referralReward(r *models.Referral, userID int) (float64, int, bool) {
+	if r.RewardedAt == nil {
+		return 0, 0, false
+	}
+	switch userID {
+	case r.ReferrerID:
+		return r.ReferrerBonus, r.RefereeID, true
+	case r.RefereeID:
+		return r.RefereeBonus, r.ReferrerID, true
+	}
+	return 0, 0, false
+}
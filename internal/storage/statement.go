@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+)
+
+const (
+	statusProcessed = "PROCESSED"
+	statusInvalid   = "INVALID"
+	statusCancelled = models.OrderCancelled
+)
+
+// reversedStatuses are the statuses of orders whose accrual may have been
+// credited and then clawed back: cancelled orders and processed orders the
+// accrual system invalidated. Their accrual stays on the balance next to
+// the clawback.
+var reversedStatuses = []string{statusCancelled, statusInvalid}
+
+func (db *Postgres) GetBalanceAt(ctx context.Context, userID string, at time.Time) (float64, error) {
+	var balance float64
+	err := db.DB.QueryRow(ctx, getBalanceAt,
+		userID, models.StatementAccrual, statusProcessed, models.StatementWithdrawal, tenant.ID(ctx),
+		models.StatementTransferIn, models.StatementTransferOut, models.StatementBonus, models.StatementReferral,
+		reversedStatuses, models.StatementClawback, at,
+	).Scan(&balance)
+	return balance, err
+}
+
+func (db *Postgres) StreamStatementEntries(ctx context.Context, userID string, from, to time.Time, fn func(models.StatementEntry) error) error {
+	rows, err := db.DB.Query(ctx, getStatementMovements,
+		userID, models.StatementAccrual, statusProcessed, models.StatementWithdrawal, tenant.ID(ctx),
+		models.StatementTransferIn, models.StatementTransferOut, models.StatementBonus, models.StatementReferral,
+		reversedStatuses, models.StatementClawback, from, to,
+	)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var entry models.StatementEntry
+		if err := rows.Scan(&entry.Type, &entry.Order, &entry.Counterparty, &entry.Amount, &entry.At); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (m *Memory) GetBalanceAt(ctx context.Context, userID string, at time.Time) (float64, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var balance float64
+	for _, entry := range m.movements(tenant.ID(ctx), userID) {
+		if entry.At.Before(at) {
+			balance += entry.Amount
+		}
+	}
+	return balance, nil
+}
+
+func (m *Memory) StreamStatementEntries(ctx context.Context, userID string, from, to time.Time, fn func(models.StatementEntry) error) error {
+	m.mu.RLock()
+	movements := m.movements(tenant.ID(ctx), userID)
+	m.mu.RUnlock()
+
+	for _, entry := range movements {
+		if entry.At.Before(from) || !entry.At.Before(to) {
+			continue
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// movements returns the balance movements of the user ordered like the
+// Postgres statement query.
+func (m *Memory) movements(tenantID, userID string) []models.StatementEntry {
+	type movement struct {
+		entry models.StatementEntry
+		id    int
+	}
+
+	var movements []movement
+	for _, order := range m.orders {
+		if order.TenantID != tenantID || strconv.Itoa(order.UserID) != userID {
+			continue
+		}
+		if order.Status != statusProcessed && (!slices.Contains(reversedStatuses, order.Status) || order.Accrual <= 0) {
+			continue
+		}
+		movements = append(movements, movement{
+			entry: models.StatementEntry{Type: models.StatementAccrual, Order: order.Number, Amount: float64(order.Accrual), At: m.processedAt(tenantID, order)},
+			id:    order.OrderID,
+		})
+	}
+	for _, withdrawal := range m.withdrawals {
+		if withdrawal.TenantID != tenantID || withdrawal.UserID != userID {
+			continue
+		}
+		movements = append(movements, movement{
+			entry: models.StatementEntry{Type: models.StatementWithdrawal, Order: withdrawal.OrderNumber, Amount: -float64(withdrawal.Amount), At: withdrawal.ProcessedAt},
+			id:    withdrawal.WithdrawalID,
+		})
+	}
+	for _, transfer := range m.transfers {
+		if transfer.TenantID != tenantID {
+			continue
+		}
+		entry := models.StatementEntry{Amount: float64(transfer.Amount), At: transfer.CreatedAt}
+		counterpartyID := ""
+		switch userID {
+		case transfer.RecipientID:
+			entry.Type, counterpartyID = models.StatementTransferIn, transfer.SenderID
+		case transfer.SenderID:
+			entry.Type, counterpartyID = models.StatementTransferOut, transfer.RecipientID
+			entry.Amount = -entry.Amount
+		default:
+			continue
+		}
+		if counterparty, err := m.findUser(tenantID, counterpartyID); err == nil {
+			entry.Counterparty = counterparty.login
+		}
+		movements = append(movements, movement{entry: entry, id: transfer.TransferID})
+	}
+	for _, bonus := range m.bonuses {
+		if bonus.TenantID != tenantID || strconv.Itoa(bonus.UserID) != userID {
+			continue
+		}
+		movements = append(movements, movement{
+			entry: models.StatementEntry{Type: models.StatementBonus, Order: bonus.OrderNumber, Amount: bonus.Amount, At: bonus.CreatedAt},
+			id:    bonus.BonusID,
+		})
+	}
+	id, _ := strconv.Atoi(userID)
+	for _, referral := range m.referrals {
+		if referral.TenantID != tenantID {
+			continue
+		}
+		amount, counterpartyID, ok := referralReward(referral, id)
+		if !ok || amount <= 0 {
+			continue
+		}
+		entry := models.StatementEntry{Type: models.StatementReferral, Amount: amount, At: *referral.RewardedAt}
+		if counterparty, err := m.findUser(tenantID, strconv.Itoa(counterpartyID)); err == nil {
+			entry.Counterparty = counterparty.login
+		}
+		movements = append(movements, movement{entry: entry, id: referral.ReferralID})
+	}
+
+	for _, clawback := range m.clawbacks {
+		if clawback.TenantID != tenantID || strconv.Itoa(clawback.UserID) != userID || clawback.Amount <= 0 {
+			continue
+		}
+		movements = append(movements, movement{
+			entry: models.StatementEntry{Type: models.StatementClawback, Order: clawback.OrderNumber, Amount: -clawback.Amount, At: clawback.CreatedAt},
+			id:    clawback.ClawbackID,
+		})
+	}
+
+	sort.SliceStable(movements, func(i, j int) bool {
+		a, b := movements[i], movements[j]
+		if !a.entry.At.Equal(b.entry.At) {
+			return a.entry.At.Before(b.entry.At)
+		}
+		if a.entry.Type != b.entry.Type {
+			return a.entry.Type < b.entry.Type
+		}
+		return a.id < b.id
+	})
+
+	entries := make([]models.StatementEntry, len(movements))
+	for i, movement := range movements {
+		entries[i] = movement.entry
+	}
+	return entries
+}
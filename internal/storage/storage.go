@@ -2,24 +2,28 @@ package storage
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"time"
 
-	// "github.com/golang-migrate/migrate/v4"
 	"github.com/AndreyKuskov2/gophermart/internal/models"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/pgx/v5"
-	"github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
-	"github.com/jackc/pgx/v5/stdlib"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const passwordHashCost = 14
+
 type Postgres struct {
 	DB *pgxpool.Pool
 }
 
+var _ Storager = (*Postgres)(nil)
+
 func NewPostgres(dbURI string) (*Postgres, error) {
 	pool, err := pgxpool.New(context.Background(), dbURI)
 	if err != nil {
@@ -30,41 +34,30 @@ func NewPostgres(dbURI string) (*Postgres, error) {
 		return nil, fmt.Errorf("cannot ping database: %v", err)
 	}
 
-	db := stdlib.OpenDBFromPool(pool)
-
-	driver, err := postgres.WithInstance(db, &postgres.Config{})
-	if err != nil {
-		return nil, fmt.Errorf("cannot create migration driver")
-	}
-
-	m, err := migrate.NewWithDatabaseInstance(
-		"file://migrations",
-		"postgres", driver)
-	if err != nil {
-		return nil, fmt.Errorf("cannot create migration instance: %v", err)
-	}
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return nil, fmt.Errorf("cannot to apply migrations: %v", err)
-	}
-
 	return &Postgres{
 		DB: pool,
 	}, nil
 }
 
+func (db *Postgres) Close() {
+	db.DB.Close()
+}
+
 func (db *Postgres) CreateUser(ctx context.Context, user models.UserCreditials) (int, error) {
-	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), 14)
+	passwordHash, err := bcrypt.GenerateFromPassword([]byte(user.Password), passwordHashCost)
 	if err != nil {
 		return 0, fmt.Errorf("cannot hashing password: %v", err)
 	}
 
 	var userID int
-	if err := db.DB.QueryRow(ctx, checkUserIsExists, user.Login).Scan(&userID); err == nil {
+	if err := db.DB.QueryRow(ctx, checkUserIsExists, user.Login, tenant.ID(ctx)).Scan(&userID); err == nil {
 		return 0, ErrUserIsExist
 	}
 
-	if err := db.DB.QueryRow(ctx, createNewUser, user.Login, string(passwordHash)).Scan(&userID); err != nil {
-		fmt.Println(err)
+	if err := db.DB.QueryRow(ctx, createNewUser, user.Login, string(passwordHash), tenant.ID(ctx)).Scan(&userID); err != nil {
+		if isUniqueViolation(err) {
+			return 0, ErrUserIsExist
+		}
 		return 0, fmt.Errorf("cannot create user: %v", err)
 	}
 	return userID, nil
@@ -74,8 +67,8 @@ func (db *Postgres) GetUserByLogin(ctx context.Context, user models.UserCreditia
 	var userID int
 	var passwordHash string
 
-	if err := db.DB.QueryRow(ctx, getUserPasswordByLogin, user.Login).Scan(&userID, &passwordHash); err != nil {
-		return 0, fmt.Errorf("user not found: %v", err)
+	if err := db.DB.QueryRow(ctx, getUserPasswordByLogin, user.Login, tenant.ID(ctx)).Scan(&userID, &passwordHash); err != nil {
+		return 0, fmt.Errorf("user not found: %w", err)
 	}
 
 	err := bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(user.Password))
@@ -85,8 +78,60 @@ func (db *Postgres) GetUserByLogin(ctx context.Context, user models.UserCreditia
 	return userID, nil
 }
 
+func (db *Postgres) GetUserByID(ctx context.Context, userID string) (*models.User, error) {
+	rows, err := db.DB.Query(ctx, getUserByID, userID, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.User])
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return &user, nil
+}
+
+func (db *Postgres) UpdateUserProfile(ctx context.Context, userID string, update models.UserProfileUpdate) (*models.User, error) {
+	rows, err := db.DB.Query(ctx, updateUserProfile, userID, update.Email, update.DisplayName, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	user, err := pgx.CollectOneRow(rows, pgx.RowToStructByName[models.User])
+	if err != nil {
+		return nil, fmt.Errorf("user not found: %w", err)
+	}
+	return &user, nil
+}
+
+func (db *Postgres) DeleteUser(ctx context.Context, userID string, at time.Time) (time.Time, error) {
+	var deletedAt time.Time
+	if err := db.DB.QueryRow(ctx, markUserDeleted, userID, at, tenant.ID(ctx)).Scan(&deletedAt); err != nil {
+		return time.Time{}, fmt.Errorf("user not found: %w", err)
+	}
+	return deletedAt, nil
+}
+
+func (db *Postgres) RestoreUser(ctx context.Context, userID string) (bool, error) {
+	tag, err := db.DB.Exec(ctx, restoreUser, userID, tenant.ID(ctx))
+	if err != nil {
+		return false, err
+	}
+	return tag.RowsAffected() > 0, nil
+}
+
+func (db *Postgres) PurgeDeletedUsers(ctx context.Context, before time.Time) ([]int, error) {
+	rows, err := db.DB.Query(ctx, purgeDeletedUsers, before, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowTo[int])
+}
+
 func (db *Postgres) GetOrderByNumber(ctx context.Context, orderNumber string) (*models.Orders, error) {
-	rows, err := db.DB.Query(ctx, getOrderByNumber, orderNumber)
+	rows, err := db.DB.Query(ctx, getOrderByNumber, orderNumber, tenant.ID(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -100,14 +145,26 @@ func (db *Postgres) GetOrderByNumber(ctx context.Context, orderNumber string) (*
 }
 
 func (db *Postgres) CreateNewOrder(ctx context.Context, order *models.Orders) error {
-	if _, err := db.DB.Exec(ctx, createOrder, order.Number, order.Status, order.Accrual, order.UserID); err != nil {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, createOrder, order.Number, order.Status, order.Accrual, order.UserID, tenant.ID(ctx)); err != nil {
+		if isUniqueViolation(err) {
+			return ErrOrderIsExist
+		}
 		return err
 	}
-	return nil
+	if _, err := tx.Exec(ctx, createOrderStatusHistory, order.Number, order.Status, nil, nil, tenant.ID(ctx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (db *Postgres) GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error) {
-	rows, err := db.DB.Query(ctx, getOrdersByUserID, userID)
+	rows, err := db.DB.Query(ctx, getOrdersByUserID, userID, tenant.ID(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -121,22 +178,54 @@ func (db *Postgres) GetOrdersByUserID(ctx context.Context, userID string) ([]mod
 }
 
 func (db *Postgres) GetUserBalance(ctx context.Context, userID string) (*models.Balance, error) {
+	return queryUserBalance(ctx, db.DB, userID)
+}
+
+type rowQuerier interface {
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// queryUserBalance reads the balance of the user with q, a transaction that
+// locked the user or the pool. The accruals of cancelled orders count, their
+// clawbacks take them back.
+func queryUserBalance(ctx context.Context, q rowQuerier, userID string) (*models.Balance, error) {
 	var balance models.Balance
-	if err := db.DB.QueryRow(ctx, getUserBalance, userID, "PROCESSED").Scan(&balance.Current, &balance.Withdrawn); err != nil {
+	err := q.QueryRow(ctx, getUserBalance, userID, statusProcessed, tenant.ID(ctx), reversedStatuses).
+		Scan(&balance.Current, &balance.Withdrawn, &balance.TransferredIn, &balance.TransferredOut, &balance.Bonus, &balance.ClawedBack)
+	if err != nil {
 		return nil, err
 	}
 	return &balance, nil
 }
 
 func (db *Postgres) CreateWithdrawal(ctx context.Context, withdrawal *models.WithdrawBalance) error {
-	if _, err := db.DB.Exec(ctx, createWithdraw, withdrawal.UserID, withdrawal.OrderNumber, withdrawal.Amount); err != nil {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	if err := tx.QueryRow(ctx, lockUserForUpdate, withdrawal.UserID, tenant.ID(ctx)).Scan(&userID); err != nil {
 		return err
 	}
-	return nil
+
+	balance, err := queryUserBalance(ctx, tx, withdrawal.UserID)
+	if err != nil {
+		return err
+	}
+	if balance.Current < float64(withdrawal.Amount) {
+		return ErrInsufficientFunds
+	}
+
+	if _, err := tx.Exec(ctx, createWithdraw, withdrawal.UserID, withdrawal.OrderNumber, withdrawal.Amount, tenant.ID(ctx)); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
 func (db *Postgres) GetWithdrawalByUserID(ctx context.Context, userID string) ([]models.WithdrawBalance, error) {
-	rows, err := db.DB.Query(ctx, getWithdrawalByUserID, userID)
+	rows, err := db.DB.Query(ctx, getWithdrawalByUserID, userID, tenant.ID(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -150,7 +239,7 @@ func (db *Postgres) GetWithdrawalByUserID(ctx context.Context, userID string) ([
 }
 
 func (db *Postgres) GetPendingOrders(ctx context.Context) ([]models.Orders, error) {
-	rows, err := db.DB.Query(ctx, getPendingOrders, "NEW", "PROCESSING")
+	rows, err := db.DB.Query(ctx, getPendingOrders, "NEW", "PROCESSING", tenant.ID(ctx))
 	if err != nil {
 		return nil, err
 	}
@@ -163,9 +252,50 @@ func (db *Postgres) GetPendingOrders(ctx context.Context) ([]models.Orders, erro
 	return orders, nil
 }
 
-func (db *Postgres) UpdateOrderStatus(ctx context.Context, orderNumber, status string, accrual *float32) error {
-	if _, err := db.DB.Exec(ctx, updateOrderStatus, status, accrual, orderNumber); err != nil {
+func (db *Postgres) GetSettledOrders(ctx context.Context, since time.Time) ([]models.Orders, error) {
+	rows, err := db.DB.Query(ctx, getSettledOrders, statusProcessed, statusInvalid, since, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, pgx.RowToStructByName[models.Orders])
+}
+
+func (db *Postgres) UpdateOrderStatus(ctx context.Context, orderNumber, status string, accrual *float32, rawResponse json.RawMessage) error {
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	tag, err := tx.Exec(ctx, updateOrderStatus, status, accrual, orderNumber, tenant.ID(ctx), statusCancelled)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return ErrOrderStatusChanged
+	}
+
+	if _, err := tx.Exec(ctx, createOrderStatusHistory, orderNumber, status, accrual, rawResponse, tenant.ID(ctx)); err != nil {
 		return err
 	}
-	return nil
+	return tx.Commit(ctx)
+}
+
+func (db *Postgres) GetOrderStatusHistory(ctx context.Context, orderNumber string) ([]models.OrderStatusHistory, error) {
+	rows, err := db.DB.Query(ctx, getOrderStatusHistory, orderNumber, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	history, err := pgx.CollectRows(rows, pgx.RowToStructByName[models.OrderStatusHistory])
+	if err != nil {
+		return nil, err
+	}
+	return history, nil
+}
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == pgerrcode.UniqueViolation
 }
@@ -0,0 +1,163 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+)
+
+type UserStorager interface {
+	CreateUser(ctx context.Context, user models.UserCreditials) (int, error)
+	GetUserByLogin(ctx context.Context, user models.UserCreditials) (int, error)
+	GetUserByID(ctx context.Context, userID string) (*models.User, error)
+	UpdateUserProfile(ctx context.Context, userID string, update models.UserProfileUpdate) (*models.User, error)
+	// DeleteUser schedules the user for deletion at at and returns the time
+	// the deletion was first scheduled.
+	DeleteUser(ctx context.Context, userID string, at time.Time) (time.Time, error)
+	// RestoreUser cancels a scheduled deletion and reports whether there was
+	// one.
+	RestoreUser(ctx context.Context, userID string) (bool, error)
+	// PurgeDeletedUsers removes users of the tenant of the context scheduled
+	// for deletion at or before before together with their orders and
+	// withdrawals.
+	PurgeDeletedUsers(ctx context.Context, before time.Time) ([]int, error)
+}
+
+type OrderStorager interface {
+	CreateNewOrder(ctx context.Context, order *models.Orders) error
+	GetOrderByNumber(ctx context.Context, orderNumber string) (*models.Orders, error)
+	GetOrdersByUserID(ctx context.Context, userID string) ([]models.Orders, error)
+	GetOrderStatusHistory(ctx context.Context, orderNumber string) ([]models.OrderStatusHistory, error)
+	GetPendingOrders(ctx context.Context) ([]models.Orders, error)
+	// GetSettledOrders returns the processed and invalid orders uploaded
+	// since since, newest first.
+	GetSettledOrders(ctx context.Context, since time.Time) ([]models.Orders, error)
+	// UpdateOrderStatus leaves cancelled orders alone. It fails with
+	// ErrOrderStatusChanged when it changes nothing: the order is missing,
+	// cancelled or already has the status and accrual.
+	UpdateOrderStatus(ctx context.Context, orderNumber, status string, accrual *float32, rawResponse json.RawMessage) error
+}
+
+type BalanceStorager interface {
+	GetUserBalance(ctx context.Context, userID string) (*models.Balance, error)
+}
+
+type WithdrawalStorager interface {
+	CreateWithdrawal(ctx context.Context, withdrawal *models.WithdrawBalance) error
+	GetWithdrawalByUserID(ctx context.Context, userID string) ([]models.WithdrawBalance, error)
+}
+
+// TransferStorager moves points between users of the tenant of the context.
+// CreateTransfer finds the recipient by the login in transfer.Counterparty,
+// debits and credits under the same locks as withdrawals and fails with
+// ErrTransferLimitExceeded when the transfers the sender made since since
+// would exceed limit. It fills in the id, recipient and creation time.
+type TransferStorager interface {
+	CreateTransfer(ctx context.Context, transfer *models.Transfer, limit models.TransferLimit, since time.Time) error
+	GetTransfersByUserID(ctx context.Context, userID string) ([]models.Transfer, error)
+}
+
+// CampaignStorager keeps the campaigns of the tenant of the context and the
+// bonuses they grant. CreateBonus locks the user like withdrawals do, clamps
+// bonus.Amount to what limit leaves of the bonuses the campaign granted the
+// user since since and fails with ErrBonusLimitReached when nothing is left
+// and with ErrBonusIsExist when the campaign already rewarded the order.
+// Missing campaigns are reported with sql.ErrNoRows.
+type CampaignStorager interface {
+	CreateCampaign(ctx context.Context, campaign *models.Campaign) error
+	GetCampaigns(ctx context.Context) ([]models.Campaign, error)
+	GetCampaign(ctx context.Context, campaignID int) (*models.Campaign, error)
+	UpdateCampaign(ctx context.Context, campaign *models.Campaign) error
+	DeleteCampaign(ctx context.Context, campaignID int) error
+	CreateBonus(ctx context.Context, bonus *models.Bonus, limit models.BonusLimit, since time.Time) error
+	// GetBonusesByUserID returns the bonuses granted to the user, newest
+	// first.
+	GetBonusesByUserID(ctx context.Context, userID string) ([]models.Bonus, error)
+	// GetProcessedOrders returns the processed orders uploaded before before,
+	// oldest first.
+	GetProcessedOrders(ctx context.Context, before time.Time) ([]models.Orders, error)
+}
+
+// ReferralStorager keeps the referral codes and referrals of the tenant of
+// the context. EnsureReferralCode stores code unless the user already has
+// one, which it then fills in, and fails with ErrReferralCodeIsExist when
+// another user has the same code. CreateReferral fails with ErrSelfReferral
+// and with ErrReferralIsExist when the referee was already referred.
+// RewardReferral sets the rewards of the pending referral of the referee
+// exactly once; missing codes and referrals are reported with sql.ErrNoRows.
+type ReferralStorager interface {
+	EnsureReferralCode(ctx context.Context, code *models.ReferralCode) error
+	GetReferralCode(ctx context.Context, code string) (*models.ReferralCode, error)
+	CreateReferral(ctx context.Context, referral *models.Referral) error
+	GetReferralsByReferrerID(ctx context.Context, referrerID int) ([]models.Referral, error)
+	RewardReferral(ctx context.Context, refereeID int, orderNumber string, reward models.ReferralReward) (*models.Referral, error)
+}
+
+// TierStorager keeps the loyalty tiers of the users of the tenant of the
+// context. GetAccruedSince sums the accruals of the orders first processed
+// since since for every user that is not deleted. SetUserTier stores the tier of
+// a user and returns the change it recorded in the history, nil when the
+// tier stays the same. CreateTierBonus fails with ErrBonusIsExist when the
+// order already got a tier bonus. Missing tiers are reported with
+// sql.ErrNoRows.
+type TierStorager interface {
+	GetAccruedSince(ctx context.Context, since time.Time) ([]models.UserAccrual, error)
+	GetUserTier(ctx context.Context, userID int) (*models.UserTier, error)
+	SetUserTier(ctx context.Context, userTier *models.UserTier) (*models.TierChange, error)
+	GetTierHistory(ctx context.Context, userID int) ([]models.TierChange, error)
+	CreateTierBonus(ctx context.Context, bonus *models.Bonus) error
+}
+
+// StatementStorager reads the balance movements of a user. Entries passed to
+// fn have no running balance; they are read from the database as fn consumes
+// them, so histories of any size can be streamed.
+type StatementStorager interface {
+	GetBalanceAt(ctx context.Context, userID string, at time.Time) (float64, error)
+	StreamStatementEntries(ctx context.Context, userID string, from, to time.Time, fn func(models.StatementEntry) error) error
+}
+
+// AuditStorager keeps the audit log. AppendAuditEvent links the event to the
+// chain by setting its PrevHash and Hash and assigns its EventID. The chain
+// is shared by all tenants, GetAuditEvents only returns the events of the
+// tenant of the context.
+type AuditStorager interface {
+	AppendAuditEvent(ctx context.Context, event *models.AuditEvent) error
+	GetAuditEvents(ctx context.Context, filter models.AuditEventFilter) ([]models.AuditEvent, error)
+	GetAuditChain(ctx context.Context) ([]models.AuditEvent, error)
+}
+
+// CancellationStorager cancels orders of the tenant of the context.
+// CancelOrder sets the order to CANCELLED under the lock of its user and
+// records the clawback of what the order earned, its accrual, the bonuses
+// granted for it and the referral reward of its user. The reward of the
+// referrer is clawed back as well, capped by the balance of the referrer
+// under the reject policy. It fails with ErrOrderStatusChanged when the order no
+// longer has the expected status and with ErrInsufficientFunds when the
+// reject policy refuses to take the balance below zero. InvalidateOrder does
+// the same for a processed order the accrual system found INVALID after all,
+// capping the clawbacks under the reject policy instead. Clawbacks only take
+// what earlier clawbacks of the order left.
+type CancellationStorager interface {
+	CancelOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error)
+	InvalidateOrder(ctx context.Context, cancellation models.OrderCancellation) (*models.CancelledOrder, error)
+	// GetClawbacksByUserID returns the clawbacks of the cancelled orders of
+	// the user, newest first.
+	GetClawbacksByUserID(ctx context.Context, userID int) ([]models.Clawback, error)
+}
+
+type Storager interface {
+	UserStorager
+	OrderStorager
+	CancellationStorager
+	BalanceStorager
+	WithdrawalStorager
+	TransferStorager
+	CampaignStorager
+	ReferralStorager
+	TierStorager
+	StatementStorager
+	AuditStorager
+	Close()
+}
@@ -0,0 +1,1421 @@
+package storagetest
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/audit"
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/storage"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// RunConformance checks that a storage backend behaves like the reference
+// Postgres implementation. newStorage must return an empty storage.
+func RunConformance(t *testing.T, newStorage func(t *testing.T) storage.Storager) {
+	t.Run("Users", func(t *testing.T) { testUsers(t, newStorage(t)) })
+	t.Run("Orders", func(t *testing.T) { testOrders(t, newStorage(t)) })
+	t.Run("OrderStatusHistory", func(t *testing.T) { testOrderStatusHistory(t, newStorage(t)) })
+	t.Run("Balance", func(t *testing.T) { testBalance(t, newStorage(t)) })
+	t.Run("ConcurrentWithdrawals", func(t *testing.T) { testConcurrentWithdrawals(t, newStorage(t)) })
+	t.Run("OrderCancellation", func(t *testing.T) { testOrderCancellation(t, newStorage(t)) })
+	t.Run("Transfers", func(t *testing.T) { testTransfers(t, newStorage(t)) })
+	t.Run("TransferLimits", func(t *testing.T) { testTransferLimits(t, newStorage(t)) })
+	t.Run("ConcurrentTransfers", func(t *testing.T) { testConcurrentTransfers(t, newStorage(t)) })
+	t.Run("Campaigns", func(t *testing.T) { testCampaigns(t, newStorage(t)) })
+	t.Run("Bonuses", func(t *testing.T) { testBonuses(t, newStorage(t)) })
+	t.Run("ConcurrentBonuses", func(t *testing.T) { testConcurrentBonuses(t, newStorage(t)) })
+	t.Run("ReferralCodes", func(t *testing.T) { testReferralCodes(t, newStorage(t)) })
+	t.Run("Referrals", func(t *testing.T) { testReferrals(t, newStorage(t)) })
+	t.Run("ConcurrentReferralRewards", func(t *testing.T) { testConcurrentReferralRewards(t, newStorage(t)) })
+	t.Run("Tiers", func(t *testing.T) { testTiers(t, newStorage(t)) })
+	t.Run("UserProfile", func(t *testing.T) { testUserProfile(t, newStorage(t)) })
+	t.Run("UserDeletion", func(t *testing.T) { testUserDeletion(t, newStorage(t)) })
+	t.Run("Statement", func(t *testing.T) { testStatement(t, newStorage(t)) })
+	t.Run("TenantIsolation", func(t *testing.T) { testTenantIsolation(t, newStorage(t)) })
+	t.Run("AuditEvents", func(t *testing.T) { testAuditEvents(t, newStorage(t)) })
+	t.Run("ConcurrentAuditEvents", func(t *testing.T) { testConcurrentAuditEvents(t, newStorage(t)) })
+}
+
+func createUser(t *testing.T, s storage.Storager, login string) int {
+	t.Helper()
+	userID, err := s.CreateUser(context.Background(), models.UserCreditials{Login: login, Password: "password"})
+	require.NoError(t, err)
+	return userID
+}
+
+func createProcessedOrder(t *testing.T, s storage.Storager, userID int, number string, accrual float32) {
+	t.Helper()
+	ctx := context.Background()
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: number, Status: "NEW", UserID: userID}))
+	require.NoError(t, s.UpdateOrderStatus(ctx, number, "PROCESSED", &accrual, nil))
+}
+
+func testUsers(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	user := models.UserCreditials{Login: "alice", Password: "secret"}
+
+	userID, err := s.CreateUser(ctx, user)
+	require.NoError(t, err)
+	assert.Positive(t, userID)
+
+	_, err = s.CreateUser(ctx, user)
+	assert.ErrorIs(t, err, storage.ErrUserIsExist)
+
+	loggedID, err := s.GetUserByLogin(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, userID, loggedID)
+
+	_, err = s.GetUserByLogin(ctx, models.UserCreditials{Login: "alice", Password: "wrong"})
+	assert.ErrorIs(t, err, storage.ErrInvalidData)
+
+	_, err = s.GetUserByLogin(ctx, models.UserCreditials{Login: "bob", Password: "secret"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	otherID := createUser(t, s, "bob")
+	assert.NotEqual(t, userID, otherID)
+
+	found, err := s.GetUserByID(ctx, strconv.Itoa(userID))
+	require.NoError(t, err)
+	assert.Equal(t, userID, found.UserID)
+	assert.Equal(t, "alice", found.Login)
+	assert.False(t, found.CreatedAt.IsZero())
+
+	_, err = s.GetUserByID(ctx, strconv.Itoa(otherID+100))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testUserProfile(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := strconv.Itoa(createUser(t, s, "alice"))
+
+	user, err := s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Empty(t, user.Email)
+	assert.Empty(t, user.DisplayName)
+	assert.Nil(t, user.DeletedAt)
+
+	email, name := "alice@example.com", "Alice"
+	user, err = s.UpdateUserProfile(ctx, userID, models.UserProfileUpdate{Email: &email, DisplayName: &name})
+	require.NoError(t, err)
+	assert.Equal(t, "alice", user.Login)
+	assert.Equal(t, email, user.Email)
+	assert.Equal(t, name, user.DisplayName)
+
+	empty := ""
+	user, err = s.UpdateUserProfile(ctx, userID, models.UserProfileUpdate{DisplayName: &empty})
+	require.NoError(t, err)
+	assert.Equal(t, email, user.Email, "unset fields are kept")
+	assert.Empty(t, user.DisplayName)
+
+	user, err = s.GetUserByID(ctx, userID)
+	require.NoError(t, err)
+	assert.Equal(t, email, user.Email)
+
+	_, err = s.UpdateUserProfile(ctx, "1000", models.UserProfileUpdate{Email: &email})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testUserDeletion(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	bobID := createUser(t, s, "bob")
+	createProcessedOrder(t, s, aliceID, "79927398713", 100)
+	createProcessedOrder(t, s, bobID, "12345678903", 100)
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: strconv.Itoa(aliceID), OrderNumber: "2377225624", Amount: 10}))
+
+	restored, err := s.RestoreUser(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	assert.False(t, restored, "nothing to restore")
+
+	scheduled := time.Now().Add(-2 * time.Hour).Truncate(time.Microsecond)
+	deletedAt, err := s.DeleteUser(ctx, strconv.Itoa(aliceID), scheduled)
+	require.NoError(t, err)
+	assert.True(t, scheduled.Equal(deletedAt))
+
+	deletedAt, err = s.DeleteUser(ctx, strconv.Itoa(aliceID), time.Now())
+	require.NoError(t, err)
+	assert.True(t, scheduled.Equal(deletedAt), "a repeated deletion keeps the schedule")
+
+	user, err := s.GetUserByID(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	require.NotNil(t, user.DeletedAt)
+
+	purged, err := s.PurgeDeletedUsers(ctx, scheduled.Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, purged, "grace period has not passed")
+
+	restored, err = s.RestoreUser(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	assert.True(t, restored)
+	purged, err = s.PurgeDeletedUsers(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, purged, "restored users are kept")
+
+	_, err = s.DeleteUser(ctx, strconv.Itoa(aliceID), scheduled)
+	require.NoError(t, err)
+	purged, err = s.PurgeDeletedUsers(ctx, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []int{aliceID}, purged)
+
+	_, err = s.GetUserByID(ctx, strconv.Itoa(aliceID))
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetOrderByNumber(ctx, "79927398713")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	history, err := s.GetOrderStatusHistory(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+	withdrawals, err := s.GetWithdrawalByUserID(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	assert.Empty(t, withdrawals)
+
+	_, err = s.GetOrderByNumber(ctx, "12345678903")
+	assert.NoError(t, err, "other users are kept")
+	_, err = s.DeleteUser(ctx, strconv.Itoa(aliceID), time.Now())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func testOrders(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	bobID := createUser(t, s, "bob")
+
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: "79927398713", Status: "NEW", UserID: aliceID}))
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: "12345678903", Status: "NEW", UserID: bobID}))
+
+	err := s.CreateNewOrder(ctx, &models.Orders{Number: "79927398713", Status: "NEW", UserID: bobID})
+	assert.ErrorIs(t, err, storage.ErrOrderIsExist)
+
+	order, err := s.GetOrderByNumber(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, "79927398713", order.Number)
+	assert.Equal(t, "NEW", order.Status)
+	assert.Equal(t, aliceID, order.UserID)
+	assert.Positive(t, order.OrderID)
+	assert.False(t, order.UploadedAt.IsZero())
+
+	_, err = s.GetOrderByNumber(ctx, "0")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	orders, err := s.GetOrdersByUserID(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "79927398713", orders[0].Number)
+
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: "2377225624", Status: "NEW", UserID: aliceID}))
+	orders, err = s.GetOrdersByUserID(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	require.Len(t, orders, 2)
+	assert.Equal(t, "2377225624", orders[0].Number, "newest order first")
+	require.NoError(t, s.UpdateOrderStatus(ctx, "2377225624", "INVALID", nil, nil))
+
+	orders, err = s.GetOrdersByUserID(ctx, strconv.Itoa(createUser(t, s, "carol")))
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	pending, err := s.GetPendingOrders(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	require.NoError(t, s.UpdateOrderStatus(ctx, "12345678903", "PROCESSING", nil, nil))
+	pending, err = s.GetPendingOrders(ctx)
+	require.NoError(t, err)
+	assert.Len(t, pending, 2)
+
+	accrual := float32(42.5)
+	require.NoError(t, s.UpdateOrderStatus(ctx, "12345678903", "PROCESSED", &accrual, nil))
+	require.NoError(t, s.UpdateOrderStatus(ctx, "79927398713", "INVALID", nil, nil))
+	pending, err = s.GetPendingOrders(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+
+	order, err = s.GetOrderByNumber(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSED", order.Status)
+	assert.Equal(t, float32(42.5), order.Accrual)
+
+	settled, err := s.GetSettledOrders(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	require.Len(t, settled, 3)
+	assert.Equal(t, "2377225624", settled[0].Number, "newest order first")
+	settled, err = s.GetSettledOrders(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, settled)
+	settled, err = s.GetSettledOrders(tenant.WithID(ctx, "acme"), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, settled)
+
+	assert.ErrorIs(t, s.UpdateOrderStatus(ctx, "0", "PROCESSED", &accrual, nil), storage.ErrOrderStatusChanged)
+}
+
+func testOrderStatusHistory(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := createUser(t, s, "alice")
+	number := "79927398713"
+
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: number, Status: "NEW", UserID: userID}))
+	require.NoError(t, s.UpdateOrderStatus(ctx, number, "PROCESSING", nil, json.RawMessage(`{"order":"79927398713","status":"PROCESSING"}`)))
+	err := s.UpdateOrderStatus(ctx, number, "PROCESSING", nil, json.RawMessage(`{"order":"79927398713","status":"PROCESSING"}`))
+	assert.ErrorIs(t, err, storage.ErrOrderStatusChanged, "an update that changes nothing is reported")
+
+	accrual := float32(500)
+	raw := json.RawMessage(`{"order":"79927398713","status":"PROCESSED","accrual":500}`)
+	require.NoError(t, s.UpdateOrderStatus(ctx, number, "PROCESSED", &accrual, raw))
+
+	history, err := s.GetOrderStatusHistory(ctx, number)
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+
+	assert.Equal(t, "NEW", history[0].Status)
+	assert.Nil(t, history[0].Accrual)
+	assert.Equal(t, "PROCESSING", history[1].Status)
+	assert.Equal(t, "PROCESSED", history[2].Status)
+	require.NotNil(t, history[2].Accrual)
+	assert.Equal(t, accrual, *history[2].Accrual)
+	assert.JSONEq(t, string(raw), string(history[2].RawResponse))
+	assert.False(t, history[2].ChangedAt.Before(history[0].ChangedAt))
+
+	history, err = s.GetOrderStatusHistory(ctx, "0")
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testBalance(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := createUser(t, s, "alice")
+	user := strconv.Itoa(userID)
+
+	balance, err := s.GetUserBalance(ctx, user)
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), balance.Current)
+	assert.Equal(t, float32(0), balance.Withdrawn)
+
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: "12345678903", Status: "NEW", UserID: userID}))
+	createProcessedOrder(t, s, userID, "79927398713", 100)
+
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: user, OrderNumber: "2377225624", Amount: 40}))
+
+	err = s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: user, OrderNumber: "2377225624", Amount: 61})
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+
+	balance, err = s.GetUserBalance(ctx, user)
+	require.NoError(t, err)
+	assert.InDelta(t, 60, balance.Current, 0.001)
+	assert.InDelta(t, 40, balance.Withdrawn, 0.001)
+
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: user, OrderNumber: "12345678903", Amount: 10}))
+
+	withdrawals, err := s.GetWithdrawalByUserID(ctx, user)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 2)
+	assert.Equal(t, "12345678903", withdrawals[0].OrderNumber, "newest withdrawal first")
+	assert.Equal(t, "2377225624", withdrawals[1].OrderNumber)
+	assert.Equal(t, float32(40), withdrawals[1].Amount)
+	assert.False(t, withdrawals[1].ProcessedAt.IsZero())
+
+	withdrawals, err = s.GetWithdrawalByUserID(ctx, strconv.Itoa(createUser(t, s, "bob")))
+	require.NoError(t, err)
+	assert.Empty(t, withdrawals)
+}
+
+func testOrderCancellation(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	alice := strconv.Itoa(aliceID)
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: "12345678903", Status: "NEW", UserID: aliceID}))
+	createProcessedOrder(t, s, aliceID, "79927398713", 100)
+	require.NoError(t, s.CreateTierBonus(ctx, &models.Bonus{UserID: aliceID, OrderNumber: "79927398713", Tier: "gold", Amount: 20}))
+
+	cancel := func(userID int, number, status, policy string) (*models.CancelledOrder, error) {
+		return s.CancelOrder(ctx, models.OrderCancellation{
+			Number: number, UserID: userID, Status: status, Policy: policy, CancelledBy: models.CancelledByAdmin, Reason: "returned",
+		})
+	}
+
+	// The order is cancelled after the accrual processor listed it.
+	pending, err := s.GetPendingOrders(ctx)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "12345678903", pending[0].Number)
+
+	_, err = cancel(aliceID, "12345678903", "PROCESSING", models.ClawbackAllow)
+	assert.ErrorIs(t, err, storage.ErrOrderStatusChanged)
+	cancelled, err := cancel(aliceID, "12345678903", "NEW", models.ClawbackAllow)
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderCancelled, cancelled.Status)
+	assert.Equal(t, "NEW", cancelled.PreviousStatus)
+	assert.Zero(t, cancelled.Clawback)
+	assert.False(t, cancelled.CancelledAt.IsZero())
+	_, err = cancel(aliceID, "12345678903", "NEW", models.ClawbackAllow)
+	assert.ErrorIs(t, err, storage.ErrOrderStatusChanged, "an order is cancelled once")
+
+	// Cancelled orders are not polled and ignore late accrual results, the
+	// update reports that it changed nothing.
+	accrual := float32(50)
+	err = s.UpdateOrderStatus(ctx, "12345678903", "PROCESSED", &accrual, nil)
+	assert.ErrorIs(t, err, storage.ErrOrderStatusChanged)
+	order, err := s.GetOrderByNumber(ctx, "12345678903")
+	require.NoError(t, err)
+	assert.Equal(t, models.OrderCancelled, order.Status)
+	pending, err = s.GetPendingOrders(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	history, err := s.GetOrderStatusHistory(ctx, "12345678903")
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, models.OrderCancelled, history[1].Status)
+
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: alice, OrderNumber: "2377225624", Amount: 100}))
+
+	// The accrual and the bonus of the order are due, the balance only
+	// covers 20 of them.
+	_, err = cancel(aliceID, "79927398713", "PROCESSED", models.ClawbackReject)
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+	order, err = s.GetOrderByNumber(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.Equal(t, "PROCESSED", order.Status, "a rejected cancellation changes nothing")
+
+	cancelled, err = cancel(aliceID, "79927398713", "PROCESSED", models.ClawbackCap)
+	require.NoError(t, err)
+	assert.InDelta(t, 20, cancelled.Clawback, 0.001)
+	assert.InDelta(t, 100, cancelled.WrittenOff, 0.001)
+	balance, err := s.GetUserBalance(ctx, alice)
+	require.NoError(t, err)
+	assert.InDelta(t, 0, balance.Current, 0.001)
+	assert.InDelta(t, 20, balance.ClawedBack, 0.001)
+
+	clawbacks, err := s.GetClawbacksByUserID(ctx, aliceID)
+	require.NoError(t, err)
+	require.Len(t, clawbacks, 1, "a cancellation with nothing to take back records no clawback")
+	assert.Equal(t, "79927398713", clawbacks[0].OrderNumber)
+	assert.InDelta(t, 20, clawbacks[0].Amount, 0.001)
+	assert.InDelta(t, 100, clawbacks[0].WrittenOff, 0.001)
+	assert.Equal(t, models.CancelledByAdmin, clawbacks[0].CancelledBy)
+	assert.Equal(t, "returned", clawbacks[0].Reason)
+	assert.False(t, clawbacks[0].CreatedAt.IsZero())
+
+	bobID := createUser(t, s, "bob")
+	bob := strconv.Itoa(bobID)
+	before := time.Now().Add(-time.Second)
+	createProcessedOrder(t, s, bobID, "4561261212345467", 50)
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: bob, OrderNumber: "2377225624", Amount: 30}))
+	_, err = cancel(aliceID, "4561261212345467", "PROCESSED", models.ClawbackAllow)
+	assert.ErrorIs(t, err, storage.ErrOrderStatusChanged, "the order belongs to another user")
+	cancelled, err = cancel(bobID, "4561261212345467", "PROCESSED", models.ClawbackAllow)
+	require.NoError(t, err)
+	assert.InDelta(t, 50, cancelled.Clawback, 0.001)
+	assert.Zero(t, cancelled.WrittenOff)
+	after := time.Now().Add(time.Second)
+
+	balance, err = s.GetUserBalance(ctx, bob)
+	require.NoError(t, err)
+	assert.InDelta(t, -30, balance.Current, 0.001, "the allow policy takes the balance below zero")
+	clawbacks, err = s.GetClawbacksByUserID(ctx, bobID)
+	require.NoError(t, err)
+	require.Len(t, clawbacks, 1)
+	assert.Equal(t, "4561261212345467", clawbacks[0].OrderNumber)
+	err = s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: bob, OrderNumber: "2377225624", Amount: 1})
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+
+	at, err := s.GetBalanceAt(ctx, bob, after)
+	require.NoError(t, err)
+	assert.InDelta(t, -30, at, 0.001)
+	var entries []models.StatementEntry
+	require.NoError(t, s.StreamStatementEntries(ctx, bob, before, after, func(entry models.StatementEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 3)
+	assert.Equal(t, models.StatementAccrual, entries[0].Type, "the accrual of a cancelled order stays")
+	assert.Equal(t, models.StatementWithdrawal, entries[1].Type)
+	assert.Equal(t, models.StatementClawback, entries[2].Type)
+	assert.Equal(t, "4561261212345467", entries[2].Order)
+	assert.InDelta(t, -50, entries[2].Amount, 0.001)
+
+	// Cancelling the order that rewarded a referral takes back the rewards
+	// of both parties; the referrer cannot block it and is capped instead.
+	carolID := createUser(t, s, "carol")
+	daveID := createUser(t, s, "dave")
+	require.NoError(t, s.CreateReferral(ctx, &models.Referral{ReferrerID: carolID, RefereeID: daveID, Status: models.ReferralPending}))
+	createProcessedOrder(t, s, daveID, "1234567812345670", 50)
+	_, err = s.RewardReferral(ctx, daveID, "1234567812345670", models.ReferralReward{ReferrerBonus: 100, RefereeBonus: 30})
+	require.NoError(t, err)
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: strconv.Itoa(carolID), OrderNumber: "2377225624", Amount: 80}))
+
+	cancelled, err = cancel(daveID, "1234567812345670", "PROCESSED", models.ClawbackReject)
+	require.NoError(t, err)
+	assert.InDelta(t, 80, cancelled.Clawback, 0.001)
+	assert.Zero(t, cancelled.WrittenOff)
+	balance, err = s.GetUserBalance(ctx, strconv.Itoa(daveID))
+	require.NoError(t, err)
+	assert.InDelta(t, 0, balance.Current, 0.001)
+
+	balance, err = s.GetUserBalance(ctx, strconv.Itoa(carolID))
+	require.NoError(t, err)
+	assert.InDelta(t, 0, balance.Current, 0.001)
+	clawbacks, err = s.GetClawbacksByUserID(ctx, carolID)
+	require.NoError(t, err)
+	require.Len(t, clawbacks, 1)
+	assert.Equal(t, "1234567812345670", clawbacks[0].OrderNumber)
+	assert.InDelta(t, 20, clawbacks[0].Amount, 0.001)
+	assert.InDelta(t, 80, clawbacks[0].WrittenOff, 0.001)
+	assert.Equal(t, "returned", clawbacks[0].Reason)
+
+	// A processed order the accrual system invalidates keeps its accrual
+	// next to the clawback, which the reject policy cannot refuse.
+	erinID := createUser(t, s, "erin")
+	erin := strconv.Itoa(erinID)
+	createProcessedOrder(t, s, erinID, "5555555555554444", 60)
+	require.NoError(t, s.CreateTierBonus(ctx, &models.Bonus{UserID: erinID, OrderNumber: "5555555555554444", Tier: "gold", Amount: 10}))
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: erin, OrderNumber: "2377225624", Amount: 50}))
+	_, err = s.InvalidateOrder(ctx, models.OrderCancellation{
+		Number: "5555555555554444", UserID: erinID, Status: "NEW", Policy: models.ClawbackReject, CancelledBy: models.CancelledByReconciler,
+	})
+	assert.ErrorIs(t, err, storage.ErrOrderStatusChanged)
+	invalidated, err := s.InvalidateOrder(ctx, models.OrderCancellation{
+		Number: "5555555555554444", UserID: erinID, Status: "PROCESSED", Policy: models.ClawbackReject, CancelledBy: models.CancelledByReconciler,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID", invalidated.Status)
+	assert.InDelta(t, 20, invalidated.Clawback, 0.001)
+	assert.InDelta(t, 50, invalidated.WrittenOff, 0.001)
+	order, err = s.GetOrderByNumber(ctx, "5555555555554444")
+	require.NoError(t, err)
+	assert.Equal(t, "INVALID", order.Status)
+	balance, err = s.GetUserBalance(ctx, erin)
+	require.NoError(t, err)
+	assert.InDelta(t, 0, balance.Current, 0.001)
+
+	// Cancelling it later finds nothing left to take back.
+	cancelled, err = cancel(erinID, "5555555555554444", "INVALID", models.ClawbackAllow)
+	require.NoError(t, err)
+	assert.Zero(t, cancelled.Clawback)
+	assert.Zero(t, cancelled.WrittenOff)
+	clawbacks, err = s.GetClawbacksByUserID(ctx, erinID)
+	require.NoError(t, err)
+	require.Len(t, clawbacks, 1)
+	assert.Equal(t, models.CancelledByReconciler, clawbacks[0].CancelledBy)
+	balance, err = s.GetUserBalance(ctx, erin)
+	require.NoError(t, err)
+	assert.InDelta(t, 0, balance.Current, 0.001)
+}
+
+func testTransfers(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	alice := strconv.Itoa(aliceID)
+	bob := strconv.Itoa(createUser(t, s, "bob"))
+	createProcessedOrder(t, s, aliceID, "79927398713", 100)
+
+	transfer := &models.Transfer{SenderID: alice, Counterparty: "bob", Amount: 30, Memo: "happy birthday"}
+	require.NoError(t, s.CreateTransfer(ctx, transfer, models.TransferLimit{}, time.Time{}))
+	assert.Positive(t, transfer.TransferID)
+	assert.Equal(t, bob, transfer.RecipientID)
+	assert.Equal(t, models.TransferSent, transfer.Direction)
+	assert.False(t, transfer.CreatedAt.IsZero())
+
+	err := s.CreateTransfer(ctx, &models.Transfer{SenderID: alice, Counterparty: "bob", Amount: 71}, models.TransferLimit{}, time.Time{})
+	assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+	err = s.CreateTransfer(ctx, &models.Transfer{SenderID: alice, Counterparty: "carol", Amount: 1}, models.TransferLimit{}, time.Time{})
+	assert.ErrorIs(t, err, storage.ErrRecipientNotFound)
+	err = s.CreateTransfer(ctx, &models.Transfer{SenderID: alice, Counterparty: "alice", Amount: 1}, models.TransferLimit{}, time.Time{})
+	assert.ErrorIs(t, err, storage.ErrSelfTransfer)
+
+	require.NoError(t, s.CreateTransfer(ctx, &models.Transfer{SenderID: bob, Counterparty: "alice", Amount: 5}, models.TransferLimit{}, time.Time{}))
+
+	balance, err := s.GetUserBalance(ctx, alice)
+	require.NoError(t, err)
+	assert.InDelta(t, 75, balance.Current, 0.001)
+	assert.InDelta(t, 5, balance.TransferredIn, 0.001)
+	assert.InDelta(t, 30, balance.TransferredOut, 0.001)
+
+	balance, err = s.GetUserBalance(ctx, bob)
+	require.NoError(t, err)
+	assert.InDelta(t, 25, balance.Current, 0.001)
+
+	// Received points can be withdrawn like accrued ones.
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: bob, OrderNumber: "2377225624", Amount: 25}))
+
+	transfers, err := s.GetTransfersByUserID(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, transfers, 2)
+	assert.Equal(t, models.TransferReceived, transfers[0].Direction, "newest transfer first")
+	assert.Equal(t, "bob", transfers[0].Counterparty)
+	assert.Equal(t, models.TransferSent, transfers[1].Direction)
+	assert.Equal(t, "bob", transfers[1].Counterparty)
+	assert.Equal(t, float32(30), transfers[1].Amount)
+	assert.Equal(t, "happy birthday", transfers[1].Memo)
+
+	transfers, err = s.GetTransfersByUserID(ctx, strconv.Itoa(createUser(t, s, "carol")))
+	require.NoError(t, err)
+	assert.Empty(t, transfers)
+
+	var entries []models.StatementEntry
+	require.NoError(t, s.StreamStatementEntries(ctx, alice, time.Time{}, time.Now().Add(time.Second), func(entry models.StatementEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 3)
+	assert.Equal(t, models.StatementAccrual, entries[0].Type)
+	assert.Equal(t, models.StatementTransferOut, entries[1].Type)
+	assert.Equal(t, "bob", entries[1].Counterparty)
+	assert.Empty(t, entries[1].Order)
+	assert.InDelta(t, -30, entries[1].Amount, 0.001)
+	assert.Equal(t, models.StatementTransferIn, entries[2].Type)
+	assert.InDelta(t, 5, entries[2].Amount, 0.001)
+
+	atNow, err := s.GetBalanceAt(ctx, alice, time.Now().Add(time.Second))
+	require.NoError(t, err)
+	assert.InDelta(t, 75, atNow, 0.001)
+
+	// Users scheduled for deletion cannot receive transfers.
+	_, err = s.DeleteUser(ctx, bob, time.Now())
+	require.NoError(t, err)
+	err = s.CreateTransfer(ctx, &models.Transfer{SenderID: alice, Counterparty: "bob", Amount: 1}, models.TransferLimit{}, time.Time{})
+	assert.ErrorIs(t, err, storage.ErrRecipientNotFound)
+	_, err = s.RestoreUser(ctx, bob)
+	require.NoError(t, err)
+
+	// Purging the sender does not take back the points it gave away.
+	_, err = s.DeleteUser(ctx, alice, time.Now())
+	require.NoError(t, err)
+	_, err = s.PurgeDeletedUsers(ctx, time.Now())
+	require.NoError(t, err)
+
+	balance, err = s.GetUserBalance(ctx, bob)
+	require.NoError(t, err)
+	assert.InDelta(t, 0, balance.Current, 0.001)
+	assert.InDelta(t, 30, balance.TransferredIn, 0.001)
+
+	transfers, err = s.GetTransfersByUserID(ctx, bob)
+	require.NoError(t, err)
+	require.Len(t, transfers, 2)
+	assert.Empty(t, transfers[0].Counterparty)
+}
+
+func testTransferLimits(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	alice := strconv.Itoa(aliceID)
+	createUser(t, s, "bob")
+	createProcessedOrder(t, s, aliceID, "79927398713", 100)
+
+	send := func(amount float32, limit models.TransferLimit, since time.Time) error {
+		return s.CreateTransfer(ctx, &models.Transfer{SenderID: alice, Counterparty: "bob", Amount: amount}, limit, since)
+	}
+
+	since := time.Now().Add(-time.Minute)
+	byAmount := models.TransferLimit{MaxAmount: 25}
+	require.NoError(t, send(10, byAmount, since))
+	require.NoError(t, send(15, byAmount, since))
+	assert.ErrorIs(t, send(1, byAmount, since), storage.ErrTransferLimitExceeded)
+	require.NoError(t, send(1, byAmount, time.Now().Add(time.Minute)), "transfers before since do not count")
+
+	byCount := models.TransferLimit{MaxCount: 3}
+	assert.ErrorIs(t, send(1, byCount, since), storage.ErrTransferLimitExceeded)
+	require.NoError(t, send(1, models.TransferLimit{}, since), "a zero limit is disabled")
+
+	balance, err := s.GetUserBalance(ctx, alice)
+	require.NoError(t, err)
+	assert.InDelta(t, 73, balance.Current, 0.001)
+}
+
+// testConcurrentTransfers sends transfers in both directions at once: the
+// balances must never go negative and no transfer may deadlock.
+func testConcurrentTransfers(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	bobID := createUser(t, s, "bob")
+	alice, bob := strconv.Itoa(aliceID), strconv.Itoa(bobID)
+	createProcessedOrder(t, s, aliceID, "79927398713", 100)
+	createProcessedOrder(t, s, bobID, "12345678903", 100)
+
+	const attempts = 10
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		for _, pair := range [][2]string{{alice, "bob"}, {bob, "alice"}} {
+			wg.Add(1)
+			go func(sender, recipient string) {
+				defer wg.Done()
+				err := s.CreateTransfer(ctx, &models.Transfer{SenderID: sender, Counterparty: recipient, Amount: 30}, models.TransferLimit{}, time.Time{})
+				if err != nil {
+					assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+				}
+			}(pair[0], pair[1])
+		}
+	}
+	wg.Wait()
+
+	var total float64
+	for _, user := range []string{alice, bob} {
+		balance, err := s.GetUserBalance(ctx, user)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, balance.Current, -0.001)
+		total += balance.Current
+	}
+	assert.InDelta(t, 200, total, 0.001, "transfers neither create nor destroy points")
+}
+
+func createCampaign(t *testing.T, s storage.Storager, rule models.CampaignRule) *models.Campaign {
+	t.Helper()
+	c := &models.Campaign{
+		Name:     "Campaign",
+		Rule:     rule,
+		StartsAt: time.Now().Add(-time.Hour).Truncate(time.Microsecond),
+		Enabled:  true,
+	}
+	require.NoError(t, s.CreateCampaign(context.Background(), c))
+	return c
+}
+
+func testCampaigns(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	acme := tenant.WithID(ctx, "acme")
+
+	endsAt := time.Now().Add(24 * time.Hour).Truncate(time.Microsecond)
+	weekend := &models.Campaign{
+		Name:       "Weekend",
+		Rule:       models.CampaignRule{Type: "multiplier", Multiplier: 2, Weekdays: []string{"saturday", "sunday"}, Timezone: "Europe/Moscow"},
+		MonthlyCap: 500,
+		StartsAt:   time.Now().Truncate(time.Microsecond),
+		EndsAt:     &endsAt,
+		Enabled:    true,
+	}
+	require.NoError(t, s.CreateCampaign(ctx, weekend))
+	assert.NotZero(t, weekend.CampaignID)
+	assert.False(t, weekend.CreatedAt.IsZero())
+	welcome := createCampaign(t, s, models.CampaignRule{Type: "first_order", Amount: 50})
+
+	stored, err := s.GetCampaign(ctx, weekend.CampaignID)
+	require.NoError(t, err)
+	assert.Equal(t, weekend.Name, stored.Name)
+	assert.Equal(t, weekend.Rule, stored.Rule)
+	assert.Equal(t, weekend.MonthlyCap, stored.MonthlyCap)
+	assert.True(t, weekend.StartsAt.Equal(stored.StartsAt))
+	require.NotNil(t, stored.EndsAt)
+	assert.True(t, endsAt.Equal(*stored.EndsAt))
+	assert.True(t, stored.Enabled)
+
+	campaigns, err := s.GetCampaigns(ctx)
+	require.NoError(t, err)
+	require.Len(t, campaigns, 2)
+	assert.Equal(t, []int{weekend.CampaignID, welcome.CampaignID}, []int{campaigns[0].CampaignID, campaigns[1].CampaignID})
+
+	welcome.Rule.Amount = 75
+	welcome.Enabled = false
+	require.NoError(t, s.UpdateCampaign(ctx, welcome))
+	stored, err = s.GetCampaign(ctx, welcome.CampaignID)
+	require.NoError(t, err)
+	assert.Equal(t, float64(75), stored.Rule.Amount)
+	assert.False(t, stored.Enabled)
+	assert.Nil(t, stored.EndsAt)
+
+	// Campaigns of another tenant can be neither read nor changed.
+	campaigns, err = s.GetCampaigns(acme)
+	require.NoError(t, err)
+	assert.Empty(t, campaigns)
+	_, err = s.GetCampaign(acme, weekend.CampaignID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, s.UpdateCampaign(acme, &models.Campaign{CampaignID: weekend.CampaignID, Name: "Stolen", Rule: weekend.Rule, StartsAt: weekend.StartsAt}), sql.ErrNoRows)
+	assert.ErrorIs(t, s.DeleteCampaign(acme, weekend.CampaignID), sql.ErrNoRows)
+
+	require.NoError(t, s.DeleteCampaign(ctx, weekend.CampaignID))
+	_, err = s.GetCampaign(ctx, weekend.CampaignID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	assert.ErrorIs(t, s.DeleteCampaign(ctx, weekend.CampaignID), sql.ErrNoRows)
+	assert.ErrorIs(t, s.UpdateCampaign(ctx, weekend), sql.ErrNoRows)
+}
+
+func testBonuses(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	alice := strconv.Itoa(aliceID)
+	createProcessedOrder(t, s, aliceID, "79927398713", 100)
+	createProcessedOrder(t, s, aliceID, "12345678903", 100)
+	createProcessedOrder(t, s, aliceID, "4561261212345467", 100)
+	weekend := createCampaign(t, s, models.CampaignRule{Type: "multiplier", Multiplier: 2})
+	welcome := createCampaign(t, s, models.CampaignRule{Type: "first_order", Amount: 50})
+
+	grant := func(c *models.Campaign, number string, amount float64, limit models.BonusLimit, since time.Time) (*models.Bonus, error) {
+		bonus := &models.Bonus{UserID: aliceID, OrderNumber: number, CampaignID: c.CampaignID, Amount: amount}
+		return bonus, s.CreateBonus(ctx, bonus, limit, since)
+	}
+
+	monthStart := time.Now().Add(-time.Minute)
+	capped := models.BonusLimit{MonthlyCap: 150}
+	bonus, err := grant(weekend, "79927398713", 100, capped, monthStart)
+	require.NoError(t, err)
+	assert.NotZero(t, bonus.BonusID)
+	assert.False(t, bonus.CreatedAt.IsZero())
+	_, err = grant(weekend, "79927398713", 100, capped, monthStart)
+	assert.ErrorIs(t, err, storage.ErrBonusIsExist, "one bonus per order and campaign")
+
+	bonus, err = grant(weekend, "12345678903", 100, capped, monthStart)
+	require.NoError(t, err)
+	assert.InDelta(t, 50, bonus.Amount, 0.001, "clamped to the monthly cap")
+	_, err = grant(weekend, "4561261212345467", 100, capped, monthStart)
+	assert.ErrorIs(t, err, storage.ErrBonusLimitReached)
+	bonus, err = grant(weekend, "4561261212345467", 100, capped, time.Now().Add(time.Minute))
+	require.NoError(t, err, "bonuses before since do not count")
+	assert.InDelta(t, 100, bonus.Amount, 0.001)
+
+	once := models.BonusLimit{OncePerUser: true}
+	_, err = grant(welcome, "79927398713", 50, once, monthStart)
+	require.NoError(t, err)
+	_, err = grant(welcome, "12345678903", 50, once, monthStart)
+	assert.ErrorIs(t, err, storage.ErrBonusLimitReached)
+
+	_, err = grant(welcome, "2377225624", 50, models.BonusLimit{}, monthStart)
+	assert.Error(t, err, "the order must exist")
+
+	granted, err := s.GetBonusesByUserID(ctx, alice)
+	require.NoError(t, err)
+	require.Len(t, granted, 4)
+	assert.Equal(t, "79927398713", granted[0].OrderNumber, "newest first")
+	assert.Equal(t, welcome.CampaignID, granted[0].CampaignID)
+	assert.InDelta(t, 50, granted[0].Amount, 0.001)
+	assert.Equal(t, weekend.CampaignID, granted[3].CampaignID)
+	carolBonuses, err := s.GetBonusesByUserID(ctx, strconv.Itoa(createUser(t, s, "carol")))
+	require.NoError(t, err)
+	assert.Empty(t, carolBonuses)
+
+	balance, err := s.GetUserBalance(ctx, alice)
+	require.NoError(t, err)
+	assert.InDelta(t, 300, balance.Bonus, 0.001)
+	assert.InDelta(t, 600, balance.Current, 0.001)
+
+	var entries []models.StatementEntry
+	require.NoError(t, s.StreamStatementEntries(ctx, alice, time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(entry models.StatementEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	var bonuses float64
+	for _, entry := range entries {
+		if entry.Type == models.StatementBonus {
+			bonuses += entry.Amount
+			assert.NotEmpty(t, entry.Order)
+		}
+	}
+	assert.InDelta(t, 300, bonuses, 0.001)
+
+	// Deleting a campaign keeps its bonuses.
+	require.NoError(t, s.DeleteCampaign(ctx, weekend.CampaignID))
+	balance, err = s.GetUserBalance(ctx, alice)
+	require.NoError(t, err)
+	assert.InDelta(t, 600, balance.Current, 0.001)
+
+	processed, err := s.GetProcessedOrders(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	require.Len(t, processed, 3)
+	assert.Equal(t, "79927398713", processed[0].Number, "oldest first")
+	processed, err = s.GetProcessedOrders(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, processed)
+	processed, err = s.GetProcessedOrders(tenant.WithID(ctx, "acme"), time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Empty(t, processed)
+
+	// Purged users lose their bonuses.
+	_, err = s.DeleteUser(ctx, alice, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = s.PurgeDeletedUsers(ctx, time.Now())
+	require.NoError(t, err)
+	bobID := createUser(t, s, "bob")
+	createProcessedOrder(t, s, bobID, "79927398713", 10)
+	balance, err = s.GetUserBalance(ctx, strconv.Itoa(bobID))
+	require.NoError(t, err)
+	assert.InDelta(t, 10, balance.Current, 0.001)
+}
+
+// testConcurrentBonuses grants bonuses of a capped campaign for many orders
+// at once: the cap must hold.
+func testConcurrentBonuses(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := createUser(t, s, "alice")
+	c := createCampaign(t, s, models.CampaignRule{Type: "multiplier", Multiplier: 2})
+
+	const orders = 10
+	numbers := make([]string, orders)
+	for i := range numbers {
+		numbers[i] = strconv.Itoa(1000 + i)
+		createProcessedOrder(t, s, userID, numbers[i], 30)
+	}
+
+	var wg sync.WaitGroup
+	for _, number := range numbers {
+		wg.Add(1)
+		go func(number string) {
+			defer wg.Done()
+			bonus := &models.Bonus{UserID: userID, OrderNumber: number, CampaignID: c.CampaignID, Amount: 30}
+			if err := s.CreateBonus(ctx, bonus, models.BonusLimit{MonthlyCap: 100}, time.Time{}); err != nil {
+				assert.ErrorIs(t, err, storage.ErrBonusLimitReached)
+			}
+		}(number)
+	}
+	wg.Wait()
+
+	balance, err := s.GetUserBalance(ctx, strconv.Itoa(userID))
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Bonus, 0.001)
+}
+
+func testReferralCodes(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	bobID := createUser(t, s, "bob")
+
+	code := &models.ReferralCode{UserID: aliceID, Code: "ALICE234", IP: "10.0.0.1"}
+	require.NoError(t, s.EnsureReferralCode(ctx, code))
+	assert.False(t, code.CreatedAt.IsZero())
+
+	again := &models.ReferralCode{UserID: aliceID, Code: "OTHER234", IP: "10.0.0.2"}
+	require.NoError(t, s.EnsureReferralCode(ctx, again))
+	assert.Equal(t, "ALICE234", again.Code, "a user keeps their first code")
+	assert.Equal(t, "10.0.0.1", again.IP)
+
+	err := s.EnsureReferralCode(ctx, &models.ReferralCode{UserID: bobID, Code: "ALICE234"})
+	assert.ErrorIs(t, err, storage.ErrReferralCodeIsExist)
+
+	found, err := s.GetReferralCode(ctx, "ALICE234")
+	require.NoError(t, err)
+	assert.Equal(t, aliceID, found.UserID)
+	assert.Equal(t, "10.0.0.1", found.IP)
+
+	_, err = s.GetReferralCode(ctx, "MISSING2")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.GetReferralCode(tenant.WithID(ctx, "acme"), "ALICE234")
+	assert.ErrorIs(t, err, sql.ErrNoRows, "codes are scoped by tenant")
+
+	// Codes of users scheduled for deletion cannot be used and go away with
+	// the user.
+	_, err = s.DeleteUser(ctx, strconv.Itoa(aliceID), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = s.GetReferralCode(ctx, "ALICE234")
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.PurgeDeletedUsers(ctx, time.Now())
+	require.NoError(t, err)
+	require.NoError(t, s.EnsureReferralCode(ctx, &models.ReferralCode{UserID: bobID, Code: "ALICE234"}))
+}
+
+func testReferrals(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	bobID := createUser(t, s, "bob")
+	carolID := createUser(t, s, "carol")
+
+	err := s.CreateReferral(ctx, &models.Referral{ReferrerID: aliceID, RefereeID: aliceID, Status: models.ReferralPending})
+	assert.ErrorIs(t, err, storage.ErrSelfReferral)
+
+	referral := &models.Referral{ReferrerID: aliceID, RefereeID: bobID, Status: models.ReferralPending, IP: "10.0.0.2"}
+	require.NoError(t, s.CreateReferral(ctx, referral))
+	assert.NotZero(t, referral.ReferralID)
+	assert.False(t, referral.CreatedAt.IsZero())
+	err = s.CreateReferral(ctx, &models.Referral{ReferrerID: carolID, RefereeID: bobID, Status: models.ReferralPending})
+	assert.ErrorIs(t, err, storage.ErrReferralIsExist, "a user is referred once")
+	require.NoError(t, s.CreateReferral(ctx, &models.Referral{
+		ReferrerID: aliceID, RefereeID: carolID, Status: models.ReferralRejected, Reason: models.ReferralSameIP, IP: "10.0.0.1",
+	}))
+
+	referrals, err := s.GetReferralsByReferrerID(ctx, aliceID)
+	require.NoError(t, err)
+	require.Len(t, referrals, 2)
+	assert.Equal(t, "carol", referrals[0].Referee, "newest first")
+	assert.Equal(t, models.ReferralRejected, referrals[0].Status)
+	assert.Equal(t, models.ReferralSameIP, referrals[0].Reason)
+	assert.Equal(t, "bob", referrals[1].Referee)
+	assert.Equal(t, "10.0.0.2", referrals[1].IP)
+	assert.Nil(t, referrals[1].RewardedAt)
+
+	reward := models.ReferralReward{ReferrerBonus: 100, RefereeBonus: 50}
+	_, err = s.RewardReferral(ctx, carolID, "12345678903", reward)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "rejected referrals are not rewarded")
+
+	createProcessedOrder(t, s, bobID, "79927398713", 10)
+	rewarded, err := s.RewardReferral(ctx, bobID, "79927398713", reward)
+	require.NoError(t, err)
+	assert.Equal(t, aliceID, rewarded.ReferrerID)
+	assert.Equal(t, models.ReferralRewarded, rewarded.Status)
+	require.NotNil(t, rewarded.RewardedAt)
+	_, err = s.RewardReferral(ctx, bobID, "79927398713", reward)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "a referral is rewarded once")
+
+	balance, err := s.GetUserBalance(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+	assert.InDelta(t, 100, balance.Bonus, 0.001)
+	balance, err = s.GetUserBalance(ctx, strconv.Itoa(bobID))
+	require.NoError(t, err)
+	assert.InDelta(t, 60, balance.Current, 0.001)
+	assert.InDelta(t, 50, balance.Bonus, 0.001)
+
+	var entries []models.StatementEntry
+	require.NoError(t, s.StreamStatementEntries(ctx, strconv.Itoa(aliceID), time.Now().Add(-time.Hour), time.Now().Add(time.Hour), func(entry models.StatementEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}))
+	require.Len(t, entries, 1)
+	assert.Equal(t, models.StatementReferral, entries[0].Type)
+	assert.Equal(t, "bob", entries[0].Counterparty)
+	assert.Empty(t, entries[0].Order)
+	assert.InDelta(t, 100, entries[0].Amount, 0.001)
+
+	referrals, err = s.GetReferralsByReferrerID(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, models.ReferralRewarded, referrals[1].Status)
+	assert.Equal(t, "79927398713", referrals[1].OrderNumber)
+	assert.InDelta(t, 100, referrals[1].ReferrerBonus, 0.001)
+
+	referrals, err = s.GetReferralsByReferrerID(tenant.WithID(ctx, "acme"), aliceID)
+	require.NoError(t, err)
+	assert.Empty(t, referrals, "referrals are scoped by tenant")
+
+	// The rewards of a purged referee stay with the referrer.
+	_, err = s.DeleteUser(ctx, strconv.Itoa(bobID), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = s.PurgeDeletedUsers(ctx, time.Now())
+	require.NoError(t, err)
+	balance, err = s.GetUserBalance(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Current, 0.001)
+	referrals, err = s.GetReferralsByReferrerID(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Empty(t, referrals[1].Referee)
+}
+
+// testConcurrentReferralRewards rewards a referral from many orders at once:
+// it must be rewarded exactly once.
+func testConcurrentReferralRewards(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	bobID := createUser(t, s, "bob")
+	require.NoError(t, s.CreateReferral(ctx, &models.Referral{ReferrerID: aliceID, RefereeID: bobID, Status: models.ReferralPending}))
+
+	const orders = 10
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	rewarded := 0
+	for i := range orders {
+		wg.Add(1)
+		go func(number string) {
+			defer wg.Done()
+			_, err := s.RewardReferral(ctx, bobID, number, models.ReferralReward{ReferrerBonus: 100, RefereeBonus: 50})
+			if err != nil {
+				assert.ErrorIs(t, err, sql.ErrNoRows)
+				return
+			}
+			mu.Lock()
+			rewarded++
+			mu.Unlock()
+		}(strconv.Itoa(1000 + i))
+	}
+	wg.Wait()
+
+	assert.Equal(t, 1, rewarded)
+	balance, err := s.GetUserBalance(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	assert.InDelta(t, 100, balance.Bonus, 0.001)
+}
+
+func testTiers(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	bobID := createUser(t, s, "bob")
+	carolID := createUser(t, s, "carol")
+	createProcessedOrder(t, s, aliceID, "79927398713", 700)
+	createProcessedOrder(t, s, aliceID, "12345678903", 500)
+	createProcessedOrder(t, s, bobID, "4561261212345467", 50)
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: "2377225624", Status: "NEW", UserID: bobID}))
+	_, err := s.DeleteUser(ctx, strconv.Itoa(carolID), time.Now())
+	require.NoError(t, err)
+
+	accruals, err := s.GetAccruedSince(ctx, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, []models.UserAccrual{{UserID: aliceID, Accrued: 1200}, {UserID: bobID, Accrued: 50}}, accruals, "users scheduled for deletion are skipped")
+	accruals, err = s.GetAccruedSince(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	assert.Equal(t, []models.UserAccrual{{UserID: aliceID}, {UserID: bobID}}, accruals, "older orders fall out of the window")
+	accruals, err = s.GetAccruedSince(tenant.WithID(ctx, "acme"), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	assert.Empty(t, accruals)
+
+	orders, err := s.GetOrdersByUserID(ctx, strconv.Itoa(bobID))
+	require.NoError(t, err)
+	var uploadedAt time.Time
+	for _, order := range orders {
+		if order.Number == "2377225624" {
+			uploadedAt = order.UploadedAt
+		}
+	}
+	require.False(t, uploadedAt.IsZero())
+	time.Sleep(20 * time.Millisecond)
+	accrual := float32(30)
+	require.NoError(t, s.UpdateOrderStatus(ctx, "2377225624", "PROCESSED", &accrual, nil))
+	accruals, err = s.GetAccruedSince(ctx, uploadedAt.Add(10*time.Millisecond))
+	require.NoError(t, err)
+	assert.Equal(t, []models.UserAccrual{{UserID: aliceID}, {UserID: bobID, Accrued: 30}}, accruals, "orders count from when they were processed, not uploaded")
+
+	_, err = s.GetUserTier(ctx, aliceID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	change, err := s.SetUserTier(ctx, &models.UserTier{UserID: aliceID, Tier: "bronze", Accrued: 0})
+	require.NoError(t, err)
+	require.NotNil(t, change)
+	assert.Empty(t, change.From)
+	assert.Equal(t, "bronze", change.To)
+
+	change, err = s.SetUserTier(ctx, &models.UserTier{UserID: aliceID, Tier: "bronze", Accrued: 500})
+	require.NoError(t, err)
+	assert.Nil(t, change, "the same tier is not a change")
+
+	change, err = s.SetUserTier(ctx, &models.UserTier{UserID: aliceID, Tier: "silver", Accrued: 1200})
+	require.NoError(t, err)
+	require.NotNil(t, change)
+	assert.Equal(t, "bronze", change.From)
+	assert.False(t, change.ChangedAt.IsZero())
+
+	userTier, err := s.GetUserTier(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Equal(t, "silver", userTier.Tier)
+	assert.InDelta(t, 1200, userTier.Accrued, 0.001)
+	assert.False(t, userTier.UpdatedAt.IsZero())
+	_, err = s.GetUserTier(tenant.WithID(ctx, "acme"), aliceID)
+	assert.ErrorIs(t, err, sql.ErrNoRows, "tiers are scoped by tenant")
+
+	history, err := s.GetTierHistory(ctx, aliceID)
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+	assert.Equal(t, "silver", history[0].To, "newest first")
+	assert.Equal(t, "bronze", history[1].To)
+	history, err = s.GetTierHistory(ctx, bobID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+
+	_, err = s.SetUserTier(ctx, &models.UserTier{UserID: 1 << 20, Tier: "bronze"})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	// Tier bonuses count as bonuses, one per order, next to campaign bonuses.
+	bonus := &models.Bonus{UserID: aliceID, OrderNumber: "79927398713", Tier: "silver", Amount: 70}
+	require.NoError(t, s.CreateTierBonus(ctx, bonus))
+	assert.NotZero(t, bonus.BonusID)
+	err = s.CreateTierBonus(ctx, &models.Bonus{UserID: aliceID, OrderNumber: "79927398713", Tier: "silver", Amount: 70})
+	assert.ErrorIs(t, err, storage.ErrBonusIsExist)
+	c := createCampaign(t, s, models.CampaignRule{Type: "multiplier", Multiplier: 2})
+	require.NoError(t, s.CreateBonus(ctx, &models.Bonus{UserID: aliceID, OrderNumber: "79927398713", CampaignID: c.CampaignID, Amount: 700}, models.BonusLimit{}, time.Time{}))
+	balance, err := s.GetUserBalance(ctx, strconv.Itoa(aliceID))
+	require.NoError(t, err)
+	assert.InDelta(t, 770, balance.Bonus, 0.001)
+	assert.InDelta(t, 1970, balance.Current, 0.001)
+
+	// Purged users lose their tiers and history.
+	_, err = s.DeleteUser(ctx, strconv.Itoa(aliceID), time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	_, err = s.PurgeDeletedUsers(ctx, time.Now().Add(time.Minute))
+	require.NoError(t, err)
+	_, err = s.GetUserTier(ctx, aliceID)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	history, err = s.GetTierHistory(ctx, aliceID)
+	require.NoError(t, err)
+	assert.Empty(t, history)
+}
+
+func testStatement(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := createUser(t, s, "alice")
+	user := strconv.Itoa(userID)
+	other := createUser(t, s, "bob")
+
+	before := time.Now().Add(-time.Second)
+	require.NoError(t, s.CreateNewOrder(ctx, &models.Orders{Number: "12345678903", Status: "NEW", UserID: userID}))
+	createProcessedOrder(t, s, userID, "79927398713", 100)
+	createProcessedOrder(t, s, other, "4561261212345467", 1000)
+	require.NoError(t, s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: user, OrderNumber: "2377225624", Amount: 40}))
+	after := time.Now().Add(time.Second)
+
+	balance, err := s.GetBalanceAt(ctx, user, before)
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), balance)
+
+	balance, err = s.GetBalanceAt(ctx, user, after)
+	require.NoError(t, err)
+	assert.InDelta(t, 60, balance, 0.001)
+
+	var entries []models.StatementEntry
+	collect := func(entry models.StatementEntry) error {
+		entries = append(entries, entry)
+		return nil
+	}
+	require.NoError(t, s.StreamStatementEntries(ctx, user, before, after, collect))
+	require.Len(t, entries, 2, "only processed orders and withdrawals of the user")
+	assert.Equal(t, models.StatementAccrual, entries[0].Type)
+	assert.Equal(t, "79927398713", entries[0].Order)
+	assert.InDelta(t, 100, entries[0].Amount, 0.001)
+	assert.Equal(t, models.StatementWithdrawal, entries[1].Type)
+	assert.Equal(t, "2377225624", entries[1].Order)
+	assert.InDelta(t, -40, entries[1].Amount, 0.001)
+	assert.False(t, entries[1].At.Before(entries[0].At))
+
+	// The period is half-open: a movement at to is not part of it.
+	first := entries[0].At
+	entries = nil
+	require.NoError(t, s.StreamStatementEntries(ctx, user, before, first, collect))
+	assert.Empty(t, entries)
+
+	errStop := errors.New("stop")
+	calls := 0
+	err = s.StreamStatementEntries(ctx, user, before, after, func(models.StatementEntry) error {
+		calls++
+		return errStop
+	})
+	assert.ErrorIs(t, err, errStop)
+	assert.Equal(t, 1, calls)
+}
+
+// testTenantIsolation checks that nothing stored for one tenant can be read
+// or changed through another one, even with the user id or order number.
+func testTenantIsolation(t *testing.T, s storage.Storager) {
+	acme := tenant.WithID(context.Background(), "acme")
+	globex := tenant.WithID(context.Background(), "globex")
+	number := "79927398713"
+
+	acmeID, err := s.CreateUser(acme, models.UserCreditials{Login: "alice", Password: "acme-password"})
+	require.NoError(t, err)
+	globexID, err := s.CreateUser(globex, models.UserCreditials{Login: "alice", Password: "globex-password"})
+	require.NoError(t, err, "logins are unique per tenant")
+	require.NotEqual(t, acmeID, globexID)
+	acmeUser := strconv.Itoa(acmeID)
+
+	_, err = s.GetUserByLogin(globex, models.UserCreditials{Login: "alice", Password: "acme-password"})
+	assert.ErrorIs(t, err, storage.ErrInvalidData)
+	userID, err := s.GetUserByLogin(globex, models.UserCreditials{Login: "alice", Password: "globex-password"})
+	require.NoError(t, err)
+	assert.Equal(t, globexID, userID)
+
+	_, err = s.GetUserByID(globex, acmeUser)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	name := "Mallory"
+	_, err = s.UpdateUserProfile(globex, acmeUser, models.UserProfileUpdate{DisplayName: &name})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+	_, err = s.DeleteUser(globex, acmeUser, time.Now())
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	accrual := float32(100)
+	require.NoError(t, s.CreateNewOrder(acme, &models.Orders{Number: number, Status: "NEW", UserID: acmeID}))
+	require.NoError(t, s.UpdateOrderStatus(acme, number, "PROCESSED", &accrual, nil))
+	assert.Error(t, s.CreateNewOrder(globex, &models.Orders{Number: "12345678903", Status: "NEW", UserID: acmeID}),
+		"an order cannot belong to a user of another tenant")
+	require.NoError(t, s.CreateNewOrder(globex, &models.Orders{Number: number, Status: "NEW", UserID: globexID}),
+		"order numbers are unique per tenant")
+
+	_, err = s.CreateUser(globex, models.UserCreditials{Login: "bob", Password: "password"})
+	require.NoError(t, err)
+	err = s.CreateTransfer(acme, &models.Transfer{SenderID: acmeUser, Counterparty: "bob", Amount: 1}, models.TransferLimit{}, time.Time{})
+	assert.ErrorIs(t, err, storage.ErrRecipientNotFound, "the recipient must belong to the tenant")
+	err = s.CreateTransfer(globex, &models.Transfer{SenderID: acmeUser, Counterparty: "bob", Amount: 1}, models.TransferLimit{}, time.Time{})
+	assert.ErrorIs(t, err, sql.ErrNoRows, "the sender must belong to the tenant")
+
+	order, err := s.GetOrderByNumber(globex, number)
+	require.NoError(t, err)
+	assert.Equal(t, globexID, order.UserID)
+	assert.Equal(t, "NEW", order.Status)
+
+	orders, err := s.GetOrdersByUserID(globex, acmeUser)
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	history, err := s.GetOrderStatusHistory(globex, number)
+	require.NoError(t, err)
+	require.Len(t, history, 1, "history of the acme order is not visible")
+
+	pending, err := s.GetPendingOrders(acme)
+	require.NoError(t, err)
+	assert.Empty(t, pending)
+	pending, err = s.GetPendingOrders(globex)
+	require.NoError(t, err)
+	require.Len(t, pending, 1)
+	assert.Equal(t, "globex", pending[0].TenantID)
+
+	balance, err := s.GetUserBalance(globex, acmeUser)
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), balance.Current)
+	err = s.CreateWithdrawal(globex, &models.WithdrawBalance{UserID: acmeUser, OrderNumber: "2377225624", Amount: 10})
+	assert.Error(t, err, "users of another tenant cannot withdraw")
+	require.NoError(t, s.CreateWithdrawal(acme, &models.WithdrawBalance{UserID: acmeUser, OrderNumber: "2377225624", Amount: 10}))
+
+	withdrawals, err := s.GetWithdrawalByUserID(globex, acmeUser)
+	require.NoError(t, err)
+	assert.Empty(t, withdrawals)
+	withdrawals, err = s.GetWithdrawalByUserID(acme, acmeUser)
+	require.NoError(t, err)
+	assert.Len(t, withdrawals, 1)
+
+	at, err := s.GetBalanceAt(globex, acmeUser, time.Now().Add(time.Hour))
+	require.NoError(t, err)
+	assert.Equal(t, float64(0), at)
+	require.NoError(t, s.StreamStatementEntries(globex, acmeUser, time.Time{}, time.Now().Add(time.Hour), func(models.StatementEntry) error {
+		t.Error("statement entry of another tenant")
+		return nil
+	}))
+
+	// The globex order is still pending after an update through acme.
+	require.NoError(t, s.UpdateOrderStatus(acme, number, "INVALID", nil, nil))
+	order, err = s.GetOrderByNumber(globex, number)
+	require.NoError(t, err)
+	assert.Equal(t, "NEW", order.Status)
+
+	require.NoError(t, s.AppendAuditEvent(acme, &models.AuditEvent{EventType: audit.EventUserRegistered, UserID: &acmeID, CreatedAt: time.Now()}))
+	require.NoError(t, s.AppendAuditEvent(globex, &models.AuditEvent{EventType: audit.EventUserRegistered, UserID: &globexID, CreatedAt: time.Now()}))
+	events, err := s.GetAuditEvents(globex, models.AuditEventFilter{})
+	require.NoError(t, err)
+	require.Len(t, events, 1)
+	assert.Equal(t, globexID, *events[0].UserID)
+	chain, err := s.GetAuditChain(context.Background())
+	require.NoError(t, err)
+	assert.True(t, audit.Verify(chain).Valid)
+
+	_, err = s.DeleteUser(acme, acmeUser, time.Now().Add(-time.Hour))
+	require.NoError(t, err)
+	purged, err := s.PurgeDeletedUsers(globex, time.Now())
+	require.NoError(t, err)
+	assert.Empty(t, purged)
+	purged, err = s.PurgeDeletedUsers(acme, time.Now())
+	require.NoError(t, err)
+	assert.Equal(t, []int{acmeID}, purged)
+	order, err = s.GetOrderByNumber(globex, number)
+	require.NoError(t, err, "purging acme keeps the globex order with the same number")
+	assert.Equal(t, globexID, order.UserID)
+}
+
+func testConcurrentWithdrawals(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	userID := createUser(t, s, "alice")
+	user := strconv.Itoa(userID)
+	createProcessedOrder(t, s, userID, "79927398713", 100)
+
+	const attempts = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		succeeded int
+	)
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := s.CreateWithdrawal(ctx, &models.WithdrawBalance{UserID: user, OrderNumber: "2377225624", Amount: 30})
+			if err == nil {
+				mu.Lock()
+				succeeded++
+				mu.Unlock()
+				return
+			}
+			assert.ErrorIs(t, err, storage.ErrInsufficientFunds)
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, 3, succeeded)
+
+	balance, err := s.GetUserBalance(ctx, user)
+	require.NoError(t, err)
+	assert.InDelta(t, 10, balance.Current, 0.001)
+}
+
+// existingAuditChain returns the audit events stored before the test: the
+// Postgres audit log is append-only, so it outlives the other test data.
+func existingAuditChain(t *testing.T, s storage.Storager) ([]models.AuditEvent, string) {
+	t.Helper()
+	chain, err := s.GetAuditChain(context.Background())
+	require.NoError(t, err)
+	if len(chain) == 0 {
+		return chain, ""
+	}
+	return chain, chain[len(chain)-1].Hash
+}
+
+func testAuditEvents(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	aliceID := createUser(t, s, "alice")
+	existing, lastHash := existingAuditChain(t, s)
+	// Stored timestamps are truncated, see audit.Timestamp.
+	start := audit.Timestamp(time.Now())
+
+	events := []*models.AuditEvent{
+		{EventType: audit.EventLoginFailed, IP: "10.0.0.1", Details: json.RawMessage(`{"login":"alice"}`), CreatedAt: time.Now()},
+		{EventType: audit.EventLoginSucceeded, UserID: &aliceID, IP: "10.0.0.1", UserAgent: "curl/8.0", RequestID: "req-1", CreatedAt: time.Now()},
+		{EventType: audit.EventWithdrawal, UserID: &aliceID, Details: json.RawMessage(`{"order":"2377225624", "sum":50}`), CreatedAt: time.Now()},
+	}
+	for _, event := range events {
+		require.NoError(t, s.AppendAuditEvent(ctx, event))
+		assert.Positive(t, event.EventID)
+		assert.Len(t, event.Hash, 64)
+	}
+	assert.Equal(t, lastHash, events[0].PrevHash)
+	assert.Equal(t, events[0].Hash, events[1].PrevHash)
+	assert.Equal(t, events[1].Hash, events[2].PrevHash)
+
+	chain, err := s.GetAuditChain(ctx)
+	require.NoError(t, err)
+	require.Len(t, chain, len(existing)+3)
+	added := chain[len(existing):]
+	assert.Equal(t, events[0].EventID, added[0].EventID)
+	assert.Equal(t, `{"order":"2377225624", "sum":50}`, string(added[2].Details), "details are stored verbatim")
+	assert.Equal(t, models.AuditChainStatus{Valid: true, Checked: len(existing) + 3}, audit.Verify(chain))
+
+	// Events stored before the test are older than start.
+	all, err := s.GetAuditEvents(ctx, models.AuditEventFilter{From: &start, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, all, 3)
+	assert.Equal(t, events[2].EventID, all[0].EventID, "newest first")
+	assert.Equal(t, "curl/8.0", all[1].UserAgent)
+	assert.Equal(t, "req-1", all[1].RequestID)
+	assert.Nil(t, all[2].UserID)
+
+	byUser, err := s.GetAuditEvents(ctx, models.AuditEventFilter{UserID: &aliceID, From: &start, Limit: 10})
+	require.NoError(t, err)
+	assert.Len(t, byUser, 2)
+
+	byType, err := s.GetAuditEvents(ctx, models.AuditEventFilter{EventType: audit.EventLoginFailed, From: &start, Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, byType, 1)
+	assert.Equal(t, "10.0.0.1", byType[0].IP)
+
+	end := time.Now().Add(time.Minute)
+	inRange, err := s.GetAuditEvents(ctx, models.AuditEventFilter{From: &start, To: &end, Limit: 2})
+	require.NoError(t, err)
+	assert.Len(t, inRange, 2, "limit is applied")
+
+	future, err := s.GetAuditEvents(ctx, models.AuditEventFilter{From: &end, Limit: 10})
+	require.NoError(t, err)
+	assert.Empty(t, future)
+}
+
+func testConcurrentAuditEvents(t *testing.T, s storage.Storager) {
+	ctx := context.Background()
+	existing, _ := existingAuditChain(t, s)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			assert.NoError(t, s.AppendAuditEvent(ctx, &models.AuditEvent{
+				EventType: audit.EventOrderUploaded,
+				Details:   json.RawMessage(`{"n":` + strconv.Itoa(i) + `}`),
+				CreatedAt: time.Now(),
+			}))
+		}(i)
+	}
+	wg.Wait()
+
+	chain, err := s.GetAuditChain(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, models.AuditChainStatus{Valid: true, Checked: len(existing) + 20}, audit.Verify(chain))
+}
@@ -0,0 +1,204 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *Postgres) GetAccruedSince(ctx context.Context, since time.Time) ([]models.UserAccrual, error) {
+	rows, err := db.DB.Query(ctx, getAccruedSince, statusProcessed, since, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.UserAccrual, error) {
+		var accrual models.UserAccrual
+		err := row.Scan(&accrual.UserID, &accrual.Accrued)
+		return accrual, err
+	})
+}
+
+func (db *Postgres) GetUserTier(ctx context.Context, userID int) (*models.UserTier, error) {
+	userTier := models.UserTier{UserID: userID, TenantID: tenant.ID(ctx)}
+	err := db.DB.QueryRow(ctx, getUserTier, userID, userTier.TenantID).Scan(&userTier.Tier, &userTier.Accrued, &userTier.UpdatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("user tier not found: %w", sql.ErrNoRows)
+		}
+		return nil, err
+	}
+	return &userTier, nil
+}
+
+func (db *Postgres) SetUserTier(ctx context.Context, userTier *models.UserTier) (*models.TierChange, error) {
+	userTier.TenantID = tenant.ID(ctx)
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	var userID int
+	if err := tx.QueryRow(ctx, lockUserForUpdate, userTier.UserID, userTier.TenantID).Scan(&userID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, fmt.Errorf("user not found: %w", sql.ErrNoRows)
+		}
+		return nil, err
+	}
+
+	var from string
+	if err := tx.QueryRow(ctx, getUserTierName, userTier.UserID, userTier.TenantID).Scan(&from); err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return nil, err
+	}
+	if err := tx.QueryRow(ctx, upsertUserTier, userTier.UserID, userTier.Tier, userTier.Accrued, userTier.TenantID).Scan(&userTier.UpdatedAt); err != nil {
+		return nil, err
+	}
+
+	var change *models.TierChange
+	if from != userTier.Tier {
+		change = &models.TierChange{From: from, To: userTier.Tier, Accrued: userTier.Accrued}
+		if err := tx.QueryRow(ctx, createTierHistory, userTier.UserID, from, userTier.Tier, userTier.Accrued, userTier.TenantID).Scan(&change.ChangedAt); err != nil {
+			return nil, err
+		}
+	}
+	return change, tx.Commit(ctx)
+}
+
+func (db *Postgres) GetTierHistory(ctx context.Context, userID int) ([]models.TierChange, error) {
+	rows, err := db.DB.Query(ctx, getTierHistory, userID, tenant.ID(ctx))
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.TierChange, error) {
+		var change models.TierChange
+		err := row.Scan(&change.From, &change.To, &change.Accrued, &change.ChangedAt)
+		return change, err
+	})
+}
+
+func (db *Postgres) CreateTierBonus(ctx context.Context, bonus *models.Bonus) error {
+	bonus.TenantID = tenant.ID(ctx)
+	err := db.DB.QueryRow(ctx, createTierBonus, bonus.UserID, bonus.OrderNumber, bonus.Tier, bonus.Amount, bonus.TenantID).Scan(&bonus.BonusID, &bonus.CreatedAt)
+	if isUniqueViolation(err) {
+		return ErrBonusIsExist
+	}
+	return err
+}
+
+func (m *Memory) GetAccruedSince(ctx context.Context, since time.Time) ([]models.UserAccrual, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	accrued := map[int]float64{}
+	for _, u := range m.users {
+		if u.tenantID == tenantID && u.deletedAt == nil {
+			accrued[u.userID] = 0
+		}
+	}
+	for _, order := range m.orders {
+		if _, ok := accrued[order.UserID]; !ok || order.TenantID != tenantID || order.Status != statusProcessed {
+			continue
+		}
+		if !m.processedAt(tenantID, order).Before(since) {
+			accrued[order.UserID] += float64(order.Accrual)
+		}
+	}
+
+	accruals := make([]models.UserAccrual, 0, len(accrued))
+	for userID, sum := range accrued {
+		accruals = append(accruals, models.UserAccrual{UserID: userID, Accrued: sum})
+	}
+	sort.Slice(accruals, func(i, j int) bool { return accruals[i].UserID < accruals[j].UserID })
+	return accruals, nil
+}
+
+func (m *Memory) GetUserTier(ctx context.Context, userID int) (*models.UserTier, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	userTier, ok := m.tiers[memoryKey{tenantID: tenant.ID(ctx), name: strconv.Itoa(userID)}]
+	if !ok {
+		return nil, fmt.Errorf("user tier not found: %w", sql.ErrNoRows)
+	}
+	stored := *userTier
+	return &stored, nil
+}
+
+func (m *Memory) SetUserTier(ctx context.Context, userTier *models.UserTier) (*models.TierChange, error) {
+	tenantID := tenant.ID(ctx)
+	key := memoryKey{tenantID: tenantID, name: strconv.Itoa(userTier.UserID)}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findUser(tenantID, key.name); err != nil {
+		return nil, err
+	}
+
+	var from string
+	if previous, ok := m.tiers[key]; ok {
+		from = previous.Tier
+	}
+	userTier.UpdatedAt = time.Now()
+	userTier.TenantID = tenantID
+	stored := *userTier
+	m.tiers[key] = &stored
+
+	if from == userTier.Tier {
+		return nil, nil
+	}
+	change := models.TierChange{From: from, To: userTier.Tier, Accrued: userTier.Accrued, ChangedAt: userTier.UpdatedAt}
+	m.tierHistory[key] = append(m.tierHistory[key], change)
+	return &change, nil
+}
+
+func (m *Memory) GetTierHistory(ctx context.Context, userID int) ([]models.TierChange, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	history := m.tierHistory[memoryKey{tenantID: tenant.ID(ctx), name: strconv.Itoa(userID)}]
+	changes := make([]models.TierChange, 0, len(history))
+	for i := len(history) - 1; i >= 0; i-- {
+		changes = append(changes, history[i])
+	}
+	return changes, nil
+}
+
+func (m *Memory) CreateTierBonus(ctx context.Context, bonus *models.Bonus) error {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, err := m.findUser(tenantID, strconv.Itoa(bonus.UserID)); err != nil {
+		return err
+	}
+	if m.findOrder(tenantID, bonus.OrderNumber) == nil {
+		return fmt.Errorf("order not found: %w", sql.ErrNoRows)
+	}
+	for _, b := range m.bonuses {
+		if b.TenantID == tenantID && b.Tier != "" && b.OrderNumber == bonus.OrderNumber {
+			return ErrBonusIsExist
+		}
+	}
+
+	m.nextBonusID++
+	bonus.BonusID = m.nextBonusID
+	bonus.CreatedAt = time.Now()
+	bonus.TenantID = tenantID
+
+	stored := *bonus
+	m.bonuses = append(m.bonuses, &stored)
+	return nil
+}
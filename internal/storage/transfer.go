@@ -0,0 +1,176 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/AndreyKuskov2/gophermart/internal/models"
+	"github.com/AndreyKuskov2/gophermart/internal/tenant"
+	"github.com/jackc/pgx/v5"
+)
+
+func (db *Postgres) CreateTransfer(ctx context.Context, transfer *models.Transfer, limit models.TransferLimit, since time.Time) error {
+	senderID, err := strconv.Atoi(transfer.SenderID)
+	if err != nil {
+		return err
+	}
+
+	tx, err := db.DB.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	var recipientID int
+	if err := tx.QueryRow(ctx, getTransferRecipientID, transfer.Counterparty, tenant.ID(ctx)).Scan(&recipientID); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return ErrRecipientNotFound
+		}
+		return err
+	}
+	if recipientID == senderID {
+		return ErrSelfTransfer
+	}
+
+	rows, err := tx.Query(ctx, lockUsersForUpdate, []int{senderID, recipientID}, tenant.ID(ctx))
+	if err != nil {
+		return err
+	}
+	locked, err := pgx.CollectRows(rows, pgx.RowTo[int])
+	if err != nil {
+		return err
+	}
+	switch {
+	case len(locked) == 2:
+	case len(locked) == 1 && locked[0] == senderID:
+		// The recipient was purged after it was looked up.
+		return ErrRecipientNotFound
+	default:
+		return fmt.Errorf("user not found: %w", sql.ErrNoRows)
+	}
+
+	balance, err := queryUserBalance(ctx, tx, transfer.SenderID)
+	if err != nil {
+		return err
+	}
+	if balance.Current < float64(transfer.Amount) {
+		return ErrInsufficientFunds
+	}
+
+	var count int
+	var sent float64
+	if err := tx.QueryRow(ctx, getSentTransfersSince, senderID, tenant.ID(ctx), since).Scan(&count, &sent); err != nil {
+		return err
+	}
+	if transferLimitExceeded(limit, count, sent, transfer.Amount) {
+		return ErrTransferLimitExceeded
+	}
+
+	if err := tx.QueryRow(ctx, createTransfer, senderID, recipientID, transfer.Amount, transfer.Memo, tenant.ID(ctx)).Scan(&transfer.TransferID, &transfer.CreatedAt); err != nil {
+		return err
+	}
+	transfer.RecipientID = strconv.Itoa(recipientID)
+	transfer.Direction = models.TransferSent
+	transfer.TenantID = tenant.ID(ctx)
+	return tx.Commit(ctx)
+}
+
+func (db *Postgres) GetTransfersByUserID(ctx context.Context, userID string) ([]models.Transfer, error) {
+	rows, err := db.DB.Query(ctx, getTransfersByUserID, userID, tenant.ID(ctx), models.TransferSent, models.TransferReceived)
+	if err != nil {
+		return nil, err
+	}
+	return pgx.CollectRows(rows, func(row pgx.CollectableRow) (models.Transfer, error) {
+		transfer := models.Transfer{TenantID: tenant.ID(ctx)}
+		err := row.Scan(&transfer.TransferID, &transfer.SenderID, &transfer.RecipientID, &transfer.Direction,
+			&transfer.Counterparty, &transfer.Amount, &transfer.Memo, &transfer.CreatedAt)
+		return transfer, err
+	})
+}
+
+func (m *Memory) CreateTransfer(ctx context.Context, transfer *models.Transfer, limit models.TransferLimit, since time.Time) error {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	sender, err := m.findUser(tenantID, transfer.SenderID)
+	if err != nil {
+		return err
+	}
+	recipient, ok := m.users[memoryKey{tenantID: tenantID, name: transfer.Counterparty}]
+	if !ok || recipient.deletedAt != nil {
+		return ErrRecipientNotFound
+	}
+	if recipient.userID == sender.userID {
+		return ErrSelfTransfer
+	}
+
+	if m.balance(tenantID, sender.userID).Current < float64(transfer.Amount) {
+		return ErrInsufficientFunds
+	}
+
+	var count int
+	var sent float64
+	for _, t := range m.transfers {
+		if t.TenantID == tenantID && t.SenderID == transfer.SenderID && !t.CreatedAt.Before(since) {
+			count++
+			sent += float64(t.Amount)
+		}
+	}
+	if transferLimitExceeded(limit, count, sent, transfer.Amount) {
+		return ErrTransferLimitExceeded
+	}
+
+	m.nextTransferID++
+	transfer.TransferID = m.nextTransferID
+	transfer.RecipientID = strconv.Itoa(recipient.userID)
+	transfer.Direction = models.TransferSent
+	transfer.CreatedAt = time.Now()
+	transfer.TenantID = tenantID
+
+	stored := *transfer
+	stored.Direction, stored.Counterparty = "", ""
+	m.transfers = append(m.transfers, &stored)
+	return nil
+}
+
+func (m *Memory) GetTransfersByUserID(ctx context.Context, userID string) ([]models.Transfer, error) {
+	tenantID := tenant.ID(ctx)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	transfers := []models.Transfer{}
+	for i := len(m.transfers) - 1; i >= 0; i-- {
+		transfer := *m.transfers[i]
+		if transfer.TenantID != tenantID {
+			continue
+		}
+		counterpartyID := ""
+		switch userID {
+		case transfer.SenderID:
+			transfer.Direction, counterpartyID = models.TransferSent, transfer.RecipientID
+		case transfer.RecipientID:
+			transfer.Direction, counterpartyID = models.TransferReceived, transfer.SenderID
+		default:
+			continue
+		}
+		if counterparty, err := m.findUser(tenantID, counterpartyID); err == nil {
+			transfer.Counterparty = counterparty.login
+		}
+		transfers = append(transfers, transfer)
+	}
+	return transfers, nil
+}
+
+func transferLimitExceeded(limit models.TransferLimit, count int, sent float64, amount float32) bool {
+	if limit.MaxCount > 0 && count+1 > limit.MaxCount {
+		return true
+	}
+	return limit.MaxAmount > 0 && sent+float64(amount) > limit.MaxAmount
+}
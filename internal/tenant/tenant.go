@@ -0,0 +1,78 @@
+// Package tenant carries the loyalty program a request belongs to. Several
+// retail brands share one deployment; their users, orders and withdrawals
+// are kept apart by the tenant id stored in the context, which the storage
+// adds to every query.
+package tenant
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/AndreyKuskov2/gophermart/pkg/jwt"
+)
+
+const (
+	// DefaultID is the tenant of requests that name no tenant. It uses the
+	// top-level accrual system address and jwt token of the configuration.
+	DefaultID = "default"
+
+	// Header names the tenant of an HTTP request.
+	Header = "X-Tenant-ID"
+)
+
+type contextKey struct{}
+
+func WithID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+// FromContext returns the tenant id attached to ctx and whether there is one.
+func FromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(contextKey{}).(string)
+	return id, ok
+}
+
+// ID returns the tenant id attached to ctx or DefaultID.
+func ID(ctx context.Context) string {
+	if id, ok := FromContext(ctx); ok && id != "" {
+		return id
+	}
+	return DefaultID
+}
+
+// OrDefault maps the empty id, e.g. of a token issued before tenants were
+// introduced, to DefaultID.
+func OrDefault(id string) string {
+	if id == "" {
+		return DefaultID
+	}
+	return id
+}
+
+// VerifyToken verifies token with the key of the tenant attached to ctx or,
+// when there is none, of the tenant named by the token, and returns the id of
+// that tenant. secret returns the key of a tenant, empty for unknown ones.
+// A token is only valid for the tenant it was issued by.
+func VerifyToken(ctx context.Context, token string, secret func(id string) string) (string, *jwt.JWTClaims, error) {
+	id, resolved := FromContext(ctx)
+	if !resolved {
+		unverified, err := jwt.ParseUnverified(token)
+		if err != nil {
+			return "", nil, err
+		}
+		id = OrDefault(unverified.Tenant)
+	}
+
+	key := secret(id)
+	if key == "" {
+		return "", nil, fmt.Errorf("unknown tenant %q", id)
+	}
+	claims, err := jwt.VerifyToken(token, key)
+	if err != nil {
+		return "", nil, err
+	}
+	if OrDefault(claims.Tenant) != id {
+		return "", nil, fmt.Errorf("token of tenant %q used for tenant %q", claims.Tenant, id)
+	}
+	return id, claims, nil
+}
@@ -0,0 +1,94 @@
+// Package tier assigns loyalty tiers. A user's tier is the highest one whose
+// minimum is covered by the points the user accrued over a rolling window;
+// the multiplier of the tier scales the accrual of the orders processed
+// while the user holds it.
+package tier
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+const maxNameLength = 32
+
+// Tier is a loyalty tier. Orders of its holders earn Multiplier times their
+// accrual.
+type Tier struct {
+	Name       string  `json:"name" yaml:"name" toml:"name"`
+	MinAccrual float64 `json:"min_accrual" yaml:"min_accrual" toml:"min_accrual"`
+	Multiplier float64 `json:"multiplier" yaml:"multiplier" toml:"multiplier"`
+}
+
+// Defaults are the tiers used when none are configured.
+func Defaults() []Tier {
+	return []Tier{
+		{Name: "bronze", MinAccrual: 0, Multiplier: 1},
+		{Name: "silver", MinAccrual: 1000, Multiplier: 1.1},
+		{Name: "gold", MinAccrual: 5000, Multiplier: 1.25},
+	}
+}
+
+// Validate reports what is wrong with tiers, if anything. Tiers must be
+// ordered by their minimum, starting at 0 so that every user has one.
+func Validate(tiers []Tier) error {
+	if len(tiers) == 0 {
+		return errors.New("at least one tier is required")
+	}
+
+	var errs []error
+	names := map[string]bool{}
+	for i, t := range tiers {
+		switch {
+		case t.Name == "" || len([]rune(t.Name)) > maxNameLength:
+			errs = append(errs, fmt.Errorf("tiers[%d]: name must have 1 to %d characters", i, maxNameLength))
+		case names[t.Name]:
+			errs = append(errs, fmt.Errorf("tiers[%d]: duplicate name %q", i, t.Name))
+		}
+		names[t.Name] = true
+
+		if t.Multiplier < 1 {
+			errs = append(errs, fmt.Errorf("tiers[%d]: multiplier must be at least 1", i))
+		}
+		if i == 0 && t.MinAccrual != 0 {
+			errs = append(errs, fmt.Errorf("tiers[%d]: the first tier must start at 0", i))
+		}
+		if i > 0 && t.MinAccrual <= tiers[i-1].MinAccrual {
+			errs = append(errs, fmt.Errorf("tiers[%d]: min_accrual must be greater than the one of the previous tier", i))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// For returns the tier of a user who accrued accrued points and the next
+// tier, if there is one. tiers must be valid.
+func For(tiers []Tier, accrued float64) (Tier, *Tier) {
+	current := 0
+	for i, t := range tiers {
+		if accrued >= t.MinAccrual {
+			current = i
+		}
+	}
+	if current+1 < len(tiers) {
+		return tiers[current], &tiers[current+1]
+	}
+	return tiers[current], nil
+}
+
+// Find returns the tier called name.
+func Find(tiers []Tier, name string) (Tier, bool) {
+	for _, t := range tiers {
+		if t.Name == name {
+			return t, true
+		}
+	}
+	return Tier{}, false
+}
+
+// Bonus returns what the tier adds to accrual, rounded to cents.
+func Bonus(t Tier, accrual float32) float64 {
+	if t.Multiplier <= 1 {
+		return 0
+	}
+	return math.Round(float64(accrual)*(t.Multiplier-1)*100) / 100
+}
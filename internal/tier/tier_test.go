@@ -0,0 +1,75 @@
+package tier
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate(t *testing.T) {
+	require.NoError(t, Validate(Defaults()))
+
+	tests := []struct {
+		name  string
+		tiers []Tier
+		want  string
+	}{
+		{name: "empty", want: "at least one tier is required"},
+		{name: "first above 0", tiers: []Tier{{Name: "silver", MinAccrual: 10, Multiplier: 1}}, want: "the first tier must start at 0"},
+		{name: "no name", tiers: []Tier{{MinAccrual: 0, Multiplier: 1}}, want: "name must have 1 to 32 characters"},
+		{name: "multiplier below 1", tiers: []Tier{{Name: "bronze", Multiplier: 0.5}}, want: "multiplier must be at least 1"},
+		{
+			name:  "duplicate name",
+			tiers: []Tier{{Name: "bronze", Multiplier: 1}, {Name: "bronze", MinAccrual: 10, Multiplier: 1}},
+			want:  `duplicate name "bronze"`,
+		},
+		{
+			name:  "unordered",
+			tiers: []Tier{{Name: "bronze", Multiplier: 1}, {Name: "gold", MinAccrual: 500, Multiplier: 2}, {Name: "silver", MinAccrual: 100, Multiplier: 1.5}},
+			want:  "tiers[2]: min_accrual must be greater than the one of the previous tier",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := Validate(tt.tiers)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestFor(t *testing.T) {
+	tiers := Defaults()
+
+	current, next := For(tiers, 0)
+	assert.Equal(t, "bronze", current.Name)
+	require.NotNil(t, next)
+	assert.Equal(t, "silver", next.Name)
+
+	current, next = For(tiers, 999.99)
+	assert.Equal(t, "bronze", current.Name)
+	assert.Equal(t, "silver", next.Name)
+
+	current, _ = For(tiers, 1000)
+	assert.Equal(t, "silver", current.Name, "the minimum is inclusive")
+
+	current, next = For(tiers, 1e6)
+	assert.Equal(t, "gold", current.Name)
+	assert.Nil(t, next)
+}
+
+func TestFind(t *testing.T) {
+	gold, ok := Find(Defaults(), "gold")
+	require.True(t, ok)
+	assert.Equal(t, 1.25, gold.Multiplier)
+
+	_, ok = Find(Defaults(), "platinum")
+	assert.False(t, ok)
+}
+
+func TestBonus(t *testing.T) {
+	assert.Equal(t, float64(0), Bonus(Tier{Multiplier: 1}, 100))
+	assert.Equal(t, float64(10), Bonus(Tier{Multiplier: 1.1}, 100))
+	assert.Equal(t, 3.09, Bonus(Tier{Multiplier: 1.25}, 12.34), "rounded to cents")
+}
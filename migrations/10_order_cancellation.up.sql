@@ -0,0 +1,22 @@
+-- What was taken back from the balance of a user when an order that had
+-- earned points was cancelled: its accrual, the bonuses granted for it and
+-- the referral rewards it earned, which also takes back the reward of the
+-- referrer. written_off is the part the negative balance policy let the user
+-- keep. An order is cancelled at most once.
+CREATE TABLE IF NOT EXISTS clawbacks(
+    clawback_id INTEGER PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    user_id INTEGER NOT NULL,
+    order_number VARCHAR(64) NOT NULL,
+    amount FLOAT NOT NULL CHECK (amount >= 0),
+    written_off FLOAT NOT NULL DEFAULT 0 CHECK (written_off >= 0),
+    cancelled_by VARCHAR(32) NOT NULL,
+    reason VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE (tenant_id, order_number, user_id),
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, user_id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id, order_number) REFERENCES orders(tenant_id, number) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS clawbacks_user_id_idx ON clawbacks(tenant_id, user_id, created_at);
@@ -1,3 +1,3 @@
-DROP TABLE IF EXISTS users;
+DROP TABLE IF EXISTS withdrawals;
 DROP TABLE IF EXISTS orders;
-DROP TABLE IF EXISTS withdrawals;
\ No newline at end of file
+DROP TABLE IF EXISTS users;
@@ -0,0 +1,15 @@
+CREATE TABLE IF NOT EXISTS order_status_history(
+    history_id INTEGER PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    order_number VARCHAR(64) NOT NULL,
+    status VARCHAR(32) NOT NULL,
+    accrual FLOAT,
+    raw_response JSONB,
+    changed_at TIMESTAMP DEFAULT NOW(),
+
+    FOREIGN KEY (order_number) REFERENCES orders(number) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS order_status_history_order_number_idx ON order_status_history(order_number);
+
+INSERT INTO order_status_history(order_number, status, accrual, changed_at)
+SELECT number, status, accrual, uploaded_at FROM orders;
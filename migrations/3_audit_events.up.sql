@@ -0,0 +1,26 @@
+CREATE TABLE IF NOT EXISTS audit_events(
+    event_id BIGINT PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    event_type VARCHAR(64) NOT NULL,
+    user_id INTEGER,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    user_agent VARCHAR(512) NOT NULL DEFAULT '',
+    request_id VARCHAR(128) NOT NULL DEFAULT '',
+    -- JSON rather than JSONB keeps the exact text covered by the hash.
+    details JSON,
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash VARCHAR(64) NOT NULL,
+    hash VARCHAR(64) NOT NULL UNIQUE
+);
+
+CREATE INDEX IF NOT EXISTS audit_events_user_id_idx ON audit_events(user_id, event_id);
+CREATE INDEX IF NOT EXISTS audit_events_event_type_idx ON audit_events(event_type, event_id);
+
+CREATE OR REPLACE FUNCTION audit_events_append_only() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_events is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_events_append_only
+    BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_events
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_events_append_only();
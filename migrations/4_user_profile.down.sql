@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS users_deleted_at_idx;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deleted_at,
+    DROP COLUMN IF EXISTS display_name,
+    DROP COLUMN IF EXISTS email;
@@ -0,0 +1,8 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS email VARCHAR(254) NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS display_name VARCHAR(128) NOT NULL DEFAULT '',
+    -- Accounts scheduled for deletion are purged once the grace period
+    -- after deleted_at has passed.
+    ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS users_deleted_at_idx ON users(deleted_at) WHERE deleted_at IS NOT NULL;
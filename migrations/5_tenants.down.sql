@@ -0,0 +1,24 @@
+-- Fails if logins or order numbers are shared by several tenants.
+DROP INDEX IF EXISTS audit_events_tenant_id_idx;
+ALTER TABLE audit_events DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE withdrawals DROP CONSTRAINT IF EXISTS withdrawals_tenant_id_user_id_fkey;
+ALTER TABLE withdrawals DROP COLUMN IF EXISTS tenant_id;
+
+DROP INDEX IF EXISTS order_status_history_tenant_id_order_number_idx;
+ALTER TABLE order_status_history DROP CONSTRAINT IF EXISTS order_status_history_tenant_id_order_number_fkey;
+
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_tenant_id_user_id_fkey;
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_tenant_id_number_key;
+ALTER TABLE orders ADD CONSTRAINT orders_number_key UNIQUE (number);
+ALTER TABLE orders DROP COLUMN IF EXISTS tenant_id;
+
+ALTER TABLE order_status_history DROP COLUMN IF EXISTS tenant_id;
+ALTER TABLE order_status_history ADD CONSTRAINT order_status_history_order_number_fkey
+    FOREIGN KEY (order_number) REFERENCES orders(number) ON DELETE CASCADE;
+CREATE INDEX IF NOT EXISTS order_status_history_order_number_idx ON order_status_history(order_number);
+
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_tenant_id_user_id_key;
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_tenant_id_login_key;
+ALTER TABLE users ADD CONSTRAINT users_login_key UNIQUE (login);
+ALTER TABLE users DROP COLUMN IF EXISTS tenant_id;
@@ -0,0 +1,30 @@
+-- Users, orders and withdrawals belong to a tenant, one loyalty program of
+-- the deployment. Rows created before tenants existed belong to the default
+-- tenant. Logins and order numbers are only unique within a tenant.
+ALTER TABLE users ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE users DROP CONSTRAINT IF EXISTS users_login_key;
+ALTER TABLE users ADD CONSTRAINT users_tenant_id_login_key UNIQUE (tenant_id, login);
+ALTER TABLE users ADD CONSTRAINT users_tenant_id_user_id_key UNIQUE (tenant_id, user_id);
+
+ALTER TABLE order_status_history DROP CONSTRAINT IF EXISTS order_status_history_order_number_fkey;
+ALTER TABLE order_status_history ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+
+ALTER TABLE orders ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE orders DROP CONSTRAINT IF EXISTS orders_number_key;
+ALTER TABLE orders ADD CONSTRAINT orders_tenant_id_number_key UNIQUE (tenant_id, number);
+-- An order can only belong to a user of its own tenant.
+ALTER TABLE orders ADD CONSTRAINT orders_tenant_id_user_id_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, user_id) ON DELETE CASCADE;
+
+ALTER TABLE order_status_history ADD CONSTRAINT order_status_history_tenant_id_order_number_fkey
+    FOREIGN KEY (tenant_id, order_number) REFERENCES orders(tenant_id, number) ON DELETE CASCADE;
+DROP INDEX IF EXISTS order_status_history_order_number_idx;
+CREATE INDEX IF NOT EXISTS order_status_history_tenant_id_order_number_idx ON order_status_history(tenant_id, order_number);
+
+ALTER TABLE withdrawals ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+ALTER TABLE withdrawals ADD CONSTRAINT withdrawals_tenant_id_user_id_fkey
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, user_id) ON DELETE CASCADE;
+
+-- Adding a column does not fire the append-only trigger.
+ALTER TABLE audit_events ADD COLUMN IF NOT EXISTS tenant_id VARCHAR(64) NOT NULL DEFAULT 'default';
+CREATE INDEX IF NOT EXISTS audit_events_tenant_id_idx ON audit_events(tenant_id, event_id);
@@ -0,0 +1,17 @@
+-- Points gifted by one user to another of the same tenant. Transfers have no
+-- foreign keys to users: they outlive purged accounts so that the points a
+-- purged user gave away stay with their recipients.
+CREATE TABLE IF NOT EXISTS transfers(
+    transfer_id INTEGER PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    sender_id INTEGER NOT NULL,
+    recipient_id INTEGER NOT NULL,
+    amount FLOAT NOT NULL CHECK (amount > 0),
+    memo VARCHAR(200) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    CHECK (sender_id <> recipient_id)
+);
+
+CREATE INDEX IF NOT EXISTS transfers_sender_id_idx ON transfers(tenant_id, sender_id, created_at);
+CREATE INDEX IF NOT EXISTS transfers_recipient_id_idx ON transfers(tenant_id, recipient_id, created_at);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS bonuses;
+DROP TABLE IF EXISTS campaigns;
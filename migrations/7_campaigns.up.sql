@@ -0,0 +1,34 @@
+-- Local bonus campaigns of a tenant. The rule is evaluated by the campaign
+-- package; bonuses granted by a campaign are kept apart from the accruals of
+-- the accrual system.
+CREATE TABLE IF NOT EXISTS campaigns(
+    campaign_id INTEGER PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    name VARCHAR(128) NOT NULL,
+    rule JSONB NOT NULL,
+    monthly_cap FLOAT NOT NULL DEFAULT 0 CHECK (monthly_cap >= 0),
+    starts_at TIMESTAMPTZ NOT NULL,
+    ends_at TIMESTAMPTZ,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS campaigns_tenant_id_idx ON campaigns(tenant_id, campaign_id);
+
+-- A campaign grants at most one bonus per order. Bonuses go away with their
+-- order and stay when their campaign is deleted.
+CREATE TABLE IF NOT EXISTS bonuses(
+    bonus_id INTEGER PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    user_id INTEGER NOT NULL,
+    order_number VARCHAR(64) NOT NULL,
+    campaign_id INTEGER REFERENCES campaigns(campaign_id) ON DELETE SET NULL,
+    amount FLOAT NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    UNIQUE (tenant_id, order_number, campaign_id),
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, user_id) ON DELETE CASCADE,
+    FOREIGN KEY (tenant_id, order_number) REFERENCES orders(tenant_id, number) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS bonuses_user_id_idx ON bonuses(tenant_id, user_id, campaign_id, created_at);
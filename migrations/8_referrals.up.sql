@@ -0,0 +1,37 @@
+-- Referral codes are created on demand and go away with their user. The ip
+-- is the address the code was created from and is compared with the
+-- addresses of the referred users.
+CREATE TABLE IF NOT EXISTS referral_codes(
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    user_id INTEGER NOT NULL,
+    code VARCHAR(16) NOT NULL,
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (tenant_id, user_id),
+    UNIQUE (tenant_id, code),
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, user_id) ON DELETE CASCADE
+);
+
+-- A user is referred at most once. Like transfers, referrals have no foreign
+-- keys to users so that the rewards of a purged user's referral stay with
+-- the other party.
+CREATE TABLE IF NOT EXISTS referrals(
+    referral_id INTEGER PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    referrer_id INTEGER NOT NULL,
+    referee_id INTEGER NOT NULL,
+    status VARCHAR(16) NOT NULL,
+    reason VARCHAR(64) NOT NULL DEFAULT '',
+    ip VARCHAR(64) NOT NULL DEFAULT '',
+    order_number VARCHAR(64) NOT NULL DEFAULT '',
+    referrer_bonus FLOAT NOT NULL DEFAULT 0 CHECK (referrer_bonus >= 0),
+    referee_bonus FLOAT NOT NULL DEFAULT 0 CHECK (referee_bonus >= 0),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    rewarded_at TIMESTAMPTZ,
+
+    UNIQUE (tenant_id, referee_id),
+    CHECK (referrer_id <> referee_id)
+);
+
+CREATE INDEX IF NOT EXISTS referrals_referrer_id_idx ON referrals(tenant_id, referrer_id, created_at);
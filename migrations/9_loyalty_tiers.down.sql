@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS bonuses_tier_order_number_key;
+ALTER TABLE bonuses DROP COLUMN IF EXISTS tier;
+DROP TABLE IF EXISTS tier_history;
+DROP TABLE IF EXISTS user_tiers;
@@ -0,0 +1,30 @@
+-- The loyalty tier of a user as of the last recalculation and the points
+-- the user accrued over the rolling window then. Both go away with the user.
+CREATE TABLE IF NOT EXISTS user_tiers(
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    user_id INTEGER NOT NULL,
+    tier VARCHAR(32) NOT NULL,
+    accrued FLOAT NOT NULL DEFAULT 0,
+    updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    PRIMARY KEY (tenant_id, user_id),
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, user_id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS tier_history(
+    history_id INTEGER PRIMARY KEY GENERATED BY DEFAULT AS IDENTITY,
+    tenant_id VARCHAR(64) NOT NULL DEFAULT 'default',
+    user_id INTEGER NOT NULL,
+    from_tier VARCHAR(32) NOT NULL DEFAULT '',
+    to_tier VARCHAR(32) NOT NULL,
+    accrued FLOAT NOT NULL DEFAULT 0,
+    changed_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+
+    FOREIGN KEY (tenant_id, user_id) REFERENCES users(tenant_id, user_id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS tier_history_user_id_idx ON tier_history(tenant_id, user_id, changed_at);
+
+-- Tier bonuses are bonuses without a campaign; an order gets at most one.
+ALTER TABLE bonuses ADD COLUMN IF NOT EXISTS tier VARCHAR(32) NOT NULL DEFAULT '';
+CREATE UNIQUE INDEX IF NOT EXISTS bonuses_tier_order_number_key ON bonuses(tenant_id, order_number) WHERE tier <> '';
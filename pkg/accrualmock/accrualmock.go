@@ -0,0 +1,172 @@
+package accrualmock
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi"
+)
+
+const (
+	StatusRegistered = "REGISTERED"
+	StatusInvalid    = "INVALID"
+	StatusProcessing = "PROCESSING"
+	StatusProcessed  = "PROCESSED"
+)
+
+// Step describes a single response of the mock. Every request for an order
+// consumes the next step of its script; the last step is repeated forever.
+type Step struct {
+	Status     string
+	Accrual    float32
+	NoContent  bool
+	RetryAfter int
+	HTTPStatus int
+	Delay      time.Duration
+}
+
+func Registered() Step {
+	return Step{Status: StatusRegistered}
+}
+
+func Invalid() Step {
+	return Step{Status: StatusInvalid}
+}
+
+func Processing() Step {
+	return Step{Status: StatusProcessing}
+}
+
+func Processed(accrual float32) Step {
+	return Step{Status: StatusProcessed, Accrual: accrual}
+}
+
+func NoContent() Step {
+	return Step{NoContent: true}
+}
+
+func TooManyRequests(retryAfter int) Step {
+	return Step{RetryAfter: retryAfter}
+}
+
+func Fault(httpStatus int) Step {
+	return Step{HTTPStatus: httpStatus}
+}
+
+func (s Step) WithDelay(delay time.Duration) Step {
+	s.Delay = delay
+	return s
+}
+
+type orderResponse struct {
+	Order   string  `json:"order"`
+	Status  string  `json:"status"`
+	Accrual float32 `json:"accrual,omitempty"`
+}
+
+type Server struct {
+	mu       sync.Mutex
+	scripts  map[string][]Step
+	defaults []Step
+	calls    map[string]int
+	latency  time.Duration
+	router   chi.Router
+}
+
+func New() *Server {
+	s := &Server{
+		scripts: make(map[string][]Step),
+		calls:   make(map[string]int),
+		router:  chi.NewRouter(),
+	}
+	s.router.Get("/api/orders/{number}", s.orderHandler)
+	return s
+}
+
+// Script sets the responses for an order number and resets its call counter.
+func (s *Server) Script(orderNumber string, steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.scripts[orderNumber] = steps
+	s.calls[orderNumber] = 0
+}
+
+// Default sets the responses for orders without their own script.
+// Without a default script unknown orders get 204 No Content.
+func (s *Server) Default(steps ...Step) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.defaults = steps
+}
+
+// SetLatency delays every response in addition to per-step delays.
+func (s *Server) SetLatency(latency time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.latency = latency
+}
+
+func (s *Server) Calls(orderNumber string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.calls[orderNumber]
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.router.ServeHTTP(w, r)
+}
+
+func (s *Server) next(orderNumber string) (Step, time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	steps, ok := s.scripts[orderNumber]
+	if !ok {
+		steps = s.defaults
+	}
+	call := s.calls[orderNumber]
+	s.calls[orderNumber]++
+
+	if len(steps) == 0 {
+		return NoContent(), s.latency
+	}
+	if call >= len(steps) {
+		call = len(steps) - 1
+	}
+	return steps[call], s.latency
+}
+
+func (s *Server) orderHandler(w http.ResponseWriter, r *http.Request) {
+	orderNumber := chi.URLParam(r, "number")
+	step, latency := s.next(orderNumber)
+
+	select {
+	case <-r.Context().Done():
+		return
+	case <-time.After(latency + step.Delay):
+	}
+
+	switch {
+	case step.HTTPStatus != 0:
+		http.Error(w, http.StatusText(step.HTTPStatus), step.HTTPStatus)
+	case step.RetryAfter > 0:
+		w.Header().Set("Retry-After", strconv.Itoa(step.RetryAfter))
+		http.Error(w, "No more than N requests per minute allowed", http.StatusTooManyRequests)
+	case step.NoContent || step.Status == "":
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(orderResponse{
+			Order:   orderNumber,
+			Status:  step.Status,
+			Accrual: step.Accrual,
+		})
+	}
+}
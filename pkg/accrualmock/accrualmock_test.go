@@ -0,0 +1,115 @@
+package accrualmock
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func get(t *testing.T, server *Server, orderNumber string) *http.Response {
+	t.Helper()
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/orders/"+orderNumber, nil))
+	return w.Result()
+}
+
+func decode(t *testing.T, resp *http.Response) orderResponse {
+	t.Helper()
+	defer resp.Body.Close()
+	var body orderResponse
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	return body
+}
+
+func TestServer_Progression(t *testing.T) {
+	server := New()
+	server.Script("79927398713", Registered(), Processing(), Processed(500))
+
+	expected := []string{StatusRegistered, StatusProcessing, StatusProcessed, StatusProcessed}
+	for _, status := range expected {
+		resp := get(t, server, "79927398713")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		body := decode(t, resp)
+		assert.Equal(t, "79927398713", body.Order)
+		assert.Equal(t, status, body.Status)
+	}
+
+	body := decode(t, get(t, server, "79927398713"))
+	assert.Equal(t, float32(500), body.Accrual)
+	assert.Equal(t, 5, server.Calls("79927398713"))
+}
+
+func TestServer_UnknownOrder(t *testing.T) {
+	server := New()
+
+	resp := get(t, server, "79927398713")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	server.Default(Invalid())
+	body := decode(t, get(t, server, "79927398713"))
+	assert.Equal(t, StatusInvalid, body.Status)
+}
+
+func TestServer_TooManyRequests(t *testing.T) {
+	server := New()
+	server.Script("79927398713", TooManyRequests(60), NoContent())
+
+	resp := get(t, server, "79927398713")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	assert.Equal(t, "60", resp.Header.Get("Retry-After"))
+
+	resp = get(t, server, "79927398713")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+}
+
+func TestServer_Fault(t *testing.T) {
+	server := New()
+	server.Script("79927398713", Fault(http.StatusBadGateway))
+
+	resp := get(t, server, "79927398713")
+	resp.Body.Close()
+	assert.Equal(t, http.StatusBadGateway, resp.StatusCode)
+}
+
+func TestServer_Latency(t *testing.T) {
+	server := New()
+	server.SetLatency(20 * time.Millisecond)
+	server.Script("79927398713", Processing().WithDelay(30*time.Millisecond))
+
+	start := time.Now()
+	resp := get(t, server, "79927398713")
+	resp.Body.Close()
+	assert.GreaterOrEqual(t, time.Since(start), 50*time.Millisecond)
+}
+
+func TestServer_LoadScript(t *testing.T) {
+	server := New()
+	err := server.LoadScript(strings.NewReader(`{
+		"default": [{"status": "PROCESSED", "accrual": 10}],
+		"orders": {
+			"79927398713": [{"retry_after": 5}, {"http_status": 500, "delay": "1ms"}, {"no_content": true}]
+		}
+	}`))
+	require.NoError(t, err)
+
+	assert.Equal(t, float32(10), decode(t, get(t, server, "12345678903")).Accrual)
+
+	codes := []int{http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusNoContent}
+	for _, code := range codes {
+		resp := get(t, server, "79927398713")
+		resp.Body.Close()
+		assert.Equal(t, code, resp.StatusCode)
+	}
+
+	err = server.LoadScript(strings.NewReader(`{"orders": {"1": [{"delay": "soon"}]}}`))
+	assert.Error(t, err)
+}
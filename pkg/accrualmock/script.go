@@ -0,0 +1,76 @@
+package accrualmock
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+type stepConfig struct {
+	Status     string  `json:"status"`
+	Accrual    float32 `json:"accrual"`
+	NoContent  bool    `json:"no_content"`
+	RetryAfter int     `json:"retry_after"`
+	HTTPStatus int     `json:"http_status"`
+	Delay      string  `json:"delay"`
+}
+
+type scriptConfig struct {
+	Default []stepConfig            `json:"default"`
+	Orders  map[string][]stepConfig `json:"orders"`
+}
+
+// LoadScript reads scripts in JSON format:
+//
+//	{
+//	  "default": [{"status": "PROCESSING"}, {"status": "PROCESSED", "accrual": 100}],
+//	  "orders": {
+//	    "79927398713": [{"retry_after": 1}, {"http_status": 500, "delay": "2s"}, {"status": "INVALID"}]
+//	  }
+//	}
+func (s *Server) LoadScript(r io.Reader) error {
+	var cfg scriptConfig
+	if err := json.NewDecoder(r).Decode(&cfg); err != nil {
+		return fmt.Errorf("cannot decode script: %v", err)
+	}
+
+	if len(cfg.Default) > 0 {
+		defaults, err := parseSteps(cfg.Default)
+		if err != nil {
+			return err
+		}
+		s.Default(defaults...)
+	}
+
+	for orderNumber, stepConfigs := range cfg.Orders {
+		steps, err := parseSteps(stepConfigs)
+		if err != nil {
+			return fmt.Errorf("order %v: %v", orderNumber, err)
+		}
+		s.Script(orderNumber, steps...)
+	}
+	return nil
+}
+
+func parseSteps(configs []stepConfig) ([]Step, error) {
+	steps := make([]Step, 0, len(configs))
+	for _, cfg := range configs {
+		step := Step{
+			Status:     cfg.Status,
+			Accrual:    cfg.Accrual,
+			NoContent:  cfg.NoContent,
+			RetryAfter: cfg.RetryAfter,
+			HTTPStatus: cfg.HTTPStatus,
+		}
+		if cfg.Delay != "" {
+			delay, err := time.ParseDuration(cfg.Delay)
+			if err != nil {
+				return nil, fmt.Errorf("invalid delay %q: %v", cfg.Delay, err)
+			}
+			step.Delay = delay
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
@@ -0,0 +1,246 @@
+package gophermartclient
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// Client is a typed client of the gophermart HTTP API. After Register or
+// Login it keeps the token and the credentials, and logs in again once when
+// a request is rejected with 401.
+type Client struct {
+	baseURL    string
+	httpClient *http.Client
+
+	mu          sync.Mutex
+	token       string
+	credentials *credentials
+}
+
+type Option func(*Client)
+
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) {
+		c.httpClient = httpClient
+	}
+}
+
+func New(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:    strings.TrimSuffix(baseURL, "/"),
+		httpClient: http.DefaultClient,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+func (c *Client) Token() string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token
+}
+
+// SetToken sets a token obtained elsewhere. Without credentials the client
+// cannot log in again when the token expires.
+func (c *Client) SetToken(token string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.token = token
+}
+
+func (c *Client) Register(ctx context.Context, login, password string) error {
+	return c.authenticate(ctx, "register", "/api/user/register", login, password, map[int]error{
+		http.StatusConflict: ErrLoginTaken,
+	})
+}
+
+func (c *Client) Login(ctx context.Context, login, password string) error {
+	return c.authenticate(ctx, "login", "/api/user/login", login, password, map[int]error{
+		http.StatusUnauthorized: ErrUnauthorized,
+	})
+}
+
+// UploadOrder uploads an order number. It reports whether the order was
+// accepted now (true) or had already been uploaded by this user (false).
+func (c *Client) UploadOrder(ctx context.Context, number string) (bool, error) {
+	response, err := c.do(ctx, http.MethodPost, "/api/user/orders", "text/plain", []byte(number))
+	if err != nil {
+		return false, err
+	}
+
+	switch response.statusCode {
+	case http.StatusAccepted:
+		return true, nil
+	case http.StatusOK:
+		return false, nil
+	default:
+		return false, newAPIError("upload order", response.statusCode, response.body, map[int]error{
+			http.StatusConflict:            ErrOrderOwnedByAnotherUser,
+			http.StatusUnprocessableEntity: ErrInvalidOrderNumber,
+		})
+	}
+}
+
+func (c *Client) Orders(ctx context.Context) ([]Order, error) {
+	var orders []Order
+	if err := c.get(ctx, "list orders", "/api/user/orders", &orders, true); err != nil {
+		return nil, err
+	}
+	return orders, nil
+}
+
+func (c *Client) Order(ctx context.Context, number string) (*OrderDetails, error) {
+	var order OrderDetails
+	if err := c.get(ctx, "get order", "/api/user/orders/"+url.PathEscape(number), &order, false); err != nil {
+		return nil, err
+	}
+	return &order, nil
+}
+
+func (c *Client) Balance(ctx context.Context) (*Balance, error) {
+	var balance Balance
+	if err := c.get(ctx, "get balance", "/api/user/balance", &balance, false); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+func (c *Client) Withdraw(ctx context.Context, order string, sum float64) error {
+	body, err := json.Marshal(withdrawRequest{Order: order, Sum: sum})
+	if err != nil {
+		return err
+	}
+
+	response, err := c.do(ctx, http.MethodPost, "/api/user/balance/withdraw", "application/json", body)
+	if err != nil {
+		return err
+	}
+	if response.statusCode != http.StatusOK {
+		return newAPIError("withdraw", response.statusCode, response.body, map[int]error{
+			http.StatusPaymentRequired:     ErrInsufficientFunds,
+			http.StatusUnprocessableEntity: ErrInvalidOrderNumber,
+		})
+	}
+	return nil
+}
+
+func (c *Client) Withdrawals(ctx context.Context) ([]Withdrawal, error) {
+	var withdrawals []Withdrawal
+	if err := c.get(ctx, "list withdrawals", "/api/user/withdrawals", &withdrawals, true); err != nil {
+		return nil, err
+	}
+	return withdrawals, nil
+}
+
+type response struct {
+	statusCode int
+	header     http.Header
+	body       []byte
+}
+
+func (c *Client) authenticate(ctx context.Context, operation, path, login, password string, operationErrors map[int]error) error {
+	creds := &credentials{Login: login, Password: password}
+	body, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+
+	response, err := c.send(ctx, http.MethodPost, path, "application/json", body, "")
+	if err != nil {
+		return err
+	}
+	if response.statusCode != http.StatusOK {
+		return newAPIError(operation, response.statusCode, response.body, operationErrors)
+	}
+
+	token := response.header.Get("Authorization")
+	if token == "" {
+		return fmt.Errorf("%s: no token in response", operation)
+	}
+
+	c.mu.Lock()
+	c.token = token
+	c.credentials = creds
+	c.mu.Unlock()
+	return nil
+}
+
+// get decodes a 200 response into target. Lists are answered with 204 when
+// empty, so for them 204 leaves target untouched.
+func (c *Client) get(ctx context.Context, operation, path string, target any, isList bool) error {
+	response, err := c.do(ctx, http.MethodGet, path, "", nil)
+	if err != nil {
+		return err
+	}
+	if isList && response.statusCode == http.StatusNoContent {
+		return nil
+	}
+	if response.statusCode != http.StatusOK {
+		return newAPIError(operation, response.statusCode, response.body, nil)
+	}
+	if err := json.Unmarshal(response.body, target); err != nil {
+		return fmt.Errorf("%s: cannot decode response: %w", operation, err)
+	}
+	return nil
+}
+
+// do sends an authorized request and logs in again once on 401.
+func (c *Client) do(ctx context.Context, method, path, contentType string, body []byte) (*response, error) {
+	c.mu.Lock()
+	token, creds := c.token, c.credentials
+	c.mu.Unlock()
+
+	response, err := c.send(ctx, method, path, contentType, body, token)
+	if err != nil || response.statusCode != http.StatusUnauthorized || creds == nil {
+		return response, err
+	}
+
+	if err := c.Login(ctx, creds.Login, creds.Password); err != nil {
+		return nil, err
+	}
+	return c.send(ctx, method, path, contentType, body, c.Token())
+}
+
+func (c *Client) send(ctx context.Context, method, path, contentType string, body []byte, token string) (*response, error) {
+	var reader io.Reader
+	if body != nil {
+		reader = bytes.NewReader(body)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, reader)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		request.Header.Set("Content-Type", contentType)
+	}
+	if token != "" {
+		request.Header.Set("Authorization", token)
+	}
+
+	httpResponse, err := c.httpClient.Do(request)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResponse.Body.Close()
+
+	responseBody, err := io.ReadAll(httpResponse.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return &response{
+		statusCode: httpResponse.StatusCode,
+		header:     httpResponse.Header,
+		body:       responseBody,
+	}, nil
+}
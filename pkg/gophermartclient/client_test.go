@@ -0,0 +1,138 @@
+package gophermartclient
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndreyKuskov2/gophermart/internal/integration"
+	"github.com/AndreyKuskov2/gophermart/pkg/accrualmock"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClient_FullFlow(t *testing.T) {
+	h := integration.NewMemory(t)
+	ctx := context.Background()
+	client := New(h.URL)
+
+	require.NoError(t, client.Register(ctx, "alice", "secret"))
+	assert.NotEmpty(t, client.Token())
+
+	orders, err := client.Orders(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, orders)
+
+	h.Accrual.Script("79927398713", accrualmock.Processing(), accrualmock.Processed(500))
+
+	created, err := client.UploadOrder(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.True(t, created)
+
+	created, err = client.UploadOrder(ctx, "79927398713")
+	require.NoError(t, err)
+	assert.False(t, created)
+
+	_, err = client.UploadOrder(ctx, "79927398710")
+	assert.ErrorIs(t, err, ErrInvalidOrderNumber)
+
+	h.ProcessAccruals()
+	h.ProcessAccruals()
+
+	orders, err = client.Orders(ctx)
+	require.NoError(t, err)
+	require.Len(t, orders, 1)
+	assert.Equal(t, "PROCESSED", orders[0].Status)
+	assert.Equal(t, float64(500), orders[0].Accrual)
+
+	order, err := client.Order(ctx, "79927398713")
+	require.NoError(t, err)
+	require.Len(t, order.History, 3)
+	assert.Equal(t, "PROCESSING", order.History[1].Status)
+
+	_, err = client.Order(ctx, "12345678903")
+	assert.ErrorIs(t, err, ErrNotFound)
+
+	err = client.Withdraw(ctx, "2377225624", 1000)
+	assert.ErrorIs(t, err, ErrInsufficientFunds)
+
+	err = client.Withdraw(ctx, "2377225625", 10)
+	assert.ErrorIs(t, err, ErrInvalidOrderNumber)
+
+	require.NoError(t, client.Withdraw(ctx, "2377225624", 100))
+
+	balance, err := client.Balance(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, float64(400), balance.Current)
+	assert.Equal(t, float64(100), balance.Withdrawn)
+
+	withdrawals, err := client.Withdrawals(ctx)
+	require.NoError(t, err)
+	require.Len(t, withdrawals, 1)
+	assert.Equal(t, "2377225624", withdrawals[0].Order)
+	assert.Equal(t, float64(100), withdrawals[0].Sum)
+	assert.False(t, withdrawals[0].ProcessedAt.IsZero())
+}
+
+func TestClient_Errors(t *testing.T) {
+	h := integration.NewMemory(t)
+	ctx := context.Background()
+
+	alice := New(h.URL)
+	require.NoError(t, alice.Register(ctx, "alice", "secret"))
+	_, err := alice.UploadOrder(ctx, "79927398713")
+	require.NoError(t, err)
+
+	err = New(h.URL).Register(ctx, "alice", "other")
+	assert.ErrorIs(t, err, ErrLoginTaken)
+
+	var apiErr *APIError
+	require.True(t, errors.As(err, &apiErr))
+	assert.Equal(t, http.StatusConflict, apiErr.StatusCode)
+	assert.Equal(t, "register", apiErr.Operation)
+
+	err = New(h.URL).Login(ctx, "alice", "wrong")
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	err = New(h.URL).Register(ctx, "", "secret")
+	assert.ErrorIs(t, err, ErrBadRequest)
+
+	_, err = New(h.URL).Balance(ctx)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+
+	bob := New(h.URL)
+	require.NoError(t, bob.Register(ctx, "bob", "secret"))
+	_, err = bob.UploadOrder(ctx, "79927398713")
+	assert.ErrorIs(t, err, ErrOrderOwnedByAnotherUser)
+}
+
+func TestClient_ReloginOnUnauthorized(t *testing.T) {
+	h := integration.NewMemory(t)
+	ctx := context.Background()
+
+	client := New(h.URL)
+	require.NoError(t, client.Register(ctx, "alice", "secret"))
+
+	client.SetToken("expired")
+	balance, err := client.Balance(ctx)
+	require.NoError(t, err)
+	assert.Zero(t, balance.Current)
+	assert.NotEqual(t, "expired", client.Token())
+
+	anonymous := New(h.URL)
+	anonymous.SetToken("expired")
+	_, err = anonymous.Balance(ctx)
+	assert.ErrorIs(t, err, ErrUnauthorized)
+}
+
+func TestClient_ServerError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	_, err := New(server.URL).Balance(context.Background())
+	assert.ErrorIs(t, err, ErrServer)
+}
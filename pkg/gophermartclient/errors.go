@@ -0,0 +1,62 @@
+package gophermartclient
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+var (
+	ErrBadRequest               = errors.New("bad request")
+	ErrUnauthorized             = errors.New("unauthorized")
+	ErrLoginTaken               = errors.New("login is already taken")
+	ErrOrderOwnedByAnotherUser  = errors.New("order was uploaded by another user")
+	ErrInvalidOrderNumber       = errors.New("invalid order number")
+	ErrInsufficientFunds        = errors.New("insufficient funds")
+	ErrNotFound                 = errors.New("not found")
+	ErrServer                   = errors.New("server error")
+	ErrUnexpectedResponseStatus = errors.New("unexpected response status")
+)
+
+// APIError is returned for every response with an unexpected status code.
+// It wraps one of the Err* sentinels, so callers can use errors.Is.
+type APIError struct {
+	Operation  string
+	StatusCode int
+	Body       string
+	err        error
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s: %d %s: %v", e.Operation, e.StatusCode, http.StatusText(e.StatusCode), e.err)
+}
+
+func (e *APIError) Unwrap() error {
+	return e.err
+}
+
+var commonErrors = map[int]error{
+	http.StatusBadRequest:   ErrBadRequest,
+	http.StatusUnauthorized: ErrUnauthorized,
+	http.StatusNotFound:     ErrNotFound,
+}
+
+func newAPIError(operation string, statusCode int, body []byte, operationErrors map[int]error) *APIError {
+	err, ok := operationErrors[statusCode]
+	if !ok {
+		err, ok = commonErrors[statusCode]
+	}
+	if !ok {
+		err = ErrUnexpectedResponseStatus
+		if statusCode >= http.StatusInternalServerError {
+			err = ErrServer
+		}
+	}
+
+	return &APIError{
+		Operation:  operation,
+		StatusCode: statusCode,
+		Body:       string(body),
+		err:        err,
+	}
+}
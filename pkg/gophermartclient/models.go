@@ -0,0 +1,46 @@
+package gophermartclient
+
+import (
+	"encoding/json"
+	"time"
+)
+
+type Order struct {
+	Number     string    `json:"number"`
+	Status     string    `json:"status"`
+	Accrual    float64   `json:"accrual,omitempty"`
+	UploadedAt time.Time `json:"uploaded_at"`
+}
+
+type OrderStatusChange struct {
+	Status      string          `json:"status"`
+	Accrual     *float64        `json:"accrual,omitempty"`
+	RawResponse json.RawMessage `json:"raw_response,omitempty"`
+	ChangedAt   time.Time       `json:"changed_at"`
+}
+
+type OrderDetails struct {
+	Order
+	History []OrderStatusChange `json:"history"`
+}
+
+type Balance struct {
+	Current   float64 `json:"current"`
+	Withdrawn float64 `json:"withdrawn"`
+}
+
+type Withdrawal struct {
+	Order       string    `json:"order"`
+	Sum         float64   `json:"sum"`
+	ProcessedAt time.Time `json:"processed_at"`
+}
+
+type credentials struct {
+	Login    string `json:"login"`
+	Password string `json:"password"`
+}
+
+type withdrawRequest struct {
+	Order string  `json:"order"`
+	Sum   float64 `json:"sum"`
+}
@@ -11,6 +11,8 @@ import (
 
 type JWTClaims struct {
 	jwtlib.RegisteredClaims
+	// Tenant is the loyalty program that issued the token.
+	Tenant string `json:"tenant,omitempty"`
 }
 
 func VerifyToken(tokenString, secretKey string) (*JWTClaims, error) {
@@ -33,6 +35,16 @@ func VerifyToken(tokenString, secretKey string) (*JWTClaims, error) {
 	return claims, nil
 }
 
+// ParseUnverified reads the claims of tokenString without checking its
+// signature, e.g. to find the key it has to be verified with.
+func ParseUnverified(tokenString string) (*JWTClaims, error) {
+	claims := &JWTClaims{}
+	if _, _, err := jwtlib.NewParser().ParseUnverified(tokenString, claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
 func GetJwtClaims(r *http.Request) (*JWTClaims, error) {
 	claims, ok := r.Context().Value("claims").(*JWTClaims)
 	if !ok {
@@ -42,11 +54,16 @@ func GetJwtClaims(r *http.Request) (*JWTClaims, error) {
 }
 
 func CreateJwtToken(JwtSecretToken string, userID int) (string, error) {
+	return CreateTenantJwtToken(JwtSecretToken, userID, "")
+}
+
+func CreateTenantJwtToken(JwtSecretToken string, userID int, tenant string) (string, error) {
 	claims := JWTClaims{
-		jwtlib.RegisteredClaims{
+		RegisteredClaims: jwtlib.RegisteredClaims{
 			ExpiresAt: jwtlib.NewNumericDate(time.Now().Add(time.Duration(3600 * time.Second))),
 			Subject:   strconv.Itoa(userID),
 		},
+		Tenant: tenant,
 	}
 	token := jwtlib.NewWithClaims(jwtlib.SigningMethodHS256, claims)
 	t, err := token.SignedString([]byte(JwtSecretToken))
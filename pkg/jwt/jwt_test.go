@@ -103,9 +103,36 @@ func TestVerifyToken(t *testing.T) {
 	}
 }
 
+func TestCreateTenantJwtToken(t *testing.T) {
+	token, err := CreateTenantJwtToken(testSecretKey, 7, "acme")
+	if err != nil {
+		t.Fatalf("CreateTenantJwtToken failed: %v", err)
+	}
+
+	unverified, err := ParseUnverified(token)
+	if err != nil {
+		t.Fatalf("ParseUnverified failed: %v", err)
+	}
+	if unverified.Tenant != "acme" {
+		t.Errorf("Expected tenant 'acme', got '%s'", unverified.Tenant)
+	}
+
+	claims, err := VerifyToken(token, testSecretKey)
+	if err != nil {
+		t.Fatalf("VerifyToken failed: %v", err)
+	}
+	if claims.Tenant != "acme" || claims.Subject != "7" {
+		t.Errorf("Unexpected claims: tenant '%s', subject '%s'", claims.Tenant, claims.Subject)
+	}
+
+	if _, err := ParseUnverified("invalid.token.here"); err == nil {
+		t.Fatal("ParseUnverified should fail with malformed token")
+	}
+}
+
 func TestVerifyTokenWithExpiredToken(t *testing.T) {
 	claims := JWTClaims{
-		jwtlib.RegisteredClaims{
+		RegisteredClaims: jwtlib.RegisteredClaims{
 			ExpiresAt: jwtlib.NewNumericDate(time.Now().Add(-time.Second)),
 			Subject:   "123",
 		},
@@ -124,7 +151,7 @@ func TestVerifyTokenWithExpiredToken(t *testing.T) {
 
 func TestGetJwtClaims(t *testing.T) {
 	testClaims := &JWTClaims{
-		jwtlib.RegisteredClaims{
+		RegisteredClaims: jwtlib.RegisteredClaims{
 			Subject: "789",
 		},
 	}
@@ -172,7 +199,7 @@ func TestGetJwtClaims(t *testing.T) {
 
 func TestJWTClaimsStruct(t *testing.T) {
 	claims := &JWTClaims{
-		jwtlib.RegisteredClaims{
+		RegisteredClaims: jwtlib.RegisteredClaims{
 			Subject:   "test-subject",
 			ExpiresAt: jwtlib.NewNumericDate(time.Now().Add(time.Hour)),
 		},
@@ -1,30 +1,156 @@
 package logger
 
 import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	EncodingJSON    = "json"
+	EncodingConsole = "console"
+
+	OutputStdout = "stdout"
+	OutputStderr = "stderr"
 )
 
 type Logger struct {
-	Log *zap.Logger
+	Log   *zap.Logger
+	Level zap.AtomicLevel
+}
+
+// Sampling limits repeated messages: within every second the first Initial
+// entries with the same level and message are logged, then every
+// Thereafter-th one. Zero Initial disables sampling.
+type Sampling struct {
+	Initial    int
+	Thereafter int
+}
+
+// Rotation configures rotation of file outputs. Zero MaxSizeMB disables
+// rotation.
+type Rotation struct {
+	MaxSizeMB  int
+	MaxBackups int
+	MaxAgeDays int
+	Compress   bool
+}
+
+type Options struct {
+	Level    string
+	Encoding string
+	// Outputs are stdout, stderr or file paths.
+	Outputs  []string
+	Sampling Sampling
+	Rotation Rotation
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Level:    "info",
+		Encoding: EncodingJSON,
+		Outputs:  []string{OutputStdout},
+	}
 }
 
 func NewLogger() (*Logger, error) {
-	config := zap.Config{
-		Level:            zap.NewAtomicLevelAt(zap.InfoLevel),
-		Development:      false,
-		Encoding:         "json",
-		EncoderConfig:    zap.NewProductionEncoderConfig(),
-		OutputPaths:      []string{"stdout", "logfile"},
-		ErrorOutputPaths: []string{"stderr"},
+	return New(DefaultOptions())
+}
+
+func New(opts Options) (*Logger, error) {
+	level := zap.NewAtomicLevel()
+	if err := level.UnmarshalText([]byte(opts.Level)); err != nil {
+		return nil, fmt.Errorf("invalid log level %q: %w", opts.Level, err)
 	}
 
-	logger, err := config.Build()
-	if err != nil {
-		return nil, err
+	encoderConfig := zap.NewProductionEncoderConfig()
+	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
+	var encoder zapcore.Encoder
+	switch opts.Encoding {
+	case EncodingJSON, "":
+		encoder = zapcore.NewJSONEncoder(encoderConfig)
+	case EncodingConsole:
+		encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+		encoder = zapcore.NewConsoleEncoder(encoderConfig)
+	default:
+		return nil, fmt.Errorf("unknown log encoding: %q", opts.Encoding)
+	}
+
+	outputs := opts.Outputs
+	if len(outputs) == 0 {
+		outputs = []string{OutputStdout}
+	}
+	syncers := make([]zapcore.WriteSyncer, 0, len(outputs))
+	for _, output := range outputs {
+		syncer, err := openOutput(output, opts.Rotation)
+		if err != nil {
+			return nil, err
+		}
+		syncers = append(syncers, syncer)
+	}
+
+	core := zapcore.NewCore(encoder, zapcore.NewMultiWriteSyncer(syncers...), level)
+	if opts.Sampling.Initial > 0 {
+		core = zapcore.NewSamplerWithOptions(core, time.Second, opts.Sampling.Initial, opts.Sampling.Thereafter)
 	}
-	defer logger.Sync()
 
 	return &Logger{
-		Log: logger,
+		Log:   zap.New(core, zap.ErrorOutput(zapcore.Lock(os.Stderr))),
+		Level: level,
 	}, nil
 }
+
+func openOutput(output string, rotation Rotation) (zapcore.WriteSyncer, error) {
+	switch output {
+	case OutputStdout:
+		return zapcore.Lock(os.Stdout), nil
+	case OutputStderr:
+		return zapcore.Lock(os.Stderr), nil
+	}
+
+	var writer io.Writer
+	if rotation.MaxSizeMB > 0 {
+		writer = &lumberjack.Logger{
+			Filename:   output,
+			MaxSize:    rotation.MaxSizeMB,
+			MaxBackups: rotation.MaxBackups,
+			MaxAge:     rotation.MaxAgeDays,
+			Compress:   rotation.Compress,
+		}
+	} else {
+		file, err := os.OpenFile(output, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, fmt.Errorf("cannot open log output: %w", err)
+		}
+		writer = file
+	}
+	return zapcore.Lock(zapcore.AddSync(writer)), nil
+}
+
+// SetLevel changes the level of the logger and all loggers derived from it.
+func (l *Logger) SetLevel(level string) error {
+	return l.Level.UnmarshalText([]byte(level))
+}
+
+type contextKey struct{}
+
+// WithFields returns a context whose request-scoped logger carries fields in
+// addition to the ones already attached to ctx.
+func (l *Logger) WithFields(ctx context.Context, fields ...zap.Field) context.Context {
+	return context.WithValue(ctx, contextKey{}, l.Ctx(ctx).With(fields...))
+}
+
+// Ctx returns the request-scoped logger of ctx, or the base logger when
+// there is none.
+func (l *Logger) Ctx(ctx context.Context) *zap.Logger {
+	if log, ok := ctx.Value(contextKey{}).(*zap.Logger); ok {
+		return log
+	}
+	return l.Log
+}
@@ -1,9 +1,14 @@
 package logger
 
 import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 
 	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
 )
 
 func TestNewLogger(t *testing.T) {
@@ -51,3 +56,112 @@ func TestLoggerConfiguration(t *testing.T) {
 
 	logger.Log.Debug("debug message should not be logged")
 }
+
+func TestLoggerSetLevel(t *testing.T) {
+	logger, err := NewLogger()
+	if err != nil {
+		t.Fatalf("Failed to create logger: %v", err)
+	}
+
+	if logger.Log.Core().Enabled(zap.DebugLevel) {
+		t.Fatal("debug level is enabled by default")
+	}
+
+	if err := logger.SetLevel("debug"); err != nil {
+		t.Fatalf("SetLevel() failed with error: %v", err)
+	}
+	if !logger.Log.Core().Enabled(zap.DebugLevel) {
+		t.Fatal("debug level is not enabled after SetLevel")
+	}
+
+	if err := logger.SetLevel("verbose"); err == nil {
+		t.Fatal("SetLevel() accepted an unknown level")
+	}
+}
+
+func TestNew(t *testing.T) {
+	dir := t.TempDir()
+
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{name: "defaults", opts: DefaultOptions()},
+		{name: "console", opts: Options{Level: "warn", Encoding: EncodingConsole, Outputs: []string{OutputStderr}}},
+		{name: "file", opts: Options{Level: "info", Outputs: []string{filepath.Join(dir, "plain.log")}}},
+		{name: "rotated file", opts: Options{Level: "info", Outputs: []string{filepath.Join(dir, "rotated.log")}, Rotation: Rotation{MaxSizeMB: 1, MaxBackups: 2}}},
+		{name: "sampling", opts: Options{Level: "info", Sampling: Sampling{Initial: 1, Thereafter: 100}}},
+		{name: "unknown level", opts: Options{Level: "verbose"}, wantErr: true},
+		{name: "unknown encoding", opts: Options{Level: "info", Encoding: "xml"}, wantErr: true},
+		{name: "unwritable file", opts: Options{Level: "info", Outputs: []string{filepath.Join(dir, "missing", "app.log")}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger, err := New(tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("New() succeeded, want error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New() failed with error: %v", err)
+			}
+			logger.Log.Info("test message")
+		})
+	}
+
+	for _, name := range []string{"plain.log", "rotated.log"} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatalf("cannot read %v: %v", name, err)
+		}
+		if !strings.Contains(string(data), "test message") {
+			t.Fatalf("%v does not contain the logged message: %q", name, data)
+		}
+	}
+}
+
+func TestNew_Sampling(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "sampled.log")
+	logger, err := New(Options{Level: "info", Outputs: []string{path}, Sampling: Sampling{Initial: 2, Thereafter: 1000}})
+	if err != nil {
+		t.Fatalf("New() failed with error: %v", err)
+	}
+
+	for i := 0; i < 10; i++ {
+		logger.Log.Info("repeated message")
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("cannot read log: %v", err)
+	}
+	if got := strings.Count(string(data), "repeated message"); got != 2 {
+		t.Fatalf("logged %d repeated messages, want 2", got)
+	}
+}
+
+func TestLoggerContext(t *testing.T) {
+	core, logs := observer.New(zap.InfoLevel)
+	logger := &Logger{Log: zap.New(core)}
+
+	ctx := context.Background()
+	if logger.Ctx(ctx) != logger.Log {
+		t.Fatal("Ctx() without request-scoped logger does not return the base logger")
+	}
+
+	ctx = logger.WithFields(ctx, zap.String("request_id", "req-1"))
+	ctx = logger.WithFields(ctx, zap.String("user_id", "42"))
+	logger.Ctx(ctx).Info("handled")
+
+	entries := logs.All()
+	if len(entries) != 1 {
+		t.Fatalf("got %d entries, want 1", len(entries))
+	}
+	fields := entries[0].ContextMap()
+	if fields["request_id"] != "req-1" || fields["user_id"] != "42" {
+		t.Fatalf("unexpected fields: %v", fields)
+	}
+}
@@ -0,0 +1,41 @@
+package validator
+
+// dammTable is the totally anti-symmetric quasigroup of order 10 of the
+// Damm algorithm.
+var dammTable = [10][10]byte{
+	{0, 3, 1, 7, 5, 9, 8, 6, 4, 2},
+	{7, 0, 9, 2, 1, 5, 4, 8, 6, 3},
+	{4, 2, 0, 6, 8, 7, 1, 3, 5, 9},
+	{1, 7, 5, 0, 9, 8, 3, 4, 2, 6},
+	{6, 1, 2, 3, 0, 4, 5, 9, 7, 8},
+	{3, 6, 7, 4, 2, 0, 9, 5, 8, 1},
+	{5, 8, 6, 9, 7, 2, 0, 1, 3, 4},
+	{8, 9, 4, 5, 3, 6, 2, 0, 1, 7},
+	{9, 4, 3, 8, 6, 1, 7, 2, 0, 5},
+	{2, 5, 8, 1, 4, 3, 6, 7, 9, 0},
+}
+
+// DammAlgorithm reports whether orderNumber is a non-empty string of digits
+// whose last one is its Damm check digit.
+func DammAlgorithm(orderNumber string) bool {
+	if orderNumber == "" {
+		return false
+	}
+
+	var interim byte
+	for i := 0; i < len(orderNumber); i++ {
+		r := orderNumber[i]
+		if r < '0' || r > '9' {
+			return false
+		}
+		interim = dammTable[interim][r-'0']
+	}
+	return interim == 0
+}
+
+// Damm accepts the order numbers with a valid Damm check digit, which
+// catches every single digit error and every transposition of adjacent
+// digits.
+func Damm() Validator {
+	return checkDigit(DammAlgorithm)
+}
@@ -0,0 +1,62 @@
+package validator
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var checkDigitSchemes = map[string]func(string) bool{
+	"luhn":     LuhnAlgorith,
+	"damm":     DammAlgorithm,
+	"verhoeff": VerhoeffAlgorithm,
+}
+
+// FuzzCheckDigits checks that every scheme accepts exactly one check digit
+// for any payload and rejects anything but digits.
+func FuzzCheckDigits(f *testing.F) {
+	for _, seed := range []string{"", "0", "7992739871", "572", "236", "12a", " 1", strings.Repeat("9", 63)} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, payload string) {
+		isDigits := digits(payload) == nil || payload == ""
+		for name, valid := range checkDigitSchemes {
+			accepted := 0
+			for d := 0; d <= 9; d++ {
+				if valid(payload + strconv.Itoa(d)) {
+					accepted++
+				}
+			}
+			if isDigits && accepted != 1 {
+				t.Errorf("%s accepts %d check digits for %q, want 1", name, accepted, payload)
+			}
+			if !isDigits && accepted != 0 {
+				t.Errorf("%s accepts %q with a non-digit", name, payload)
+			}
+			if valid("") {
+				t.Errorf("%s accepts the empty string", name)
+			}
+		}
+	})
+}
+
+// FuzzRules checks the default rules against their definition.
+func FuzzRules(f *testing.F) {
+	for _, seed := range []string{"", "79927398713", "79927398710", "0000", "x", strings.Repeat("0", 65)} {
+		f.Add(seed)
+	}
+
+	v := Default()
+	f.Fuzz(func(t *testing.T, orderNumber string) {
+		err := v.Validate(orderNumber)
+		want := len(orderNumber) >= 1 && len(orderNumber) <= MaxLength && LuhnAlgorith(orderNumber)
+		if (err == nil) != want {
+			t.Fatalf("Validate(%q) = %v, want valid %v", orderNumber, err, want)
+		}
+		if err != nil && !errors.Is(err, ErrLength) && !errors.Is(err, ErrNotDigits) && !errors.Is(err, ErrChecksum) {
+			t.Fatalf("Validate(%q) = %v, want one of the package errors", orderNumber, err)
+		}
+	})
+}
@@ -1,6 +1,12 @@
 package validator
 
+// LuhnAlgorith reports whether orderNumber is a non-empty string of digits
+// whose last one is its Luhn check digit.
 func LuhnAlgorith(orderNumber string) bool {
+	if orderNumber == "" {
+		return false
+	}
+
 	var sum int
 	double := false
 
@@ -26,3 +32,22 @@ func LuhnAlgorith(orderNumber string) bool {
 
 	return sum%10 == 0
 }
+
+// Luhn accepts the order numbers with a valid Luhn check digit, the scheme
+// of payment card numbers.
+func Luhn() Validator {
+	return checkDigit(LuhnAlgorith)
+}
+
+// checkDigit adapts a check digit scheme to a Validator.
+func checkDigit(valid func(orderNumber string) bool) Validator {
+	return Func(func(orderNumber string) error {
+		if err := digits(orderNumber); err != nil {
+			return err
+		}
+		if !valid(orderNumber) {
+			return ErrChecksum
+		}
+		return nil
+	})
+}
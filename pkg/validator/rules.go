@@ -0,0 +1,80 @@
+package validator
+
+import (
+	"errors"
+	"fmt"
+)
+
+// MaxLength is the longest order number that can be stored.
+const MaxLength = 64
+
+// The check digit schemes of Rules.
+const (
+	ChecksumLuhn     = "luhn"
+	ChecksumDamm     = "damm"
+	ChecksumVerhoeff = "verhoeff"
+	ChecksumNone     = "none"
+)
+
+// Rules describe the order numbers a merchant issues: digits with the check
+// digit of Checksum, Luhn unless set, MinLength to MaxLength long, 1 and
+// MaxLength unless set, and starting with one of Prefixes if any are given.
+type Rules struct {
+	Checksum  string   `yaml:"checksum" toml:"checksum"`
+	MinLength int      `yaml:"min_length" toml:"min_length"`
+	MaxLength int      `yaml:"max_length" toml:"max_length"`
+	Prefixes  []string `yaml:"prefixes" toml:"prefixes"`
+}
+
+// Default is the validator of the default Rules.
+func Default() Validator {
+	v, _ := Rules{}.Validator()
+	return v
+}
+
+// Validator returns the validator of the rules or what is wrong with them.
+func (r Rules) Validator() (Validator, error) {
+	var errs []error
+
+	var checksum Validator
+	switch r.Checksum {
+	case "", ChecksumLuhn:
+		checksum = Luhn()
+	case ChecksumDamm:
+		checksum = Damm()
+	case ChecksumVerhoeff:
+		checksum = Verhoeff()
+	case ChecksumNone:
+		checksum = Digits()
+	default:
+		errs = append(errs, fmt.Errorf("unknown checksum %q, want %s, %s, %s or %s", r.Checksum, ChecksumLuhn, ChecksumDamm, ChecksumVerhoeff, ChecksumNone))
+	}
+
+	minLength, maxLength := r.MinLength, r.MaxLength
+	if minLength == 0 {
+		minLength = 1
+	}
+	if maxLength == 0 {
+		maxLength = MaxLength
+	}
+	if minLength < 1 || maxLength > MaxLength || minLength > maxLength {
+		errs = append(errs, fmt.Errorf("min_length and max_length must be within 1 and %d, min_length first", MaxLength))
+	}
+
+	for i, prefix := range r.Prefixes {
+		if digits(prefix) != nil {
+			errs = append(errs, fmt.Errorf("prefixes[%d]: must be digits, got %q", i, prefix))
+		}
+	}
+
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+
+	// The length is checked first so that overlong input is not scanned.
+	validators := []Validator{Length(minLength, maxLength), checksum}
+	if len(r.Prefixes) > 0 {
+		validators = append(validators, Prefixes(r.Prefixes...))
+	}
+	return All(validators...), nil
+}
@@ -0,0 +1,59 @@
+package validator
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRules_Default(t *testing.T) {
+	v := Default()
+
+	assert.NoError(t, v.Validate("79927398713"))
+	assert.ErrorIs(t, v.Validate(""), ErrLength, "empty order numbers are rejected")
+	assert.ErrorIs(t, v.Validate("79927398710"), ErrChecksum)
+
+	// 65 zeros pass the Luhn check but do not fit the orders table.
+	assert.NoError(t, v.Validate(strings.Repeat("0", MaxLength)))
+	assert.ErrorIs(t, v.Validate(strings.Repeat("0", MaxLength+1)), ErrLength)
+}
+
+func TestRules_Validator(t *testing.T) {
+	v, err := Rules{Checksum: ChecksumDamm, MinLength: 4, MaxLength: 8, Prefixes: []string{"57", "9"}}.Validator()
+	require.NoError(t, err)
+
+	assert.NoError(t, v.Validate("5724"))
+	assert.ErrorIs(t, v.Validate("79927398713"), ErrLength)
+	assert.ErrorIs(t, v.Validate("5723"), ErrChecksum)
+	assert.ErrorIs(t, v.Validate("1234"), ErrPrefix)
+
+	v, err = Rules{Checksum: ChecksumNone}.Validator()
+	require.NoError(t, err)
+	assert.NoError(t, v.Validate("79927398710"))
+	assert.ErrorIs(t, v.Validate("7992739871x"), ErrNotDigits)
+
+	v, err = Rules{Checksum: ChecksumVerhoeff}.Validator()
+	require.NoError(t, err)
+	assert.NoError(t, v.Validate("2363"))
+}
+
+func TestRules_Invalid(t *testing.T) {
+	for _, test := range []struct {
+		name  string
+		rules Rules
+		err   string
+	}{
+		{name: "checksum", rules: Rules{Checksum: "crc32"}, err: `unknown checksum "crc32"`},
+		{name: "max length", rules: Rules{MaxLength: MaxLength + 1}, err: "min_length and max_length must be within 1 and 64"},
+		{name: "negative min length", rules: Rules{MinLength: -1}, err: "min_length and max_length must be within 1 and 64"},
+		{name: "bounds order", rules: Rules{MinLength: 10, MaxLength: 5}, err: "min_length and max_length must be within 1 and 64"},
+		{name: "prefix", rules: Rules{Prefixes: []string{"4", "A1"}}, err: `prefixes[1]: must be digits, got "A1"`},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			_, err := test.rules.Validator()
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
@@ -0,0 +1,103 @@
+// Package validator checks order numbers. A Validator is one rule, such as
+// a check digit scheme, a length bound or the prefixes a merchant issues;
+// All and Any compose them and Rules builds the validator of a merchant
+// from its configuration.
+package validator
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrEmpty     = errors.New("order number is empty")
+	ErrNotDigits = errors.New("order number must only contain digits")
+	ErrLength    = errors.New("order number length is out of bounds")
+	ErrPrefix    = errors.New("order number prefix is not allowed")
+	ErrChecksum  = errors.New("order number check digit is wrong")
+)
+
+// Validator checks an order number, returning why it is rejected.
+type Validator interface {
+	Validate(orderNumber string) error
+}
+
+// Func adapts a function to a Validator.
+type Func func(orderNumber string) error
+
+func (f Func) Validate(orderNumber string) error {
+	return f(orderNumber)
+}
+
+// All accepts the order numbers every one of validators accepts, failing
+// with the error of the first one rejecting it.
+func All(validators ...Validator) Validator {
+	return Func(func(orderNumber string) error {
+		for _, v := range validators {
+			if err := v.Validate(orderNumber); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Any accepts the order numbers at least one of validators accepts,
+// failing with the errors of all of them otherwise. Any without validators
+// accepts nothing.
+func Any(validators ...Validator) Validator {
+	return Func(func(orderNumber string) error {
+		if len(validators) == 0 {
+			return errors.New("no validator accepts the order number")
+		}
+		var errs []error
+		for _, v := range validators {
+			err := v.Validate(orderNumber)
+			if err == nil {
+				return nil
+			}
+			errs = append(errs, err)
+		}
+		return errors.Join(errs...)
+	})
+}
+
+// Digits accepts non-empty order numbers made of ASCII digits only.
+func Digits() Validator {
+	return Func(digits)
+}
+
+func digits(orderNumber string) error {
+	if orderNumber == "" {
+		return ErrEmpty
+	}
+	for i := 0; i < len(orderNumber); i++ {
+		if orderNumber[i] < '0' || orderNumber[i] > '9' {
+			return ErrNotDigits
+		}
+	}
+	return nil
+}
+
+// Length accepts order numbers of min to max bytes.
+func Length(min, max int) Validator {
+	return Func(func(orderNumber string) error {
+		if len(orderNumber) < min || len(orderNumber) > max {
+			return fmt.Errorf("%w: %d characters, want %d to %d", ErrLength, len(orderNumber), min, max)
+		}
+		return nil
+	})
+}
+
+// Prefixes accepts the order numbers starting with one of prefixes.
+func Prefixes(prefixes ...string) Validator {
+	return Func(func(orderNumber string) error {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(orderNumber, prefix) {
+				return nil
+			}
+		}
+		return ErrPrefix
+	})
+}
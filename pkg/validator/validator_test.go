@@ -0,0 +1,94 @@
+package validator
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDigits(t *testing.T) {
+	assert.NoError(t, Digits().Validate("0123456789"))
+	assert.ErrorIs(t, Digits().Validate(""), ErrEmpty)
+	assert.ErrorIs(t, Digits().Validate("12a4"), ErrNotDigits)
+	assert.ErrorIs(t, Digits().Validate("١٢٣"), ErrNotDigits, "only ASCII digits are accepted")
+}
+
+func TestLength(t *testing.T) {
+	v := Length(2, 4)
+	assert.NoError(t, v.Validate("12"))
+	assert.NoError(t, v.Validate("1234"))
+	assert.ErrorIs(t, v.Validate("1"), ErrLength)
+	assert.ErrorIs(t, v.Validate("12345"), ErrLength)
+	assert.EqualError(t, v.Validate("12345"), "order number length is out of bounds: 5 characters, want 2 to 4")
+}
+
+func TestPrefixes(t *testing.T) {
+	v := Prefixes("4", "51")
+	assert.NoError(t, v.Validate("4111111111111111"))
+	assert.NoError(t, v.Validate("5105105105105100"))
+	assert.ErrorIs(t, v.Validate("5555555555554444"), ErrPrefix)
+	assert.ErrorIs(t, Prefixes().Validate("4111111111111111"), ErrPrefix)
+}
+
+func TestCheckDigits(t *testing.T) {
+	for _, test := range []struct {
+		name      string
+		validator Validator
+		valid     []string
+		invalid   []string
+	}{
+		{name: "luhn", validator: Luhn(), valid: []string{"79927398713", "4111111111111111", "0"}, invalid: []string{"79927398710", "79927398731"}},
+		{name: "damm", validator: Damm(), valid: []string{"5724", "0"}, invalid: []string{"5723", "7524"}},
+		{name: "verhoeff", validator: Verhoeff(), valid: []string{"2363", "0", "123451"}, invalid: []string{"2364", "3263"}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			for _, number := range test.valid {
+				assert.NoError(t, test.validator.Validate(number), number)
+			}
+			for _, number := range test.invalid {
+				assert.ErrorIs(t, test.validator.Validate(number), ErrChecksum, number)
+			}
+			assert.ErrorIs(t, test.validator.Validate(""), ErrEmpty)
+			assert.ErrorIs(t, test.validator.Validate("57a4"), ErrNotDigits)
+		})
+	}
+}
+
+func TestAll(t *testing.T) {
+	v := All(Length(1, 11), Luhn(), Prefixes("7"))
+
+	assert.NoError(t, v.Validate("79927398713"))
+	assert.ErrorIs(t, v.Validate("4111111111111111"), ErrLength, "the first failing validator decides the error")
+	assert.ErrorIs(t, v.Validate("79927398710"), ErrChecksum)
+	assert.ErrorIs(t, v.Validate("12345678903"), ErrPrefix)
+	assert.NoError(t, All().Validate("anything"))
+}
+
+func TestAny(t *testing.T) {
+	v := Any(Luhn(), Damm())
+
+	assert.NoError(t, v.Validate("79927398713"))
+	assert.NoError(t, v.Validate("5724"))
+	err := v.Validate("5723")
+	assert.ErrorIs(t, err, ErrChecksum)
+	assert.Error(t, Any().Validate("79927398713"))
+
+	// Partners with either scheme, each with numbers of their own prefix.
+	partners := Any(All(Prefixes("1"), Luhn()), All(Prefixes("5"), Damm()))
+	assert.NoError(t, partners.Validate("5724"))
+	assert.NoError(t, partners.Validate("18"))
+	assert.Error(t, partners.Validate("79927398713"))
+}
+
+func TestFunc(t *testing.T) {
+	errOdd := errors.New("odd")
+	even := Func(func(orderNumber string) error {
+		if (orderNumber[len(orderNumber)-1]-'0')%2 != 0 {
+			return errOdd
+		}
+		return nil
+	})
+	assert.NoError(t, All(Digits(), even).Validate("1234"))
+	assert.ErrorIs(t, All(Digits(), even).Validate("1235"), errOdd)
+}
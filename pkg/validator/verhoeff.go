@@ -0,0 +1,54 @@
+package validator
+
+// verhoeffMultiplication is the multiplication table of the dihedral group
+// D5 and verhoeffPermutation the permutations applied to the digits by
+// their position from the right.
+var (
+	verhoeffMultiplication = [10][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 2, 3, 4, 0, 6, 7, 8, 9, 5},
+		{2, 3, 4, 0, 1, 7, 8, 9, 5, 6},
+		{3, 4, 0, 1, 2, 8, 9, 5, 6, 7},
+		{4, 0, 1, 2, 3, 9, 5, 6, 7, 8},
+		{5, 9, 8, 7, 6, 0, 4, 3, 2, 1},
+		{6, 5, 9, 8, 7, 1, 0, 4, 3, 2},
+		{7, 6, 5, 9, 8, 2, 1, 0, 4, 3},
+		{8, 7, 6, 5, 9, 3, 2, 1, 0, 4},
+		{9, 8, 7, 6, 5, 4, 3, 2, 1, 0},
+	}
+	verhoeffPermutation = [8][10]byte{
+		{0, 1, 2, 3, 4, 5, 6, 7, 8, 9},
+		{1, 5, 7, 6, 2, 8, 3, 0, 9, 4},
+		{5, 8, 0, 3, 7, 9, 6, 1, 4, 2},
+		{8, 9, 1, 6, 0, 4, 3, 5, 2, 7},
+		{9, 4, 5, 3, 1, 2, 6, 8, 7, 0},
+		{4, 2, 8, 6, 5, 7, 3, 9, 0, 1},
+		{2, 7, 9, 3, 8, 0, 6, 4, 1, 5},
+		{7, 0, 4, 6, 9, 1, 3, 2, 5, 8},
+	}
+)
+
+// VerhoeffAlgorithm reports whether orderNumber is a non-empty string of
+// digits whose last one is its Verhoeff check digit.
+func VerhoeffAlgorithm(orderNumber string) bool {
+	if orderNumber == "" {
+		return false
+	}
+
+	var check byte
+	for i := 0; i < len(orderNumber); i++ {
+		r := orderNumber[len(orderNumber)-1-i]
+		if r < '0' || r > '9' {
+			return false
+		}
+		check = verhoeffMultiplication[check][verhoeffPermutation[i%8][r-'0']]
+	}
+	return check == 0
+}
+
+// Verhoeff accepts the order numbers with a valid Verhoeff check digit,
+// which catches every single digit error and every transposition of
+// adjacent digits.
+func Verhoeff() Validator {
+	return checkDigit(VerhoeffAlgorithm)
+}